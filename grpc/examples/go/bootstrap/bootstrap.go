@@ -0,0 +1,304 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"goexamples/features/channelz"
+	"goexamples/features/healthcheck"
+	"goexamples/features/keepalive"
+	"goexamples/features/reflection"
+	"goexamples/features/validate"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// ErrNoListener 在没有配置任何监听器时由 ListenAndServe 返回。
+var ErrNoListener = errors.New("bootstrap: no listener, use WithTCP, WithUnix or WithListener")
+
+type registration struct {
+	desc *grpc.ServiceDesc
+	impl any
+}
+
+type Option func(*Server)
+
+// WithService 注册一个服务，可以多次使用在同一个服务端上注册多个服务。
+func WithService(desc *grpc.ServiceDesc, impl any) Option {
+	return func(s *Server) {
+		s.services = append(s.services, registration{desc: desc, impl: impl})
+	}
+}
+
+// WithServerOptions 添加 grpc.ServerOption，其中的拦截器先于 WithUnaryInterceptors、WithStreamInterceptors 执行。
+func WithServerOptions(opts ...grpc.ServerOption) Option {
+	return func(s *Server) {
+		s.serverOpts = append(s.serverOpts, opts...)
+	}
+}
+
+// WithUnaryInterceptors 添加一元拦截器，按添加顺序执行。
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) Option {
+	return func(s *Server) {
+		s.unary = append(s.unary, interceptors...)
+	}
+}
+
+// WithStreamInterceptors 添加流拦截器，按添加顺序执行。
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) Option {
+	return func(s *Server) {
+		s.stream = append(s.stream, interceptors...)
+	}
+}
+
+// WithKeepalive 设置保活配置，默认为 keepalive.DefaultServer，WithServerOptions 中的同类选项可以覆盖。
+func WithKeepalive(cfg keepalive.ServerConfig) Option {
+	return func(s *Server) {
+		s.keepalive = cfg.Options()
+	}
+}
+
+// WithValidation 按 proto 中声明的校验规则检查请求，校验拦截器在其他拦截器之后执行。
+func WithValidation() Option {
+	return func(s *Server) {
+		s.validate = true
+	}
+}
+
+// WithReflection 在 dev 模式下注册反射服务，见 features/reflection.Register。
+func WithReflection(mode string) Option {
+	return func(s *Server) {
+		s.reflectionMode = mode
+	}
+}
+
+// WithChannelz 在 dev 模式下注册 channelz 服务，见 features/channelz.Register。
+func WithChannelz(mode string) Option {
+	return func(s *Server) {
+		s.channelzMode = mode
+	}
+}
+
+// WithHealth 注册 grpc_health_v1 服务，WithService 注册的服务和 services 初始状态为 SERVING，可以通过 Server.Health 修改。
+// services 用于没有通过 WithService 注册的服务，例如由 grpc.UnknownServiceHandler 处理的服务。
+func WithHealth(services ...string) Option {
+	return func(s *Server) {
+		s.withHealth = true
+		s.healthServices = append(s.healthServices, services...)
+	}
+}
+
+// WithListen 添加一个在 ListenAndServe 时创建的监听器，可以多次使用同时监听多个地址。
+func WithListen(listen func() (net.Listener, error)) Option {
+	return func(s *Server) {
+		s.listen = append(s.listen, listen)
+	}
+}
+
+// WithTCP 监听 TCP 端口，port 为 0 时由系统分配。
+func WithTCP(port int) Option {
+	return WithListen(func() (net.Listener, error) {
+		return net.Listen("tcp", fmt.Sprintf(":%d", port))
+	})
+}
+
+// WithUnix 监听 unix socket，上次运行残留的 socket 文件会先被删除。
+func WithUnix(path string) Option {
+	return WithListen(func() (net.Listener, error) {
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			if err := os.Remove(path); err != nil {
+				return nil, err
+			}
+		}
+		return net.Listen("unix", path)
+	})
+}
+
+// WithListener 使用已经创建好的监听器，比如 bufconn 或者 systemd 传入的监听器。
+func WithListener(lis net.Listener) Option {
+	return WithListen(func() (net.Listener, error) {
+		return lis, nil
+	})
+}
+
+// OnStart 在 ListenAndServe 创建监听器之前执行，返回错误时不再启动，可以用来加载数据。
+func OnStart(f func() error) Option {
+	return func(s *Server) {
+		s.onStart = append(s.onStart, f)
+	}
+}
+
+// OnListen 在每个监听器创建之后、开始处理请求之前执行，可以用来输出监听的地址。
+func OnListen(f func(net.Listener)) Option {
+	return func(s *Server) {
+		s.onListen = append(s.onListen, f)
+	}
+}
+
+// OnStop 在服务端关闭时执行一次，此时健康状态已经是 NOT_SERVING，连接还没有关闭。
+func OnStop(f func()) Option {
+	return func(s *Server) {
+		s.onStop = append(s.onStop, f)
+	}
+}
+
+// Server 在同一个 grpc.Server 上注册多个服务，统一配置拦截器、反射、channelz、健康检查和监听器，
+// 示例中的各个服务端都嵌入了它，只需要实现业务方法。
+type Server struct {
+	server *grpc.Server
+	health *healthcheck.Health
+
+	services       []registration
+	keepalive      []grpc.ServerOption
+	serverOpts     []grpc.ServerOption
+	unary          []grpc.UnaryServerInterceptor
+	stream         []grpc.StreamServerInterceptor
+	validate       bool
+	reflectionMode string
+	channelzMode   string
+	withHealth     bool
+	healthServices []string
+	listen         []func() (net.Listener, error)
+	onStart        []func() error
+	onListen       []func(net.Listener)
+	onStop         []func()
+
+	once sync.Once
+}
+
+func (s *Server) serverOptions() []grpc.ServerOption {
+	opts := slices.Concat(s.keepalive, s.serverOpts)
+	if len(s.unary) > 0 {
+		opts = append(opts, grpc.ChainUnaryInterceptor(s.unary...))
+	}
+	if len(s.stream) > 0 {
+		opts = append(opts, grpc.ChainStreamInterceptor(s.stream...))
+	}
+	if s.validate {
+		opts = append(opts, validate.ServerOptions()...)
+	}
+	return opts
+}
+
+// RawServer 返回底层的 grpc.Server。
+func (s *Server) RawServer() *grpc.Server {
+	return s.server
+}
+
+// Health 返回服务端的健康状态，没有使用 WithHealth 时为 nil。
+func (s *Server) Health() *healthcheck.Health {
+	return s.health
+}
+
+// RegisterService 实现 grpc.ServiceRegistrar，用于在启动前注册额外的服务。
+func (s *Server) RegisterService(desc *grpc.ServiceDesc, impl any) {
+	s.server.RegisterService(desc, impl)
+}
+
+// GetServiceInfo 返回注册的服务，与 RegisterService 一起满足 reflection.GRPCServer。
+func (s *Server) GetServiceInfo() map[string]grpc.ServiceInfo {
+	return s.server.GetServiceInfo()
+}
+
+// ServeHTTP 让服务端与 http 服务共用端口，需要 HTTP/2（h2c）。
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.server.ServeHTTP(w, r)
+}
+
+// Serve 在 lis 上处理请求，不执行 OnStart、OnListen，用于 harness 等自行管理监听器的场景。
+func (s *Server) Serve(lis net.Listener) error {
+	return s.server.Serve(lis)
+}
+
+// ListenAndServe 执行 OnStart，创建所有监听器并在每个监听器上处理请求，直到服务端关闭或者某个监听器出错。
+// 一个监听器出错时关闭整个服务端并返回该错误，正常关闭时返回 nil。
+func (s *Server) ListenAndServe() error {
+	if len(s.listen) == 0 {
+		return ErrNoListener
+	}
+	for _, f := range s.onStart {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	listeners := make([]net.Listener, 0, len(s.listen))
+	for _, listen := range s.listen {
+		lis, err := listen()
+		if err != nil {
+			for _, lis := range listeners {
+				lis.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, lis)
+	}
+	for _, lis := range listeners {
+		for _, f := range s.onListen {
+			f(lis)
+		}
+	}
+
+	errc := make(chan error, len(listeners))
+	for _, lis := range listeners {
+		go func() {
+			errc <- s.server.Serve(lis)
+		}()
+	}
+	for range listeners {
+		// 启动期间就被关闭的服务端返回 ErrServerStopped，与正常关闭相同
+		if err := <-errc; err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			s.Stop()
+			return err
+		}
+	}
+	return nil
+}
+
+// shutdown 将所有服务设置为 NOT_SERVING 并执行 OnStop，只执行一次。
+func (s *Server) shutdown() {
+	s.once.Do(func() {
+		if s.health != nil {
+			s.health.Shutdown()
+		}
+		for _, f := range s.onStop {
+			f()
+		}
+	})
+}
+
+// Stop 立即关闭所有连接和监听器。
+func (s *Server) Stop() {
+	s.shutdown()
+	s.server.Stop()
+}
+
+// GracefulStop 不再接受新的请求，等待正在处理的请求结束后关闭。
+func (s *Server) GracefulStop() {
+	s.shutdown()
+	s.server.GracefulStop()
+}
+
+// New 默认使用 keepalive.DefaultServer 的保活配置，按选项创建 grpc.Server 并注册所有服务。
+func New(opts ...Option) *Server {
+	s := &Server{keepalive: keepalive.DefaultServer.Options()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.server = grpc.NewServer(s.serverOptions()...)
+	names := make([]string, 0, len(s.services))
+	for _, r := range s.services {
+		s.server.RegisterService(r.desc, r.impl)
+		names = append(names, r.desc.ServiceName)
+	}
+	if s.withHealth {
+		s.health = healthcheck.NewHealth(append(names, s.healthServices...)...)
+		s.health.Register(s.server)
+	}
+	reflection.Register(s.server, s.reflectionMode)
+	channelz.Register(s.server, s.channelzMode)
+	return s
+}
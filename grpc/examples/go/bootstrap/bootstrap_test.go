@@ -0,0 +1,212 @@
+package bootstrap_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goexamples/bootstrap"
+	"goexamples/features/proto/message"
+	"goexamples/harness"
+	helloworld "goexamples/helloworld/proto"
+	"net"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type greeter struct {
+	helloworld.UnimplementedGreeterServer
+}
+
+func (greeter) SayHello(_ context.Context, in *helloworld.HelloRequest) (*helloworld.HelloReply, error) {
+	return &helloworld.HelloReply{Message: "Hello " + in.GetName()}, nil
+}
+
+type echo struct {
+	message.UnimplementedMessageServiceServer
+}
+
+func (echo) Unary(_ context.Context, in *message.Message) (*message.Message, error) {
+	return in, nil
+}
+
+func services() []bootstrap.Option {
+	return []bootstrap.Option{
+		bootstrap.WithService(&helloworld.Greeter_ServiceDesc, greeter{}),
+		bootstrap.WithService(&message.MessageService_ServiceDesc, echo{}),
+	}
+}
+
+// 多个服务注册在同一个服务端上，健康检查覆盖所有服务，反射和 channelz 只在 dev 模式下注册
+func TestServices(t *testing.T) {
+	for mode, want := range map[string]bool{"dev": true, "prod": false} {
+		s := bootstrap.New(append(services(),
+			bootstrap.WithHealth("extra.Service"),
+			bootstrap.WithReflection(mode),
+			bootstrap.WithChannelz(mode),
+		)...)
+		info := s.GetServiceInfo()
+		for _, name := range []string{"Greeter", "message.MessageService", "grpc.health.v1.Health"} {
+			if _, ok := info[name]; !ok {
+				t.Errorf("mode %s: %s not registered", mode, name)
+			}
+		}
+		for _, name := range []string{"grpc.reflection.v1.ServerReflection", "grpc.channelz.v1.Channelz"} {
+			if _, ok := info[name]; ok != want {
+				t.Errorf("mode %s: %s registered = %v, want %v", mode, name, ok, want)
+			}
+		}
+		statuses := s.Health().Statuses()
+		for _, name := range []string{"Greeter", "message.MessageService", "extra.Service"} {
+			if statuses[name] != "SERVING" {
+				t.Errorf("mode %s: %s = %q, want SERVING", mode, name, statuses[name])
+			}
+		}
+	}
+
+	if s := bootstrap.New(services()...); s.Health() != nil {
+		t.Error("health registered without WithHealth")
+	}
+}
+
+// WithServerOptions 中的拦截器先执行，校验拦截器最后执行
+func TestInterceptors(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	record := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			mu.Lock()
+			calls = append(calls, name)
+			mu.Unlock()
+			return handler(ctx, req)
+		}
+	}
+	h := harness.New(t, harness.WithUnaryInterceptors(record("harness")))
+	client := harness.Client(h, func(opts ...grpc.ServerOption) harness.Server {
+		return bootstrap.New(append(services(),
+			bootstrap.WithUnaryInterceptors(record("first"), record("second")),
+			bootstrap.WithServerOptions(opts...),
+			bootstrap.WithValidation(),
+		)...)
+	}, message.NewMessageServiceClient)
+
+	_, err := client.Unary(context.Background(), &message.Message{Content: strings.Repeat("x", 4097)})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("err = %v, want InvalidArgument", err)
+	}
+	if want := []string{"harness", "first", "second"}; !slices.Equal(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
+
+// dial 通过健康检查确认服务端可以在 target 上访问。
+func dial(t *testing.T, target string, opts ...grpc.DialOption) {
+	t.Helper()
+	conn, err := grpc.NewClient(target, append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: "Greeter"})
+	if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("%s: status = %v, err = %v", target, resp.GetStatus(), err)
+	}
+}
+
+// 同一个服务端同时在 TCP 端口、unix socket 和传入的监听器上处理请求，关闭时先将健康状态设置为 NOT_SERVING 再执行 OnStop
+func TestListeners(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "grpc.sock")
+	// 模拟上次运行残留的 socket 文件
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	buf := bufconn.Listen(1 << 20)
+	var addrs []net.Addr
+	ready := make(chan struct{})
+	var s *bootstrap.Server
+	var stops int
+	var serving bool
+	s = bootstrap.New(append(services(),
+		bootstrap.WithHealth(),
+		bootstrap.WithTCP(0),
+		bootstrap.WithUnix(sock),
+		bootstrap.WithListener(buf),
+		bootstrap.OnListen(func(lis net.Listener) {
+			if addrs = append(addrs, lis.Addr()); len(addrs) == 3 {
+				close(ready)
+			}
+		}),
+		bootstrap.OnStop(func() {
+			stops++
+			serving = s.Health().Serving("Greeter")
+		}),
+	)...)
+	done := make(chan error, 1)
+	go func() { done <- s.ListenAndServe() }()
+	<-ready
+
+	dial(t, fmt.Sprintf("localhost:%d", addrs[0].(*net.TCPAddr).Port))
+	dial(t, "unix://"+sock)
+	dial(t, "passthrough:///bufnet", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return buf.DialContext(ctx)
+	}))
+
+	s.Stop()
+	s.GracefulStop()
+	if err := <-done; err != nil {
+		t.Fatalf("ListenAndServe() = %v, want nil after Stop", err)
+	}
+	if stops != 1 || serving {
+		t.Fatalf("OnStop called %d times, serving = %v, want once and NOT_SERVING", stops, serving)
+	}
+}
+
+func TestStartErrors(t *testing.T) {
+	if err := bootstrap.New(services()...).ListenAndServe(); !errors.Is(err, bootstrap.ErrNoListener) {
+		t.Fatalf("err = %v, want ErrNoListener", err)
+	}
+
+	// OnStart 出错时不创建监听器
+	errLoad := errors.New("load failed")
+	listened := false
+	s := bootstrap.New(
+		bootstrap.WithListen(func() (net.Listener, error) {
+			listened = true
+			return bufconn.Listen(1), nil
+		}),
+		bootstrap.OnStart(func() error { return errLoad }),
+	)
+	if err := s.ListenAndServe(); err != errLoad || listened {
+		t.Fatalf("err = %v, listened = %v, want the OnStart error", err, listened)
+	}
+
+	// 后面的监听器创建失败时关闭已经创建的监听器
+	first := bufconn.Listen(1)
+	errListen := errors.New("address in use")
+	s = bootstrap.New(
+		bootstrap.WithListener(first),
+		bootstrap.WithListen(func() (net.Listener, error) { return nil, errListen }),
+	)
+	if err := s.ListenAndServe(); err != errListen {
+		t.Fatalf("err = %v, want the listen error", err)
+	}
+	if _, err := first.Accept(); err == nil {
+		t.Fatal("first listener not closed")
+	}
+}
@@ -0,0 +1,497 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEnvPrefix 是环境变量的默认前缀，字段 rpc-port 对应的环境变量为 GOEXAMPLES_RPC_PORT。
+const DefaultEnvPrefix = "GOEXAMPLES"
+
+// 所有命令都有的参数：-config 指定配置文件，-print_config 打印最终生效的配置后退出。
+const (
+	ConfigFlag = "config"
+	PrintFlag  = "print_config"
+)
+
+// Source 是配置项最终生效的值的来源，后面的来源覆盖前面的来源。
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Validator 由配置结构体实现，所有来源都应用之后调用。
+type Validator interface {
+	Validate() error
+}
+
+type Option func(*loader)
+
+// WithEnvPrefix 设置环境变量的前缀，默认为 DefaultEnvPrefix，为空时不加前缀。
+func WithEnvPrefix(prefix string) Option {
+	return func(l *loader) {
+		l.envPrefix = prefix
+	}
+}
+
+// field 是配置结构体中带有 config 标签的字段。
+type field struct {
+	name   string
+	usage  string
+	path   bool // 值为文件路径，来自配置文件的相对路径按配置文件所在的目录解析
+	value  reflect.Value
+	source Source
+}
+
+func (f *field) isBool() bool {
+	return f.value.Kind() == reflect.Bool
+}
+
+// set 将字符串形式的值写入字段，appending 为 true 时 []string 字段追加而不是替换。
+func (f *field) set(s string, appending bool) error {
+	if v, ok := f.value.Addr().Interface().(flag.Value); ok {
+		return v.Set(s)
+	}
+	switch v := f.value.Addr().Interface().(type) {
+	case *time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*v = d
+		return nil
+	case *[]string:
+		if appending {
+			*v = append(*v, s)
+		} else {
+			*v = []string{s}
+		}
+		return nil
+	}
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, f.value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, f.value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, f.value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.value.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %v", f.value.Type())
+	}
+	return nil
+}
+
+// setAll 写入一个来源中的所有值，零个或多个值只适用于 []string 和实现了 flag.Value 的字段。
+func (f *field) setAll(values []string, source Source) error {
+	_, isValue := f.value.Addr().Interface().(flag.Value)
+	list, isList := f.value.Addr().Interface().(*[]string)
+	if len(values) != 1 && !isValue && !isList {
+		return fmt.Errorf("%s: expects a single value, got %d", f.name, len(values))
+	}
+	if isList && !isValue && len(values) == 0 {
+		*list = nil
+	}
+	for i, s := range values {
+		if err := f.set(s, i > 0); err != nil {
+			return fmt.Errorf("%s: invalid value %q from %s: %w", f.name, s, source, err)
+		}
+	}
+	f.source = source
+	return nil
+}
+
+func (f *field) String() string {
+	if v, ok := f.value.Addr().Interface().(flag.Value); ok {
+		return v.String()
+	}
+	switch v := f.value.Interface().(type) {
+	case time.Duration:
+		return v.String()
+	case []string:
+		return strings.Join(v, ",")
+	}
+	return fmt.Sprint(f.value.Interface())
+}
+
+// flagValue 先记录命令行参数的原始值，在配置文件和环境变量之后再写入字段。
+type flagValue struct {
+	field  *field
+	values []string
+}
+
+func (v *flagValue) String() string {
+	if v == nil || v.field == nil {
+		return ""
+	}
+	return v.field.String()
+}
+
+func (v *flagValue) Set(s string) error {
+	v.values = append(v.values, s)
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.field != nil && v.field.isBool()
+}
+
+type loader struct {
+	envPrefix string
+	fields    []*field
+}
+
+func (l *loader) lookup(name string) *field {
+	for _, f := range l.fields {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// env 返回配置项对应的环境变量名称。
+func (l *loader) env(name string) string {
+	name = strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+	if l.envPrefix == "" {
+		return name
+	}
+	return l.envPrefix + "_" + name
+}
+
+// collect 收集结构体中带有 config 标签的字段，嵌入的结构体展开到同一层。
+func (l *loader) collect(v reflect.Value) error {
+	t := v.Type()
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("config")
+		if !ok {
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				if err := l.collect(v.Field(i)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		name, opt, _ := strings.Cut(tag, ",")
+		if name == "" || name == ConfigFlag || name == PrintFlag || l.lookup(name) != nil {
+			return fmt.Errorf("config: invalid or duplicate name %q of field %s", name, sf.Name)
+		}
+		if !sf.IsExported() {
+			return fmt.Errorf("config: field %s is not exported", sf.Name)
+		}
+		l.fields = append(l.fields, &field{
+			name:   name,
+			usage:  sf.Tag.Get("usage"),
+			path:   opt == "path",
+			value:  v.Field(i),
+			source: SourceDefault,
+		})
+	}
+	return nil
+}
+
+// decode 按扩展名解析 JSON 或 YAML 配置文件，返回顶层的键值。
+func decode(file string) (map[string]any, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]any{}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		err = d.Decode(&values)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &values)
+	default:
+		return nil, fmt.Errorf("config: unsupported config file %s, use .json, .yaml or .yml", file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: failed to parse %s: %w", file, err)
+	}
+	return values, nil
+}
+
+// scalars 将配置文件中的值转换为字符串，列表中的每一项为一个值。
+func scalars(v any) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := scalars(item)
+			if err != nil || len(s) != 1 {
+				return nil, fmt.Errorf("nested value %v", item)
+			}
+			out = append(out, s[0])
+		}
+		return out, nil
+	case map[string]any:
+		return nil, fmt.Errorf("nested value %v", v)
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
+
+func (l *loader) applyFile(file string) error {
+	values, err := decode(file)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(file)
+	for name, v := range values {
+		f := l.lookup(name)
+		if f == nil {
+			return fmt.Errorf("config: unknown key %q in %s", name, file)
+		}
+		s, err := scalars(v)
+		if err != nil {
+			return fmt.Errorf("config: %s in %s: %w", name, file, err)
+		}
+		if f.path {
+			for i, p := range s {
+				if p != "" && !filepath.IsAbs(p) {
+					s[i] = filepath.Join(dir, p)
+				}
+			}
+		}
+		if err := f.setAll(s, SourceFile); err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+	}
+	return nil
+}
+
+func (l *loader) applyEnv() error {
+	for _, f := range l.fields {
+		s, ok := os.LookupEnv(l.env(f.name))
+		if !ok {
+			continue
+		}
+		values := []string{s}
+		// 环境变量中的多个值用逗号分隔
+		if f.value.Kind() == reflect.Slice {
+			values = strings.Split(s, ",")
+		}
+		if err := f.setAll(values, SourceEnv); err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+	}
+	return nil
+}
+
+// Entry 是一个配置项最终生效的值。
+type Entry struct {
+	Name   string
+	Value  string
+	Source Source
+}
+
+// Config 是加载的结果：使用的配置文件、最终生效的配置和命令行中剩余的参数，PrintOnly 表示使用了 -print_config。
+type Config struct {
+	File      string
+	Args      []string
+	Entries   []Entry
+	PrintOnly bool
+}
+
+// Print 按字段的声明顺序打印最终生效的配置和来源。
+func (c *Config) Print(w io.Writer) {
+	if c.File != "" {
+		fmt.Fprintf(w, "# config file: %s\n", c.File)
+	}
+	width := 0
+	for _, e := range c.Entries {
+		width = max(width, len(e.Name))
+	}
+	for _, e := range c.Entries {
+		value := e.Value
+		if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(w, "%-*s = %s  # %s\n", width, e.Name, value, e.Source)
+	}
+}
+
+// Load 为 cfg（结构体指针）中带有 config 标签的字段注册命令行参数并解析 args，然后按以下顺序叠加配置，后面的覆盖前面的：
+//
+//  1. cfg 中已有的值作为默认值
+//  2. 配置文件，由 -config 或者 <PREFIX>_CONFIG 指定，按扩展名解析 JSON 或 YAML，键为字段的名称，不允许未知的键
+//  3. 环境变量 <PREFIX>_<NAME>，名称转为大写，- 和 . 替换为 _，多个值用逗号分隔
+//  4. 命令行参数 -<name>，[]string 字段可以重复
+//
+// 标签的格式为 `config:"name[,path]" usage:"..."`，带有 path 的字段是文件路径，配置文件中的相对路径按配置文件所在的目录解析，
+// 其他来源的相对路径按工作目录解析。实现了 flag.Value 的字段每个值都调用一次 Set，由 Set 决定如何合并。
+// 所有来源应用之后，如果 cfg 实现了 Validator 则进行校验。
+func Load(fs *flag.FlagSet, args []string, cfg any, opts ...Option) (*Config, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config: %T is not a pointer to struct", cfg)
+	}
+	l := &loader{envPrefix: DefaultEnvPrefix}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if err := l.collect(v.Elem()); err != nil {
+		return nil, err
+	}
+
+	flags := make(map[string]*flagValue, len(l.fields))
+	for _, f := range l.fields {
+		flags[f.name] = &flagValue{field: f}
+		usage := f.usage
+		if usage != "" {
+			usage += " "
+		}
+		fs.Var(flags[f.name], f.name, fmt.Sprintf("%s(env %s)", usage, l.env(f.name)))
+	}
+	file := fs.String(ConfigFlag, "", fmt.Sprintf("JSON or YAML config file, overridden by environment variables and flags (env %s)", l.env(ConfigFlag)))
+	printOnly := fs.Bool(PrintFlag, false, "print the effective config and exit")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	c := &Config{File: *file, Args: fs.Args(), PrintOnly: *printOnly}
+	if c.File == "" {
+		c.File = os.Getenv(l.env(ConfigFlag))
+	}
+	if c.File != "" {
+		if err := l.applyFile(c.File); err != nil {
+			return nil, err
+		}
+	}
+	if err := l.applyEnv(); err != nil {
+		return nil, err
+	}
+	for _, f := range l.fields {
+		if values := flags[f.name].values; len(values) > 0 {
+			if err := f.setAll(values, SourceFlag); err != nil {
+				return nil, fmt.Errorf("config: %w", err)
+			}
+		}
+	}
+	if v, ok := cfg.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+	}
+	for _, f := range l.fields {
+		c.Entries = append(c.Entries, Entry{Name: f.name, Value: f.String(), Source: f.source})
+	}
+	return c, nil
+}
+
+// MustLoad 使用 flag.CommandLine 和 os.Args 加载配置，出错时打印错误和用法后退出，
+// 使用了 -print_config 时打印最终生效的配置后退出。
+func MustLoad(cfg any, opts ...Option) *Config {
+	c, err := Load(flag.CommandLine, os.Args[1:], cfg, opts...)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(flag.CommandLine.Output(), err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if c.PrintOnly {
+		c.Print(os.Stdout)
+		os.Exit(0)
+	}
+	return c
+}
+
+// Server 是服务端命令共有的配置。
+type Server struct {
+	Port int    `config:"port" usage:"port to listen on"`
+	Mode string `config:"mode" usage:"mode to run, dev or prod, debugging services such as channelz and reflection are registered in dev mode"`
+}
+
+// DefaultServer 是服务端命令的默认配置。
+var DefaultServer = Server{Port: 50051, Mode: "dev"}
+
+func (s Server) Validate() error {
+	return errors.Join(ValidatePort("port", s.Port), ValidateMode(s.Mode))
+}
+
+// Client 是客户端命令共有的配置。
+type Client struct {
+	Addr string `config:"addr" usage:"addr to connect to"`
+}
+
+// DefaultClient 是客户端命令的默认配置。
+var DefaultClient = Client{Addr: "localhost:50051"}
+
+func (c Client) Validate() error {
+	if c.Addr == "" {
+		return errors.New("addr is required")
+	}
+	return nil
+}
+
+// ValidatePort 检查端口号，0 表示由系统分配。
+func ValidatePort(name string, port int) error {
+	if port < 0 || port > 65535 {
+		return fmt.Errorf("%s %d out of range [0, 65535]", name, port)
+	}
+	return nil
+}
+
+// Modes 是支持的运行模式。
+var Modes = []string{"dev", "prod"}
+
+func ValidateMode(mode string) error {
+	if !slices.Contains(Modes, mode) {
+		return fmt.Errorf("mode %q should be one of %v", mode, Modes)
+	}
+	return nil
+}
+
+// ValidateFile 检查文件是否存在，path 为空时不检查。
+func ValidateFile(name, path string) error {
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
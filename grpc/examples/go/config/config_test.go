@@ -0,0 +1,209 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Server
+	Data    string        `config:"data,path" usage:"data file"`
+	Timeout time.Duration `config:"timeout"`
+	Rate    float64       `config:"rate"`
+	Verbose bool          `config:"verbose"`
+	Keys    []string      `config:"keys"`
+	Ignored string
+}
+
+func defaults() *testConfig {
+	return &testConfig{Server: DefaultServer, Data: "testdata/data.json", Timeout: time.Second}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func load(t *testing.T, cfg any, args ...string) (*Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return Load(fs, args, cfg)
+}
+
+func sources(c *Config) map[string]Source {
+	out := map[string]Source{}
+	for _, e := range c.Entries {
+		out[e.Name] = e.Source
+	}
+	return out
+}
+
+// 默认值 -> 配置文件 -> 环境变量 -> 命令行参数，后面的覆盖前面的
+func TestLayers(t *testing.T) {
+	file := writeFile(t, "config.yaml", "port: 8000\nmode: prod\ntimeout: 3s\nrate: 0.5\nkeys: [a, b]\n")
+	t.Setenv("GOEXAMPLES_MODE", "dev")
+	t.Setenv("GOEXAMPLES_TIMEOUT", "4s")
+	t.Setenv("GOEXAMPLES_KEYS", "c,d")
+
+	cfg := defaults()
+	c, err := load(t, cfg, "-config", file, "-timeout", "5s", "-keys", "e", "-keys", "f", "-verbose", "rest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testConfig{
+		Server:  Server{Port: 8000, Mode: "dev"},
+		Data:    "testdata/data.json",
+		Timeout: 5 * time.Second,
+		Rate:    0.5,
+		Verbose: true,
+		Keys:    []string{"e", "f"},
+	}
+	if !reflect.DeepEqual(*cfg, want) {
+		t.Fatalf("config = %+v, want %+v", *cfg, want)
+	}
+	wantSources := map[string]Source{
+		"port": SourceFile, "mode": SourceEnv, "data": SourceDefault,
+		"timeout": SourceFlag, "rate": SourceFile, "verbose": SourceFlag, "keys": SourceFlag,
+	}
+	if got := sources(c); len(got) != len(wantSources) {
+		t.Fatalf("sources = %v, want %v", got, wantSources)
+	} else {
+		for name, s := range wantSources {
+			if got[name] != s {
+				t.Errorf("%s from %s, want %s", name, got[name], s)
+			}
+		}
+	}
+	if c.File != file || !slices.Equal(c.Args, []string{"rest"}) {
+		t.Fatalf("file = %q, args = %v", c.File, c.Args)
+	}
+}
+
+// 配置文件中的相对路径按配置文件所在的目录解析，命令行参数中的按工作目录解析
+func TestPath(t *testing.T) {
+	file := writeFile(t, "config.json", `{"data": "poems.json", "keys": "single"}`)
+	t.Setenv("GOEXAMPLES_CONFIG", file)
+	cfg := defaults()
+	if _, err := load(t, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(filepath.Dir(file), "poems.json"); cfg.Data != want {
+		t.Fatalf("data = %q, want %q", cfg.Data, want)
+	}
+	if !slices.Equal(cfg.Keys, []string{"single"}) {
+		t.Fatalf("keys = %v", cfg.Keys)
+	}
+
+	cfg = defaults()
+	if _, err := load(t, cfg, "-data", "poems.json"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Data != "poems.json" {
+		t.Fatalf("data = %q, want relative to the working dir", cfg.Data)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		file string
+		args []string
+		want string
+	}{
+		"unknown key":      {file: writeFile(t, "a.json", `{"prot": 1}`), want: `unknown key "prot"`},
+		"nested value":     {file: writeFile(t, "b.yaml", "port: {a: 1}\n"), want: "nested value"},
+		"bad file type":    {file: writeFile(t, "c.toml", "port = 1\n"), want: "unsupported config file"},
+		"bad yaml":         {file: writeFile(t, "d.yml", "port: [\n"), want: "failed to parse"},
+		"invalid number":   {args: []string{"-port", "http"}, want: `port: invalid value "http" from flag`},
+		"invalid duration": {args: []string{"-timeout", "3"}, want: "timeout"},
+		"list for scalar":  {file: writeFile(t, "e.json", `{"mode": ["dev", "prod"]}`), want: "expects a single value"},
+		"invalid port":     {args: []string{"-port", "70000"}, want: "port 70000 out of range"},
+		"invalid mode":     {args: []string{"-mode", "debug"}, want: `mode "debug" should be one of`},
+		"unknown flag":     {args: []string{"-prot", "1"}, want: "not defined"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			args := tc.args
+			if tc.file != "" {
+				args = append([]string{"-config", tc.file}, args...)
+			}
+			if _, err := load(t, defaults(), args...); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("err = %v, want %q", err, tc.want)
+			}
+		})
+	}
+
+	if _, err := load(t, &struct {
+		A string `config:"a"`
+		B string `config:"a"`
+	}{}); err == nil {
+		t.Fatal("duplicate name accepted")
+	}
+	if _, err := load(t, DefaultServer); err == nil {
+		t.Fatal("non-pointer config accepted")
+	}
+}
+
+// headers 是实现了 flag.Value 的字段，每个值调用一次 Set。
+type headers []string
+
+func (h *headers) String() string     { return strings.Join(*h, "; ") }
+func (h *headers) Set(s string) error { *h = append(*h, s); return nil }
+
+func TestFlagValue(t *testing.T) {
+	var cfg struct {
+		Headers headers `config:"H"`
+	}
+	file := writeFile(t, "h.yaml", "H: ['a: 1', 'b: 2']\n")
+	if _, err := load(t, &cfg, "-config", file, "-H", "c: 3, 4"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a: 1", "b: 2", "c: 3, 4"}; !slices.Equal(cfg.Headers, want) {
+		t.Fatalf("headers = %q, want %q", cfg.Headers, want)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	cfg := &struct {
+		Client
+		Name string `config:"name"`
+	}{Client: DefaultClient}
+	c, err := load(t, cfg, "-name", "world", "-print_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.PrintOnly {
+		t.Fatal("PrintOnly = false")
+	}
+	var b bytes.Buffer
+	c.Print(&b)
+	want := "addr = localhost:50051  # default\nname = world  # flag\n"
+	if b.String() != want {
+		t.Fatalf("print:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var b bytes.Buffer
+	fs.SetOutput(&b)
+	if _, err := Load(fs, []string{"-h"}, defaults(), WithEnvPrefix("POEM")); err != flag.ErrHelp {
+		t.Fatalf("err = %v, want ErrHelp", err)
+	}
+	for _, want := range []string{"-data value\n    \tdata file (env POEM_DATA) (default testdata/data.json)", "-port value", "(env POEM_CONFIG)", "-print_config"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("usage does not contain %q:\n%s", want, b.String())
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package breaker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// State 是熔断器的状态。
+//
+//	Closed: 正常放行调用，统计失败次数，达到阈值后进入 Open
+//	Open: 直接返回 Unavailable，不发起调用，冷却时间结束后进入 HalfOpen
+//	HalfOpen: 放行少量探测调用，全部成功后进入 Closed，任何一次失败都重新进入 Open
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// KeyFunc 决定调用归属的熔断器，相同 key 的调用共享状态。
+type KeyFunc func(method string, cc *grpc.ClientConn) string
+
+// ByMethod 每个方法使用独立的熔断器，默认使用。
+func ByMethod(method string, _ *grpc.ClientConn) string {
+	return method
+}
+
+// ByTarget 同一个连接目标的所有方法共享熔断器，后端整体不可用时更快地熔断。
+func ByTarget(_ string, cc *grpc.ClientConn) string {
+	return cc.Target()
+}
+
+// IsFailure 判断一次调用的结果是否计为失败。
+type IsFailure func(err error) bool
+
+// DefaultIsFailure 只把说明后端出了问题的错误计为失败，参数错误、找不到资源、客户端取消等错误不影响熔断。
+func DefaultIsFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Internal, codes.Unavailable, codes.DataLoss:
+		return true
+	default:
+		return false
+	}
+}
+
+type Option func(*Breaker)
+
+// WithKey 设置熔断器的划分方式，默认为 ByMethod。
+func WithKey(key KeyFunc) Option {
+	return func(b *Breaker) {
+		b.key = key
+	}
+}
+
+// WithConsecutiveFailures 连续失败 n 次后熔断，n 小于等于 0 时不按连续失败熔断，默认为 5。
+func WithConsecutiveFailures(n int) Option {
+	return func(b *Breaker) {
+		b.consecutive = n
+	}
+}
+
+// WithFailureRate 最近 window 次调用中失败的比例达到 rate 后熔断，调用次数少于 minCalls 时不判断。
+// rate 小于等于 0 时不按失败率熔断，默认不开启。
+func WithFailureRate(rate float64, window, minCalls int) Option {
+	return func(b *Breaker) {
+		b.rate, b.window, b.minCalls = rate, max(1, window), max(1, minCalls)
+	}
+}
+
+// WithCoolDown 设置熔断后的冷却时间，结束后进入半开状态，默认为 10 秒。
+func WithCoolDown(d time.Duration) Option {
+	return func(b *Breaker) {
+		b.coolDown = d
+	}
+}
+
+// WithHalfOpenCalls 设置半开状态下同时放行的探测调用数，全部成功后恢复，默认为 1。
+func WithHalfOpenCalls(n int) Option {
+	return func(b *Breaker) {
+		b.halfOpenCalls = max(1, n)
+	}
+}
+
+// WithIsFailure 设置哪些错误计为失败，默认为 DefaultIsFailure。
+func WithIsFailure(f IsFailure) Option {
+	return func(b *Breaker) {
+		b.isFailure = f
+	}
+}
+
+// WithOnStateChange 设置状态变化的回调，可以用来输出日志或指标，回调在锁外执行，可以调用 Breaker 的方法。
+func WithOnStateChange(f func(key string, from, to State)) Option {
+	return func(b *Breaker) {
+		b.onChange = append(b.onChange, f)
+	}
+}
+
+// circuit 是一个 key 的熔断状态，generation 在每次状态变化时递增，旧状态下发起的调用的结果会被忽略。
+type circuit struct {
+	state       State
+	generation  uint64
+	openedAt    time.Time
+	consecutive int
+	results     []bool // Closed 状态下最近的调用结果，true 为失败
+	next        int
+	inflight    int // HalfOpen 状态下正在进行的探测调用
+	successes   int
+}
+
+func (c *circuit) failureRate() (float64, int) {
+	failures := 0
+	for _, f := range c.results {
+		if f {
+			failures++
+		}
+	}
+	if len(c.results) == 0 {
+		return 0, 0
+	}
+	return float64(failures) / float64(len(c.results)), len(c.results)
+}
+
+type transition struct {
+	key      string
+	from, to State
+}
+
+// Breaker 是客户端熔断器，同时提供一元和流式客户端拦截器。
+// 熔断期间调用直接失败，返回 Unavailable 和 errdetails.RetryInfo，RetryInfo 为剩余的冷却时间。
+type Breaker struct {
+	key           KeyFunc
+	consecutive   int
+	rate          float64
+	window        int
+	minCalls      int
+	coolDown      time.Duration
+	halfOpenCalls int
+	isFailure     IsFailure
+	onChange      []func(key string, from, to State)
+	now           func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+func (b *Breaker) circuit(key string) *circuit {
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+	return c
+}
+
+// set 在持有锁时切换状态，返回需要在锁外通知的状态变化。
+func (b *Breaker) set(key string, c *circuit, to State, now time.Time) []transition {
+	from := c.state
+	c.state = to
+	c.generation++
+	c.consecutive, c.results, c.next = 0, nil, 0
+	c.inflight, c.successes = 0, 0
+	if to == Open {
+		c.openedAt = now
+	}
+	return []transition{{key: key, from: from, to: to}}
+}
+
+func (b *Breaker) notify(ts []transition) {
+	for _, t := range ts {
+		for _, f := range b.onChange {
+			f(t.key, t.from, t.to)
+		}
+	}
+}
+
+// allow 判断是否放行调用，放行时返回调用开始时的 generation。
+func (b *Breaker) allow(key string) (uint64, error) {
+	now := b.now()
+	b.mu.Lock()
+	c := b.circuit(key)
+	var ts []transition
+	if c.state == Open && now.Sub(c.openedAt) >= b.coolDown {
+		ts = b.set(key, c, HalfOpen, now)
+	}
+	var err error
+	switch c.state {
+	case Open:
+		err = b.reject(key, "open", c.openedAt.Add(b.coolDown).Sub(now))
+	case HalfOpen:
+		if c.inflight >= b.halfOpenCalls {
+			err = b.reject(key, "half-open", 0)
+		} else {
+			c.inflight++
+		}
+	}
+	generation := c.generation
+	b.mu.Unlock()
+	b.notify(ts)
+	return generation, err
+}
+
+func (b *Breaker) reject(key, state string, retry time.Duration) error {
+	st := status.Newf(codes.Unavailable, "circuit breaker for %s is %s, failing fast", key, state)
+	if retry > 0 {
+		if ds, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retry)}); err == nil {
+			st = ds
+		}
+	}
+	return st.Err()
+}
+
+// done 记录调用的结果，ignore 为 true 表示调用被放弃，结果无法判断，只释放探测名额。
+func (b *Breaker) done(key string, generation uint64, err error, ignore bool) {
+	now := b.now()
+	b.mu.Lock()
+	c := b.circuit(key)
+	if c.generation != generation {
+		b.mu.Unlock()
+		return
+	}
+	// 客户端取消的调用不能说明后端的状况
+	ignore = ignore || status.Code(err) == codes.Canceled
+	failed := !ignore && b.isFailure(err)
+	var ts []transition
+	switch c.state {
+	case Closed:
+		if ignore {
+			break
+		}
+		if failed {
+			c.consecutive++
+		} else {
+			c.consecutive = 0
+		}
+		if len(c.results) < b.window {
+			c.results = append(c.results, failed)
+		} else {
+			c.results[c.next] = failed
+		}
+		c.next = (c.next + 1) % b.window
+		rate, calls := c.failureRate()
+		if (b.consecutive > 0 && c.consecutive >= b.consecutive) || (b.rate > 0 && calls >= b.minCalls && rate >= b.rate) {
+			ts = b.set(key, c, Open, now)
+		}
+	case HalfOpen:
+		c.inflight--
+		switch {
+		case failed:
+			ts = b.set(key, c, Open, now)
+		case ignore:
+		default:
+			if c.successes++; c.successes >= b.halfOpenCalls {
+				ts = b.set(key, c, Closed, now)
+			}
+		}
+	}
+	b.mu.Unlock()
+	b.notify(ts)
+}
+
+// State 返回 key 当前的状态，冷却时间已经结束的熔断器会报告为 HalfOpen。
+func (b *Breaker) State(key string) State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[key]
+	if !ok {
+		return Closed
+	}
+	if c.state == Open && b.now().Sub(c.openedAt) >= b.coolDown {
+		return HalfOpen
+	}
+	return c.state
+}
+
+func (b *Breaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		key := b.key(method, cc)
+		generation, err := b.allow(key)
+		if err != nil {
+			return err
+		}
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		b.done(key, generation, err, false)
+		return err
+	}
+}
+
+// breakerClientStream 在流结束时记录结果：RecvMsg 返回错误（io.EOF 为成功），或者非服务端流收到了唯一的响应。
+// 调用方没有读完就放弃的流在上下文结束时释放探测名额，不计入结果。
+type breakerClientStream struct {
+	grpc.ClientStream
+	desc   *grpc.StreamDesc
+	once   sync.Once
+	finish func(err error, ignore bool)
+	stop   func() bool
+}
+
+func (s *breakerClientStream) end(err error, ignore bool) {
+	s.once.Do(func() {
+		s.finish(err, ignore)
+	})
+}
+
+func (s *breakerClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil || !s.desc.ServerStreams {
+		if err == io.EOF {
+			s.end(nil, false)
+		} else {
+			s.end(err, false)
+		}
+		s.stop()
+	}
+	return err
+}
+
+func (b *Breaker) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		key := b.key(method, cc)
+		generation, err := b.allow(key)
+		if err != nil {
+			return nil, err
+		}
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			b.done(key, generation, err, false)
+			return nil, err
+		}
+		s := &breakerClientStream{ClientStream: cs, desc: desc, finish: func(err error, ignore bool) {
+			b.done(key, generation, err, ignore)
+		}}
+		s.stop = context.AfterFunc(ctx, func() { s.end(nil, true) })
+		return s, nil
+	}
+}
+
+// DialOptions 返回注册拦截器的客户端配置。
+func (b *Breaker) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(b.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(b.StreamClientInterceptor()),
+	}
+}
+
+func NewBreaker(opts ...Option) *Breaker {
+	b := &Breaker{
+		key:           ByMethod,
+		consecutive:   5,
+		window:        1,
+		minCalls:      1,
+		coolDown:      10 * time.Second,
+		halfOpenCalls: 1,
+		isFailure:     DefaultIsFailure,
+		now:           time.Now,
+		circuits:      map[string]*circuit{},
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
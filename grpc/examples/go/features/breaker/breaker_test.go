@@ -0,0 +1,285 @@
+package breaker
+
+import (
+	"context"
+	"goexamples/bootstrap"
+	"goexamples/features/fault"
+	"goexamples/features/proto/message"
+	"goexamples/harness"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// clock 是可以手动推进的时钟。
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// env 是一个带有故障注入的消息服务端和使用熔断器的客户端，calls 统计服务端实际收到的调用。
+type env struct {
+	client      message.MessageServiceClient
+	breaker     *Breaker
+	injector    *fault.Injector
+	clock       *clock
+	calls       atomic.Int32
+	mu          sync.Mutex
+	transitions []string
+}
+
+func newEnv(t *testing.T, opts ...Option) *env {
+	t.Helper()
+	e := &env{injector: fault.NewInjector("dev"), clock: &clock{now: time.Unix(0, 0)}}
+	opts = append(opts, WithOnStateChange(func(key string, from, to State) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.transitions = append(e.transitions, from.String()+"->"+to.String())
+	}))
+	e.breaker = NewBreaker(opts...)
+	e.breaker.now = e.clock.Now
+	count := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		e.calls.Add(1)
+		return handler(ctx, req)
+	}
+	countStream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		e.calls.Add(1)
+		return handler(srv, ss)
+	}
+	h := harness.New(t,
+		harness.WithUnaryInterceptors(count, e.injector.UnaryServerInterceptor()),
+		harness.WithStreamInterceptors(countStream, e.injector.StreamServerInterceptor()),
+		harness.WithDialOptions(e.breaker.DialOptions()...),
+	)
+	e.client = harness.Client(h, func(opts ...grpc.ServerOption) harness.Server {
+		return message.NewMessageSrvServer(bootstrap.WithServerOptions(opts...))
+	}, message.NewMessageServiceClient)
+	return e
+}
+
+// fail 让服务端的所有调用返回 code，code 为 OK 时恢复正常。
+func (e *env) fail(code codes.Code) {
+	var rules []fault.Rule
+	if code != codes.OK {
+		rules = []fault.Rule{{ErrorRate: 1, Code: fault.Code(code)}}
+	}
+	e.injector.SetRules(rules)
+}
+
+func (e *env) unary() error {
+	_, err := e.client.Unary(context.Background(), &message.Message{Content: "hello"})
+	return err
+}
+
+func (e *env) states() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.transitions)
+}
+
+func TestConsecutiveFailures(t *testing.T) {
+	e := newEnv(t, WithConsecutiveFailures(3), WithCoolDown(time.Second))
+	e.fail(codes.Unavailable)
+	for range 3 {
+		if err := e.unary(); status.Code(err) != codes.Unavailable {
+			t.Fatalf("err = %v, want injected Unavailable", err)
+		}
+	}
+	if got := e.breaker.State(message.MessageService_Unary_FullMethodName); got != Open {
+		t.Fatalf("state = %v, want open", got)
+	}
+
+	// 熔断期间直接失败，不会到达服务端
+	calls := e.calls.Load()
+	err := e.unary()
+	if status.Code(err) != codes.Unavailable || !strings.Contains(status.Convert(err).Message(), "circuit breaker") {
+		t.Fatalf("err = %v, want fail fast", err)
+	}
+	if e.calls.Load() != calls {
+		t.Fatal("call reached the server while the circuit is open")
+	}
+	var retry time.Duration
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			retry = info.GetRetryDelay().AsDuration()
+		}
+	}
+	if retry != time.Second {
+		t.Fatalf("retry delay = %v, want 1s", retry)
+	}
+
+	// 其他方法使用独立的熔断器
+	ss, err := e.client.ServerStream(context.Background(), &message.MessageCollection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ss.Recv(); status.Code(err) != codes.Unavailable || strings.Contains(err.Error(), "circuit breaker") {
+		t.Fatalf("stream err = %v, want injected error", err)
+	}
+
+	// 冷却结束后放行一次探测，成功后恢复
+	e.fail(codes.OK)
+	e.clock.Advance(time.Second)
+	if err := e.unary(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if want := []string{"closed->open", "open->half-open", "half-open->closed"}; !slices.Equal(e.states(), want) {
+		t.Fatalf("transitions = %v, want %v", e.states(), want)
+	}
+}
+
+func TestHalfOpenFailure(t *testing.T) {
+	e := newEnv(t, WithConsecutiveFailures(1), WithCoolDown(time.Second))
+	e.fail(codes.Internal)
+	e.unary()
+	e.clock.Advance(time.Second)
+	if err := e.unary(); status.Code(err) != codes.Internal {
+		t.Fatalf("probe err = %v, want injected Internal", err)
+	}
+	// 探测失败后重新熔断，冷却时间重新计算
+	e.clock.Advance(time.Second / 2)
+	if err := e.unary(); !strings.Contains(status.Convert(err).Message(), "is open") {
+		t.Fatalf("err = %v, want open", err)
+	}
+	if want := []string{"closed->open", "open->half-open", "half-open->open"}; !slices.Equal(e.states(), want) {
+		t.Fatalf("transitions = %v, want %v", e.states(), want)
+	}
+}
+
+func TestFailureRate(t *testing.T) {
+	e := newEnv(t, WithConsecutiveFailures(0), WithFailureRate(0.5, 4, 4))
+	// 失败、成功交替，前三次调用不足 minCalls，第四次时失败率达到 50%
+	for i := range 4 {
+		if i%2 == 0 {
+			e.fail(codes.DeadlineExceeded)
+		} else {
+			e.fail(codes.OK)
+		}
+		e.unary()
+		if want := i == 3; (e.breaker.State(message.MessageService_Unary_FullMethodName) == Open) != want {
+			t.Fatalf("call %d: state = %v", i, e.breaker.State(message.MessageService_Unary_FullMethodName))
+		}
+	}
+}
+
+func TestIgnoredErrors(t *testing.T) {
+	e := newEnv(t, WithConsecutiveFailures(2))
+	// 参数错误、限流不计为失败
+	for _, code := range []codes.Code{codes.InvalidArgument, codes.ResourceExhausted, codes.NotFound} {
+		e.fail(code)
+		e.unary()
+		e.unary()
+	}
+	e.fail(codes.OK)
+	if _, err := e.client.Unary(context.Background(), &message.Message{Content: strings.Repeat("x", 4097)}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("err = %v, want InvalidArgument", err)
+	}
+	if got := e.breaker.State(message.MessageService_Unary_FullMethodName); got != Closed {
+		t.Fatalf("state = %v, want closed", got)
+	}
+}
+
+func TestStream(t *testing.T) {
+	e := newEnv(t, WithConsecutiveFailures(2), WithCoolDown(time.Second))
+	method := message.MessageService_BidirectionalStream_FullMethodName
+	e.injector.SetRules([]fault.Rule{{Method: method, Metadata: map[string]string{"x-fault": "abort"}, AbortAfter: 1, Code: fault.Code(codes.Unavailable)}})
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-fault", "abort")
+	for range 2 {
+		bs, err := e.client.BidirectionalStream(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bs.Send(&message.Message{Content: "1"})
+		bs.CloseSend()
+		for err == nil {
+			_, err = bs.Recv()
+		}
+	}
+	if got := e.breaker.State(method); got != Open {
+		t.Fatalf("state = %v, want open", got)
+	}
+	if _, err := e.client.BidirectionalStream(context.Background()); status.Code(err) != codes.Unavailable {
+		t.Fatalf("err = %v, want fail fast", err)
+	}
+
+	// 半开状态下只放行一个探测流，流结束前其他调用直接失败
+	e.clock.Advance(time.Second)
+	probe, err := e.client.BidirectionalStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.client.BidirectionalStream(context.Background()); !strings.Contains(status.Convert(err).Message(), "half-open") {
+		t.Fatalf("err = %v, want half-open", err)
+	}
+	probe.Send(&message.Message{Content: "ok"})
+	probe.CloseSend()
+	for err == nil {
+		_, err = probe.Recv()
+	}
+	if err != io.EOF || e.breaker.State(method) != Closed {
+		t.Fatalf("probe err = %v, state = %v, want closed", err, e.breaker.State(method))
+	}
+}
+
+func TestAbandonedProbe(t *testing.T) {
+	e := newEnv(t, WithConsecutiveFailures(1), WithCoolDown(time.Second))
+	e.fail(codes.Unavailable)
+	e.unary()
+	e.fail(codes.OK)
+	e.clock.Advance(time.Second)
+
+	// 没有读完就取消的探测流不计入结果，只释放探测名额
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := e.client.BidirectionalStream(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if err := e.unary(); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("probe slot not released: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestByTarget(t *testing.T) {
+	e := newEnv(t, WithKey(ByTarget), WithConsecutiveFailures(1))
+	e.fail(codes.Unavailable)
+	e.unary()
+	// 同一个目标的其他方法也被熔断
+	if _, err := e.client.BidirectionalStream(context.Background()); !strings.Contains(status.Convert(err).Message(), "passthrough:///bufnet is open") {
+		t.Fatalf("err = %v, want the target open", err)
+	}
+}
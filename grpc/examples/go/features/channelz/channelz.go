@@ -0,0 +1,267 @@
+package channelz
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	channelzgrpc "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/channelz/service"
+)
+
+// DefaultPath 是管理页面默认挂载的路径。
+const DefaultPath = "/debug/channelz"
+
+// 分页查询时每页的数量。
+const pageSize = 100
+
+// Register 在 dev 模式下为服务端注册 channelz 服务，可以通过 grpcdebug 等工具查看连接状态，生产环境不要开启。
+func Register(s grpc.ServiceRegistrar, mode string) {
+	if mode == "dev" {
+		service.RegisterChannelzServiceToServer(s)
+	}
+}
+
+// registrar 截获 RegisterChannelzServiceToServer 注册的服务实现，管理页面直接在进程内调用它，不需要经过网络。
+type registrar struct {
+	impl channelzgrpc.ChannelzServer
+}
+
+func (r *registrar) RegisterService(_ *grpc.ServiceDesc, impl any) {
+	r.impl = impl.(channelzgrpc.ChannelzServer)
+}
+
+// Socket 是一个连接的快照，Streams* 为该连接上创建、成功、失败的流数量。
+type Socket struct {
+	ID               int64
+	Name             string
+	Local, Remote    string
+	StreamsStarted   int64
+	StreamsSucceeded int64
+	StreamsFailed    int64
+	MessagesSent     int64
+	MessagesReceived int64
+	KeepAlivesSent   int64
+}
+
+// Channel 是客户端 channel 或 subchannel 的快照。
+type Channel struct {
+	ID             int64
+	Name           string
+	Target         string
+	State          string
+	CallsStarted   int64
+	CallsSucceeded int64
+	CallsFailed    int64
+	Channels       []*Channel // 嵌套的 channel
+	Subchannels    []*Channel
+	Sockets        []*Socket
+}
+
+// Server 是服务端的快照，通过 ServeHTTP 接入 http 服务（同端口复用）时没有监听和连接套接字，只有调用计数。
+type Server struct {
+	ID             int64
+	Name           string
+	CallsStarted   int64
+	CallsSucceeded int64
+	CallsFailed    int64
+	ListenSockets  []*Socket
+	Sockets        []*Socket
+}
+
+// Snapshot 是当前进程中所有 channel 和服务端的快照。
+type Snapshot struct {
+	Channels []*Channel
+	Servers  []*Server
+}
+
+// Handler 以 html 页面展示 channelz 数据，请求参数 format=text 时返回纯文本。
+type Handler struct {
+	cz channelzgrpc.ChannelzServer
+}
+
+func formatAddr(a *channelzgrpc.Address) string {
+	switch {
+	case a.GetTcpipAddress() != nil:
+		t := a.GetTcpipAddress()
+		return net.JoinHostPort(net.IP(t.GetIpAddress()).String(), fmt.Sprint(t.GetPort()))
+	case a.GetUdsAddress() != nil:
+		return "unix:" + a.GetUdsAddress().GetFilename()
+	case a.GetOtherAddress() != nil:
+		return a.GetOtherAddress().GetName()
+	}
+	return ""
+}
+
+func (h *Handler) socket(ctx context.Context, ref *channelzgrpc.SocketRef) (*Socket, error) {
+	resp, err := h.cz.GetSocket(ctx, &channelzgrpc.GetSocketRequest{SocketId: ref.GetSocketId()})
+	if err != nil {
+		return nil, err
+	}
+	s, d := resp.GetSocket(), resp.GetSocket().GetData()
+	return &Socket{
+		ID:               ref.GetSocketId(),
+		Name:             ref.GetName(),
+		Local:            formatAddr(s.GetLocal()),
+		Remote:           formatAddr(s.GetRemote()),
+		StreamsStarted:   d.GetStreamsStarted(),
+		StreamsSucceeded: d.GetStreamsSucceeded(),
+		StreamsFailed:    d.GetStreamsFailed(),
+		MessagesSent:     d.GetMessagesSent(),
+		MessagesReceived: d.GetMessagesReceived(),
+		KeepAlivesSent:   d.GetKeepAlivesSent(),
+	}, nil
+}
+
+// sockets 查询套接字详情，快照期间已经关闭的套接字直接跳过。
+func (h *Handler) sockets(ctx context.Context, refs []*channelzgrpc.SocketRef) []*Socket {
+	var out []*Socket
+	for _, ref := range refs {
+		if s, err := h.socket(ctx, ref); err == nil {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+type channelLike interface {
+	GetData() *channelzgrpc.ChannelData
+	GetChannelRef() []*channelzgrpc.ChannelRef
+	GetSubchannelRef() []*channelzgrpc.SubchannelRef
+	GetSocketRef() []*channelzgrpc.SocketRef
+}
+
+func (h *Handler) channel(ctx context.Context, id int64, name string, c channelLike) *Channel {
+	d := c.GetData()
+	out := &Channel{
+		ID:             id,
+		Name:           name,
+		Target:         d.GetTarget(),
+		State:          d.GetState().GetState().String(),
+		CallsStarted:   d.GetCallsStarted(),
+		CallsSucceeded: d.GetCallsSucceeded(),
+		CallsFailed:    d.GetCallsFailed(),
+		Sockets:        h.sockets(ctx, c.GetSocketRef()),
+	}
+	for _, ref := range c.GetChannelRef() {
+		if resp, err := h.cz.GetChannel(ctx, &channelzgrpc.GetChannelRequest{ChannelId: ref.GetChannelId()}); err == nil {
+			out.Channels = append(out.Channels, h.channel(ctx, ref.GetChannelId(), ref.GetName(), resp.GetChannel()))
+		}
+	}
+	for _, ref := range c.GetSubchannelRef() {
+		if resp, err := h.cz.GetSubchannel(ctx, &channelzgrpc.GetSubchannelRequest{SubchannelId: ref.GetSubchannelId()}); err == nil {
+			out.Subchannels = append(out.Subchannels, h.channel(ctx, ref.GetSubchannelId(), ref.GetName(), resp.GetSubchannel()))
+		}
+	}
+	return out
+}
+
+func (h *Handler) server(ctx context.Context, s *channelzgrpc.Server) (*Server, error) {
+	d := s.GetData()
+	out := &Server{
+		ID:             s.GetRef().GetServerId(),
+		Name:           s.GetRef().GetName(),
+		CallsStarted:   d.GetCallsStarted(),
+		CallsSucceeded: d.GetCallsSucceeded(),
+		CallsFailed:    d.GetCallsFailed(),
+		ListenSockets:  h.sockets(ctx, s.GetListenSocket()),
+	}
+	for start := int64(0); ; {
+		resp, err := h.cz.GetServerSockets(ctx, &channelzgrpc.GetServerSocketsRequest{ServerId: out.ID, StartSocketId: start, MaxResults: pageSize})
+		if err != nil {
+			return nil, err
+		}
+		refs := resp.GetSocketRef()
+		out.Sockets = append(out.Sockets, h.sockets(ctx, refs)...)
+		if resp.GetEnd() || len(refs) == 0 {
+			return out, nil
+		}
+		start = refs[len(refs)-1].GetSocketId() + 1
+	}
+}
+
+// Snapshot 查询当前进程中的所有顶层 channel、服务端及其套接字。
+func (h *Handler) Snapshot(ctx context.Context) (*Snapshot, error) {
+	snap := &Snapshot{}
+	for start := int64(0); ; {
+		resp, err := h.cz.GetTopChannels(ctx, &channelzgrpc.GetTopChannelsRequest{StartChannelId: start, MaxResults: pageSize})
+		if err != nil {
+			return nil, err
+		}
+		chs := resp.GetChannel()
+		for _, c := range chs {
+			snap.Channels = append(snap.Channels, h.channel(ctx, c.GetRef().GetChannelId(), c.GetRef().GetName(), c))
+		}
+		if resp.GetEnd() || len(chs) == 0 {
+			break
+		}
+		start = chs[len(chs)-1].GetRef().GetChannelId() + 1
+	}
+	for start := int64(0); ; {
+		resp, err := h.cz.GetServers(ctx, &channelzgrpc.GetServersRequest{StartServerId: start, MaxResults: pageSize})
+		if err != nil {
+			return nil, err
+		}
+		srvs := resp.GetServer()
+		for _, s := range srvs {
+			srv, err := h.server(ctx, s)
+			if err != nil {
+				return nil, err
+			}
+			snap.Servers = append(snap.Servers, srv)
+		}
+		if resp.GetEnd() || len(srvs) == 0 {
+			break
+		}
+		start = srvs[len(srvs)-1].GetRef().GetServerId() + 1
+	}
+	return snap, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snap, err := h.Snapshot(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		writeText(w, snap)
+		return
+	}
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, snap); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// NewHandler 创建管理页面，页面展示的是整个进程的 channelz 数据，与服务端是否注册了 channelz 服务无关。
+func NewHandler() *Handler {
+	r := &registrar{}
+	service.RegisterChannelzServiceToServer(r)
+	return &Handler{cz: r.impl}
+}
+
+// HandleGateway 在 dev 模式下将管理页面挂载到网关的 DefaultPath，与网关共用端口和中间件。
+func HandleGateway(mux *runtime.ServeMux, mode string) error {
+	if mode != "dev" {
+		return nil
+	}
+	h := NewHandler()
+	return mux.HandlePath(http.MethodGet, DefaultPath, func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		h.ServeHTTP(w, r)
+	})
+}
+
+// IsAdmin 判断请求是否访问管理页面，可以作为 ServerMux 的匹配条件。
+func IsAdmin(r *http.Request) bool {
+	return r.URL.Path == DefaultPath
+}
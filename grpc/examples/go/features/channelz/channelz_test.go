@@ -0,0 +1,101 @@
+package channelz_test
+
+import (
+	"context"
+	"goexamples/bootstrap"
+	"goexamples/features/channelz"
+	"goexamples/features/proto/message"
+	"goexamples/harness"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+)
+
+const channelzService = "grpc.channelz.v1.Channelz"
+
+func TestRegister(t *testing.T) {
+	for mode, want := range map[string]bool{"dev": true, "prod": false} {
+		s := grpc.NewServer()
+		channelz.Register(s, mode)
+		if _, ok := s.GetServiceInfo()[channelzService]; ok != want {
+			t.Errorf("mode %s: channelz registered = %v, want %v", mode, ok, want)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	conn := harness.New(t).Start(func(opts ...grpc.ServerOption) harness.Server {
+		return message.NewMessageSrvServer(bootstrap.WithServerOptions(opts...))
+	})
+	c := message.NewMessageServiceClient(conn)
+	for range 3 {
+		if _, err := c.Unary(context.Background(), &message.Message{Content: "hello"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snap, err := channelz.NewHandler().Snapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var server *channelz.Server
+	for _, s := range snap.Servers {
+		if s.CallsSucceeded >= 3 {
+			server = s
+		}
+	}
+	if server == nil {
+		t.Fatalf("no server with 3 succeeded calls in %d servers", len(snap.Servers))
+	}
+	if len(server.Sockets) != 1 || server.Sockets[0].StreamsSucceeded < 3 {
+		t.Fatalf("want one socket with at least 3 succeeded streams, got %+v", server.Sockets)
+	}
+
+	var sockets int
+	var walk func(*channelz.Channel)
+	walk = func(ch *channelz.Channel) {
+		sockets += len(ch.Sockets)
+		for _, sc := range ch.Subchannels {
+			walk(sc)
+		}
+	}
+	for _, ch := range snap.Channels {
+		walk(ch)
+	}
+	if len(snap.Channels) == 0 || sockets == 0 {
+		t.Fatalf("want client channel with sockets, got %d channels and %d sockets", len(snap.Channels), sockets)
+	}
+}
+
+func TestHandleGateway(t *testing.T) {
+	tests := []struct {
+		mode       string
+		query      string
+		wantStatus int
+		wantBody   string
+	}{
+		{mode: "dev", wantStatus: http.StatusOK, wantBody: "<h1>channelz</h1>"},
+		{mode: "dev", query: "?format=text", wantStatus: http.StatusOK},
+		{mode: "prod", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+tt.query, func(t *testing.T) {
+			mux := runtime.NewServeMux()
+			if err := channelz.HandleGateway(mux, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, channelz.DefaultPath+tt.query, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Fatalf("body does not contain %q:\n%s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
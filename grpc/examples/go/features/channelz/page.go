@@ -0,0 +1,90 @@
+package channelz
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+var page = template.Must(template.New("channelz").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>channelz</title>
+<style>
+body { font-family: monospace; margin: 1em 2em; }
+table { border-collapse: collapse; margin: 0.5em 0 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+th { background: #eee; }
+.channel { margin-left: 1.5em; border-left: 2px solid #ddd; padding-left: 1em; }
+.failed { color: #c00; }
+</style>
+</head>
+<body>
+{{define "sockets"}}
+{{if .}}
+<table>
+<tr><th>socket</th><th>local</th><th>remote</th><th>streams started</th><th>succeeded</th><th>failed</th><th>msgs sent</th><th>msgs received</th><th>keepalives sent</th></tr>
+{{range .}}<tr><td>{{.ID}} {{.Name}}</td><td>{{.Local}}</td><td>{{.Remote}}</td><td>{{.StreamsStarted}}</td><td>{{.StreamsSucceeded}}</td><td{{if .StreamsFailed}} class="failed"{{end}}>{{.StreamsFailed}}</td><td>{{.MessagesSent}}</td><td>{{.MessagesReceived}}</td><td>{{.KeepAlivesSent}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{end}}
+{{define "channel"}}
+<div class="channel">
+<p><b>{{.ID}} {{.Name}}</b> target={{.Target}} state={{.State}} calls started={{.CallsStarted}} succeeded={{.CallsSucceeded}} <span{{if .CallsFailed}} class="failed"{{end}}>failed={{.CallsFailed}}</span></p>
+{{template "sockets" .Sockets}}
+{{range .Subchannels}}{{template "channel" .}}{{end}}
+{{range .Channels}}{{template "channel" .}}{{end}}
+</div>
+{{end}}
+<h1>channelz</h1>
+<h2>servers ({{len .Servers}})</h2>
+{{range .Servers}}
+<h3>server {{.ID}} {{.Name}}</h3>
+<p>calls started={{.CallsStarted}} succeeded={{.CallsSucceeded}} <span{{if .CallsFailed}} class="failed"{{end}}>failed={{.CallsFailed}}</span></p>
+{{if .ListenSockets}}<p>listen sockets:</p>{{template "sockets" .ListenSockets}}{{end}}
+{{if .Sockets}}<p>sockets:</p>{{template "sockets" .Sockets}}{{else}}<p>no sockets, the server may be served through ServeHTTP</p>{{end}}
+{{else}}
+<p>no servers</p>
+{{end}}
+<h2>channels ({{len .Channels}})</h2>
+{{range .Channels}}{{template "channel" .}}{{else}}<p>no channels</p>{{end}}
+</body>
+</html>
+`))
+
+func writeSockets(w io.Writer, indent string, sockets []*Socket) {
+	for _, s := range sockets {
+		fmt.Fprintf(w, "%ssocket %d %s local=%s remote=%s streams started=%d succeeded=%d failed=%d messages sent=%d received=%d\n",
+			indent, s.ID, s.Name, s.Local, s.Remote, s.StreamsStarted, s.StreamsSucceeded, s.StreamsFailed, s.MessagesSent, s.MessagesReceived)
+	}
+}
+
+func writeChannel(w io.Writer, depth int, kind string, c *Channel) {
+	indent := strings.Repeat("  ", depth)
+	fmt.Fprintf(w, "%s%s %d %s target=%s state=%s calls started=%d succeeded=%d failed=%d\n",
+		indent, kind, c.ID, c.Name, c.Target, c.State, c.CallsStarted, c.CallsSucceeded, c.CallsFailed)
+	writeSockets(w, indent+"  ", c.Sockets)
+	for _, sc := range c.Subchannels {
+		writeChannel(w, depth+1, "subchannel", sc)
+	}
+	for _, ch := range c.Channels {
+		writeChannel(w, depth+1, "channel", ch)
+	}
+}
+
+// writeText 以缩进的纯文本输出快照，便于 curl 查看。
+func writeText(w io.Writer, snap *Snapshot) {
+	for _, s := range snap.Servers {
+		fmt.Fprintf(w, "server %d %s calls started=%d succeeded=%d failed=%d\n", s.ID, s.Name, s.CallsStarted, s.CallsSucceeded, s.CallsFailed)
+		for _, l := range s.ListenSockets {
+			fmt.Fprintf(w, "  listen %d %s local=%s\n", l.ID, l.Name, l.Local)
+		}
+		writeSockets(w, "  ", s.Sockets)
+	}
+	for _, c := range snap.Channels {
+		writeChannel(w, 0, "channel", c)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"goexamples/config"
+	"goexamples/features/proto/message"
+	"log"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+type Config struct {
+	config.Client
+	Room string `config:"room" usage:"room to join"`
+	Name string `config:"name" usage:"sender id, generated by server if empty or taken"`
+}
+
+var cfg = Config{Client: config.DefaultClient, Room: "lobby"}
+
+func format(m *message.Message) string {
+	ts := m.GetTimestamp().AsTime().Local().Format(time.TimeOnly)
+	switch m.GetKind() {
+	case message.Kind_JOIN, message.Kind_LEAVE:
+		return fmt.Sprintf("[%s] * %s", ts, m.GetContent())
+	default:
+		return fmt.Sprintf("[%s] %s: %s", ts, m.GetSender(), m.GetContent())
+	}
+}
+
+func main() {
+	config.MustLoad(&cfg)
+	client, err := message.NewMessageSrvClient(
+		cfg.Addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		log.Fatalf("did not start client: %v\n", err)
+	}
+	defer client.Close()
+
+	session, err := client.JoinRoom(context.Background(), cfg.Room, cfg.Name, 16)
+	if err != nil {
+		log.Fatalf("failed to join room %s: %v\n", cfg.Room, err)
+	}
+	fmt.Printf("joined room %s, type messages and press enter, ctrl+d to leave\n", cfg.Room)
+
+	// 标准输入的每一行作为一条聊天消息，输入结束（ctrl+d）后取消会话离开聊天室；只关闭发送时仍然会接收消息
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				if err := session.Send(&message.Message{Content: line}); err != nil {
+					return
+				}
+			}
+		}
+		session.Cancel()
+	}()
+
+	for m := range session.Recv() {
+		fmt.Println(format(m))
+	}
+	if err := session.Wait(); err != nil && status.Code(err) != codes.Canceled {
+		log.Fatalf("left room %s: %v\n", cfg.Room, err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"goexamples/bootstrap"
+	"goexamples/config"
+	"goexamples/features/proto/message"
+	"log"
+	"net"
+)
+
+type Config struct {
+	config.Server
+	Buffer     int  `config:"buffer" usage:"buffered messages per subscriber"`
+	Disconnect bool `config:"disconnect" usage:"disconnect slow subscribers instead of dropping their messages"`
+}
+
+func (c Config) Validate() error {
+	if c.Buffer <= 0 {
+		return errors.Join(c.Server.Validate(), fmt.Errorf("buffer %d should be positive", c.Buffer))
+	}
+	return c.Server.Validate()
+}
+
+var cfg = Config{Server: config.DefaultServer, Buffer: message.DefaultRoomBuffer}
+
+func main() {
+	config.MustLoad(&cfg)
+	policy := message.DropSlow
+	if cfg.Disconnect {
+		policy = message.DisconnectSlow
+	}
+	server := message.NewMessageSrvServer(
+		bootstrap.WithChannelz(cfg.Mode),
+		bootstrap.WithReflection(cfg.Mode),
+		bootstrap.WithTCP(cfg.Port),
+		bootstrap.OnListen(func(lis net.Listener) {
+			log.Printf("server listening at %v\n", lis.Addr())
+		}),
+	)
+	server.SetRooms(message.NewRooms(cfg.Buffer, policy))
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalf("failed to listen: %v\n", err)
+	}
+}
@@ -0,0 +1,359 @@
+package cors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+// DefaultMaxAge 是预检请求结果的默认缓存时间。
+const DefaultMaxAge = 10 * time.Minute
+
+var (
+	// DefaultMethods 是默认允许的方法。
+	DefaultMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	// DefaultHeaders 是默认允许的请求头，包括网关和 gRPC-Web 使用的请求头。
+	DefaultHeaders = []string{"Accept", "Accept-Language", "Authorization", "Content-Language", "Content-Type", "Grpc-Timeout", "X-Grpc-Web", "X-User-Agent"}
+)
+
+// compile 编译来源的匹配规则：
+//
+//	*: 任意来源
+//	以 ^ 开头: 正则表达式，必须匹配整个来源（没有 $ 时同样锚定结尾），例如 ^https://(app|admin)\.example\.com$
+//	包含一个 *: 通配子域名，例如 https://*.example.com 匹配 https://a.example.com、https://a.b.example.com，不匹配 https://example.com
+//	其他: 完整的来源，例如 https://app.example.com:8443，不区分大小写
+func compile(pattern string) (func(string) bool, error) {
+	switch {
+	case pattern == "*":
+		return func(string) bool { return true }, nil
+	case strings.HasPrefix(pattern, "^"):
+		// 锚定结尾，否则 ^https://app\.example\.com 也会匹配 https://app.example.com.evil.io
+		re, err := regexp.Compile(`^(?:` + pattern[1:] + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid origin %q: %w", pattern, err)
+		}
+		return re.MatchString, nil
+	case strings.Contains(pattern, "*"):
+		prefix, suffix, _ := strings.Cut(strings.ToLower(pattern), "*")
+		if strings.Contains(suffix, "*") || !strings.HasSuffix(prefix, "://") || !strings.HasPrefix(suffix, ".") {
+			return nil, fmt.Errorf("invalid origin %q, wildcard should be like https://*.example.com", pattern)
+		}
+		return func(origin string) bool {
+			origin = strings.ToLower(origin)
+			if len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+				return false
+			}
+			// 通配的部分只能是域名
+			return !strings.ContainsAny(origin[len(prefix):len(origin)-len(suffix)], "/:@")
+		}, nil
+	}
+	return func(origin string) bool { return strings.EqualFold(origin, pattern) }, nil
+}
+
+// errAnyWithCredentials：允许任意来源的同时允许凭据，任何网站都可以带着用户的 cookie 调用接口并读取响应。
+var errAnyWithCredentials = errors.New("origin * cannot be used with credentials")
+
+// ValidateOrigins 检查来源的匹配规则，credentials 为是否使用 WithCredentials，可以在 config 的 Validate 中使用。
+func ValidateOrigins(patterns []string, credentials bool) error {
+	var errs []error
+	for _, p := range patterns {
+		if _, err := compile(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if credentials && slices.Contains(patterns, "*") {
+		errs = append(errs, errAnyWithCredentials)
+	}
+	return errors.Join(errs...)
+}
+
+type Option func(*CORS)
+
+// WithOrigins 添加允许的来源，规则见 compile，不合法的规则会导致 panic，需要先通过 ValidateOrigins 检查。
+func WithOrigins(patterns ...string) Option {
+	return func(c *CORS) {
+		for _, p := range patterns {
+			match, err := compile(p)
+			if err != nil {
+				panic(fmt.Sprintf("cors: %v", err))
+			}
+			c.origins = append(c.origins, match)
+			c.any = c.any || p == "*"
+		}
+	}
+}
+
+// WithOriginFunc 添加判断来源的函数，与 WithOrigins 中的规则任意一个匹配即允许。
+func WithOriginFunc(f func(origin string) bool) Option {
+	return func(c *CORS) {
+		c.origins = append(c.origins, f)
+	}
+}
+
+// WithMethods 设置允许的方法，默认为 DefaultMethods。
+func WithMethods(methods ...string) Option {
+	return func(c *CORS) {
+		c.methods = methods
+	}
+}
+
+// WithHeaders 设置允许的请求头，默认为 DefaultHeaders；* 表示允许预检请求中的所有请求头。
+func WithHeaders(headers ...string) Option {
+	return func(c *CORS) {
+		c.headers = headers
+	}
+}
+
+// WithExposedHeaders 添加浏览器可以读取的响应头，网关转换的 header 元数据（Grpc-Metadata-*）总是可以读取。
+func WithExposedHeaders(headers ...string) Option {
+	return func(c *CORS) {
+		c.exposed = append(c.exposed, headers...)
+	}
+}
+
+// WithMetadata 允许浏览器发送这些 gRPC 元数据：网关的 Grpc-Metadata-<key> 请求头和 gRPC-Web 直接发送的 <key> 请求头。
+func WithMetadata(keys ...string) Option {
+	return func(c *CORS) {
+		for _, k := range keys {
+			c.metadata = append(c.metadata, runtime.MetadataHeaderPrefix+k, k)
+		}
+	}
+}
+
+// WithCredentials 允许请求携带 cookie 等凭据，不能和任意来源 * 一起使用。
+func WithCredentials() Option {
+	return func(c *CORS) {
+		c.credentials = true
+	}
+}
+
+// WithMaxAge 设置预检请求结果的缓存时间，小于等于 0 时不设置，默认为 DefaultMaxAge。
+func WithMaxAge(d time.Duration) Option {
+	return func(c *CORS) {
+		c.maxAge = d
+	}
+}
+
+// CORS 处理跨域请求，Access-Control-Allow-Origin 总是回复请求的来源而不是 *。
+//
+//   - 预检请求由 CORS 直接回复，不会到达网关和 gRPC 服务端；来源、方法或请求头不允许时返回 403。
+//   - 允许的来源的其他请求添加 Access-Control-Allow-Origin 等响应头后继续处理，其他来源的请求不做修改，由浏览器拦截，
+//     同源的请求不受影响。
+//   - 响应中的 header 元数据（Grpc-Metadata-*）和 WithExposedHeaders 设置的响应头加入 Access-Control-Expose-Headers。
+//
+// Handler 包装整个 ServerMux，ServeMuxOptions 只作用于网关。
+type CORS struct {
+	origins     []func(string) bool
+	methods     []string
+	headers     []string
+	metadata    []string // Grpc-Metadata-<key> 和 <key> 请求头
+	exposed     []string
+	credentials bool
+	maxAge      time.Duration
+	any         bool // 是否允许任意来源
+}
+
+// AllowOrigin 判断是否允许来源，可以传给 grpcweb.WithOriginFunc 等其他处理跨域的组件，使它们使用相同的规则。
+func (c *CORS) AllowOrigin(origin string) bool {
+	for _, match := range c.origins {
+		if match(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+func (c *CORS) preflight(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	origin, method := r.Header.Get("Origin"), r.Header.Get("Access-Control-Request-Method")
+	if !c.AllowOrigin(origin) {
+		http.Error(w, fmt.Sprintf("cors: origin %s not allowed", origin), http.StatusForbidden)
+		return
+	}
+	if !slices.Contains(c.methods, method) {
+		http.Error(w, fmt.Sprintf("cors: method %s not allowed", method), http.StatusForbidden)
+		return
+	}
+	var headers []string
+	for _, v := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		if !c.allowHeader(v) {
+			http.Error(w, fmt.Sprintf("cors: header %s not allowed", v), http.StatusForbidden)
+			return
+		}
+		headers = append(headers, strings.ToLower(v))
+	}
+
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Set("Access-Control-Allow-Methods", strings.Join(c.methods, ", "))
+	if len(headers) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+	if c.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if c.maxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.maxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *CORS) allowHeader(name string) bool {
+	if slices.Contains(c.headers, "*") {
+		return true
+	}
+	equal := func(h string) bool { return strings.EqualFold(h, name) }
+	return slices.ContainsFunc(c.headers, equal) || slices.ContainsFunc(c.metadata, equal)
+}
+
+// allow 为允许的来源设置响应头，返回是否允许。
+func (c *CORS) allow(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	w.Header().Add("Vary", "Origin")
+	if !c.AllowOrigin(origin) {
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if c.credentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+// serve 处理预检请求，或者设置响应头后调用 next。
+func (c *CORS) serve(w http.ResponseWriter, r *http.Request, next func(http.ResponseWriter)) {
+	if isPreflight(r) {
+		c.preflight(w, r)
+		return
+	}
+	if !c.allow(w, r) {
+		next(w)
+		return
+	}
+	next(&exposeWriter{ResponseWriter: w, exposed: c.exposed})
+}
+
+// Handler 包装 ServerMux 等 http.Handler，处理所有路径的跨域请求。
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.serve(w, r, func(w http.ResponseWriter) { next.ServeHTTP(w, r) })
+	})
+}
+
+// Middleware 实现 runtime.Middleware，只作用于匹配到路由的请求，预检请求需要 ServeMuxOptions 中的路由错误处理。
+func (c *CORS) Middleware(next runtime.HandlerFunc) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		c.serve(w, r, func(w http.ResponseWriter) { next(w, r, pathParams) })
+	}
+}
+
+// routingErrorHandler 处理网关没有匹配到路由的请求：预检请求的 OPTIONS 方法没有注册，网关返回 405 之前在这里回复；
+// 其他路由错误添加跨域响应头，使浏览器可以读取 404 等错误。
+func (c *CORS) routingErrorHandler(ctx context.Context, mux *runtime.ServeMux, m runtime.Marshaler, w http.ResponseWriter, r *http.Request, httpStatus int) {
+	if httpStatus == http.StatusMethodNotAllowed && isPreflight(r) {
+		c.preflight(w, r)
+		return
+	}
+	if c.allow(w, r) {
+		w = &exposeWriter{ResponseWriter: w, exposed: c.exposed}
+	}
+	runtime.DefaultRoutingErrorHandler(ctx, mux, m, w, r, httpStatus)
+}
+
+// ServeMuxOptions 返回在网关上处理跨域请求的选项，会替换网关的路由错误处理，需要在创建网关时传入。
+func (c *CORS) ServeMuxOptions() []runtime.ServeMuxOption {
+	return []runtime.ServeMuxOption{
+		runtime.WithMiddlewares(c.Middleware),
+		runtime.WithRoutingErrorHandler(c.routingErrorHandler),
+	}
+}
+
+// exposeWriter 在写出响应头时设置 Access-Control-Expose-Headers，合并已经设置的值（比如 gRPC-Web 的响应头）。
+type exposeWriter struct {
+	http.ResponseWriter
+	exposed     []string
+	wroteHeader bool
+}
+
+func (ew *exposeWriter) WriteHeader(code int) {
+	if !ew.wroteHeader {
+		ew.wroteHeader = true
+		h := ew.Header()
+		exposed := slices.Clone(ew.exposed)
+		for _, v := range strings.Split(h.Get("Access-Control-Expose-Headers"), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				exposed = append(exposed, v)
+			}
+		}
+		for k := range h {
+			if strings.HasPrefix(k, runtime.MetadataHeaderPrefix) {
+				exposed = append(exposed, k)
+			}
+		}
+		for i, v := range exposed {
+			exposed[i] = strings.ToLower(v)
+		}
+		slices.Sort(exposed)
+		if exposed = slices.Compact(exposed); len(exposed) > 0 {
+			h.Set("Access-Control-Expose-Headers", strings.Join(exposed, ", "))
+		}
+	}
+	ew.ResponseWriter.WriteHeader(code)
+}
+
+func (ew *exposeWriter) Write(b []byte) (int, error) {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	return ew.ResponseWriter.Write(b)
+}
+
+// Flush 让 gRPC-Web 和网关的服务端流可以逐条发送消息。
+func (ew *exposeWriter) Flush() {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(ew.ResponseWriter).Flush()
+}
+
+// Unwrap 让 http.ResponseController 可以访问底层的 ResponseWriter，比如 WebSocket 接管连接。
+func (ew *exposeWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// NewCORS 默认不允许任何来源，使用 DefaultMethods、DefaultHeaders 和 DefaultMaxAge。
+// 同时允许任意来源和凭据时 panic，需要先通过 ValidateOrigins 检查。
+func NewCORS(opts ...Option) *CORS {
+	c := &CORS{
+		methods: DefaultMethods,
+		headers: DefaultHeaders,
+		maxAge:  DefaultMaxAge,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.any && c.credentials {
+		panic(fmt.Sprintf("cors: %v", errAnyWithCredentials))
+	}
+	return c
+}
@@ -0,0 +1,189 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+func TestOrigins(t *testing.T) {
+	c := NewCORS(WithOrigins("https://app.example.com", "https://*.example.net", `^https://(web|admin)\.example\.org(:\d+)?$`, `^https://api\.example\.io`))
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"https://APP.example.com", true},
+		{"https://app.example.com:8443", false},
+		{"http://app.example.com", false},
+		{"https://a.example.net", true},
+		{"https://a.b.example.net", true},
+		{"https://example.net", false},
+		{"https://a.example.net.evil.com", false},
+		{"https://evil.com/.example.net", false},
+		{"https://admin.example.org:8443", true},
+		{"https://api.example.org", false},
+		// 正则表达式没有 $ 时同样匹配整个来源
+		{"https://api.example.io", true},
+		{"https://api.example.io.evil.com", false},
+		{"https://admin.example.org.evil.com", false},
+	}
+	for _, tt := range tests {
+		if got := c.AllowOrigin(tt.origin); got != tt.want {
+			t.Errorf("AllowOrigin(%s) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+
+	if err := ValidateOrigins([]string{"*", "https://*.example.com", "^https://.*$"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateOrigins([]string{"https://*.example.com"}, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"*.example.com", "https://*.*.example.com", "https://a*.example.com", "^(https"} {
+		if ValidateOrigins([]string{p}, false) == nil {
+			t.Errorf("ValidateOrigins(%s) should fail", p)
+		}
+	}
+	if ValidateOrigins([]string{"*"}, true) == nil {
+		t.Error("ValidateOrigins(*) with credentials should fail")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("NewCORS with * and credentials should panic")
+		}
+	}()
+	NewCORS(WithOrigins("*"), WithCredentials())
+}
+
+func request(method, url, origin string, header ...string) *http.Request {
+	r := httptest.NewRequest(method, url, nil)
+	r.Header.Set("Origin", origin)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	return r
+}
+
+func TestHandler(t *testing.T) {
+	called := 0
+	h := NewCORS(
+		WithOrigins("https://*.example.com"),
+		WithMetadata("tenant"),
+		WithExposedHeaders("X-Total-Count"),
+		WithCredentials(),
+	).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called++
+		w.Header().Set(runtime.MetadataHeaderPrefix+"Request-Id", "1")
+		w.Write([]byte("ok"))
+	}))
+
+	tests := []struct {
+		name    string
+		req     *http.Request
+		want    int
+		headers map[string]string
+		called  bool
+	}{
+		{
+			name: "preflight",
+			req: request(http.MethodOptions, "/api/v1/users", "https://app.example.com",
+				"Access-Control-Request-Method", http.MethodPost,
+				"Access-Control-Request-Headers", "Content-Type, Grpc-Metadata-Tenant"),
+			want: http.StatusNoContent,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Headers":     "content-type, grpc-metadata-tenant",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+			},
+		},
+		{
+			name: "preflight origin",
+			req: request(http.MethodOptions, "/api/v1/users", "https://evil.com",
+				"Access-Control-Request-Method", http.MethodGet),
+			want:    http.StatusForbidden,
+			headers: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name: "preflight method",
+			req: request(http.MethodOptions, "/api/v1/users", "https://app.example.com",
+				"Access-Control-Request-Method", http.MethodConnect),
+			want: http.StatusForbidden,
+		},
+		{
+			name: "preflight header",
+			req: request(http.MethodOptions, "/api/v1/users", "https://app.example.com",
+				"Access-Control-Request-Method", http.MethodGet,
+				"Access-Control-Request-Headers", "X-Secret"),
+			want: http.StatusForbidden,
+		},
+		{
+			name: "request",
+			req:  request(http.MethodGet, "/api/v1/users", "https://app.example.com"),
+			want: http.StatusOK,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":   "https://app.example.com",
+				"Access-Control-Expose-Headers": "grpc-metadata-request-id, x-total-count",
+				"Vary":                          "Origin",
+			},
+			called: true,
+		},
+		{
+			name:    "request origin",
+			req:     request(http.MethodGet, "/api/v1/users", "https://evil.com"),
+			want:    http.StatusOK,
+			headers: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Expose-Headers": ""},
+			called:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = 0
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, tt.req)
+			if w.Code != tt.want || (called > 0) != tt.called {
+				t.Fatalf("got %d, called %d times, want %d", w.Code, called, tt.want)
+			}
+			for k, v := range tt.headers {
+				if got := w.Header().Get(k); got != v {
+					t.Errorf("%s = %q, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
+
+func TestServeMuxOptions(t *testing.T) {
+	called := false
+	mux := runtime.NewServeMux(NewCORS(WithOrigins("http://localhost:3000")).ServeMuxOptions()...)
+	mux.HandlePath(http.MethodGet, "/v1/users/{id}", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		called = true
+		w.Header().Set(runtime.MetadataHeaderPrefix+"Request-Id", "1")
+		w.Write([]byte("{}"))
+	})
+
+	// 网关没有注册 OPTIONS 方法，预检请求由路由错误处理回复
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, request(http.MethodOptions, "/v1/users/1", "http://localhost:3000", "Access-Control-Request-Method", http.MethodGet))
+	if w.Code != http.StatusNoContent || called {
+		t.Fatalf("preflight = %d, called %v", w.Code, called)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, request(http.MethodGet, "/v1/users/1", "http://localhost:3000"))
+	if !called || w.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" ||
+		!strings.Contains(w.Header().Get("Access-Control-Expose-Headers"), "grpc-metadata-request-id") {
+		t.Fatalf("response headers = %v", w.Header())
+	}
+
+	// 路由错误同样带有跨域响应头，浏览器可以读取错误
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, request(http.MethodGet, "/v1/missing", "http://localhost:3000"))
+	if w.Code != http.StatusNotFound || w.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" {
+		t.Fatalf("not found = %d %v", w.Code, w.Header())
+	}
+}
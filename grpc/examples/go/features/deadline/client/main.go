@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"goexamples/config"
+	"goexamples/features/deadline"
+	"goexamples/features/proto/message"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type Config struct {
+	config.Client
+	Timeout time.Duration `config:"timeout" usage:"default timeout of rpc without deadline"`
+}
+
+var cfg = Config{Client: config.DefaultClient, Timeout: 2 * time.Second}
+
+func main() {
+	config.MustLoad(&cfg)
+	d := deadline.NewDeadline(deadline.WithDefault(cfg.Timeout))
+	client, err := message.NewMessageSrvClient(
+		cfg.Addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(d.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(d.StreamClientInterceptor()),
+	)
+	if err != nil {
+		log.Fatalf("did not start client: %v\n", err)
+	}
+	defer client.Close()
+
+	func() {
+		// 未设置截止时间，由客户端拦截器补充默认超时时间
+		m := "hello world"
+		log.Printf("main.client.Unary send message without deadline: %s\n", m)
+		if out, err := client.Unary(context.Background(), &message.Message{Content: m}); err != nil {
+			log.Fatalf("main.client.Unary failed: %v\n", err)
+		} else {
+			log.Printf("main.client.Unary response: %v\n", out.GetContent())
+		}
+	}()
+
+	func() {
+		// 已设置截止时间，拦截器不做修改，服务端看到的剩余时间与客户端一致
+		m := "hello world"
+		fmt.Println()
+		log.Printf("main.client.Unary send message with 500ms timeout: %s\n", m)
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		if out, err := client.Unary(ctx, &message.Message{Content: m}); err != nil {
+			log.Fatalf("main.client.Unary failed: %v\n", err)
+		} else {
+			log.Printf("main.client.Unary response: %v\n", out.GetContent())
+		}
+	}()
+
+	func() {
+		mc := []*message.Message{{Content: "server stream message 1"}, {Content: "server stream message 2"}, {Content: "server stream message 3"}}
+		fmt.Println()
+		log.Println("main.client.ServerStream send message with expired deadline")
+
+		// 截止时间已过，调用立即以 DeadlineExceeded 结束
+		ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+		defer cancel()
+		if out, err := client.ServerStream(ctx, mc); err != nil {
+			log.Printf("main.client.ServerStream failed: %v\n", err)
+		} else {
+			for _, m := range out {
+				log.Printf("main.client.ServerStream response: %v\n", m.GetContent())
+			}
+		}
+	}()
+}
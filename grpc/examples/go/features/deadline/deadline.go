@@ -0,0 +1,193 @@
+package deadline
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Deadline 为没有设置截止时间的 rpc 调用补充默认的超时时间，并限制截止时间的最大值。
+//
+// 客户端通过 context.WithTimeout / context.WithDeadline 设置截止时间，grpc 会将剩余时间通过 grpc-timeout 头传给服务端，
+// 服务端的 ctx.Deadline() 与客户端保持一致；经过 grpc-gateway 转发时，http 请求头 Grpc-Timeout 会被转换为截止时间。
+// 如果客户端没有设置截止时间，服务端的上下文永远不会超时，客户端离开后业务方法仍可能继续执行。
+type Deadline struct {
+	def       time.Duration
+	max       time.Duration
+	methods   map[string]time.Duration
+	streamDef *time.Duration
+}
+
+type Option func(*Deadline)
+
+// WithDefault 设置未单独配置的方法的默认超时时间，0 表示不补充。
+func WithDefault(timeout time.Duration) Option {
+	return func(d *Deadline) {
+		d.def = timeout
+	}
+}
+
+// WithMax 设置截止时间的最大值，剩余时间超过该值时会被截断，0 表示不限制。
+func WithMax(timeout time.Duration) Option {
+	return func(d *Deadline) {
+		d.max = timeout
+	}
+}
+
+// WithMethod 为某个方法单独设置默认超时时间，method 为完整的方法名称，格式：/package.Service/Method
+func WithMethod(method string, timeout time.Duration) Option {
+	return func(d *Deadline) {
+		d.methods[method] = timeout
+	}
+}
+
+// WithStreamDefault 为流式方法设置默认超时时间，0 表示不补充，WithMethod 单独设置的方法除外。
+// 比如服务端推送的流需要一直保持到客户端离开，流的截止时间完全由客户端决定。
+func WithStreamDefault(timeout time.Duration) Option {
+	return func(d *Deadline) {
+		d.streamDef = &timeout
+	}
+}
+
+type noDefaultKey struct{}
+
+// WithoutDefault 标记上下文不需要补充默认超时时间，最大超时时间仍然对已有的截止时间生效。
+// 比如网关中浏览器的 EventSource 无法设置 Grpc-Timeout 请求头，SSE 的流需要保持到浏览器离开。
+func WithoutDefault(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noDefaultKey{}, true)
+}
+
+func (d *Deadline) timeout(ctx context.Context, method string, stream bool) time.Duration {
+	if skip, _ := ctx.Value(noDefaultKey{}).(bool); skip {
+		return 0
+	}
+	if t, ok := d.methods[method]; ok {
+		return t
+	}
+	if stream && d.streamDef != nil {
+		return *d.streamDef
+	}
+	return d.def
+}
+
+// Apply 返回应用了默认超时时间和最大超时时间后的上下文，调用方需要在调用结束后执行 cancel。
+func (d *Deadline) Apply(ctx context.Context, method string) (context.Context, context.CancelFunc) {
+	return d.apply(ctx, method, false)
+}
+
+func (d *Deadline) apply(ctx context.Context, method string, stream bool) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		if t := d.timeout(ctx, method, stream); t > 0 {
+			if d.max > 0 {
+				t = min(t, d.max)
+			}
+			return context.WithTimeout(ctx, t)
+		}
+	} else if d.max > 0 && time.Until(deadline) > d.max {
+		return context.WithTimeout(ctx, d.max)
+	}
+	return ctx, func() {}
+}
+
+func (d *Deadline) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, cancel := d.Apply(ctx, info.FullMethod)
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor 通过替换 ServerStream.Context() 传递新的截止时间。
+// 底层流的 RecvMsg / SendMsg 只感知客户端传来的截止时间，补充或者截断了截止时间时，
+// 包装后的 RecvMsg / SendMsg 在截止时间到达后立即返回 codes.DeadlineExceeded，阻塞在 Recv 上的业务方法也能结束。
+func (d *Deadline) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel := d.apply(ss.Context(), info.FullMethod, true)
+		defer cancel()
+		if ctx == ss.Context() {
+			return handler(srv, ss)
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) RecvMsg(m any) error {
+	return s.wait(func() error { return s.ServerStream.RecvMsg(m) })
+}
+
+func (s *serverStream) SendMsg(m any) error {
+	return s.wait(func() error { return s.ServerStream.SendMsg(m) })
+}
+
+// wait 在新的协程中执行 f，截止时间到达时不再等待。此时 f 仍阻塞在底层的流上，直到业务方法返回、grpc 结束整个流，
+// 之后的调用直接返回错误，不会与它并发；超时的 RecvMsg 仍可能写入 m，业务方法不能再使用 m。
+func (s *serverStream) wait(f func() error) error {
+	if err := s.ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-s.ctx.Done():
+		return status.FromContextError(s.ctx.Err()).Err()
+	}
+}
+
+func (d *Deadline) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, cancel := d.Apply(ctx, method)
+		defer cancel()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor 为流补充默认超时时间，流结束（RecvMsg 返回错误或者非服务端流收到唯一的响应）时释放上下文。
+func (d *Deadline) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, cancel := d.apply(ctx, method, true)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		return &clientStream{ClientStream: cs, desc: desc, cancel: cancel}, nil
+	}
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	desc   *grpc.StreamDesc
+	cancel context.CancelFunc
+}
+
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil || !s.desc.ServerStreams {
+		s.cancel()
+	}
+	return err
+}
+
+func NewDeadline(opts ...Option) *Deadline {
+	d := &Deadline{methods: map[string]time.Duration{}}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
@@ -0,0 +1,98 @@
+package deadline
+
+import (
+	"context"
+	"goexamples/bootstrap"
+	"goexamples/features/proto/message"
+	"goexamples/harness"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func remaining(t *testing.T, ctx context.Context) time.Duration {
+	t.Helper()
+	d, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	return time.Until(d)
+}
+
+func TestApply(t *testing.T) {
+	const method = "/message.MessageService/Unary"
+	tests := []struct {
+		name    string
+		opts    []Option
+		timeout time.Duration // 调用方设置的超时时间，0 表示未设置
+		stream  bool
+		skip    bool          // 上下文通过 WithoutDefault 标记
+		want    time.Duration // 期望的剩余时间，0 表示没有截止时间
+	}{
+		{name: "no default", want: 0},
+		{name: "default", opts: []Option{WithDefault(time.Second)}, want: time.Second},
+		{name: "method default", opts: []Option{WithDefault(time.Second), WithMethod(method, 3*time.Second)}, want: 3 * time.Second},
+		{name: "default capped", opts: []Option{WithDefault(5 * time.Second), WithMax(2 * time.Second)}, want: 2 * time.Second},
+		{name: "keep caller", opts: []Option{WithDefault(5 * time.Second)}, timeout: time.Second, want: time.Second},
+		{name: "cap caller", opts: []Option{WithMax(2 * time.Second)}, timeout: time.Minute, want: 2 * time.Second},
+		{name: "keep shorter caller", opts: []Option{WithMax(2 * time.Second)}, timeout: time.Second, want: time.Second},
+		{name: "stream default", opts: []Option{WithDefault(time.Second), WithStreamDefault(0)}, stream: true, want: 0},
+		{name: "stream method default", opts: []Option{WithStreamDefault(0), WithMethod(method, time.Second)}, stream: true, want: time.Second},
+		{name: "unary ignores stream default", opts: []Option{WithDefault(time.Second), WithStreamDefault(0)}, want: time.Second},
+		{name: "without default", opts: []Option{WithDefault(time.Second), WithMax(2 * time.Second)}, skip: true, want: 0},
+		{name: "without default caps caller", opts: []Option{WithMax(2 * time.Second)}, timeout: time.Minute, skip: true, want: 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			if tt.skip {
+				ctx = WithoutDefault(ctx)
+			}
+			ctx, cancel := NewDeadline(tt.opts...).apply(ctx, method, tt.stream)
+			defer cancel()
+
+			got := remaining(t, ctx)
+			if tt.want == 0 {
+				if got != 0 {
+					t.Fatalf("want no deadline, got %v", got)
+				}
+				return
+			}
+			if got > tt.want || got < tt.want-100*time.Millisecond {
+				t.Fatalf("want remaining %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// 客户端打开双向流后不发送任何消息，服务端阻塞在 Recv 上，截止时间到达后流以 DeadlineExceeded 结束
+func TestStreamServerInterceptorRecv(t *testing.T) {
+	d := NewDeadline(WithDefault(100 * time.Millisecond))
+	conn := harness.New(t, harness.WithStreamInterceptors(d.StreamServerInterceptor())).Start(func(opts ...grpc.ServerOption) harness.Server {
+		return message.NewMessageSrvServer(bootstrap.WithServerOptions(opts...))
+	})
+
+	// 客户端不设置截止时间，由服务端补充；5 秒后取消只用于防止测试卡住
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(5*time.Second, cancel)
+	stream, err := message.NewMessageServiceClient(conn).BidirectionalStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := stream.Recv(); status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("want DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("stream ended after %v, want about 100ms", elapsed)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goexamples/bootstrap"
+	"goexamples/config"
+	"goexamples/features/deadline"
+	"goexamples/features/proto/message"
+	"log"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func logDeadline(ctx context.Context, method string) {
+	if d, ok := ctx.Deadline(); ok {
+		log.Printf("server %s deadline: %v, remaining %v\n", method, d.Format(time.RFC3339Nano), time.Until(d).Round(time.Millisecond))
+	} else {
+		log.Printf("server %s has no deadline\n", method)
+	}
+}
+
+func unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	logDeadline(ctx, info.FullMethod)
+	return handler(ctx, req)
+}
+
+func streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	logDeadline(ss.Context(), info.FullMethod)
+	return handler(srv, ss)
+}
+
+type Config struct {
+	config.Server
+	Timeout time.Duration `config:"timeout" usage:"default timeout of rpc without deadline"`
+	Max     time.Duration `config:"max" usage:"max timeout of rpc"`
+}
+
+func (c Config) Validate() error {
+	if c.Timeout <= 0 || c.Max < c.Timeout {
+		return errors.Join(c.Server.Validate(), fmt.Errorf("timeout %v should be positive and not greater than max %v", c.Timeout, c.Max))
+	}
+	return c.Server.Validate()
+}
+
+var cfg = Config{Server: config.DefaultServer, Timeout: 5 * time.Second, Max: 10 * time.Second}
+
+func main() {
+	config.MustLoad(&cfg)
+	d := deadline.NewDeadline(
+		deadline.WithDefault(cfg.Timeout),
+		deadline.WithMax(cfg.Max),
+		deadline.WithMethod(message.MessageService_BidirectionalStream_FullMethodName, 2*cfg.Timeout),
+	)
+	server := message.NewMessageSrvServer(
+		// deadline 拦截器先执行，后续拦截器和业务方法看到的都是调整后的截止时间
+		bootstrap.WithUnaryInterceptors(d.UnaryServerInterceptor(), unaryInterceptor),
+		bootstrap.WithStreamInterceptors(d.StreamServerInterceptor(), streamInterceptor),
+		bootstrap.WithChannelz(cfg.Mode),
+		bootstrap.WithReflection(cfg.Mode),
+		bootstrap.WithTCP(cfg.Port),
+		bootstrap.OnListen(func(lis net.Listener) {
+			log.Printf("server listening at %v\n", lis.Addr())
+		}),
+	)
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalf("failed to listen: %v\n", err)
+	}
+}
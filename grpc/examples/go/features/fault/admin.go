@@ -0,0 +1,87 @@
+package fault
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+// DefaultPath 是管理接口默认挂载的路径。
+const DefaultPath = "/debug/faults"
+
+// 规则请求体的最大长度。
+const maxBody = 1 << 20
+
+// ServeHTTP 是规则的管理接口：GET 返回当前规则，PUT 使用请求体中的 JSON 数组替换全部规则，DELETE 清空规则。
+// 不在 dev 模式下时返回 404。
+func (i *Injector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !i.enabled {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var rules []Rule
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rules); err != nil {
+			http.Error(w, "invalid rules: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := i.SetRules(rules); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		i.SetRules(nil)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	rules := i.Rules()
+	if rules == nil {
+		rules = []Rule{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(rules)
+}
+
+// HandleGateway 在 dev 模式下将管理接口挂载到网关的 DefaultPath，与网关共用端口和中间件。
+// 管理接口没有认证，可以注入延迟和错误，只应在运维人员明确开启时挂载到对外的网关上。
+func (i *Injector) HandleGateway(mux *runtime.ServeMux) error {
+	if !i.enabled {
+		return nil
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		err := mux.HandlePath(method, DefaultPath, func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+			i.ServeHTTP(w, r)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsAdmin 判断请求是否访问管理接口，可以作为 ServerMux 的匹配条件。
+func IsAdmin(r *http.Request) bool {
+	return r.URL.Path == DefaultPath
+}
+
+// ListenAndServe 在单独的端口上提供管理接口，用于没有网关的 gRPC 服务端。
+// 管理接口没有认证，只监听 127.0.0.1；port 为 0 或者不在 dev 模式下时不开放，直接返回。
+func (i *Injector) ListenAndServe(port int) error {
+	if !i.enabled || port == 0 {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle(DefaultPath, i)
+	return http.ListenAndServe(fmt.Sprintf("127.0.0.1:%d", port), mux)
+}
@@ -0,0 +1,352 @@
+package fault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ErrDisabled 表示不在 dev 模式下，不能修改故障规则。
+var ErrDisabled = errors.New("fault: injection is disabled outside dev mode")
+
+// Duration 在 JSON 中以 time.Duration 的字符串形式保存，例如 "100ms"。
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	*d = Duration(v)
+	return err
+}
+
+// Code 在 JSON 中以 google.rpc.Code 的名称保存，例如 "UNAVAILABLE"，也可以使用数字。
+type Code codes.Code
+
+func (c Code) MarshalJSON() ([]byte, error) {
+	return json.Marshal(code.Code(c).String())
+}
+
+func (c *Code) UnmarshalJSON(b []byte) error {
+	return (*codes.Code)(c).UnmarshalJSON(b)
+}
+
+// Rule 是一条故障规则，Method 和 Metadata 选择生效的调用，其余字段描述注入的故障，可以同时注入多种故障。
+//
+//	Method: 完整的方法名，以 * 结尾时按前缀匹配（例如 /PoemService/*），为空时匹配所有方法
+//	Metadata: 请求元数据中每个键都有一个值与之相同时才生效，例如 {"x-fault": "slow"}
+//	Delay、Jitter: 调用开始前等待 Delay 加上 [0, Jitter) 中的随机时间
+//	ErrorRate: 以该概率直接返回 Code 错误，不调用业务方法，Code 为空时使用 UNAVAILABLE
+//	AbortAfter: 流式调用收发的消息数达到该值后中断流，返回 Code 错误，Code 为空时使用 ABORTED
+//	DropHeader、DropTrailer: 丢弃业务方法设置的 header、trailer
+type Rule struct {
+	Method      string            `json:"method,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Delay       Duration          `json:"delay,omitempty"`
+	Jitter      Duration          `json:"jitter,omitempty"`
+	Code        Code              `json:"code,omitempty"`
+	ErrorRate   float64           `json:"error_rate,omitempty"`
+	AbortAfter  int               `json:"abort_after,omitempty"`
+	DropHeader  bool              `json:"drop_header,omitempty"`
+	DropTrailer bool              `json:"drop_trailer,omitempty"`
+}
+
+// Validate 检查规则的取值范围。
+func (r *Rule) Validate() error {
+	switch {
+	case r.Method != "" && !strings.HasPrefix(r.Method, "/"):
+		return fmt.Errorf("fault: method %q should be in the form /package.Service/Method", r.Method)
+	case r.Delay < 0 || r.Jitter < 0:
+		return fmt.Errorf("fault: negative delay %v, jitter %v", time.Duration(r.Delay), time.Duration(r.Jitter))
+	case r.ErrorRate < 0 || r.ErrorRate > 1:
+		return fmt.Errorf("fault: error rate %v is not in [0, 1]", r.ErrorRate)
+	case r.AbortAfter < 0:
+		return fmt.Errorf("fault: negative abort after %d", r.AbortAfter)
+	case codes.Code(r.Code) > codes.Unauthenticated:
+		return fmt.Errorf("fault: invalid code %d", r.Code)
+	}
+	return nil
+}
+
+func (r *Rule) match(method string, md metadata.MD) bool {
+	if prefix, ok := strings.CutSuffix(r.Method, "*"); ok {
+		if !strings.HasPrefix(method, prefix) {
+			return false
+		}
+	} else if r.Method != "" && r.Method != method {
+		return false
+	}
+	for k, v := range r.Metadata {
+		if !slices.Contains(md.Get(k), v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Rule) code(def codes.Code) codes.Code {
+	if r.Code == Code(codes.OK) {
+		return def
+	}
+	return codes.Code(r.Code)
+}
+
+// Injector 按规则为服务端注入故障，同时提供一元和流式服务端拦截器，规则可以在运行时修改。
+// 只有 dev 模式下才会生效，其他模式下拦截器直接调用业务方法，也不能修改规则。
+type Injector struct {
+	enabled bool
+	rand    func() float64
+
+	mu    sync.RWMutex
+	rules []Rule
+}
+
+// NewInjector 创建故障注入器，rules 为初始规则，按顺序使用第一条匹配的规则。
+func NewInjector(mode string, rules ...Rule) *Injector {
+	i := &Injector{enabled: mode == "dev", rand: rand.Float64}
+	if i.enabled {
+		if err := i.SetRules(rules); err != nil {
+			panic(err)
+		}
+	}
+	return i
+}
+
+func (i *Injector) Enabled() bool {
+	return i.enabled
+}
+
+// Rules 返回当前规则的副本。
+func (i *Injector) Rules() []Rule {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return slices.Clone(i.rules)
+}
+
+// SetRules 替换全部规则，任何一条规则无效时不做修改。
+func (i *Injector) SetRules(rules []Rule) error {
+	if !i.enabled {
+		return ErrDisabled
+	}
+	for idx := range rules {
+		if err := rules[idx].Validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", idx, err)
+		}
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.rules = slices.Clone(rules)
+	return nil
+}
+
+func (i *Injector) match(ctx context.Context, method string) *Rule {
+	if !i.enabled {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	for _, r := range i.rules {
+		if r.match(method, md) {
+			return &r
+		}
+	}
+	return nil
+}
+
+// inject 注入延迟和错误，返回的错误直接作为调用的结果。
+func (i *Injector) inject(ctx context.Context, r *Rule) error {
+	d := time.Duration(r.Delay)
+	if r.Jitter > 0 {
+		d += time.Duration(i.rand() * float64(r.Jitter))
+	}
+	if d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	if r.ErrorRate > 0 && i.rand() < r.ErrorRate {
+		return status.Errorf(r.code(codes.Unavailable), "fault: injected error")
+	}
+	return nil
+}
+
+// faultyTransportStream 丢弃业务方法通过 grpc.SetHeader、grpc.SendHeader、grpc.SetTrailer 设置的元数据。
+type faultyTransportStream struct {
+	grpc.ServerTransportStream
+	rule *Rule
+}
+
+func (s *faultyTransportStream) SetHeader(md metadata.MD) error {
+	if s.rule.DropHeader {
+		return nil
+	}
+	return s.ServerTransportStream.SetHeader(md)
+}
+
+func (s *faultyTransportStream) SendHeader(md metadata.MD) error {
+	if s.rule.DropHeader {
+		return nil
+	}
+	return s.ServerTransportStream.SendHeader(md)
+}
+
+func (s *faultyTransportStream) SetTrailer(md metadata.MD) error {
+	if s.rule.DropTrailer {
+		return nil
+	}
+	return s.ServerTransportStream.SetTrailer(md)
+}
+
+func withTransportStream(ctx context.Context, r *Rule) context.Context {
+	if !r.DropHeader && !r.DropTrailer {
+		return ctx
+	}
+	if sts := grpc.ServerTransportStreamFromContext(ctx); sts != nil {
+		return grpc.NewContextWithServerTransportStream(ctx, &faultyTransportStream{ServerTransportStream: sts, rule: r})
+	}
+	return ctx
+}
+
+func (i *Injector) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		r := i.match(ctx, info.FullMethod)
+		if r == nil {
+			return handler(ctx, req)
+		}
+		if err := i.inject(ctx, r); err != nil {
+			return nil, err
+		}
+		return handler(withTransportStream(ctx, r), req)
+	}
+}
+
+// faultyServerStream 丢弃 header、trailer，并在收发的消息数达到 AbortAfter 后中断流。
+type faultyServerStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	rule *Rule
+
+	// 聊天室等场景下收发消息在不同的 goroutine 中
+	mu       sync.Mutex
+	messages int
+	aborted  error
+}
+
+func (s *faultyServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *faultyServerStream) SetHeader(md metadata.MD) error {
+	if s.rule.DropHeader {
+		return nil
+	}
+	return s.ServerStream.SetHeader(md)
+}
+
+func (s *faultyServerStream) SendHeader(md metadata.MD) error {
+	if s.rule.DropHeader {
+		return nil
+	}
+	return s.ServerStream.SendHeader(md)
+}
+
+func (s *faultyServerStream) SetTrailer(md metadata.MD) {
+	if !s.rule.DropTrailer {
+		s.ServerStream.SetTrailer(md)
+	}
+}
+
+// abortErr 返回中断错误，流尚未中断时为 nil。
+func (s *faultyServerStream) abortErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.aborted
+}
+
+// count 记录一条消息，达到 AbortAfter 后之后的收发都返回中断错误。
+func (s *faultyServerStream) count() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.aborted != nil {
+		return s.aborted
+	}
+	if s.rule.AbortAfter > 0 && s.messages >= s.rule.AbortAfter {
+		s.aborted = status.Errorf(s.rule.code(codes.Aborted), "fault: stream aborted after %d messages", s.messages)
+		return s.aborted
+	}
+	s.messages++
+	return nil
+}
+
+func (s *faultyServerStream) SendMsg(m any) error {
+	if err := s.count(); err != nil {
+		return err
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// RecvMsg 只在成功接收消息后计数，流结束（io.EOF）和接收出错不计入 AbortAfter。
+func (s *faultyServerStream) RecvMsg(m any) error {
+	if err := s.abortErr(); err != nil {
+		return err
+	}
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.count()
+}
+
+func (i *Injector) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		r := i.match(ss.Context(), info.FullMethod)
+		if r == nil {
+			return handler(srv, ss)
+		}
+		if err := i.inject(ss.Context(), r); err != nil {
+			return err
+		}
+		fs := &faultyServerStream{ServerStream: ss, ctx: withTransportStream(ss.Context(), r), rule: r}
+		err := handler(srv, fs)
+		// 业务方法可能忽略了中断错误，或者返回了包装后的错误，以中断错误作为调用的结果
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		if fs.aborted != nil {
+			return fs.aborted
+		}
+		return err
+	}
+}
+
+// ServerOptions 返回注册拦截器的服务端配置，不在 dev 模式下时返回 nil。
+func (i *Injector) ServerOptions() []grpc.ServerOption {
+	if !i.enabled {
+		return nil
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(i.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(i.StreamServerInterceptor()),
+	}
+}
@@ -0,0 +1,293 @@
+package fault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"goexamples/bootstrap"
+	"goexamples/features/proto/message"
+	"goexamples/harness"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestRuleJSON(t *testing.T) {
+	var r Rule
+	in := `{"method": "/PoemService/*", "metadata": {"x-fault": "slow"}, "delay": "100ms", "jitter": "1s", "code": "RESOURCE_EXHAUSTED", "error_rate": 0.5, "abort_after": 3, "drop_trailer": true}`
+	if err := json.Unmarshal([]byte(in), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Delay != Duration(100*time.Millisecond) || r.Jitter != Duration(time.Second) || codes.Code(r.Code) != codes.ResourceExhausted {
+		t.Fatalf("rule = %+v", r)
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"delay":"100ms"`, `"code":"RESOURCE_EXHAUSTED"`, `"drop_trailer":true`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("marshal = %s, want %s", b, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []Rule{
+		{Method: "PoemService/GetPoem"},
+		{Delay: Duration(-time.Second)},
+		{ErrorRate: 1.5},
+		{AbortAfter: -1},
+		{Code: 17},
+	}
+	for _, r := range tests {
+		if err := r.Validate(); err == nil {
+			t.Errorf("%+v: want error", r)
+		}
+	}
+	i := NewInjector("dev", Rule{Method: "/a"})
+	if err := i.SetRules([]Rule{{ErrorRate: 0.1}, {ErrorRate: 2}}); err == nil {
+		t.Fatal("want error for the second rule")
+	}
+	if got := i.Rules(); len(got) != 1 || got[0].Method != "/a" {
+		t.Fatalf("rules changed by invalid rules: %+v", got)
+	}
+}
+
+func start(t *testing.T, i *Injector) message.MessageServiceClient {
+	t.Helper()
+	conn := harness.New(t, harness.WithServerOptions(i.ServerOptions()...)).Start(func(opts ...grpc.ServerOption) harness.Server {
+		return message.NewMessageSrvServer(bootstrap.WithServerOptions(opts...))
+	})
+	return message.NewMessageServiceClient(conn)
+}
+
+func TestDisabled(t *testing.T) {
+	i := NewInjector("prod", Rule{ErrorRate: 1})
+	if !errors.Is(i.SetRules([]Rule{{ErrorRate: 1}}), ErrDisabled) {
+		t.Fatal("SetRules should fail outside dev mode")
+	}
+	if len(i.ServerOptions()) != 0 {
+		t.Fatal("ServerOptions should be empty outside dev mode")
+	}
+	if _, err := start(t, i).Unary(context.Background(), &message.Message{Content: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	i.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DefaultPath, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("admin status = %d, want 404", rec.Code)
+	}
+}
+
+func TestErrorAndLatency(t *testing.T) {
+	i := NewInjector("dev",
+		Rule{Method: message.MessageService_Unary_FullMethodName, Metadata: map[string]string{"x-fault": "error"}, ErrorRate: 1, Code: Code(codes.ResourceExhausted)},
+		Rule{Method: "/message.MessageService/*", Metadata: map[string]string{"x-fault": "slow"}, Delay: Duration(50 * time.Millisecond)},
+		Rule{Method: message.MessageService_ServerStream_FullMethodName, ErrorRate: 1},
+	)
+	c := start(t, i)
+	with := func(v string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "x-fault", v)
+	}
+
+	if _, err := c.Unary(context.Background(), &message.Message{Content: "ok"}); err != nil {
+		t.Fatalf("unselected call: %v", err)
+	}
+	if _, err := c.Unary(with("error"), &message.Message{Content: "hello"}); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("err = %v, want ResourceExhausted", err)
+	}
+
+	start := time.Now()
+	if _, err := c.Unary(with("slow"), &message.Message{Content: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("call took %v, want at least 50ms", d)
+	}
+	ctx, cancel := context.WithTimeout(with("slow"), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Unary(ctx, &message.Message{Content: "hello"}); status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+
+	// 流式调用的错误在接收第一条消息时返回，默认为 UNAVAILABLE
+	ss, err := c.ServerStream(context.Background(), &message.MessageCollection{Value: []*message.Message{{Content: "x"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ss.Recv(); status.Code(err) != codes.Unavailable {
+		t.Fatalf("err = %v, want Unavailable", err)
+	}
+
+	// 运行时修改规则后立即生效
+	i.SetRules(nil)
+	if _, err := c.Unary(with("error"), &message.Message{Content: "hello"}); err != nil {
+		t.Fatalf("after clearing rules: %v", err)
+	}
+}
+
+func TestErrorRate(t *testing.T) {
+	i := NewInjector("dev", Rule{ErrorRate: 0.5})
+	values := []float64{0.2, 0.8, 0.49, 0.5}
+	i.rand = func() float64 {
+		v := values[0]
+		values = values[1:]
+		return v
+	}
+	c := start(t, i)
+	var got []codes.Code
+	for range 4 {
+		_, err := c.Unary(context.Background(), &message.Message{Content: "hello"})
+		got = append(got, status.Code(err))
+	}
+	// 没有 Jitter 时每次调用只在判断错误时取一次随机数，小于 ErrorRate 时返回错误
+	want := []codes.Code{codes.Unavailable, codes.OK, codes.Unavailable, codes.OK}
+	for idx := range want {
+		if got[idx] != want[idx] {
+			t.Fatalf("codes = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestAbortAfter(t *testing.T) {
+	i := NewInjector("dev", Rule{Method: message.MessageService_BidirectionalStream_FullMethodName, AbortAfter: 4})
+	bs, err := start(t, i).BidirectionalStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 回显模式下每条消息收发各计一次，第三条消息接收后中断
+	var got []string
+	for _, content := range []string{"1", "2", "3"} {
+		bs.Send(&message.Message{Content: content})
+	}
+	bs.CloseSend()
+	for {
+		m, err := bs.Recv()
+		if err != nil {
+			if status.Code(err) != codes.Aborted {
+				t.Fatalf("err = %v, want Aborted", err)
+			}
+			break
+		}
+		got = append(got, m.GetContent())
+	}
+	if strings.Join(got, ",") != "1,2" {
+		t.Fatalf("received %v before abort, want [1 2]", got)
+	}
+}
+
+// 客户端流的 3 条消息和服务端的响应共 4 条消息，流结束时的 io.EOF 不计数，调用正常完成
+func TestAbortAfterClientStream(t *testing.T) {
+	i := NewInjector("dev", Rule{Method: message.MessageService_ClientStream_FullMethodName, AbortAfter: 4})
+	cs, err := start(t, i).ClientStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"1", "2", "3"} {
+		if err := cs.Send(&message.Message{Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := cs.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("want success with exactly AbortAfter messages, got %v", err)
+	}
+	if len(r.GetValue()) != 3 {
+		t.Fatalf("want 3 messages echoed, got %v", r.GetValue())
+	}
+}
+
+func TestDropMetadata(t *testing.T) {
+	i := NewInjector("dev", Rule{DropHeader: true, DropTrailer: true})
+	c := start(t, i)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "client", "fault_test")
+
+	var header, trailer metadata.MD
+	if _, err := c.Unary(ctx, &message.Message{Content: "hi"}, grpc.Header(&header), grpc.Trailer(&trailer)); err != nil {
+		t.Fatal(err)
+	}
+	if len(header.Get("from")) != 0 || len(trailer.Get("from")) != 0 {
+		t.Fatalf("unary header = %v, trailer = %v, want them dropped", header, trailer)
+	}
+
+	ss, err := c.ServerStream(ctx, &message.MessageCollection{Value: []*message.Message{{Content: "x"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := ss.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	header, _ = ss.Header()
+	if len(header.Get("from")) != 0 || len(ss.Trailer().Get("from")) != 0 {
+		t.Fatalf("stream header = %v, trailer = %v, want them dropped", header, ss.Trailer())
+	}
+
+	// 不匹配规则的调用不受影响
+	i.SetRules([]Rule{{Method: "/other/*", DropHeader: true}})
+	if _, err := c.Unary(ctx, &message.Message{Content: "hi"}, grpc.Header(&header)); err != nil || len(header.Get("from")) == 0 {
+		t.Fatalf("header = %v, %v, want from", header, err)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	i := NewInjector("dev")
+	mux := runtime.NewServeMux()
+	if err := i.HandleGateway(mux); err != nil {
+		t.Fatal(err)
+	}
+	do := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, DefaultPath, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do(http.MethodPut, `[{"method": "/PoemService/GetPoem", "delay": "10ms", "code": "UNAVAILABLE", "error_rate": 0.1}]`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d: %s", rec.Code, rec.Body)
+	}
+	if got := i.Rules(); len(got) != 1 || got[0].Method != "/PoemService/GetPoem" || codes.Code(got[0].Code) != codes.Unavailable {
+		t.Fatalf("rules = %+v", got)
+	}
+	if rec := do(http.MethodGet, ""); !strings.Contains(rec.Body.String(), `"delay": "10ms"`) {
+		t.Fatalf("GET = %s", rec.Body)
+	}
+	for _, body := range []string{`{}`, `[{"error_rate": 2}]`, `[{"unknown": 1}]`} {
+		if rec := do(http.MethodPut, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s: status = %d, want 400", body, rec.Code)
+		}
+	}
+	if rec := do(http.MethodDelete, ""); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" || len(i.Rules()) != 0 {
+		t.Fatalf("DELETE = %d %s, rules = %v", rec.Code, rec.Body, i.Rules())
+	}
+}
+
+// 管理接口默认不开放：端口为 0 或者不在 dev 模式下时不监听，直接返回
+func TestListenAndServeDisabled(t *testing.T) {
+	if err := NewInjector("dev").ListenAndServe(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewInjector("prod").ListenAndServe(8091); err != nil {
+		t.Fatal(err)
+	}
+}
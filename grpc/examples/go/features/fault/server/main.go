@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"goexamples/bootstrap"
+	"goexamples/config"
+	"goexamples/features/fault"
+	"goexamples/features/proto/message"
+	"log"
+	"net"
+	"os"
+)
+
+// Config 中 mode 为 dev 时才注入故障。
+type Config struct {
+	config.Server
+	AdminPort int    `config:"admin_port" usage:"port of the fault rules admin endpoint on 127.0.0.1, 0 to disable"`
+	Rules     string `config:"rules,path" usage:"JSON file of the initial fault rules"`
+}
+
+func (c Config) Validate() error {
+	return errors.Join(c.Server.Validate(), config.ValidatePort("admin_port", c.AdminPort), config.ValidateFile("rules", c.Rules))
+}
+
+var cfg = Config{Server: config.DefaultServer}
+
+func main() {
+	config.MustLoad(&cfg)
+
+	var initial []fault.Rule
+	if cfg.Rules != "" {
+		b, err := os.ReadFile(cfg.Rules)
+		if err != nil {
+			log.Fatalf("failed to read rules: %v\n", err)
+		}
+		if err := json.Unmarshal(b, &initial); err != nil {
+			log.Fatalf("invalid rules: %v\n", err)
+		}
+	}
+	injector := fault.NewInjector(cfg.Mode)
+	if err := injector.SetRules(initial); err != nil && injector.Enabled() {
+		log.Fatalf("invalid rules: %v\n", err)
+	}
+	go func() {
+		if err := injector.ListenAndServe(cfg.AdminPort); err != nil {
+			log.Fatalf("failed to serve fault admin: %v\n", err)
+		}
+	}()
+
+	server := message.NewMessageSrvServer(
+		bootstrap.WithServerOptions(injector.ServerOptions()...),
+		bootstrap.WithChannelz(cfg.Mode),
+		bootstrap.WithReflection(cfg.Mode),
+		bootstrap.WithTCP(cfg.Port),
+		bootstrap.OnListen(func(lis net.Listener) {
+			log.Printf("server listening at %v\n", lis.Addr())
+			if injector.Enabled() && cfg.AdminPort != 0 {
+				log.Printf("fault rules admin at http://127.0.0.1:%d%s\n", cfg.AdminPort, fault.DefaultPath)
+			}
+		}),
+	)
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalf("failed to listen: %v\n", err)
+	}
+}
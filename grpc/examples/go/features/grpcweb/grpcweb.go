@@ -0,0 +1,285 @@
+package grpcweb
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+const (
+	ContentType     = "application/grpc-web"
+	ContentTypeText = "application/grpc-web-text"
+	// DefaultMaxAge 是预检请求结果的默认缓存时间。
+	DefaultMaxAge = 10 * time.Minute
+)
+
+// trailerFlag 标记 trailer 帧，见 PROTOCOL-WEB.md。
+const trailerFlag = 0x80
+
+// exposed 是浏览器需要读取的响应头，服务端设置的 header 元数据在响应时追加。
+var exposed = []string{"grpc-status", "grpc-message", "grpc-status-details-bin"}
+
+// IsGRPCWeb 判断请求是否为 gRPC-Web 请求或者它的预检请求，可以作为 ServerMux 的匹配条件。
+// 预检请求按 Access-Control-Request-Headers 中的 x-grpc-web 区分，gRPC-Web 客户端都会发送这个请求头。
+func IsGRPCWeb(r *http.Request) bool {
+	if r.Method == http.MethodOptions {
+		for _, h := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+			if strings.EqualFold(strings.TrimSpace(h), "x-grpc-web") {
+				return true
+			}
+		}
+		return false
+	}
+	return strings.HasPrefix(r.Header.Get("Content-Type"), ContentType)
+}
+
+type Option func(*Handler)
+
+// WithOriginFunc 设置允许跨域访问的来源，默认允许所有来源；不允许携带 cookie 等凭据，认证信息通过元数据传递。
+func WithOriginFunc(f func(origin string) bool) Option {
+	return func(h *Handler) {
+		h.allowOrigin = f
+	}
+}
+
+// WithMaxAge 设置预检请求结果的缓存时间，默认为 DefaultMaxAge。
+func WithMaxAge(d time.Duration) Option {
+	return func(h *Handler) {
+		h.maxAge = d
+	}
+}
+
+// Handler 将 gRPC-Web 请求转为 gRPC 请求交给服务端处理，浏览器无法发送 HTTP/2 的 trailer，也无法读取响应的 trailer，
+// gRPC-Web 把 trailer 编码为响应体中的最后一帧：
+//
+//	application/grpc-web: 二进制格式，与 gRPC 的帧相同，trailer 帧的标志位为 0x80
+//	application/grpc-web-text: 请求体和响应体为 base64 编码，每次刷新时编码已经写出的数据
+//
+// 支持一元调用和服务端流；浏览器无法流式发送请求，客户端流只能在一个请求体中发送所有消息。
+// 跨域的预检请求由 Handler 直接回复，不会到达服务端；外层使用 cors.Handler 时预检请求由 cors 回复，元数据请求头需要通过 cors.WithMetadata 允许。
+type Handler struct {
+	server      http.Handler
+	allowOrigin func(string) bool
+	maxAge      time.Duration
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		h.preflight(w, r)
+		return
+	}
+	if r.Method != http.MethodPost || !IsGRPCWeb(r) {
+		http.Error(w, "grpcweb: not a grpc-web request", http.StatusBadRequest)
+		return
+	}
+	// 其他来源的请求不设置跨域响应头，由浏览器拦截，同源的请求不受影响
+	if origin := r.Header.Get("Origin"); origin != "" && h.allowOrigin(origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+	}
+
+	// 浏览器通过 HTTP/1.1 访问时，需要在写出响应之后仍然可以读取请求体
+	http.NewResponseController(w).EnableFullDuplex()
+
+	contentType := r.Header.Get("Content-Type")
+	text := strings.HasPrefix(contentType, ContentTypeText)
+	req := r.Clone(r.Context())
+	req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2"
+	req.ContentLength = -1
+	req.Header.Del("Content-Length")
+	if text {
+		req.Header.Set("Content-Type", "application/grpc"+strings.TrimPrefix(contentType, ContentTypeText))
+		req.Body = io.NopCloser(&textReader{r: bufio.NewReader(r.Body)})
+	} else {
+		req.Header.Set("Content-Type", "application/grpc"+strings.TrimPrefix(contentType, ContentType))
+	}
+
+	ww := &webWriter{w: w, rc: http.NewResponseController(w), text: text, header: http.Header{}}
+	h.server.ServeHTTP(ww, req)
+	ww.finish()
+}
+
+func (h *Handler) preflight(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" || r.Header.Get("Access-Control-Request-Method") == "" {
+		http.Error(w, "grpcweb: not a preflight request", http.StatusBadRequest)
+		return
+	}
+	if !h.allowOrigin(origin) {
+		http.Error(w, "grpcweb: origin not allowed", http.StatusForbidden)
+		return
+	}
+	header := w.Header()
+	header.Set("Access-Control-Allow-Origin", origin)
+	header.Set("Access-Control-Allow-Methods", http.MethodPost)
+	// 元数据作为请求头发送，名称由应用决定，这里允许请求的所有请求头
+	header.Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+	header.Set("Access-Control-Max-Age", strconv.Itoa(int(h.maxAge.Seconds())))
+	header.Add("Vary", "Origin")
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// textReader 解码 grpc-web-text 的请求体，客户端分段编码时中间可能出现填充字符，因此按 4 个字符一组解码。
+type textReader struct {
+	r   *bufio.Reader
+	buf [3]byte
+	out []byte
+}
+
+func (t *textReader) Read(p []byte) (int, error) {
+	for len(t.out) == 0 {
+		var quantum [4]byte
+		for n := 0; n < len(quantum); {
+			c, err := t.r.ReadByte()
+			if err == io.EOF && n > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return 0, err
+			}
+			if c == '\r' || c == '\n' || c == ' ' || c == '\t' {
+				continue
+			}
+			quantum[n] = c
+			n++
+		}
+		n, err := base64.StdEncoding.Decode(t.buf[:], quantum[:])
+		if err != nil {
+			return 0, err
+		}
+		t.out = t.buf[:n]
+	}
+	n := copy(p, t.out)
+	t.out = t.out[n:]
+	return n, nil
+}
+
+// webWriter 在服务端写出响应头时把 gRPC 的响应头转为 gRPC-Web 的响应头，之后设置的响应头都是 trailer，
+// 在服务端处理完成后编码为响应体中的 trailer 帧。
+type webWriter struct {
+	w      http.ResponseWriter
+	rc     *http.ResponseController
+	text   bool
+	header http.Header
+
+	wroteHeader bool
+	grpc        bool            // 是否为 gRPC 响应，服务端拒绝请求时写出的是普通的 HTTP 错误
+	sent        map[string]bool // 作为响应头发送的名称
+	pending     []byte          // grpc-web-text 中还不足 3 字节、没有编码的数据
+}
+
+func (ww *webWriter) Header() http.Header {
+	return ww.header
+}
+
+func (ww *webWriter) WriteHeader(code int) {
+	if ww.wroteHeader {
+		return
+	}
+	ww.wroteHeader = true
+	ww.sent = map[string]bool{}
+	h := ww.w.Header()
+	expose := slices.Clone(exposed)
+	for k, vs := range ww.header {
+		// 预先声明的 trailer 在 finish 中输出
+		if k == "Trailer" || strings.HasPrefix(k, http2.TrailerPrefix) {
+			continue
+		}
+		ww.sent[k] = true
+		h[k] = slices.Clone(vs)
+		if k != "Content-Type" && len(vs) > 0 {
+			expose = append(expose, strings.ToLower(k))
+		}
+	}
+	if ct := h.Get("Content-Type"); strings.HasPrefix(ct, "application/grpc") {
+		ww.grpc = true
+		if ww.text {
+			h.Set("Content-Type", ContentTypeText+strings.TrimPrefix(ct, "application/grpc"))
+		} else {
+			h.Set("Content-Type", ContentType+strings.TrimPrefix(ct, "application/grpc"))
+		}
+	}
+	if h.Get("Access-Control-Allow-Origin") != "" {
+		slices.Sort(expose)
+		h.Set("Access-Control-Expose-Headers", strings.Join(expose, ", "))
+	}
+	ww.w.WriteHeader(code)
+}
+
+func (ww *webWriter) Write(b []byte) (int, error) {
+	ww.WriteHeader(http.StatusOK)
+	if !ww.text || !ww.grpc {
+		return ww.w.Write(b)
+	}
+	ww.pending = append(ww.pending, b...)
+	n := len(ww.pending) / 3 * 3
+	if n == 0 {
+		return len(b), nil
+	}
+	if _, err := ww.w.Write([]byte(base64.StdEncoding.EncodeToString(ww.pending[:n]))); err != nil {
+		return 0, err
+	}
+	ww.pending = ww.pending[n:]
+	return len(b), nil
+}
+
+// Flush 由服务端在每条消息之后调用，grpc-web-text 此时编码剩余的数据，带有填充字符。
+func (ww *webWriter) Flush() {
+	ww.WriteHeader(http.StatusOK)
+	if len(ww.pending) > 0 {
+		ww.w.Write([]byte(base64.StdEncoding.EncodeToString(ww.pending)))
+		ww.pending = nil
+	}
+	ww.rc.Flush()
+}
+
+// finish 在服务端处理完成后写出 trailer 帧，名称为小写，每行一个 name: value。
+func (ww *webWriter) finish() {
+	ww.WriteHeader(http.StatusOK)
+	if !ww.grpc {
+		return
+	}
+	trailer := http.Header{}
+	for k, vs := range ww.header {
+		switch {
+		case strings.HasPrefix(k, http2.TrailerPrefix):
+			trailer[strings.TrimPrefix(k, http2.TrailerPrefix)] = vs
+		case k != "Trailer" && !ww.sent[k]:
+			trailer[k] = vs
+		}
+	}
+	var body strings.Builder
+	for _, k := range slices.Sorted(maps.Keys(trailer)) {
+		for _, v := range trailer[k] {
+			body.WriteString(strings.ToLower(k) + ": " + v + "\r\n")
+		}
+	}
+	frame := []byte{trailerFlag}
+	frame = binary.BigEndian.AppendUint32(frame, uint32(body.Len()))
+	ww.Write(append(frame, body.String()...))
+	ww.Flush()
+}
+
+// NewHandler 为 server 提供 gRPC-Web 接口，server 通常是 *grpc.Server 或者示例中的服务端，它们都实现了 http.Handler。
+func NewHandler(server http.Handler, opts ...Option) *Handler {
+	h := &Handler{
+		server:      server,
+		allowOrigin: func(string) bool { return true },
+		maxAge:      DefaultMaxAge,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
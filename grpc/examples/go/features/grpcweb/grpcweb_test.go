@@ -0,0 +1,66 @@
+package grpcweb
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTextReader(t *testing.T) {
+	// 两段分别编码的数据，中间有填充字符和换行
+	r := &textReader{r: bufio.NewReader(strings.NewReader("aGVsbG8=\r\nIHdvcmxk"))}
+	b, err := io.ReadAll(r)
+	if err != nil || string(b) != "hello world" {
+		t.Fatalf("ReadAll = %q %v", b, err)
+	}
+	r = &textReader{r: bufio.NewReader(strings.NewReader("aGVsbG"))}
+	if _, err := io.ReadAll(r); err != io.ErrUnexpectedEOF {
+		t.Fatalf("ReadAll error = %v, want ErrUnexpectedEOF", err)
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("%s %s should not reach the server", r.Method, r.URL)
+	})
+	h := NewHandler(backend, WithOriginFunc(func(origin string) bool {
+		return origin == "http://localhost:3000"
+	}))
+
+	tests := []struct {
+		name    string
+		origin  string
+		match   bool
+		want    int
+		headers string
+	}{
+		{"allowed", "http://localhost:3000", true, http.StatusNoContent, "content-type,x-grpc-web,authorization"},
+		{"forbidden", "http://evil.example.com", true, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodOptions, "/user.UserService/GetUser", nil)
+			r.Header.Set("Origin", tt.origin)
+			r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			r.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web,authorization")
+			if IsGRPCWeb(r) != tt.match {
+				t.Fatalf("IsGRPCWeb = %v", !tt.match)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want || w.Header().Get("Access-Control-Allow-Headers") != tt.headers {
+				t.Fatalf("got %d %v", w.Code, w.Header())
+			}
+		})
+	}
+
+	// 不带 x-grpc-web 的预检请求属于其他服务
+	r := httptest.NewRequest(http.MethodOptions, "/api/v1/users", nil)
+	r.Header.Set("Access-Control-Request-Headers", "content-type")
+	if IsGRPCWeb(r) {
+		t.Fatal("IsGRPCWeb should be false for other preflight requests")
+	}
+}
@@ -0,0 +1,142 @@
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Overall 是代表整个服务端的服务名称，客户端未指定服务名称时检查的就是它。
+const Overall = ""
+
+// HTTP 探针的路径：/healthz 只表示进程存活，/readyz 表示所有服务都可以处理请求。
+const (
+	LivePath  = "/healthz"
+	ReadyPath = "/readyz"
+)
+
+// Health 管理服务端中各个服务的健康状态，同时以 grpc_health_v1 服务和 HTTP 探针两种形式对外提供。
+//
+// 整体状态（Overall）由各个服务的状态汇总而来，只有所有服务都是 SERVING 时才是 SERVING。
+type Health struct {
+	server *health.Server
+
+	mu       sync.Mutex
+	serving  map[string]bool
+	shutdown bool
+}
+
+func (h *Health) update() {
+	status := healthpb.HealthCheckResponse_SERVING
+	for service, serving := range h.serving {
+		if !serving {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		h.server.SetServingStatus(service, servingStatus(serving))
+	}
+	h.server.SetServingStatus(Overall, status)
+}
+
+func servingStatus(serving bool) healthpb.HealthCheckResponse_ServingStatus {
+	if serving {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
+
+// Register 在 grpc 服务端中注册 grpc_health_v1 服务。
+func (h *Health) Register(s grpc.ServiceRegistrar) {
+	healthpb.RegisterHealthServer(s, h.server)
+}
+
+// Set 修改服务的状态，比如数据加载期间设置为 false，加载完成后设置为 true。
+// 调用 Shutdown 后修改无效。
+func (h *Health) Set(service string, serving bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.shutdown {
+		return
+	}
+	h.serving[service] = serving
+	h.update()
+}
+
+// Serving 返回服务是否可以处理请求，service 为 Overall 时返回整体状态。
+func (h *Health) Serving(service string) bool {
+	resp, err := h.server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	return err == nil && resp.GetStatus() == healthpb.HealthCheckResponse_SERVING
+}
+
+// Statuses 返回所有服务（不包括整体状态）当前的状态。
+func (h *Health) Statuses() map[string]string {
+	h.mu.Lock()
+	services := slices.Collect(maps.Keys(h.serving))
+	h.mu.Unlock()
+
+	statuses := make(map[string]string, len(services))
+	for _, service := range services {
+		statuses[service] = servingStatus(h.Serving(service)).String()
+	}
+	return statuses
+}
+
+// Shutdown 在服务端关闭前调用，将所有服务设置为 NOT_SERVING，客户端会停止向该服务端发送新的请求。
+func (h *Health) Shutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.shutdown = true
+	h.server.Shutdown()
+}
+
+// ServeHTTP 处理 /healthz 和 /readyz 探针，/readyz 在有服务未就绪时返回 503。
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case LivePath:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	case ReadyPath:
+		ready := h.Serving(Overall)
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"status":   servingStatus(ready).String(),
+			"services": h.Statuses(),
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// IsProbe 判断请求是否为健康探针，用于 ServerMux 的匹配条件。
+func IsProbe(r *http.Request) bool {
+	return r.URL.Path == LivePath || r.URL.Path == ReadyPath
+}
+
+// NewHealth 创建 Health，services 的初始状态均为 SERVING。
+func NewHealth(services ...string) *Health {
+	h := &Health{server: health.NewServer(), serving: map[string]bool{}}
+	for _, service := range services {
+		h.serving[service] = true
+	}
+	h.update()
+	return h
+}
+
+// WithHealthCheck 开启客户端健康检查：客户端通过 grpc_health_v1.Watch 订阅 service 的状态，
+// 服务端不是 SERVING 时不再向其发送请求。健康检查只在 round_robin 等负载均衡策略下生效，这里一并设置。
+func WithHealthCheck(service string) grpc.DialOption {
+	return grpc.WithDefaultServiceConfig(fmt.Sprintf(`{
+		"loadBalancingConfig": [{"round_robin": {}}],
+		"healthCheckConfig": {"serviceName": %q}
+	}`, service))
+}
@@ -0,0 +1,106 @@
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const service = "user.UserService"
+
+func TestHealthOverall(t *testing.T) {
+	h := NewHealth(service, "other.Service")
+	if !h.Serving(Overall) || !h.Serving(service) {
+		t.Fatal("want all serving initially")
+	}
+
+	h.Set(service, false)
+	if h.Serving(Overall) || h.Serving(service) || !h.Serving("other.Service") {
+		t.Fatalf("want only %s not serving, got %v", service, h.Statuses())
+	}
+
+	h.Set(service, true)
+	h.Shutdown()
+	h.Set(service, true)
+	if h.Serving(Overall) || h.Serving(service) {
+		t.Fatal("want not serving after shutdown")
+	}
+}
+
+func TestHealthHTTP(t *testing.T) {
+	h := NewHealth(service)
+	probe := func(path string) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		body := map[string]any{}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body
+	}
+
+	if code, body := probe(ReadyPath); code != http.StatusOK || body["status"] != "SERVING" {
+		t.Fatalf("want ready, got %d %v", code, body)
+	}
+	h.Set(service, false)
+	code, body := probe(ReadyPath)
+	if code != http.StatusServiceUnavailable || body["services"].(map[string]any)[service] != "NOT_SERVING" {
+		t.Fatalf("want not ready, got %d %v", code, body)
+	}
+	// 存活探针不受服务状态影响
+	if code, _ := probe(LivePath); code != http.StatusOK {
+		t.Fatalf("want alive, got %d", code)
+	}
+}
+
+func TestWithHealthCheck(t *testing.T) {
+	h := NewHealth(service)
+	h.Set(service, false)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	h.Register(srv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		WithHealthCheck(service),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := healthpb.NewHealthClient(conn)
+	check := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		return err
+	}
+
+	// 服务未就绪时，客户端不会把请求发给该服务端
+	if err := check(); status.Code(err) != codes.Unavailable {
+		t.Fatalf("want Unavailable, got %v", err)
+	}
+
+	h.Set(service, true)
+	deadline := time.Now().Add(2 * time.Second)
+	for err := check(); err != nil; err = check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("want call to succeed after serving, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
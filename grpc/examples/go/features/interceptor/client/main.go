@@ -2,14 +2,17 @@ package main
 
 import (
 	"context"
-	"flag"
 	"fmt"
+	"goexamples/config"
 	"goexamples/features/proto/message"
+	"goexamples/features/streamhook"
 	"goexamples/utils"
 	"log"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 // method: 客户端要调用的完整 rpc 方法名称，格式：/package.Service/Method
@@ -49,19 +52,36 @@ func streamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.Clie
 	return streamer(ctx, desc, cc, method, opts...)
 }
 
-var (
-	addr = flag.String("addr", "localhost:50051", "addr to connect to")
-)
+// streamHooks 观察客户端流中每条消息的收发、Header 的到达以及流的最终状态。
+func streamHooks(counter *streamhook.Counter) streamhook.Hooks {
+	return streamhook.Merge(
+		counter.Hooks(),
+		streamhook.Timing("client", 100*time.Millisecond),
+		// 发送前校验消息，校验失败的消息不会发送给服务端
+		streamhook.Validate(nil, streamhook.SelfValidator),
+		streamhook.Hooks{
+			OnSent: func(info *streamhook.Info, m any, cost time.Duration, err error) {
+				log.Printf("client stream hook sent: method=%v, msg=%v, cost=%v, err=%v\n", info.FullMethod, utils.String(m), cost, err)
+			},
+			OnHeader: func(info *streamhook.Info, md metadata.MD) {
+				log.Printf("client stream hook header: method=%v, header=%v\n", info.FullMethod, utils.String(md))
+			},
+		},
+	)
+}
+
+var cfg = config.DefaultClient
 
 func main() {
-	flag.Parse()
+	config.MustLoad(&cfg)
+	counter := streamhook.NewCounter()
 	client, err := message.NewMessageSrvClient(
-		*addr,
+		cfg.Addr,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 		// 配置一个一元拦截器，如果需要多个拦截器，请使用 grpc.WithChainUnaryInterceptor
 		grpc.WithUnaryInterceptor(unaryInterceptor),
-		// 配置一个流拦截器，如果需要多个拦截器，请使用 grpc.WithChainStreamInterceptor
-		grpc.WithStreamInterceptor(streamInterceptor),
+		// 配置多个流拦截器，按注册的顺序执行
+		grpc.WithChainStreamInterceptor(streamInterceptor, streamhook.StreamClientInterceptor(streamHooks(counter))),
 		// 多个拦截器按注册的顺序执行
 		// grpc.WithChainUnaryInterceptor(unaryInterceptor, unaryInterceptor2),
 	)
@@ -122,4 +142,13 @@ func main() {
 			}
 		}
 	}()
+
+	fmt.Println()
+	for _, method := range []string{
+		message.MessageService_ClientStream_FullMethodName,
+		message.MessageService_ServerStream_FullMethodName,
+		message.MessageService_BidirectionalStream_FullMethodName,
+	} {
+		log.Printf("main.client stream stats: method=%v, %v\n", method, counter.Stats(method))
+	}
 }
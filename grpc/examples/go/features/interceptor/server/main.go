@@ -2,13 +2,17 @@ package main
 
 import (
 	"context"
-	"flag"
+	"goexamples/bootstrap"
+	"goexamples/config"
 	"goexamples/features/proto/message"
+	"goexamples/features/streamhook"
 	"goexamples/utils"
 	"log"
 	"net"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
 )
 
 // req: 客户端传来的请求参数
@@ -41,24 +45,53 @@ func streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInf
 	return handler(srv, ss)
 }
 
-var (
-	port = flag.Int("port", 50051, "port to listen on")
-)
+// 流拦截器只在流建立时调用一次，每条消息的收发需要通过包装 ServerStream 观察。
+// streamHooks 在每条消息收发时计数、计时，并校验客户端发来的消息，流结束时打印统计信息。
+func streamHooks() streamhook.Hooks {
+	counter := streamhook.NewCounter()
+	return streamhook.Merge(
+		counter.Hooks(),
+		streamhook.Timing("server", 100*time.Millisecond),
+		streamhook.Validate(streamhook.SelfValidator, nil),
+		streamhook.Hooks{
+			OnRecv: func(info *streamhook.Info, m any, cost time.Duration, err error) error {
+				if err == nil {
+					log.Printf("server stream hook recv: method=%v, msg=%v, cost=%v\n", info.FullMethod, utils.String(m), cost)
+				}
+				return nil
+			},
+			OnSent: func(info *streamhook.Info, m any, cost time.Duration, err error) {
+				log.Printf("server stream hook sent: method=%v, msg=%v, cost=%v, err=%v\n", info.FullMethod, utils.String(m), cost, err)
+			},
+			OnClose: func(info *streamhook.Info, st *status.Status) {
+				log.Printf("server stream hook closed: method=%v, stats=%v\n", info.FullMethod, counter.Stats(info.FullMethod))
+			},
+		},
+	)
+}
+
+var cfg = config.DefaultServer
 
 func main() {
-	flag.Parse()
+	config.MustLoad(&cfg)
 	server := message.NewMessageSrvServer(
-		// 配置一个一元拦截器，如果需要多个拦截器，请使用 grpc.ChainUnaryInterceptor
-		grpc.UnaryInterceptor(unaryInterceptor),
-		// 配置一个流拦截器，如果需要多个拦截器，请使用 grpc.ChainStreamInterceptor
-		grpc.StreamInterceptor(streamInterceptor),
-		// 多个拦截器按注册的顺序执行
-		// grpc.ChainUnaryInterceptor(unaryInterceptor, unaryInterceptor2),
+		bootstrap.WithServerOptions(
+			// 配置一个一元拦截器，如果需要多个拦截器，请使用 grpc.ChainUnaryInterceptor
+			grpc.UnaryInterceptor(unaryInterceptor),
+			// 配置多个流拦截器，按注册的顺序执行
+			grpc.ChainStreamInterceptor(streamInterceptor, streamhook.StreamServerInterceptor(streamHooks())),
+			// 多个拦截器按注册的顺序执行
+			// grpc.ChainUnaryInterceptor(unaryInterceptor, unaryInterceptor2),
+		),
+		// 也可以使用 bootstrap.WithUnaryInterceptors、bootstrap.WithStreamInterceptors，它们在 WithServerOptions 中的拦截器之后执行
+		bootstrap.WithChannelz(cfg.Mode),
+		bootstrap.WithReflection(cfg.Mode),
+		bootstrap.WithTCP(cfg.Port),
+		bootstrap.OnListen(func(lis net.Listener) {
+			log.Printf("server listening at %v\n", lis.Addr())
+		}),
 	)
-	onListen := func(lis net.Listener) {
-		log.Printf("server listening at %v\n", lis.Addr())
-	}
-	if err := server.Listen(*port, onListen); err != nil {
+	if err := server.ListenAndServe(); err != nil {
 		log.Fatalf("failed to listen: %v\n", err)
 	}
 }
@@ -0,0 +1,87 @@
+package keepalive
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+	grpckeepalive "google.golang.org/grpc/keepalive"
+)
+
+// ServerConfig 是服务端的连接保活和连接寿命配置，为 0 的字段使用 grpc 的默认值。
+type ServerConfig struct {
+	// Time 连接上多久没有数据后服务端发送 ping，最小为 1 秒
+	Time time.Duration
+	// Timeout 发送 ping 后等待 ack 的时间，超时认为客户端已经失联并关闭连接
+	Timeout time.Duration
+	// MaxConnectionIdle 连接上没有活动的 rpc 超过该时间后，发送 GOAWAY 关闭连接
+	MaxConnectionIdle time.Duration
+	// MaxConnectionAge 连接存活超过该时间后发送 GOAWAY，客户端会重新建立连接，便于负载重新均衡
+	MaxConnectionAge time.Duration
+	// MaxConnectionAgeGrace 发送 GOAWAY 后，等待进行中的 rpc 完成的时间，超时强制关闭连接
+	MaxConnectionAgeGrace time.Duration
+
+	// MinTime 客户端 ping 的最小间隔，ping 过于频繁的客户端会收到 GOAWAY（ENHANCE_YOUR_CALM）
+	MinTime time.Duration
+	// PermitWithoutStream 是否允许客户端在没有活动的 rpc 时发送 ping
+	PermitWithoutStream bool
+}
+
+func (c ServerConfig) Options() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.KeepaliveParams(grpckeepalive.ServerParameters{
+			Time:                  c.Time,
+			Timeout:               c.Timeout,
+			MaxConnectionIdle:     c.MaxConnectionIdle,
+			MaxConnectionAge:      c.MaxConnectionAge,
+			MaxConnectionAgeGrace: c.MaxConnectionAgeGrace,
+		}),
+		grpc.KeepaliveEnforcementPolicy(grpckeepalive.EnforcementPolicy{
+			MinTime:             c.MinTime,
+			PermitWithoutStream: c.PermitWithoutStream,
+		}),
+	}
+}
+
+// ClientConfig 是客户端的连接保活和空闲配置，为 0 的字段使用 grpc 的默认值。
+type ClientConfig struct {
+	// Time 连接上多久没有数据后客户端发送 ping，最小为 10 秒，不能小于服务端的 MinTime
+	Time time.Duration
+	// Timeout 发送 ping 后等待 ack 的时间，超时认为服务端已经失联，连接上的 rpc 以 Unavailable 结束
+	Timeout time.Duration
+	// PermitWithoutStream 没有活动的 rpc 时是否也发送 ping
+	PermitWithoutStream bool
+	// IdleTimeout 客户端没有 rpc 超过该时间后进入空闲状态并关闭连接，下次调用时重新连接
+	IdleTimeout time.Duration
+}
+
+func (c ClientConfig) Options() []grpc.DialOption {
+	opts := []grpc.DialOption{
+		grpc.WithKeepaliveParams(grpckeepalive.ClientParameters{
+			Time:                c.Time,
+			Timeout:             c.Timeout,
+			PermitWithoutStream: c.PermitWithoutStream,
+		}),
+	}
+	if c.IdleTimeout > 0 {
+		opts = append(opts, grpc.WithIdleTimeout(c.IdleTimeout))
+	}
+	return opts
+}
+
+// DefaultServer 是示例中服务端构造函数使用的默认配置：每 30 秒探测一次客户端，
+// 空闲 5 分钟的连接会被关闭，不限制连接寿命，长时间运行的流（比如 BatchUploadPoemStream）不会被中断。
+var DefaultServer = ServerConfig{
+	Time:                30 * time.Second,
+	Timeout:             10 * time.Second,
+	MaxConnectionIdle:   5 * time.Minute,
+	MinTime:             10 * time.Second,
+	PermitWithoutStream: true,
+}
+
+// DefaultClient 是示例中客户端构造函数使用的默认配置，ping 间隔不小于 DefaultServer.MinTime。
+var DefaultClient = ClientConfig{
+	Time:                30 * time.Second,
+	Timeout:             10 * time.Second,
+	PermitWithoutStream: true,
+	IdleTimeout:         30 * time.Minute,
+}
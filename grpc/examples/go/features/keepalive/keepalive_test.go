@@ -0,0 +1,201 @@
+package keepalive_test
+
+import (
+	"context"
+	"goexamples/bootstrap"
+	"goexamples/features/keepalive"
+	"goexamples/features/proto/message"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// blackhole 是客户端和服务端之间的 tcp 代理，冻结后丢弃双向的所有数据但不关闭连接，模拟对端失联（断电、网线断开等）。
+type blackhole struct {
+	lis    net.Listener
+	frozen atomic.Bool
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (b *blackhole) pipe(dst, src net.Conn) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if err != nil {
+			dst.Close()
+			return
+		}
+		if !b.frozen.Load() {
+			dst.Write(buf[:n])
+		}
+	}
+}
+
+func (b *blackhole) serve(target string) {
+	for {
+		conn, err := b.lis.Accept()
+		if err != nil {
+			return
+		}
+		upstream, err := net.Dial("tcp", target)
+		if err != nil {
+			conn.Close()
+			continue
+		}
+		b.mu.Lock()
+		b.conns = append(b.conns, conn, upstream)
+		b.mu.Unlock()
+		go b.pipe(upstream, conn)
+		go b.pipe(conn, upstream)
+	}
+}
+
+func (b *blackhole) close() {
+	b.lis.Close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, conn := range b.conns {
+		conn.Close()
+	}
+}
+
+func startBlackhole(t *testing.T, target string) *blackhole {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &blackhole{lis: lis}
+	go b.serve(target)
+	t.Cleanup(b.close)
+	return b
+}
+
+// startServer 启动 MessageSrvServer，返回地址和每个流结束时的错误。
+func startServer(t *testing.T, cfg keepalive.ServerConfig) (string, <-chan error) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ended := make(chan error, 10)
+	opts := append(cfg.Options(), grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		ended <- err
+		return err
+	}))
+	srv := message.NewMessageSrvServer(bootstrap.WithServerOptions(opts...))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String(), ended
+}
+
+// openStream 打开一个双向流并完成一次往返，确认连接可用。
+func openStream(t *testing.T, addr string, opts ...grpc.DialOption) *message.BidirectionalSession {
+	t.Helper()
+	c, err := message.NewMessageSrvClient(addr, append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	session, err := c.OpenBidirectionalStream(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Send(&message.Message{Content: "ping"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-session.Recv():
+	case <-time.After(2 * time.Second):
+		t.Fatal("no echo")
+	}
+	return session
+}
+
+func TestServerDetectsDeadClient(t *testing.T) {
+	cfg := keepalive.ServerConfig{Time: time.Second, Timeout: time.Second}
+	addr, ended := startServer(t, cfg)
+	proxy := startBlackhole(t, addr)
+	openStream(t, proxy.lis.Addr().String())
+
+	proxy.frozen.Store(true)
+	start := time.Now()
+	// 客户端失联后，服务端最迟在 Time + Timeout 后关闭连接，流随之结束
+	window := cfg.Time + cfg.Timeout + time.Second
+	select {
+	case err := <-ended:
+		if err == nil {
+			t.Fatal("want stream to end with error")
+		}
+		t.Logf("dead client detected after %v: %v", time.Since(start), err)
+	case <-time.After(window):
+		t.Fatalf("dead client not detected within %v", window)
+	}
+}
+
+func TestClientDetectsDeadServer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("client keepalive time is at least 10s")
+	}
+	addr, _ := startServer(t, keepalive.DefaultServer)
+	proxy := startBlackhole(t, addr)
+	cfg := keepalive.ClientConfig{Time: 10 * time.Second, Timeout: time.Second}
+	session := openStream(t, proxy.lis.Addr().String(), cfg.Options()...)
+
+	proxy.frozen.Store(true)
+	start := time.Now()
+	window := cfg.Time + cfg.Timeout + 2*time.Second
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+	select {
+	case err := <-done:
+		if status.Code(err) != codes.Unavailable {
+			t.Fatalf("want Unavailable, got %v", err)
+		}
+		t.Logf("dead server detected after %v: %v", time.Since(start), err)
+	case <-time.After(window):
+		t.Fatalf("dead server not detected within %v", window)
+	}
+}
+
+func TestMaxConnectionAge(t *testing.T) {
+	cfg := keepalive.ServerConfig{MaxConnectionAge: 500 * time.Millisecond, MaxConnectionAgeGrace: 500 * time.Millisecond}
+	addr, _ := startServer(t, cfg)
+	session := openStream(t, addr)
+
+	// 连接寿命到期后服务端发送 GOAWAY，宽限期结束时仍未完成的流被强制关闭（寿命有 ±10% 的随机抖动）
+	window := cfg.MaxConnectionAge*11/10 + cfg.MaxConnectionAgeGrace + 2*time.Second
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+	select {
+	case err := <-done:
+		if status.Code(err) != codes.Unavailable {
+			t.Fatalf("want Unavailable, got %v", err)
+		}
+		t.Logf("stream closed after %v: %v", time.Since(start), err)
+	case <-time.After(window):
+		t.Fatalf("stream not closed within %v", window)
+	}
+}
@@ -0,0 +1,112 @@
+package loadbalance
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/balancer/roundrobin"
+	"google.golang.org/grpc/resolver"
+)
+
+// 可选的负载均衡策略
+const (
+	RoundRobin           = roundrobin.Name
+	WeightedLeastRequest = "weighted_least_request"
+)
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(WeightedLeastRequest, wlrPickerBuilder{}, base.Config{HealthCheck: true}))
+}
+
+type weightKey struct{}
+
+// WithWeight 为地址设置权重，权重越大分配到的请求越多。
+func WithWeight(addr resolver.Address, weight uint32) resolver.Address {
+	addr.BalancerAttributes = addr.BalancerAttributes.WithValue(weightKey{}, weight)
+	return addr
+}
+
+// Weight 返回地址的权重，未设置时为 1。
+func Weight(addr resolver.Address) uint32 {
+	if w, ok := addr.BalancerAttributes.Value(weightKey{}).(uint32); ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+type wlrSubConn struct {
+	sc          balancer.SubConn
+	weight      float64
+	outstanding atomic.Int64
+}
+
+type wlrPickerBuilder struct{}
+
+// Build 在可用的连接变化时调用。正在处理的请求数记录在 picker 中，重建 picker 后重新计数，
+// 旧请求完成时只会修改旧 picker 的计数。
+func (wlrPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	scs := make([]*wlrSubConn, 0, len(info.ReadySCs))
+	for sc, sci := range info.ReadySCs {
+		scs = append(scs, &wlrSubConn{sc: sc, weight: float64(Weight(sci.Address))})
+	}
+	return &wlrPicker{scs: scs, rand: rand.Float64}
+}
+
+// wlrPicker 按 weight / (正在处理的请求数 + 1) 加权随机选择连接：
+// 空闲时按权重分配请求，某个服务端积压的请求越多，分配给它的新请求越少。
+type wlrPicker struct {
+	scs  []*wlrSubConn
+	rand func() float64
+}
+
+func (p *wlrPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	scores := make([]float64, len(p.scs))
+	total := 0.0
+	for i, sc := range p.scs {
+		scores[i] = sc.weight / float64(sc.outstanding.Load()+1)
+		total += scores[i]
+	}
+	chosen := p.scs[len(p.scs)-1]
+	for i, r := 0, p.rand()*total; i < len(p.scs); i++ {
+		if r -= scores[i]; r < 0 {
+			chosen = p.scs[i]
+			break
+		}
+	}
+	chosen.outstanding.Add(1)
+	return balancer.PickResult{SubConn: chosen.sc, Done: func(balancer.DoneInfo) {
+		chosen.outstanding.Add(-1)
+	}}, nil
+}
+
+// ServiceConfig 生成使用 policy 策略的服务配置，同时开启对 healthService 的客户端健康检查。
+//
+// 副本突然退出时，已经发给它的请求会以 UNAVAILABLE 失败，因此同时为所有方法开启重试，重试时会选择其他副本。
+func ServiceConfig(policy, healthService string) string {
+	return fmt.Sprintf(`{
+		"loadBalancingConfig": [{%q: {}}],
+		"healthCheckConfig": {"serviceName": %q},
+		"methodConfig": [{
+			"name": [{}],
+			"retryPolicy": {
+				"maxAttempts": 3,
+				"initialBackoff": "0.01s",
+				"maxBackoff": "0.1s",
+				"backoffMultiplier": 2,
+				"retryableStatusCodes": ["UNAVAILABLE"]
+			}
+		}]
+	}`, policy, healthService)
+}
+
+// WithPolicy 设置负载均衡策略，会覆盖客户端构造函数中的默认策略（round_robin）。
+func WithPolicy(policy, healthService string) grpc.DialOption {
+	return grpc.WithDefaultServiceConfig(ServiceConfig(policy, healthService))
+}
@@ -0,0 +1,67 @@
+package loadbalance
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/resolver"
+)
+
+type fakeSubConn struct {
+	balancer.SubConn
+	name string
+}
+
+func TestParseAddresses(t *testing.T) {
+	addrs, err := parseAddresses([]string{"# comment", "a:1", "", " b:2*3 "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 || addrs[0].Addr != "a:1" || Weight(addrs[0]) != 1 || addrs[1].Addr != "b:2" || Weight(addrs[1]) != 3 {
+		t.Fatalf("unexpected addresses: %v", addrs)
+	}
+	for _, bad := range [][]string{{"a:1*0"}, {"a:1*x"}, {"*2"}, {"# only comment"}} {
+		if _, err := parseAddresses(bad); err == nil {
+			t.Fatalf("want error for %v", bad)
+		}
+	}
+}
+
+func TestWeightedLeastRequestPicker(t *testing.T) {
+	a, b := &fakeSubConn{name: "a"}, &fakeSubConn{name: "b"}
+	p := &wlrPicker{scs: []*wlrSubConn{
+		{sc: a, weight: float64(Weight(WithWeight(resolver.Address{}, 1)))},
+		{sc: b, weight: float64(Weight(WithWeight(resolver.Address{}, 3)))},
+	}}
+
+	// 空闲时按权重分配：a 占 1/4，b 占 3/4
+	tests := []struct {
+		rand float64
+		want *fakeSubConn
+	}{
+		{rand: 0.1, want: a},
+		{rand: 0.3, want: b},
+		{rand: 0.9, want: b},
+	}
+	for _, tt := range tests {
+		p.rand = func() float64 { return tt.rand }
+		res, err := p.Pick(balancer.PickInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.SubConn != tt.want {
+			t.Fatalf("rand %v: want %s, got %s", tt.rand, tt.want.name, res.SubConn.(*fakeSubConn).name)
+		}
+		res.Done(balancer.DoneInfo{})
+	}
+
+	// b 积压 5 个请求后得分为 3/6，a 为 1，a 的占比变为 2/3
+	p.scs[1].outstanding.Store(5)
+	p.rand = func() float64 { return 0.6 }
+	if res, _ := p.Pick(balancer.PickInfo{}); res.SubConn != a {
+		t.Fatalf("want busy subconn avoided, got %s", res.SubConn.(*fakeSubConn).name)
+	}
+	if n := p.scs[0].outstanding.Load(); n != 1 {
+		t.Fatalf("want 1 outstanding on a, got %d", n)
+	}
+}
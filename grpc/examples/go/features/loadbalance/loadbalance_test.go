@@ -0,0 +1,151 @@
+package loadbalance_test
+
+import (
+	"context"
+	"fmt"
+	"goexamples/bootstrap"
+	"goexamples/features/loadbalance"
+	"goexamples/features/proto/message"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestMain(m *testing.M) {
+	// 服务端会打印每个请求，测试时不需要
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+type replica struct {
+	addr  string
+	calls atomic.Int64
+	srv   *message.MessageSrvServer
+}
+
+// startReplicas 在随机端口上启动 n 个 MessageSrvServer，每个副本记录自己处理的请求数。
+func startReplicas(t *testing.T, n int) []*replica {
+	t.Helper()
+	replicas := make([]*replica, n)
+	for i := range replicas {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &replica{addr: lis.Addr().String()}
+		r.srv = message.NewMessageSrvServer(bootstrap.WithUnaryInterceptors(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			r.calls.Add(1)
+			return handler(ctx, req)
+		}))
+		go r.srv.Serve(lis)
+		t.Cleanup(r.srv.Stop)
+		replicas[i] = r
+	}
+	return replicas
+}
+
+func call(t *testing.T, c *message.MessageSrvClient, n int) {
+	t.Helper()
+	for i := range n {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		_, err := c.Unary(ctx, &message.Message{Content: fmt.Sprint(i)}, grpc.WaitForReady(true))
+		cancel()
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+}
+
+func counts(replicas []*replica) []int64 {
+	out := make([]int64, len(replicas))
+	for i, r := range replicas {
+		out[i] = r.calls.Load()
+	}
+	return out
+}
+
+func TestFailover(t *testing.T) {
+	for _, policy := range []string{loadbalance.RoundRobin, loadbalance.WeightedLeastRequest} {
+		t.Run(policy, func(t *testing.T) {
+			replicas := startReplicas(t, 3)
+			addrs := make([]string, len(replicas))
+			for i, r := range replicas {
+				addrs[i] = r.addr
+			}
+			c, err := message.NewMessageSrvClient(
+				loadbalance.StaticScheme+":///"+strings.Join(addrs, ","),
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+				loadbalance.WithPolicy(policy, message.MessageService_ServiceDesc.ServiceName),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			call(t, c, 60)
+			for i, n := range counts(replicas) {
+				if n == 0 {
+					t.Fatalf("replica %d got no traffic: %v", i, counts(replicas))
+				}
+			}
+
+			// 关闭一个副本，之后的请求全部由剩下的副本处理
+			replicas[0].srv.Stop()
+			before := counts(replicas)
+			call(t, c, 60)
+			after := counts(replicas)
+			if after[0] != before[0] {
+				t.Fatalf("stopped replica still got traffic: %v -> %v", before, after)
+			}
+			if after[1] == before[1] || after[2] == before[2] {
+				t.Fatalf("want traffic spread over remaining replicas: %v -> %v", before, after)
+			}
+		})
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	replicas := startReplicas(t, 2)
+	file := filepath.Join(t.TempDir(), "addrs.txt")
+	write := func(lines ...string) {
+		if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("# replicas", replicas[0].addr)
+
+	c, err := message.NewMessageSrvClient(
+		loadbalance.FileScheme+"://"+file,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithResolvers(loadbalance.NewFileBuilder(10*time.Millisecond)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	call(t, c, 10)
+	if got := counts(replicas); got[0] != 10 || got[1] != 0 {
+		t.Fatalf("want all calls on first replica, got %v", got)
+	}
+
+	// 修改文件后切换到第二个副本
+	write(replicas[1].addr)
+	deadline := time.Now().Add(2 * time.Second)
+	for replicas[1].calls.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("file change not picked up")
+		}
+		call(t, c, 1)
+		time.Sleep(10 * time.Millisecond)
+	}
+}
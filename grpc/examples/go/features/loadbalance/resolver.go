@@ -0,0 +1,178 @@
+package loadbalance
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/resolver"
+)
+
+// 自定义的地址解析方案：
+//
+//	static:///host1:port1,host2:port2*3  静态地址列表，以逗号分隔
+//	file:///path/to/addrs.txt            从文件中读取地址，每行一个，# 开头为注释，文件修改后自动更新
+//
+// 每个地址后面可以用 *weight 指定权重，默认为 1，权重只对 weighted_least_request 策略有效。
+// 解析器不注册到全局，通过 WithResolvers 只作用于需要它们的客户端，不影响进程中其他客户端的 file 等地址。
+const (
+	StaticScheme = "static"
+	FileScheme   = "file"
+)
+
+// DefaultFileInterval 是 file 方案检查文件是否修改的时间间隔。
+const DefaultFileInterval = time.Second
+
+// WithResolvers 为客户端添加 static 和 file 方案的解析器。
+// grpc 使用第一个匹配方案的解析器，需要其他文件检查间隔时，把 grpc.WithResolvers(NewFileBuilder(interval)) 放在它之前。
+func WithResolvers() grpc.DialOption {
+	return grpc.WithResolvers(staticBuilder{}, NewFileBuilder(DefaultFileInterval))
+}
+
+// parseAddress 解析一个地址：host:port 或者 host:port*weight
+func parseAddress(entry string) (resolver.Address, error) {
+	addr, weight, found := strings.Cut(entry, "*")
+	if addr == "" {
+		return resolver.Address{}, fmt.Errorf("empty address in %q", entry)
+	}
+	w := uint64(1)
+	if found {
+		var err error
+		if w, err = strconv.ParseUint(weight, 10, 32); err != nil || w == 0 {
+			return resolver.Address{}, fmt.Errorf("invalid weight in %q", entry)
+		}
+	}
+	return WithWeight(resolver.Address{Addr: addr}, uint32(w)), nil
+}
+
+func parseAddresses(entries []string) ([]resolver.Address, error) {
+	addrs := []resolver.Address{}
+	for _, entry := range entries {
+		if entry = strings.TrimSpace(entry); entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		addr, err := parseAddress(entry)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no address")
+	}
+	return addrs, nil
+}
+
+type staticBuilder struct{}
+
+func (staticBuilder) Scheme() string {
+	return StaticScheme
+}
+
+func (staticBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	addrs, err := parseAddresses(strings.Split(target.Endpoint(), ","))
+	if err != nil {
+		return nil, fmt.Errorf("loadbalance: %v", err)
+	}
+	if err := cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		return nil, err
+	}
+	return staticResolver{}, nil
+}
+
+// staticResolver 的地址列表不会变化，不需要重新解析。
+type staticResolver struct{}
+
+func (staticResolver) ResolveNow(resolver.ResolveNowOptions) {}
+func (staticResolver) Close()                                {}
+
+type fileBuilder struct {
+	interval time.Duration
+}
+
+func (b fileBuilder) Scheme() string {
+	return FileScheme
+}
+
+func (b fileBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	// file:///abs/path 取 Path，file:rel/path 取 Opaque
+	path := target.URL.Path
+	if path == "" {
+		path = target.URL.Opaque
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &fileResolver{path: path, cc: cc, now: make(chan struct{}, 1), cancel: cancel}
+	if err := r.load(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("loadbalance: %v", err)
+	}
+	go r.watch(ctx, b.interval)
+	return r, nil
+}
+
+// NewFileBuilder 创建 file 方案的解析器，interval 为检查文件是否修改的时间间隔。
+// WithResolvers 中的解析器间隔为 DefaultFileInterval，需要其他间隔时通过 grpc.WithResolvers 使用。
+func NewFileBuilder(interval time.Duration) resolver.Builder {
+	if interval <= 0 {
+		interval = DefaultFileInterval
+	}
+	return fileBuilder{interval: interval}
+}
+
+type fileResolver struct {
+	path   string
+	cc     resolver.ClientConn
+	now    chan struct{}
+	cancel context.CancelFunc
+	last   []byte
+}
+
+// load 读取文件，内容变化时更新地址列表。
+func (r *fileResolver) load() error {
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	if r.last != nil && bytes.Equal(data, r.last) {
+		return nil
+	}
+	addrs, err := parseAddresses(strings.Split(string(data), "\n"))
+	if err != nil {
+		return fmt.Errorf("%s: %v", r.path, err)
+	}
+	r.last = data
+	return r.cc.UpdateState(resolver.State{Addresses: addrs})
+}
+
+func (r *fileResolver) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.now:
+		}
+		// 文件暂时不可用或者内容有误时保留之前的地址列表
+		if err := r.load(); err != nil {
+			r.cc.ReportError(err)
+		}
+	}
+}
+
+func (r *fileResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.now <- struct{}{}:
+	default:
+	}
+}
+
+func (r *fileResolver) Close() {
+	r.cancel()
+}
@@ -2,8 +2,8 @@ package main
 
 import (
 	"context"
-	"flag"
 	"fmt"
+	"goexamples/config"
 	"goexamples/features/proto/message"
 	"goexamples/utils"
 	"log"
@@ -14,14 +14,12 @@ import (
 	"google.golang.org/grpc/metadata"
 )
 
-var (
-	addr = flag.String("addr", "localhost:50051", "addr to connect to")
-)
+var cfg = config.DefaultClient
 
 func main() {
-	flag.Parse()
+	config.MustLoad(&cfg)
 	client, err := message.NewMessageSrvClient(
-		*addr,
+		cfg.Addr,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 	)
 	if err != nil {
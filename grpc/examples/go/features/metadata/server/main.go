@@ -1,23 +1,26 @@
 package main
 
 import (
-	"flag"
+	"goexamples/bootstrap"
+	"goexamples/config"
 	"goexamples/features/proto/message"
 	"log"
 	"net"
 )
 
-var (
-	port = flag.Int("port", 50051, "port to listen on")
-)
+var cfg = config.DefaultServer
 
 func main() {
-	flag.Parse()
-	server := message.NewMessageSrvServer()
-	onListen := func(lis net.Listener) {
-		log.Printf("server listening at %v\n", lis.Addr())
-	}
-	if err := server.Listen(*port, onListen); err != nil {
+	config.MustLoad(&cfg)
+	server := message.NewMessageSrvServer(
+		bootstrap.WithChannelz(cfg.Mode),
+		bootstrap.WithReflection(cfg.Mode),
+		bootstrap.WithTCP(cfg.Port),
+		bootstrap.OnListen(func(lis net.Listener) {
+			log.Printf("server listening at %v\n", lis.Addr())
+		}),
+	)
+	if err := server.ListenAndServe(); err != nil {
 		log.Fatalf("failed to listen: %v\n", err)
 	}
 }
@@ -2,15 +2,18 @@ package main
 
 import (
 	"context"
-	"flag"
 	"fmt"
+	"goexamples/config"
 	"goexamples/features/proto/message"
+	"goexamples/features/streamhook"
 	"goexamples/utils"
 	"log"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func unaryInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
@@ -31,17 +34,33 @@ func streamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.Clie
 	return streamer(ctx, desc, cc, method, opts...)
 }
 
-var (
-	addr = flag.String("addr", "localhost:50051", "addr to connect to")
-)
+// streamHooks 观察服务端返回的元数据：Header 在收到时触发，Trailer 在流结束后触发。
+func streamHooks() streamhook.Hooks {
+	return streamhook.Merge(
+		streamhook.Timing("client", 100*time.Millisecond),
+		streamhook.Hooks{
+			OnHeader: func(info *streamhook.Info, md metadata.MD) {
+				log.Printf("client stream hook header: method=%v, header=%v\n", info.FullMethod, utils.String(md))
+			},
+			OnTrailer: func(info *streamhook.Info, md metadata.MD) {
+				log.Printf("client stream hook trailer: method=%v, trailer=%v\n", info.FullMethod, utils.String(md))
+			},
+			OnClose: func(info *streamhook.Info, st *status.Status) {
+				log.Printf("client stream hook closed: method=%v, code=%v\n", info.FullMethod, st.Code())
+			},
+		},
+	)
+}
+
+var cfg = config.DefaultClient
 
 func main() {
-	flag.Parse()
+	config.MustLoad(&cfg)
 	client, err := message.NewMessageSrvClient(
-		*addr,
+		cfg.Addr,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 		grpc.WithUnaryInterceptor(unaryInterceptor),
-		grpc.WithStreamInterceptor(streamInterceptor),
+		grpc.WithChainStreamInterceptor(streamInterceptor, streamhook.StreamClientInterceptor(streamHooks())),
 	)
 	if err != nil {
 		log.Fatalf("did not start client: %v\n", err)
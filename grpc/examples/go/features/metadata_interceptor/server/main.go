@@ -3,14 +3,18 @@ package main
 import (
 	"context"
 	"errors"
-	"flag"
+	"goexamples/bootstrap"
+	"goexamples/config"
 	"goexamples/features/proto/message"
+	"goexamples/features/streamhook"
 	"goexamples/utils"
 	"log"
 	"net"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 var (
@@ -50,20 +54,42 @@ func streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInf
 	return handler(srv, ss)
 }
 
-var (
-	port = flag.Int("port", 50051, "port to listen on")
-)
+// streamHooks 观察元数据的设置：streamhook 拦截器先于 streamInterceptor 注册，
+// 因此 streamInterceptor 中调用的 ss.SetHeader / ss.SetTrailer 也会触发钩子。
+func streamHooks() streamhook.Hooks {
+	counter := streamhook.NewCounter()
+	return streamhook.Merge(
+		counter.Hooks(),
+		streamhook.Timing("server", 100*time.Millisecond),
+		streamhook.Hooks{
+			OnHeader: func(info *streamhook.Info, md metadata.MD) {
+				log.Printf("server stream hook header: method=%v, header=%v\n", info.FullMethod, utils.String(md))
+			},
+			OnTrailer: func(info *streamhook.Info, md metadata.MD) {
+				log.Printf("server stream hook trailer: method=%v, trailer=%v\n", info.FullMethod, utils.String(md))
+			},
+			OnClose: func(info *streamhook.Info, st *status.Status) {
+				log.Printf("server stream hook closed: method=%v, stats=%v\n", info.FullMethod, counter.Stats(info.FullMethod))
+			},
+		},
+	)
+}
+
+var cfg = config.DefaultServer
 
 func main() {
-	flag.Parse()
+	config.MustLoad(&cfg)
 	server := message.NewMessageSrvServer(
-		grpc.UnaryInterceptor(unaryInterceptor),
-		grpc.StreamInterceptor(streamInterceptor),
+		bootstrap.WithUnaryInterceptors(unaryInterceptor),
+		bootstrap.WithStreamInterceptors(streamhook.StreamServerInterceptor(streamHooks()), streamInterceptor),
+		bootstrap.WithChannelz(cfg.Mode),
+		bootstrap.WithReflection(cfg.Mode),
+		bootstrap.WithTCP(cfg.Port),
+		bootstrap.OnListen(func(lis net.Listener) {
+			log.Printf("server listening at %v\n", lis.Addr())
+		}),
 	)
-	onListen := func(lis net.Listener) {
-		log.Printf("server listening at %v\n", lis.Addr())
-	}
-	if err := server.Listen(*port, onListen); err != nil {
+	if err := server.ListenAndServe(); err != nil {
 		log.Fatalf("failed to listen: %v\n", err)
 	}
 }
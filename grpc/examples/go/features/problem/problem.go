@@ -0,0 +1,301 @@
+package problem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// ContentType 是 RFC 7807 规定的错误响应类型。
+	ContentType = "application/problem+json"
+	// DefaultType 表示错误没有更具体的说明，此时 title 为 HTTP 状态码的描述。
+	DefaultType = "about:blank"
+)
+
+// Problem 是 RFC 7807 的错误响应，Extensions 中的成员与标准成员平铺在同一个 JSON 对象中。
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]any
+}
+
+// standard 是 RFC 7807 定义的成员，按输出顺序排列。
+var standard = []string{"type", "title", "status", "detail", "instance"}
+
+// MarshalJSON 先输出标准成员，再按名称顺序平铺扩展成员，与标准成员同名的扩展成员被忽略。
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	values := map[string]any{"type": p.Type, "title": p.Title, "status": p.Status}
+	if p.Detail != "" {
+		values["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		values["instance"] = p.Instance
+	}
+	names := slices.Clone(standard)
+	for _, k := range slices.Sorted(maps.Keys(p.Extensions)) {
+		if !slices.Contains(standard, k) {
+			names = append(names, k)
+			values[k] = p.Extensions[k]
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for _, k := range names {
+		v, ok := values[k]
+		if !ok {
+			continue
+		}
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("problem: %s: %w", k, err)
+		}
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(buf)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// Statuses 是 gRPC 状态码到 HTTP 状态码的映射表，实现了 flag.Value，可以直接作为 config 的字段，
+// 每个值的格式为 NotFound=404，状态码名称也可以写成 NOT_FOUND 或数字。
+type Statuses map[codes.Code]int
+
+// DefaultStatuses 返回与 grpc-gateway 默认错误处理相同的映射表。
+func DefaultStatuses() Statuses {
+	s := Statuses{}
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		s[c] = runtime.HTTPStatusFromCode(c)
+	}
+	return s
+}
+
+func (s *Statuses) String() string {
+	if s == nil || *s == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*s))
+	for _, c := range slices.Sorted(maps.Keys(*s)) {
+		pairs = append(pairs, fmt.Sprintf("%v=%d", c, (*s)[c]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (s *Statuses) Set(v string) error {
+	name, value, ok := strings.Cut(v, "=")
+	if !ok {
+		return fmt.Errorf("status %q should be in the form NotFound=404", v)
+	}
+	code, err := ParseCode(strings.TrimSpace(name))
+	if err != nil {
+		return err
+	}
+	st, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || st < 100 || st > 599 {
+		return fmt.Errorf("invalid http status %q of %v", value, code)
+	}
+	if *s == nil {
+		*s = Statuses{}
+	}
+	(*s)[code] = st
+	return nil
+}
+
+// ParseCode 解析 gRPC 状态码，支持 NotFound、NOT_FOUND 和数字三种写法。
+func ParseCode(name string) (codes.Code, error) {
+	if n, err := strconv.ParseUint(name, 10, 32); err == nil && n <= uint64(codes.Unauthenticated) {
+		return codes.Code(n), nil
+	}
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if strings.EqualFold(strings.ReplaceAll(name, "_", ""), c.String()) {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown grpc code %q", name)
+}
+
+type Option func(*Handler)
+
+// WithStatuses 覆盖映射表中的部分状态码，没有覆盖的仍使用 DefaultStatuses。
+func WithStatuses(s Statuses) Option {
+	return func(h *Handler) {
+		maps.Copy(h.statuses, s)
+	}
+}
+
+// WithStatus 覆盖一个 gRPC 状态码对应的 HTTP 状态码。
+func WithStatus(code codes.Code, status int) Option {
+	return WithStatuses(Statuses{code: status})
+}
+
+// WithTypeBase 设置 type 的前缀，type 为前缀加上状态码名称，例如 https://example.com/problems/not-found，
+// 默认为 DefaultType。
+func WithTypeBase(base string) Option {
+	return func(h *Handler) {
+		h.typeBase = base
+	}
+}
+
+// Handler 将 gRPC 错误转为 RFC 7807 的错误响应，通过 ServeMuxOption 注册到网关上替换默认的错误处理。
+//
+// 扩展成员：
+//
+//	code: gRPC 状态码名称，例如 NotFound
+//	invalid-params: errdetails.BadRequest 中的字段错误，[{"name": "user.email", "reason": "..."}]
+//	retry-after: errdetails.RetryInfo 中的重试间隔（秒），同时设置 Retry-After 响应头
+//	resource: errdetails.ResourceInfo，{"type": "...", "name": "...", "owner": "...", "description": "..."}
+//	details: 其他错误详情，以 protojson 格式输出
+type Handler struct {
+	statuses Statuses
+	typeBase string
+}
+
+// Status 返回 gRPC 状态码对应的 HTTP 状态码，映射表中没有的状态码返回 500。
+func (h *Handler) Status(code codes.Code) int {
+	if st, ok := h.statuses[code]; ok {
+		return st
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *Handler) typeOf(code codes.Code) string {
+	if h.typeBase == "" {
+		return DefaultType
+	}
+	// NotFound -> not-found
+	var b strings.Builder
+	for i, r := range code.String() {
+		if 'A' <= r && r <= 'Z' {
+			if i > 0 {
+				b.WriteByte('-')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return strings.TrimSuffix(h.typeBase, "/") + "/" + b.String()
+}
+
+// FromError 按映射表将 err 转为 Problem，网关路由错误等 runtime.HTTPStatusError 保留其中的 HTTP 状态码。
+func (h *Handler) FromError(r *http.Request, err error) *Problem {
+	httpStatus := 0
+	var se *runtime.HTTPStatusError
+	if errors.As(err, &se) {
+		err, httpStatus = se.Err, se.HTTPStatus
+	}
+	s := status.Convert(err)
+	if httpStatus == 0 {
+		httpStatus = h.Status(s.Code())
+	}
+	p := &Problem{
+		Type:       h.typeOf(s.Code()),
+		Title:      http.StatusText(httpStatus),
+		Status:     httpStatus,
+		Detail:     s.Message(),
+		Extensions: map[string]any{"code": s.Code().String()},
+	}
+	if r != nil {
+		p.Instance = r.URL.RequestURI()
+	}
+
+	var others []json.RawMessage
+	for _, d := range s.Details() {
+		switch d := d.(type) {
+		case *errdetails.BadRequest:
+			params := make([]map[string]string, 0, len(d.GetFieldViolations()))
+			for _, v := range d.GetFieldViolations() {
+				params = append(params, map[string]string{"name": v.GetField(), "reason": v.GetDescription()})
+			}
+			p.Extensions["invalid-params"] = params
+		case *errdetails.RetryInfo:
+			p.Extensions["retry-after"] = d.GetRetryDelay().AsDuration().Seconds()
+		case *errdetails.ResourceInfo:
+			p.Extensions["resource"] = map[string]string{
+				"type":        d.GetResourceType(),
+				"name":        d.GetResourceName(),
+				"owner":       d.GetOwner(),
+				"description": d.GetDescription(),
+			}
+		case proto.Message:
+			if b, err := protojson.Marshal(d); err == nil {
+				others = append(others, b)
+			}
+		}
+	}
+	if len(others) > 0 {
+		p.Extensions["details"] = others
+	}
+	return p
+}
+
+// ErrorHandler 实现 runtime.ErrorHandlerFunc，与默认的错误处理一样转发 header 元数据，不转发 trailer。
+func (h *Handler) ErrorHandler(ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	p := h.FromError(r, err)
+
+	w.Header().Del("Trailer")
+	w.Header().Del("Transfer-Encoding")
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		for k, vs := range md.HeaderMD {
+			for _, v := range vs {
+				w.Header().Add(runtime.MetadataHeaderPrefix+k, v)
+			}
+		}
+	}
+	w.Header().Set("Content-Type", ContentType)
+	if after, ok := p.Extensions["retry-after"].(float64); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(after))))
+	}
+
+	buf, err := json.Marshal(p)
+	if err != nil {
+		grpclog.Errorf("Failed to marshal problem %v: %v", p, err)
+		buf = []byte(`{"type": "about:blank", "title": "Internal Server Error", "status": 500}`)
+		p.Status = http.StatusInternalServerError
+	}
+	w.WriteHeader(p.Status)
+	if r != nil && r.Method == http.MethodHead {
+		return
+	}
+	if _, err := w.Write(buf); err != nil {
+		grpclog.Errorf("Failed to write response: %v", err)
+	}
+}
+
+// ServeMuxOption 返回替换网关错误处理的选项，在创建网关时传入。
+func (h *Handler) ServeMuxOption() runtime.ServeMuxOption {
+	return runtime.WithErrorHandler(h.ErrorHandler)
+}
+
+// NewHandler 默认使用 DefaultStatuses 和 DefaultType。
+func NewHandler(opts ...Option) *Handler {
+	h := &Handler{statuses: DefaultStatuses()}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
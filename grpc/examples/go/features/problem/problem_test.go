@@ -0,0 +1,167 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestErrorHandler(t *testing.T) {
+	h := NewHandler(WithStatus(codes.FailedPrecondition, http.StatusConflict), WithTypeBase("https://example.com/problems/"))
+
+	st, err := status.New(codes.InvalidArgument, "invalid user").WithDetails(
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "user.email", Description: "must be an email"}}},
+		&errdetails.ErrorInfo{Reason: "INVALID", Domain: "example.com"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited, err := status.New(codes.ResourceExhausted, "too many requests").WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(1500 * time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing, err := status.New(codes.NotFound, "user 9 not found").WithDetails(&errdetails.ResourceInfo{ResourceType: "user.User", ResourceName: "users/9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		header map[string]string
+		want   map[string]any
+	}{
+		{
+			name:   "bad request",
+			err:    st.Err(),
+			status: http.StatusBadRequest,
+			want: map[string]any{
+				"type": "https://example.com/problems/invalid-argument", "title": "Bad Request", "status": 400.0,
+				"detail": "invalid user", "instance": "/api/v1/users?x=1", "code": "InvalidArgument",
+				"invalid-params": []any{map[string]any{"name": "user.email", "reason": "must be an email"}},
+				"details":        []any{map[string]any{"reason": "INVALID", "domain": "example.com"}},
+			},
+		},
+		{
+			name:   "retry info",
+			err:    limited.Err(),
+			status: http.StatusTooManyRequests,
+			header: map[string]string{"Retry-After": "2"},
+			want: map[string]any{
+				"type": "https://example.com/problems/resource-exhausted", "title": "Too Many Requests", "status": 429.0,
+				"detail": "too many requests", "instance": "/api/v1/users?x=1", "code": "ResourceExhausted", "retry-after": 1.5,
+			},
+		},
+		{
+			name:   "resource info",
+			err:    missing.Err(),
+			status: http.StatusNotFound,
+			want: map[string]any{
+				"type": "https://example.com/problems/not-found", "title": "Not Found", "status": 404.0,
+				"detail": "user 9 not found", "instance": "/api/v1/users?x=1", "code": "NotFound",
+				"resource": map[string]any{"type": "user.User", "name": "users/9", "owner": "", "description": ""},
+			},
+		},
+		{
+			name:   "configured status",
+			err:    status.Error(codes.FailedPrecondition, "no update mask"),
+			status: http.StatusConflict,
+			want: map[string]any{
+				"type": "https://example.com/problems/failed-precondition", "title": "Conflict", "status": 409.0,
+				"detail": "no update mask", "instance": "/api/v1/users?x=1", "code": "FailedPrecondition",
+			},
+		},
+		{
+			name:   "http status error",
+			err:    &runtime.HTTPStatusError{HTTPStatus: http.StatusMethodNotAllowed, Err: status.Error(codes.Unimplemented, "Method Not Allowed")},
+			status: http.StatusMethodNotAllowed,
+			want: map[string]any{
+				"type": "https://example.com/problems/unimplemented", "title": "Method Not Allowed", "status": 405.0,
+				"detail": "Method Not Allowed", "instance": "/api/v1/users?x=1", "code": "Unimplemented",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := runtime.NewServerMetadataContext(context.Background(), runtime.ServerMetadata{HeaderMD: metadata.Pairs("request-id", "42")})
+			w := httptest.NewRecorder()
+			h.ErrorHandler(ctx, nil, nil, w, httptest.NewRequest(http.MethodGet, "/api/v1/users?x=1", nil), tt.err)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != ContentType {
+				t.Fatalf("Content-Type = %q", ct)
+			}
+			if v := w.Header().Get("Grpc-Metadata-Request-Id"); v != "42" {
+				t.Fatalf("header metadata not forwarded: %v", w.Header())
+			}
+			for k, v := range tt.header {
+				if got := w.Header().Get(k); got != v {
+					t.Fatalf("%s = %q, want %q", k, got, v)
+				}
+			}
+			var got map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("body = %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 网关的路由错误也通过 Handler 输出
+func TestServeMuxOption(t *testing.T) {
+	mux := runtime.NewServeMux(NewHandler().ServeMuxOption())
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != ContentType {
+		t.Fatalf("status = %d, header = %v", w.Code, w.Header())
+	}
+	var p map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p["type"] != DefaultType || p["title"] != "Not Found" || p["instance"] != "/missing" {
+		t.Fatalf("problem = %v", p)
+	}
+}
+
+func TestStatuses(t *testing.T) {
+	s := Statuses{}
+	for _, v := range []string{"NotFound=410", "FAILED_PRECONDITION = 409", "14=502"} {
+		if err := s.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := (Statuses{codes.NotFound: 410, codes.FailedPrecondition: 409, codes.Unavailable: 502}); !reflect.DeepEqual(s, want) {
+		t.Fatalf("statuses = %v, want %v", s, want)
+	}
+	if got := s.String(); got != "NotFound=410,FailedPrecondition=409,Unavailable=502" {
+		t.Fatalf("String() = %q", got)
+	}
+	for _, v := range []string{"NotFound", "Missing=404", "NotFound=4040"} {
+		if err := s.Set(v); err == nil {
+			t.Errorf("Set(%q) accepted", v)
+		}
+	}
+
+	h := NewHandler(WithStatuses(s))
+	if h.Status(codes.NotFound) != 410 || h.Status(codes.InvalidArgument) != http.StatusBadRequest || h.Status(codes.Code(99)) != http.StatusInternalServerError {
+		t.Fatal("statuses not merged with the defaults")
+	}
+}
@@ -1,2 +1,3 @@
 #!/usr/bin/env bash
-protoc --go_out=. --go-grpc_out=. ./message.proto
+# validate/validate.proto 位于 features 目录
+protoc -I . -I ../.. --go_out=. --go-grpc_out=. ./message.proto
@@ -2,11 +2,19 @@ package message
 
 import (
 	context "context"
+	"goexamples/features/healthcheck"
+	"goexamples/features/keepalive"
+	"goexamples/features/streamheader"
+	"goexamples/streams"
 	"goexamples/utils"
-	"io"
 	"log"
+	"slices"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	// 注册 static、file 地址解析方案和 weighted_least_request 策略
+	"goexamples/features/loadbalance"
 )
 
 // Client Handler 实现：
@@ -39,21 +47,18 @@ func (c *MessageSrvClient) ClientStream(ctx context.Context, in []*Message, opts
 	// ClientStream.Recv() 也是一个阻塞方法，用于接收响应数据。在首次接收响应数据时会自动等待 Header 的到达，因为 Header 总是先于数据流传输。
 	// 在流式 rpc 通信中，若在服务端未显式发送 Header（即未调用 ServerStream.SendHeader()）时，
 	// 且在客户端下 Header 读取（ClientStream.Header()）先于响应数据读取（ClientStream.Recv()、ClientStreamingClient.CloseAndRecv()）执行，会导致双向阻塞死锁，即客户端和服务端相互等待对方响应。
-	if header, err := sin.Header(); err == nil {
-		log.Printf("client.ClientStream header: %s\n", utils.String(header))
-	}
-	for _, m := range in {
-		if err := sin.Send(m); err != nil {
-			return nil, err
+	// 因此这里不直接调用 Header()，而是在后台读取 Header，到达后通过回调处理，发送数据不受 Header 是否到达的影响。
+	streamheader.Watch(sin).Then(func(header metadata.MD, err error) {
+		if err == nil {
+			log.Printf("client.ClientStream header: %s\n", utils.String(header))
 		}
-	}
-
-	if mc, err := sin.CloseAndRecv(); err != nil {
+	})
+	mc, err := streams.SendAllAndClose(ctx, sin, slices.Values(in))
+	if err != nil {
 		return nil, err
-	} else {
-		log.Printf("client.ClientStream trailer: %s\n", utils.String(sin.Trailer()))
-		return mc.GetValue(), nil
 	}
+	log.Printf("client.ClientStream trailer: %s\n", utils.String(sin.Trailer()))
+	return mc.GetValue(), nil
 }
 
 func (c *MessageSrvClient) ServerStream(ctx context.Context, in []*Message, opts ...grpc.CallOption) ([]*Message, error) {
@@ -62,57 +67,53 @@ func (c *MessageSrvClient) ServerStream(ctx context.Context, in []*Message, opts
 		return nil, err
 	}
 
-	if header, err := sout.Header(); err == nil {
-		log.Printf("client.ServerStream header: %s\n", utils.String(header))
-	}
-
-	cout := []*Message{}
-	for {
-		out, err := sout.Recv()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
+	streamheader.Watch(sout).Then(func(header metadata.MD, err error) {
+		if err == nil {
+			log.Printf("client.ServerStream header: %s\n", utils.String(header))
 		}
-		cout = append(cout, out)
+	})
+
+	cout, err := streams.Collect(ctx, sout)
+	if err != nil {
+		return nil, err
 	}
 
 	log.Printf("client.ServerStream trailer: %s\n", utils.String(sout.Trailer()))
 	return cout, nil
 }
 
+// BidirectionalStream 基于全双工会话实现：发送在单独的协程中进行，接收与发送同时进行，服务端的响应不会堆积。
 func (c *MessageSrvClient) BidirectionalStream(ctx context.Context, in []*Message, opts ...grpc.CallOption) ([]*Message, error) {
-	stream, err := c.client.BidirectionalStream(ctx, opts...)
+	session, err := c.OpenBidirectionalStream(ctx, len(in), opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	if header, err := stream.Header(); err == nil {
-		log.Printf("client.BidirectionalStream header: %s\n", utils.String(header))
-	}
-
-	for _, m := range in {
-		if err := stream.Send(m); err != nil {
-			return nil, err
+	session.Header().Then(func(header metadata.MD, err error) {
+		if err == nil {
+			log.Printf("client.BidirectionalStream header: %s\n", utils.String(header))
 		}
-	}
-	if err := stream.CloseSend(); err != nil {
-		return nil, err
-	}
+	})
+
+	go func() {
+		for _, m := range in {
+			// 发送失败时会话已经结束，错误由 Wait 返回
+			if err := session.Send(m); err != nil {
+				return
+			}
+		}
+		session.CloseSend()
+	}()
 
 	cout := []*Message{}
-	for {
-		if out, err := stream.Recv(); err == nil {
-			cout = append(cout, out)
-		} else if err == io.EOF {
-			break
-		} else {
-			return nil, err
-		}
+	for out := range session.Recv() {
+		cout = append(cout, out)
+	}
+	if err := session.Wait(); err != nil {
+		return nil, err
 	}
 
-	log.Printf("client.BidirectionalStream trailer: %s\n", utils.String(stream.Trailer()))
+	log.Printf("client.BidirectionalStream trailer: %s\n", utils.String(session.Trailer()))
 	return cout, nil
 }
 
@@ -120,10 +121,19 @@ func (c *MessageSrvClient) Close() error {
 	return c.conn.Close()
 }
 
+// NewMessageSrvClient 默认开启客户端健康检查并使用 keepalive.DefaultClient 的保活配置，opts 中的同类选项可以覆盖。
+// addr 可以是单个地址，也可以是 static:///host1:port1,host2:port2 或 file:///path 形式的多个副本，默认以 round_robin 策略分配请求。
 func NewMessageSrvClient(addr string, opts ...grpc.DialOption) (*MessageSrvClient, error) {
+	opts = append(append(keepalive.DefaultClient.Options(), healthcheck.WithHealthCheck(MessageService_ServiceDesc.ServiceName)), opts...)
+	// 放在最后，opts 中同一方案的解析器优先
+	opts = append(opts, loadbalance.WithResolvers())
 	conn, err := grpc.NewClient(addr, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return &MessageSrvClient{conn: conn, client: NewMessageServiceClient(conn)}, nil
+	return NewMessageSrvClientFromConn(conn), nil
+}
+
+func NewMessageSrvClientFromConn(conn *grpc.ClientConn) *MessageSrvClient {
+	return &MessageSrvClient{conn: conn, client: NewMessageServiceClient(conn)}
 }
@@ -7,8 +7,10 @@
 package message
 
 import (
+	_ "goexamples/features/validate"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -21,9 +23,64 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// Kind 区分聊天室模式下的消息类型，普通的回显模式只使用 CHAT。
+type Kind int32
+
+const (
+	Kind_CHAT  Kind = 0 // 聊天消息
+	Kind_JOIN  Kind = 1 // 客户端发送时为加入聊天室的控制消息，服务端发送时为成员加入通知
+	Kind_LEAVE Kind = 2 // 成员离开通知
+)
+
+// Enum value maps for Kind.
+var (
+	Kind_name = map[int32]string{
+		0: "CHAT",
+		1: "JOIN",
+		2: "LEAVE",
+	}
+	Kind_value = map[string]int32{
+		"CHAT":  0,
+		"JOIN":  1,
+		"LEAVE": 2,
+	}
+)
+
+func (x Kind) Enum() *Kind {
+	p := new(Kind)
+	*p = x
+	return p
+}
+
+func (x Kind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Kind) Descriptor() protoreflect.EnumDescriptor {
+	return file_message_proto_enumTypes[0].Descriptor()
+}
+
+func (Kind) Type() protoreflect.EnumType {
+	return &file_message_proto_enumTypes[0]
+}
+
+func (x Kind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Kind.Descriptor instead.
+func (Kind) EnumDescriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{0}
+}
+
 type Message struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Content       string                 `protobuf:"bytes,1,opt,name=content,proto3" json:"content,omitempty"`
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Content string                 `protobuf:"bytes,1,opt,name=content,proto3" json:"content,omitempty"` // 消息内容，不能为空；JOIN 控制消息中服务端不使用
+	// 以下字段仅在聊天室模式下使用
+	Kind          Kind                   `protobuf:"varint,2,opt,name=kind,proto3,enum=message.Kind" json:"kind,omitempty"`
+	Room          string                 `protobuf:"bytes,3,opt,name=room,proto3" json:"room,omitempty"`
+	Sender        string                 `protobuf:"bytes,4,opt,name=sender,proto3" json:"sender,omitempty"`       // 发送者 id，由服务端填写
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // 服务端时间戳
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -65,6 +122,34 @@ func (x *Message) GetContent() string {
 	return ""
 }
 
+func (x *Message) GetKind() Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return Kind_CHAT
+}
+
+func (x *Message) GetRoom() string {
+	if x != nil {
+		return x.Room
+	}
+	return ""
+}
+
+func (x *Message) GetSender() string {
+	if x != nil {
+		return x.Sender
+	}
+	return ""
+}
+
+func (x *Message) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
 type MessageCollection struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Value         []*Message             `protobuf:"bytes,1,rep,name=value,proto3" json:"value,omitempty"`
@@ -113,11 +198,19 @@ var File_message_proto protoreflect.FileDescriptor
 
 const file_message_proto_rawDesc = "" +
 	"\n" +
-	"\rmessage.proto\x12\amessage\"#\n" +
-	"\aMessage\x12\x18\n" +
-	"\acontent\x18\x01 \x01(\tR\acontent\";\n" +
+	"\rmessage.proto\x12\amessage\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x17validate/validate.proto\"\xd9\x01\n" +
+	"\aMessage\x12#\n" +
+	"\acontent\x18\x01 \x01(\tB\t\x8a\xb5\x18\x05\b\x01\x18\x80 R\acontent\x12!\n" +
+	"\x04kind\x18\x02 \x01(\x0e2\r.message.KindR\x04kind\x12,\n" +
+	"\x04room\x18\x03 \x01(\tB\x18\x8a\xb5\x18\x14\x18@\"\x10^[A-Za-z0-9_-]*$R\x04room\x12\x1e\n" +
+	"\x06sender\x18\x04 \x01(\tB\x06\x8a\xb5\x18\x02\x18 R\x06sender\x128\n" +
+	"\ttimestamp\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\";\n" +
 	"\x11MessageCollection\x12&\n" +
-	"\x05value\x18\x01 \x03(\v2\x10.message.MessageR\x05value2\x84\x02\n" +
+	"\x05value\x18\x01 \x03(\v2\x10.message.MessageR\x05value*%\n" +
+	"\x04Kind\x12\b\n" +
+	"\x04CHAT\x10\x00\x12\b\n" +
+	"\x04JOIN\x10\x01\x12\t\n" +
+	"\x05LEAVE\x10\x022\x84\x02\n" +
 	"\x0eMessageService\x12-\n" +
 	"\x05Unary\x12\x10.message.Message\x1a\x10.message.Message\"\x00\x12@\n" +
 	"\fClientStream\x12\x10.message.Message\x1a\x1a.message.MessageCollection\"\x00(\x01\x12@\n" +
@@ -136,26 +229,31 @@ func file_message_proto_rawDescGZIP() []byte {
 	return file_message_proto_rawDescData
 }
 
+var file_message_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
 var file_message_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
 var file_message_proto_goTypes = []any{
-	(*Message)(nil),           // 0: message.Message
-	(*MessageCollection)(nil), // 1: message.MessageCollection
+	(Kind)(0),                     // 0: message.Kind
+	(*Message)(nil),               // 1: message.Message
+	(*MessageCollection)(nil),     // 2: message.MessageCollection
+	(*timestamppb.Timestamp)(nil), // 3: google.protobuf.Timestamp
 }
 var file_message_proto_depIdxs = []int32{
-	0, // 0: message.MessageCollection.value:type_name -> message.Message
-	0, // 1: message.MessageService.Unary:input_type -> message.Message
-	0, // 2: message.MessageService.ClientStream:input_type -> message.Message
-	1, // 3: message.MessageService.ServerStream:input_type -> message.MessageCollection
-	0, // 4: message.MessageService.BidirectionalStream:input_type -> message.Message
-	0, // 5: message.MessageService.Unary:output_type -> message.Message
-	1, // 6: message.MessageService.ClientStream:output_type -> message.MessageCollection
-	0, // 7: message.MessageService.ServerStream:output_type -> message.Message
-	0, // 8: message.MessageService.BidirectionalStream:output_type -> message.Message
-	5, // [5:9] is the sub-list for method output_type
-	1, // [1:5] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	0, // 0: message.Message.kind:type_name -> message.Kind
+	3, // 1: message.Message.timestamp:type_name -> google.protobuf.Timestamp
+	1, // 2: message.MessageCollection.value:type_name -> message.Message
+	1, // 3: message.MessageService.Unary:input_type -> message.Message
+	1, // 4: message.MessageService.ClientStream:input_type -> message.Message
+	2, // 5: message.MessageService.ServerStream:input_type -> message.MessageCollection
+	1, // 6: message.MessageService.BidirectionalStream:input_type -> message.Message
+	1, // 7: message.MessageService.Unary:output_type -> message.Message
+	2, // 8: message.MessageService.ClientStream:output_type -> message.MessageCollection
+	1, // 9: message.MessageService.ServerStream:output_type -> message.Message
+	1, // 10: message.MessageService.BidirectionalStream:output_type -> message.Message
+	7, // [7:11] is the sub-list for method output_type
+	3, // [3:7] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_message_proto_init() }
@@ -168,13 +266,14 @@ func file_message_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_message_proto_rawDesc), len(file_message_proto_rawDesc)),
-			NumEnums:      0,
+			NumEnums:      1,
 			NumMessages:   2,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_message_proto_goTypes,
 		DependencyIndexes: file_message_proto_depIdxs,
+		EnumInfos:         file_message_proto_enumTypes,
 		MessageInfos:      file_message_proto_msgTypes,
 	}.Build()
 	File_message_proto = out.File
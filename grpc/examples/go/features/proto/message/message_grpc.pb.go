@@ -32,6 +32,7 @@ type MessageServiceClient interface {
 	Unary(ctx context.Context, in *Message, opts ...grpc.CallOption) (*Message, error)
 	ClientStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Message, MessageCollection], error)
 	ServerStream(ctx context.Context, in *MessageCollection, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Message], error)
+	// 默认回显客户端发送的每条消息；通过元数据 room 或首条 JOIN 控制消息加入聊天室后，消息广播给聊天室中的所有成员
 	BidirectionalStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[Message, Message], error)
 }
 
@@ -105,6 +106,7 @@ type MessageServiceServer interface {
 	Unary(context.Context, *Message) (*Message, error)
 	ClientStream(grpc.ClientStreamingServer[Message, MessageCollection]) error
 	ServerStream(*MessageCollection, grpc.ServerStreamingServer[Message]) error
+	// 默认回显客户端发送的每条消息；通过元数据 room 或首条 JOIN 控制消息加入聊天室后，消息广播给聊天室中的所有成员
 	BidirectionalStream(grpc.BidiStreamingServer[Message, Message]) error
 	mustEmbedUnimplementedMessageServiceServer()
 }
@@ -0,0 +1,102 @@
+package message
+
+import (
+	"context"
+	"goexamples/harness"
+	"slices"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func contents(mc []*Message) []string {
+	out := make([]string, len(mc))
+	for i, m := range mc {
+		out[i] = m.GetContent()
+	}
+	return out
+}
+
+func TestMessageService(t *testing.T) {
+	var mu sync.Mutex
+	methods := []string{}
+	record := func(method string) {
+		mu.Lock()
+		defer mu.Unlock()
+		methods = append(methods, method)
+	}
+	c := startMessageSrv(t,
+		harness.WithUnaryInterceptors(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			record(info.FullMethod)
+			return handler(ctx, req)
+		}),
+		harness.WithStreamInterceptors(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			record(info.FullMethod)
+			return handler(srv, ss)
+		}),
+	)
+	in := []*Message{{Content: "a"}, {Content: "b"}, {Content: "c"}}
+
+	tests := []struct {
+		method string
+		call   func(ctx context.Context, opts ...grpc.CallOption) ([]*Message, error)
+		want   []string
+	}{
+		{
+			method: MessageService_Unary_FullMethodName,
+			call: func(ctx context.Context, opts ...grpc.CallOption) ([]*Message, error) {
+				out, err := c.Unary(ctx, in[0], opts...)
+				return []*Message{out}, err
+			},
+			want: []string{"a"},
+		},
+		{
+			method: MessageService_ClientStream_FullMethodName,
+			call: func(ctx context.Context, opts ...grpc.CallOption) ([]*Message, error) {
+				return c.ClientStream(ctx, in, opts...)
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			method: MessageService_ServerStream_FullMethodName,
+			call: func(ctx context.Context, opts ...grpc.CallOption) ([]*Message, error) {
+				return c.ServerStream(ctx, in, opts...)
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			method: MessageService_BidirectionalStream_FullMethodName,
+			call: func(ctx context.Context, opts ...grpc.CallOption) ([]*Message, error) {
+				return c.BidirectionalStream(ctx, in, opts...)
+			},
+			want: []string{"a", "b", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("test", tt.method))
+			var header, trailer metadata.MD
+			out, err := tt.call(ctx, grpc.Header(&header), grpc.Trailer(&trailer))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := contents(out); !slices.Equal(got, tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, got)
+			}
+			// 服务端在 Header 和 Trailer 中都会返回 from 元数据
+			if len(header.Get("from")) == 0 || len(trailer.Get("from")) == 0 {
+				t.Fatalf("want server header and trailer, got %v, %v", header, trailer)
+			}
+		})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, tt := range tests {
+		if !slices.Contains(methods, tt.method) {
+			t.Fatalf("want interceptor called for %s, got %v", tt.method, methods)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package message
+
+import (
+	"context"
+	"fmt"
+	"goexamples/utils"
+	"io"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// 通过元数据加入聊天室时使用的键，也可以在首条 JOIN 控制消息的 room、sender 字段中指定。
+const (
+	RoomKey   = "room"
+	SenderKey = "sender"
+)
+
+// DefaultRoomBuffer 是每个订阅者默认的缓冲消息数量。
+const DefaultRoomBuffer = 64
+
+// SlowPolicy 决定订阅者的缓冲区已满（消费太慢）时如何处理新消息。
+type SlowPolicy int
+
+const (
+	// DropSlow 丢弃发给该订阅者的新消息，不影响其他成员。
+	DropSlow SlowPolicy = iota
+	// DisconnectSlow 断开该订阅者，流以 ResourceExhausted 结束。
+	DisconnectSlow
+)
+
+type subscriber struct {
+	id      string
+	out     chan *Message
+	kicked  chan struct{}
+	once    sync.Once
+	dropped int
+}
+
+func (s *subscriber) kick() {
+	s.once.Do(func() { close(s.kicked) })
+}
+
+// Rooms 管理所有聊天室及其成员，每个成员拥有一个有界缓冲区，广播时不会因为某个成员消费太慢而阻塞。
+type Rooms struct {
+	buffer int
+	policy SlowPolicy
+	now    func() time.Time
+
+	mu    sync.Mutex
+	rooms map[string]map[*subscriber]struct{}
+}
+
+// deliver 将消息放入订阅者的缓冲区，调用方需持有锁。
+func (r *Rooms) deliver(sub *subscriber, m *Message) {
+	select {
+	case sub.out <- m:
+		return
+	default:
+	}
+	switch r.policy {
+	case DisconnectSlow:
+		sub.kick()
+	default:
+		if sub.dropped++; sub.dropped == 1 || sub.dropped%100 == 0 {
+			log.Printf("rooms: subscriber %s is too slow, %d messages dropped\n", sub.id, sub.dropped)
+		}
+	}
+}
+
+// Broadcast 为消息填写服务端时间戳后，发送给聊天室中的所有成员。
+func (r *Rooms) Broadcast(room string, m *Message) {
+	m.Room = room
+	m.Timestamp = timestamppb.New(r.now())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for sub := range r.rooms[room] {
+		r.deliver(sub, m)
+	}
+}
+
+// Members 返回聊天室中所有成员的 id。
+func (r *Rooms) Members(room string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]string, 0, len(r.rooms[room]))
+	for sub := range r.rooms[room] {
+		ids = append(ids, sub.id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// join 加入聊天室，sub.id 为空或者与其他成员重复时重新分配。
+func (r *Rooms) join(room string, sub *subscriber) {
+	r.mu.Lock()
+	if r.rooms[room] == nil {
+		r.rooms[room] = map[*subscriber]struct{}{}
+	}
+	switch {
+	case sub.id == "":
+		sub.id = utils.RandString(8)
+	case r.taken(room, sub.id):
+		// 保留期望的 id 作为前缀，方便其他成员辨认
+		sub.id += "-" + utils.RandString(4)
+	}
+	for r.taken(room, sub.id) {
+		sub.id = utils.RandString(8)
+	}
+	r.rooms[room][sub] = struct{}{}
+	r.mu.Unlock()
+	// 加入通知也会发给自己，客户端可以从中得知服务端分配的 id
+	r.Broadcast(room, &Message{Kind: Kind_JOIN, Sender: sub.id, Content: fmt.Sprintf("%s joined", sub.id)})
+}
+
+// taken 判断 id 是否已被聊天室中的成员使用，调用方需持有锁。
+func (r *Rooms) taken(room, id string) bool {
+	for sub := range r.rooms[room] {
+		if sub.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rooms) leave(room string, sub *subscriber) {
+	r.mu.Lock()
+	delete(r.rooms[room], sub)
+	if len(r.rooms[room]) == 0 {
+		delete(r.rooms, room)
+	}
+	r.mu.Unlock()
+	r.Broadcast(room, &Message{Kind: Kind_LEAVE, Sender: sub.id, Content: fmt.Sprintf("%s left", sub.id)})
+}
+
+// Serve 以 sender 的身份加入聊天室，直到客户端取消流或者因为消费太慢被断开；客户端关闭发送后只接收消息。
+// sender 只是客户端期望的 id，为空时由服务端生成一个随机 id，与聊天室中的成员重复时由服务端添加随机后缀，
+// 实际的 id 通过发给自己的加入通知得知，聊天消息的发送者总是由服务端填写。
+func (r *Rooms) Serve(stream grpc.BidiStreamingServer[Message, Message], room, sender string) error {
+	if room == "" {
+		return status.Error(codes.InvalidArgument, "room is required")
+	}
+	sub := &subscriber{id: sender, out: make(chan *Message, r.buffer), kicked: make(chan struct{})}
+	r.join(room, sub)
+	defer r.leave(room, sub)
+
+	// 接收在单独的协程中进行，广播给其他成员的消息不会等待本成员的发送
+	ctx := stream.Context()
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			in, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			// 重复的控制消息直接忽略
+			if in.GetKind() != Kind_CHAT {
+				continue
+			}
+			r.Broadcast(room, &Message{Kind: Kind_CHAT, Sender: sub.id, Content: in.GetContent()})
+		}
+	}()
+
+	for {
+		select {
+		case m := <-sub.out:
+			if err := stream.Send(m); err != nil {
+				return err
+			}
+		case err := <-recvErr:
+			// 客户端关闭发送后仍然可以接收，继续投递缓冲区中和之后的消息，直到客户端取消或者被断开
+			if err != io.EOF {
+				return err
+			}
+			recvErr = nil
+		case <-sub.kicked:
+			return status.Errorf(codes.ResourceExhausted, "subscriber %s is too slow, disconnected", sub.id)
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+func NewRooms(buffer int, policy SlowPolicy) *Rooms {
+	if buffer < 1 {
+		buffer = DefaultRoomBuffer
+	}
+	return &Rooms{buffer: buffer, policy: policy, now: time.Now, rooms: map[string]map[*subscriber]struct{}{}}
+}
+
+// JoinMetadata 生成加入聊天室所需的元数据，sender 可以为空。
+func JoinMetadata(room, sender string) metadata.MD {
+	md := metadata.Pairs(RoomKey, room)
+	if sender != "" {
+		md.Set(SenderKey, sender)
+	}
+	return md
+}
+
+func roomFromMetadata(ctx context.Context) (room, sender string, ok bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(RoomKey); len(v) > 0 && v[0] != "" {
+		room = v[0]
+		if v := md.Get(SenderKey); len(v) > 0 {
+			sender = v[0]
+		}
+		return room, sender, true
+	}
+	return "", "", false
+}
+
+// JoinRoom 打开一个全双工会话并发送 JOIN 控制消息加入聊天室，之后通过会话收发聊天消息。
+func (c *MessageSrvClient) JoinRoom(ctx context.Context, room, sender string, bufferSize int, opts ...grpc.CallOption) (*BidirectionalSession, error) {
+	session, err := c.OpenBidirectionalStream(ctx, bufferSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := session.Send(&Message{Kind: Kind_JOIN, Room: room, Sender: sender, Content: "join " + room}); err != nil {
+		// 发送失败时会话已经结束，Wait 返回真正的错误
+		session.Cancel()
+		if werr := session.Wait(); werr != nil {
+			err = werr
+		}
+		return nil, err
+	}
+	return session, nil
+}
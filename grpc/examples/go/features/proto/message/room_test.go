@@ -0,0 +1,173 @@
+package message
+
+import (
+	"context"
+	"goexamples/bootstrap"
+	"goexamples/harness"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func startRoomSrv(t *testing.T, rooms *Rooms, opts ...harness.Option) *MessageSrvClient {
+	t.Helper()
+	conn := harness.New(t, opts...).Start(func(opts ...grpc.ServerOption) harness.Server {
+		srv := NewMessageSrvServer(bootstrap.WithServerOptions(opts...))
+		srv.SetRooms(rooms)
+		return srv
+	})
+	return NewMessageSrvClientFromConn(conn)
+}
+
+func expect(t *testing.T, session *BidirectionalSession, kind Kind, sender, content string) *Message {
+	t.Helper()
+	select {
+	case m, ok := <-session.Recv():
+		if !ok {
+			t.Fatalf("session closed: %v", session.Err())
+		}
+		if m.GetKind() != kind || m.GetSender() != sender || (content != "" && m.GetContent() != content) {
+			t.Fatalf("want %v from %s %q, got %v from %s %q", kind, sender, content, m.GetKind(), m.GetSender(), m.GetContent())
+		}
+		if m.GetRoom() != "lobby" || m.GetTimestamp() == nil {
+			t.Fatalf("want room and server timestamp, got %v, %v", m.GetRoom(), m.GetTimestamp())
+		}
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no %v message from %s", kind, sender)
+	}
+	return nil
+}
+
+func TestRoomsBroadcast(t *testing.T) {
+	rooms := NewRooms(8, DropSlow)
+	c := startRoomSrv(t, rooms)
+
+	// alice 通过 JOIN 控制消息加入，bob 通过元数据加入
+	alice, err := c.JoinRoom(context.Background(), "lobby", "alice", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, alice, Kind_JOIN, "alice", "")
+
+	ctx := metadata.NewOutgoingContext(context.Background(), JoinMetadata("lobby", "bob"))
+	bob, err := c.OpenBidirectionalStream(ctx, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, bob, Kind_JOIN, "bob", "")
+	expect(t, alice, Kind_JOIN, "bob", "")
+
+	if err := bob.Send(&Message{Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, alice, Kind_CHAT, "bob", "hi")
+	expect(t, bob, Kind_CHAT, "bob", "hi")
+
+	// 关闭发送后仍然是聊天室的成员，可以继续接收消息
+	if err := bob.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.Send(&Message{Content: "bye"}); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, alice, Kind_CHAT, "alice", "bye")
+	expect(t, bob, Kind_CHAT, "alice", "bye")
+
+	bob.Cancel()
+	if err := bob.Wait(); status.Code(err) != codes.Canceled {
+		t.Fatalf("want Canceled, got %v", err)
+	}
+	expect(t, alice, Kind_LEAVE, "bob", "")
+	if got := rooms.Members("lobby"); len(got) != 1 || got[0] != "alice" {
+		t.Fatalf("want only alice left, got %v", got)
+	}
+	alice.Cancel()
+	alice.Wait()
+}
+
+// 客户端指定的 id 与其他成员重复时由服务端重新分配，聊天消息的发送者总是服务端分配的 id
+func TestRoomsUniqueSender(t *testing.T) {
+	rooms := NewRooms(8, DropSlow)
+	c := startRoomSrv(t, rooms)
+
+	alice, err := c.JoinRoom(context.Background(), "lobby", "alice", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, alice, Kind_JOIN, "alice", "")
+	defer alice.Cancel()
+
+	fake, err := c.JoinRoom(context.Background(), "lobby", "alice", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Cancel()
+	select {
+	case m := <-fake.Recv():
+		if m.GetKind() != Kind_JOIN || !strings.HasPrefix(m.GetSender(), "alice-") {
+			t.Fatalf("want a new id prefixed with alice-, got %v", m)
+		}
+		id := m.GetSender()
+		expect(t, alice, Kind_JOIN, id, "")
+		if err := fake.Send(&Message{Sender: "alice", Content: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, alice, Kind_CHAT, id, "hi")
+	case <-time.After(2 * time.Second):
+		t.Fatal("no join notice")
+	}
+}
+
+// 没有加入聊天室时保持原来的回显行为
+func TestRoomsEchoWithoutJoin(t *testing.T) {
+	c := startRoomSrv(t, NewRooms(8, DropSlow))
+	out, err := c.BidirectionalStream(context.Background(), []*Message{{Content: "a"}, {Content: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 || out[0].GetContent() != "a" || out[1].GetContent() != "b" {
+		t.Fatalf("want echo, got %v", out)
+	}
+}
+
+func TestRoomsSlowSubscriber(t *testing.T) {
+	tests := []struct {
+		policy      SlowPolicy
+		wantKicked  bool
+		wantDropped int
+	}{
+		{policy: DropSlow, wantDropped: 2},
+		{policy: DisconnectSlow, wantKicked: true},
+	}
+	for _, tt := range tests {
+		rooms := NewRooms(1, tt.policy)
+		// 缓冲区只能放下加入通知，之后的两条消息都放不下
+		slow := &subscriber{id: "slow", out: make(chan *Message, 1), kicked: make(chan struct{})}
+		rooms.join("lobby", slow)
+		rooms.Broadcast("lobby", &Message{Content: "1"})
+		rooms.Broadcast("lobby", &Message{Content: "2"})
+
+		select {
+		case <-slow.kicked:
+			if !tt.wantKicked {
+				t.Fatalf("policy %v: unexpected disconnect", tt.policy)
+			}
+		default:
+			if tt.wantKicked {
+				t.Fatalf("policy %v: want disconnect", tt.policy)
+			}
+		}
+		if slow.dropped != tt.wantDropped {
+			t.Fatalf("policy %v: want %d dropped, got %d", tt.policy, tt.wantDropped, slow.dropped)
+		}
+		if m := <-slow.out; m.GetKind() != Kind_JOIN {
+			t.Fatalf("policy %v: want join notice kept, got %v", tt.policy, m)
+		}
+	}
+}
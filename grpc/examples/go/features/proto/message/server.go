@@ -2,11 +2,10 @@ package message
 
 import (
 	"context"
-	"fmt"
+	"goexamples/bootstrap"
 	"goexamples/utils"
 	"io"
 	"log"
-	"net"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
@@ -20,19 +19,14 @@ import (
 //  4. 依据情况，设置 Trailer ？
 //  5. 结束 rpc 响应
 type MessageSrvServer struct {
-	server *grpc.Server
+	*bootstrap.Server
+	rooms *Rooms
 	UnimplementedMessageServiceServer
 }
 
-func (s *MessageSrvServer) Listen(port int, onListen func(net.Listener)) error {
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		return err
-	}
-	if onListen != nil {
-		onListen(lis)
-	}
-	return s.server.Serve(lis)
+// SetRooms 替换聊天室模式使用的 Rooms，用于调整缓冲区大小和慢消费者的处理策略。
+func (s *MessageSrvServer) SetRooms(rooms *Rooms) {
+	s.rooms = rooms
 }
 
 func (s *MessageSrvServer) Unary(ctx context.Context, in *Message) (*Message, error) {
@@ -101,25 +95,42 @@ func (s *MessageSrvServer) BidirectionalStream(sbin grpc.BidiStreamingServer[Mes
 		sbin.SendHeader(GenerateServerMetadata("server.BidirectionalStream header"))
 		defer sbin.SetTrailer(GenerateServerMetadata("server.BidirectionalStream trailer"))
 	}
+	// 通过元数据加入聊天室
+	if room, sender, ok := roomFromMetadata(sbin.Context()); ok {
+		return s.rooms.Serve(sbin, room, sender)
+	}
+	// 通过首条 JOIN 控制消息加入聊天室，否则按回显模式处理
+	in, err := sbin.Recv()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if in.GetKind() == Kind_JOIN {
+		return s.rooms.Serve(sbin, in.GetRoom(), in.GetSender())
+	}
 	for {
-		in, err := sbin.Recv()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
 		log.Printf("server.BidirectionalStream received message: %s\n", in.GetContent())
 		if err := sbin.Send(in); err != nil {
 			return err
 		}
+		if in, err = sbin.Recv(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
 	}
-	return nil
 }
 
-func NewMessageSrvServer(opts ...grpc.ServerOption) *MessageSrvServer {
-	server := grpc.NewServer(opts...)
-	srv := &MessageSrvServer{server: server}
-	RegisterMessageServiceServer(server, srv)
+// NewMessageSrvServer 注册 MessageService 和健康检查服务，opts 可以添加拦截器、反射、监听器等，参考 bootstrap.New。
+// 请求按 message.proto 中声明的校验规则检查，校验拦截器在 opts 中的拦截器之后执行。
+func NewMessageSrvServer(opts ...bootstrap.Option) *MessageSrvServer {
+	srv := &MessageSrvServer{rooms: NewRooms(DefaultRoomBuffer, DropSlow)}
+	srv.Server = bootstrap.New(append([]bootstrap.Option{
+		bootstrap.WithService(&MessageService_ServiceDesc, srv),
+		bootstrap.WithHealth(),
+		bootstrap.WithValidation(),
+	}, opts...)...)
 	return srv
 }
@@ -0,0 +1,151 @@
+package message
+
+import (
+	context "context"
+	"goexamples/features/streamheader"
+	"goexamples/streams"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// BidirectionalSession 是全双工的双向流会话，发送和接收相互独立，可以交替进行。
+//
+//   - Send 可以在任意协程中调用，多个协程并发调用时按调用顺序串行发送
+//   - Recv 返回接收消息的通道，流结束时通道关闭
+//   - 接收通道有界，调用方消费过慢时后台协程停止读取，由 http/2 流量控制向服务端施加背压；Send 同样受流量控制阻塞
+//   - 任意一端出错或者 ctx 被取消，都会结束整个会话，之后 Send 返回错误，Wait 返回结束的原因
+type BidirectionalSession struct {
+	stream grpc.BidiStreamingClient[Message, Message]
+	ctx    context.Context
+	cancel context.CancelFunc
+	header *streamheader.Future
+
+	sendMu     sync.Mutex
+	sendClosed bool
+
+	recv chan *Message
+	done chan struct{}
+
+	errOnce sync.Once
+	err     error
+}
+
+// fail 记录会话的第一个错误并取消会话。
+func (s *BidirectionalSession) fail(err error) {
+	s.errOnce.Do(func() {
+		s.err = err
+		s.cancel()
+	})
+}
+
+func (s *BidirectionalSession) recvLoop() {
+	defer close(s.done)
+	defer close(s.recv)
+	// 流正常结束时同样用掉 errOnce，done 关闭之后 Send 中的 fail 不再修改 err
+	defer s.errOnce.Do(func() {})
+	for m, err := range streams.All(s.ctx, s.stream) {
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		select {
+		case s.recv <- m:
+		case <-s.ctx.Done():
+			s.fail(status.FromContextError(s.ctx.Err()).Err())
+			return
+		}
+	}
+}
+
+// Send 发送一条消息。流已经结束时返回 io.EOF，结束的原因通过 Wait 获取。
+func (s *BidirectionalSession) Send(m *Message) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	if s.sendClosed {
+		return status.Error(codes.FailedPrecondition, "message: send after CloseSend")
+	}
+	if err := s.stream.Send(m); err != nil {
+		// io.EOF 表示流已经结束，真正的错误由接收协程从 Recv 中获得，通过 Wait 返回
+		if err != io.EOF {
+			s.fail(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// CloseSend 告诉服务端客户端已发送完所有消息，之后仍可以继续接收。
+func (s *BidirectionalSession) CloseSend() error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	if s.sendClosed {
+		return nil
+	}
+	s.sendClosed = true
+	return s.stream.CloseSend()
+}
+
+// Recv 返回接收消息的通道，流结束或者出错时关闭，错误通过 Wait / Err 获取。
+func (s *BidirectionalSession) Recv() <-chan *Message {
+	return s.recv
+}
+
+// Header 返回异步获取的响应 Header。
+func (s *BidirectionalSession) Header() *streamheader.Future {
+	return s.header
+}
+
+// Trailer 返回响应 Trailer，只能在 Wait 返回后调用。
+func (s *BidirectionalSession) Trailer() metadata.MD {
+	return s.stream.Trailer()
+}
+
+// Err 返回会话的错误，会话正常结束或尚未结束时为 nil。
+func (s *BidirectionalSession) Err() error {
+	select {
+	case <-s.done:
+	default:
+		return nil
+	}
+	return s.err
+}
+
+// Wait 等待服务端结束流，返回会话的错误。
+// 调用方需要持续消费 Recv 返回的通道，或者取消会话，否则 Wait 可能因为背压一直阻塞。
+func (s *BidirectionalSession) Wait() error {
+	<-s.done
+	s.cancel()
+	return s.err
+}
+
+// Cancel 立即结束会话，服务端会收到 codes.Canceled。
+func (s *BidirectionalSession) Cancel() {
+	s.cancel()
+}
+
+// OpenBidirectionalStream 打开一个双向流会话，bufferSize 为接收通道的容量。
+func (c *MessageSrvClient) OpenBidirectionalStream(ctx context.Context, bufferSize int, opts ...grpc.CallOption) (*BidirectionalSession, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := c.client.BidirectionalStream(ctx, opts...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	s := &BidirectionalSession{
+		stream: stream,
+		ctx:    ctx,
+		cancel: cancel,
+		header: streamheader.Watch(stream),
+		recv:   make(chan *Message, max(bufferSize, 0)),
+		done:   make(chan struct{}),
+	}
+	go s.recvLoop()
+	return s, nil
+}
@@ -0,0 +1,110 @@
+package message
+
+import (
+	"context"
+	"fmt"
+	"goexamples/harness"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func startMessageSrv(t *testing.T, opts ...harness.Option) *MessageSrvClient {
+	t.Helper()
+	return startRoomSrv(t, NewRooms(DefaultRoomBuffer, DropSlow), opts...)
+}
+
+// 一问一答：每发送一条消息都等待服务端的回应后再发送下一条，只有全双工才能完成
+func TestBidirectionalSessionPingPong(t *testing.T) {
+	c := startMessageSrv(t)
+	session, err := c.OpenBidirectionalStream(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 5 {
+		content := fmt.Sprintf("ping %d", i)
+		if err := session.Send(&Message{Content: content}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case m := <-session.Recv():
+			if m.GetContent() != content {
+				t.Fatalf("want %q, got %q", content, m.GetContent())
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no reply for %q", content)
+		}
+	}
+
+	if err := session.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Send(&Message{Content: "after close"}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("want FailedPrecondition, got %v", err)
+	}
+	if _, ok := <-session.Recv(); ok {
+		t.Fatal("want receive channel closed")
+	}
+	if err := session.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if md, err := session.Header().Get(context.Background()); err != nil || len(md.Get("from")) == 0 {
+		t.Fatalf("unexpected header: %v, %v", md, err)
+	}
+	if len(session.Trailer().Get("from")) == 0 {
+		t.Fatalf("unexpected trailer: %v", session.Trailer())
+	}
+}
+
+func TestBidirectionalSessionCancel(t *testing.T) {
+	c := startMessageSrv(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	// 接收通道容量为 0 且不消费，后台协程阻塞在发送到通道上，取消后应当结束
+	session, err := c.OpenBidirectionalStream(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		if err := session.Send(&Message{Content: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cancel()
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+	select {
+	case err := <-done:
+		if status.Code(err) != codes.Canceled {
+			t.Fatalf("want Canceled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("session not finished after cancel")
+	}
+	if err := session.Send(&Message{Content: "after cancel"}); err == nil {
+		t.Fatal("want send error after cancel")
+	}
+}
+
+func TestBidirectionalStream(t *testing.T) {
+	c := startMessageSrv(t)
+	in := []*Message{}
+	for i := range 100 {
+		in = append(in, &Message{Content: fmt.Sprint(i)})
+	}
+	out, err := c.BidirectionalStream(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != len(in) {
+		t.Fatalf("want %d messages, got %d", len(in), len(out))
+	}
+	for i := range out {
+		if out[i].GetContent() != in[i].GetContent() {
+			t.Fatalf("message %d: want %q, got %q", i, in[i].GetContent(), out[i].GetContent())
+		}
+	}
+}
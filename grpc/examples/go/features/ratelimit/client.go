@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Throttle 是客户端拦截器，负责遵守服务端通过 RetryInfo 返回的等待时间：
+//
+//  1. 一元调用被限流时，等待 RetryInfo 指定的时间后重试，最多重试 maxRetries 次
+//  2. 流式调用无法透明重放已经发送的消息，因此只记录等待时间，在此之前新建流和发送消息都会先等待
+type Throttle struct {
+	maxRetries int
+
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+func (t *Throttle) block(method string, delay time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until := time.Now().Add(delay); until.After(t.until[method]) {
+		t.until[method] = until
+	}
+}
+
+// wait 阻塞到方法的限流等待结束，或者上下文被取消。
+func (t *Throttle) wait(ctx context.Context, method string) error {
+	t.mu.Lock()
+	until := t.until[method]
+	t.mu.Unlock()
+
+	d := time.Until(until)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// observe 检查错误中是否带有 RetryInfo，有则记录等待时间。
+func (t *Throttle) observe(method string, err error) bool {
+	if delay, ok := RetryDelay(err); ok {
+		t.block(method, delay)
+		return true
+	}
+	return false
+}
+
+func (t *Throttle) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		for attempt := 0; ; attempt++ {
+			if err := t.wait(ctx, method); err != nil {
+				return err
+			}
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if !t.observe(method, err) || attempt >= t.maxRetries {
+				return err
+			}
+		}
+	}
+}
+
+func (t *Throttle) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := t.wait(ctx, method); err != nil {
+			return nil, err
+		}
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			t.observe(method, err)
+			return nil, err
+		}
+		return &throttledClientStream{ClientStream: cs, method: method, throttle: t}, nil
+	}
+}
+
+type throttledClientStream struct {
+	grpc.ClientStream
+	method   string
+	throttle *Throttle
+}
+
+func (s *throttledClientStream) SendMsg(m any) error {
+	if err := s.throttle.wait(s.Context(), s.method); err != nil {
+		return err
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *throttledClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	s.throttle.observe(s.method, err)
+	return err
+}
+
+func NewThrottle(maxRetries int) *Throttle {
+	return &Throttle{maxRetries: maxRetries, until: map[string]time.Time{}}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goexamples/config"
+	"goexamples/features/proto/message"
+	"goexamples/features/ratelimit"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type Config struct {
+	config.Client
+	Retries int `config:"retries" usage:"max retries when rate limited"`
+}
+
+func (c Config) Validate() error {
+	if c.Retries < 0 {
+		return errors.Join(c.Client.Validate(), fmt.Errorf("retries %d should not be negative", c.Retries))
+	}
+	return c.Client.Validate()
+}
+
+var cfg = Config{Client: config.DefaultClient, Retries: 3}
+
+func main() {
+	config.MustLoad(&cfg)
+	throttle := ratelimit.NewThrottle(cfg.Retries)
+	client, err := message.NewMessageSrvClient(
+		cfg.Addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(throttle.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(throttle.StreamClientInterceptor()),
+	)
+	if err != nil {
+		log.Fatalf("did not start client: %v\n", err)
+	}
+	defer client.Close()
+
+	func() {
+		// 突发调用超过服务端允许的次数后，拦截器会按照 RetryInfo 等待并重试，调用耗时随之变长
+		for i := range 6 {
+			start := time.Now()
+			m := fmt.Sprintf("hello world %d", i)
+			if out, err := client.Unary(context.Background(), &message.Message{Content: m}); err != nil {
+				log.Printf("main.client.Unary failed: %v\n", err)
+			} else {
+				log.Printf("main.client.Unary response: %v, cost %v\n", out.GetContent(), time.Since(start))
+			}
+		}
+	}()
+
+	func() {
+		mc := []*message.Message{}
+		for i := range 5 {
+			mc = append(mc, &message.Message{Content: fmt.Sprintf("bidirectional stream message %d", i)})
+		}
+		fmt.Println()
+		log.Println("main.client.BidirectionalStream send message")
+
+		// 服务端每秒只接收 2 条消息，超出后以 ResourceExhausted 结束流
+		if out, err := client.BidirectionalStream(context.Background(), mc); err != nil {
+			if delay, ok := ratelimit.RetryDelay(err); ok {
+				log.Printf("main.client.BidirectionalStream rate limited, retry after %v: %v\n", delay, err)
+			} else {
+				log.Fatalf("main.client.BidirectionalStream failed: %v\n", err)
+			}
+		} else {
+			for _, m := range out {
+				log.Printf("main.client.BidirectionalStream response: %v\n", m.GetContent())
+			}
+		}
+	}()
+}
@@ -0,0 +1,275 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// 超过该数量后，每次新建令牌桶前会清理已经回满的令牌桶，避免客户端标识过多时内存无限增长。
+const maxBuckets = 10000
+
+// Limit 描述一个令牌桶：每秒补充 Rate 个令牌，桶中最多存放 Burst 个令牌。
+// Rate 小于等于 0 时表示不限制。
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l Limit) enabled() bool {
+	return l.Rate > 0
+}
+
+func (l Limit) burst() float64 {
+	if l.Burst < 1 {
+		return 1
+	}
+	return float64(l.Burst)
+}
+
+// Rule 是一个方法的限流规则。
+//
+//	Call: 每次 rpc 调用（包括流的建立）消耗一个令牌
+//	Message: 流式 rpc 中服务端每接收一条消息消耗一个令牌，对一元调用无效
+type Rule struct {
+	Call    Limit
+	Message Limit
+}
+
+// KeyFunc 从请求上下文中提取客户端标识，相同标识的请求共享同一个令牌桶。
+type KeyFunc func(ctx context.Context) string
+
+// PeerKey 以客户端的 ip 作为标识，同一台机器上的多个连接共享令牌桶。
+func PeerKey(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
+
+// MetadataKey 以客户端元数据中 key 对应的第一个值作为标识，比如 "token"、"x-api-key"。
+func MetadataKey(key string) KeyFunc {
+	return func(ctx context.Context) string {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if v := md.Get(key); len(v) > 0 {
+				return v[0]
+			}
+		}
+		return ""
+	}
+}
+
+type principalKey struct{}
+
+// WithPrincipal 由认证拦截器调用，将认证后的主体（用户名、应用 id 等）写入上下文。
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (string, bool) {
+	p, ok := ctx.Value(principalKey{}).(string)
+	return p, ok
+}
+
+// PrincipalKey 以认证主体作为标识，需要在限流拦截器之前注册写入主体的认证拦截器。
+func PrincipalKey(ctx context.Context) string {
+	p, _ := PrincipalFromContext(ctx)
+	return p
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = min(b.limit.burst(), b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+}
+
+// take 尝试消耗一个令牌，失败时返回下一个令牌可用前需要等待的时间。
+func (b *bucket) take(now time.Time) (time.Duration, bool) {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second)), false
+}
+
+type Option func(*Limiter)
+
+// WithKey 设置客户端标识的提取方式，默认为 PeerKey。
+func WithKey(key KeyFunc) Option {
+	return func(l *Limiter) {
+		l.key = key
+	}
+}
+
+// WithDefault 设置未单独配置规则的方法所使用的规则，默认不限制。
+func WithDefault(rule Rule) Option {
+	return func(l *Limiter) {
+		l.def = rule
+	}
+}
+
+// WithMethod 为某个方法单独设置规则，method 为完整的方法名称，格式：/package.Service/Method
+func WithMethod(method string, rule Rule) Option {
+	return func(l *Limiter) {
+		l.rules[method] = rule
+	}
+}
+
+// Limiter 是按客户端标识和方法划分的令牌桶限流器，同时提供一元和流式服务端拦截器。
+type Limiter struct {
+	key   KeyFunc
+	def   Rule
+	rules map[string]Rule
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func (l *Limiter) rule(method string) Rule {
+	if r, ok := l.rules[method]; ok {
+		return r
+	}
+	return l.def
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	for k, b := range l.buckets {
+		if b.refill(now); b.tokens >= b.limit.burst() {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+func (l *Limiter) take(name string, limit Limit) (time.Duration, bool) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[name]
+	if !ok || b.limit != limit {
+		if len(l.buckets) >= maxBuckets {
+			l.sweep(now)
+		}
+		b = &bucket{tokens: limit.burst(), last: now, limit: limit}
+		l.buckets[name] = b
+	}
+	return b.take(now)
+}
+
+func (l *Limiter) allow(kind, method, key string, limit Limit) error {
+	if !limit.enabled() {
+		return nil
+	}
+	if delay, ok := l.take(kind+"|"+method+"|"+key, limit); !ok {
+		return Exhausted(fmt.Sprintf("%s rate limit exceeded: method=%s, key=%q", kind, method, key), delay)
+	}
+	return nil
+}
+
+// AllowCall 检查一次调用是否被允许，超出限制时返回带有 RetryInfo 的 ResourceExhausted 错误。
+func (l *Limiter) AllowCall(ctx context.Context, method string) error {
+	return l.allow("call", method, l.key(ctx), l.rule(method).Call)
+}
+
+// AllowMessage 检查流中的一条消息是否被允许。
+func (l *Limiter) AllowMessage(ctx context.Context, method string) error {
+	return l.allow("message", method, l.key(ctx), l.rule(method).Message)
+}
+
+func (l *Limiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := l.AllowCall(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (l *Limiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		if err := l.AllowCall(ctx, info.FullMethod); err != nil {
+			return err
+		}
+		rule := l.rule(info.FullMethod)
+		if !rule.Message.enabled() {
+			return handler(srv, ss)
+		}
+		// 客户端标识在整个流的生命周期内不变，只需要计算一次
+		key := l.key(ctx)
+		return handler(srv, &limitedServerStream{ServerStream: ss, allow: func() error {
+			return l.allow("message", info.FullMethod, key, rule.Message)
+		}})
+	}
+}
+
+// limitedServerStream 每成功接收一条消息消耗一个令牌，超出限制时丢弃该消息，RecvMsg 返回错误，业务方法将该错误返回即可结束流。
+// 流结束（io.EOF）和接收出错时不消耗令牌。
+type limitedServerStream struct {
+	grpc.ServerStream
+	allow func() error
+}
+
+func (s *limitedServerStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.allow()
+}
+
+// Exhausted 创建一个 ResourceExhausted 错误，并通过 errdetails.RetryInfo 告知客户端多久之后可以重试。
+func Exhausted(msg string, delay time.Duration) error {
+	st := status.New(codes.ResourceExhausted, msg)
+	if ds, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)}); err == nil {
+		st = ds
+	}
+	return st.Err()
+}
+
+// RetryDelay 从 ResourceExhausted 错误中取出服务端建议的重试等待时间。
+func RetryDelay(err error) (time.Duration, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		return 0, false
+	}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok && info.GetRetryDelay() != nil {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+func NewLimiter(opts ...Option) *Limiter {
+	l := &Limiter{
+		key:     PeerKey,
+		rules:   map[string]Rule{},
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const method = "/message.MessageService/Unary"
+
+func peerContext(addr string) context.Context {
+	tcp, _ := net.ResolveTCPAddr("tcp", addr)
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: tcp})
+}
+
+func TestLimiterCall(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewLimiter(WithMethod(method, Rule{Call: Limit{Rate: 1, Burst: 2}}))
+	l.now = func() time.Time { return now }
+
+	a, b := peerContext("10.0.0.1:1000"), peerContext("10.0.0.2:1000")
+	for i := range 2 {
+		if err := l.AllowCall(a, method); err != nil {
+			t.Fatalf("call %d: unexpected error: %v", i, err)
+		}
+	}
+
+	err := l.AllowCall(a, method)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("want ResourceExhausted, got %v", err)
+	}
+	if delay, ok := RetryDelay(err); !ok || delay != time.Second {
+		t.Fatalf("want retry delay 1s, got %v, %v", delay, ok)
+	}
+
+	// 同一台机器的其他连接共享令牌桶，其他客户端不受影响
+	if err := l.AllowCall(peerContext("10.0.0.1:2000"), method); err == nil {
+		t.Fatal("want same host to share bucket")
+	}
+	if err := l.AllowCall(b, method); err != nil {
+		t.Fatalf("other peer: unexpected error: %v", err)
+	}
+	// 未配置的方法默认不限制
+	if err := l.AllowCall(a, "/message.MessageService/ServerStream"); err != nil {
+		t.Fatalf("unlimited method: unexpected error: %v", err)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if delay, _ := RetryDelay(l.AllowCall(a, method)); delay != 500*time.Millisecond {
+		t.Fatalf("want retry delay 500ms, got %v", delay)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if err := l.AllowCall(a, method); err != nil {
+		t.Fatalf("after refill: unexpected error: %v", err)
+	}
+}
+
+func TestMetadataKey(t *testing.T) {
+	l := NewLimiter(WithKey(MetadataKey("token")), WithDefault(Rule{Call: Limit{Rate: 1, Burst: 1}}))
+	ctx := func(token string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("token", token))
+	}
+	if err := l.AllowCall(ctx("a"), method); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.AllowCall(ctx("b"), method); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.AllowCall(ctx("a"), method); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("want ResourceExhausted, got %v", err)
+	}
+}
+
+// recvStream 收到 msgs 条消息后返回 io.EOF。
+type recvStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	msgs int
+	recv int
+}
+
+func (s *recvStream) Context() context.Context { return s.ctx }
+func (s *recvStream) RecvMsg(any) error {
+	if s.recv == s.msgs {
+		return io.EOF
+	}
+	s.recv++
+	return nil
+}
+
+func TestStreamServerInterceptorMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		burst int
+		msgs  int
+		want  codes.Code
+		got   int // 业务方法收到的消息数
+	}{
+		{name: "exceeded", burst: 3, msgs: 10, want: codes.ResourceExhausted, got: 3},
+		{name: "exactly burst", burst: 3, msgs: 3, want: codes.OK, got: 3},
+		{name: "one token one message", burst: 1, msgs: 1, want: codes.OK, got: 1},
+		{name: "one token two messages", burst: 1, msgs: 2, want: codes.ResourceExhausted, got: 1},
+	}
+	info := &grpc.StreamServerInfo{FullMethod: "/message.MessageService/BidirectionalStream"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(WithDefault(Rule{Message: Limit{Rate: 1, Burst: tt.burst}}))
+			ss := &recvStream{ctx: peerContext("10.0.0.1:1000"), msgs: tt.msgs}
+			got := 0
+			err := l.StreamServerInterceptor()(nil, ss, info, func(_ any, stream grpc.ServerStream) error {
+				for {
+					if err := stream.RecvMsg(nil); err == io.EOF {
+						return nil
+					} else if err != nil {
+						return err
+					}
+					got++
+				}
+			})
+			if status.Code(err) != tt.want || got != tt.got {
+				t.Fatalf("got %v after %d messages, want %v after %d", err, got, tt.want, tt.got)
+			}
+		})
+	}
+}
+
+func TestThrottleUnaryRetry(t *testing.T) {
+	calls := 0
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if calls++; calls < 3 {
+			return Exhausted("limited", 10*time.Millisecond)
+		}
+		return nil
+	}
+
+	start := time.Now()
+	if err := NewThrottle(3).UnaryClientInterceptor()(context.Background(), method, nil, nil, nil, invoker); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("want 3 calls, got %d", calls)
+	}
+	if cost := time.Since(start); cost < 20*time.Millisecond {
+		t.Fatalf("want retry delay honored, cost %v", cost)
+	}
+
+	calls = 0
+	if err := NewThrottle(1).UnaryClientInterceptor()(context.Background(), method, nil, nil, nil, invoker); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("want ResourceExhausted after retries exhausted, got %v", err)
+	}
+}
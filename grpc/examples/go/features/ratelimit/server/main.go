@@ -0,0 +1,52 @@
+package main
+
+import (
+	"goexamples/bootstrap"
+	"goexamples/config"
+	"goexamples/features/proto/message"
+	"goexamples/features/ratelimit"
+	"log"
+	"net"
+)
+
+type Config struct {
+	config.Server
+	Key string `config:"key" usage:"metadata key to identify client, use peer address if empty"`
+}
+
+var cfg = Config{Server: config.DefaultServer}
+
+func main() {
+	config.MustLoad(&cfg)
+
+	keyFunc := ratelimit.PeerKey
+	if cfg.Key != "" {
+		keyFunc = ratelimit.MetadataKey(cfg.Key)
+	}
+	limiter := ratelimit.NewLimiter(
+		ratelimit.WithKey(keyFunc),
+		// 未单独配置的方法：每秒 5 次调用，允许 10 次突发
+		ratelimit.WithDefault(ratelimit.Rule{Call: ratelimit.Limit{Rate: 5, Burst: 10}}),
+		// 一元调用：每秒 1 次，允许 3 次突发
+		ratelimit.WithMethod(message.MessageService_Unary_FullMethodName, ratelimit.Rule{Call: ratelimit.Limit{Rate: 1, Burst: 3}}),
+		// 双向流：除了限制流的建立，还限制流中每秒最多接收 2 条消息
+		ratelimit.WithMethod(message.MessageService_BidirectionalStream_FullMethodName, ratelimit.Rule{
+			Call:    ratelimit.Limit{Rate: 1, Burst: 1},
+			Message: ratelimit.Limit{Rate: 2, Burst: 2},
+		}),
+	)
+
+	server := message.NewMessageSrvServer(
+		bootstrap.WithUnaryInterceptors(limiter.UnaryServerInterceptor()),
+		bootstrap.WithStreamInterceptors(limiter.StreamServerInterceptor()),
+		bootstrap.WithChannelz(cfg.Mode),
+		bootstrap.WithReflection(cfg.Mode),
+		bootstrap.WithTCP(cfg.Port),
+		bootstrap.OnListen(func(lis net.Listener) {
+			log.Printf("server listening at %v\n", lis.Addr())
+		}),
+	)
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalf("failed to listen: %v\n", err)
+	}
+}
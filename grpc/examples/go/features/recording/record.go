@@ -0,0 +1,424 @@
+package recording
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// 消息的发送方。
+const (
+	FromClient = "client"
+	FromServer = "server"
+)
+
+// Duration 在 JSON 中以 time.Duration 的字符串形式保存，例如 "1.5ms"。
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	*d = Duration(v)
+	return err
+}
+
+// MD 是 JSON 形式的元数据，-bin 结尾的二进制值以 base64 保存。
+type MD map[string][]string
+
+func toMD(md metadata.MD) MD {
+	if len(md) == 0 {
+		return nil
+	}
+	out := make(MD, len(md))
+	for k, vs := range md {
+		for _, v := range vs {
+			if strings.HasSuffix(k, "-bin") {
+				v = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+			out[k] = append(out[k], v)
+		}
+	}
+	return out
+}
+
+// Metadata 还原为 gRPC 元数据，base64 无法解码的二进制值按原样使用。
+func (md MD) Metadata() metadata.MD {
+	out := metadata.MD{}
+	for k, vs := range md {
+		for _, v := range vs {
+			if strings.HasSuffix(k, "-bin") {
+				if b, err := base64.StdEncoding.DecodeString(v); err == nil {
+					v = string(b)
+				}
+			}
+			out.Append(k, v)
+		}
+	}
+	return out
+}
+
+// Message 是调用中的一条消息，Offset 为相对调用开始的时间。
+type Message struct {
+	From    string          `json:"from"`
+	Offset  Duration        `json:"offset"`
+	Message json.RawMessage `json:"message"`
+}
+
+// Call 是一次 rpc 调用的记录，对应 JSON Lines 文件中的一行。
+// Status 为 google.rpc.Status 的 protojson 形式，包含错误详情。
+type Call struct {
+	Method   string          `json:"method"`
+	Metadata MD              `json:"metadata,omitempty"`
+	Header   MD              `json:"header,omitempty"`
+	Trailer  MD              `json:"trailer,omitempty"`
+	Messages []*Message      `json:"messages"`
+	Status   json.RawMessage `json:"status"`
+	Start    time.Time       `json:"start"`
+	Duration Duration        `json:"duration"`
+}
+
+// Err 返回记录的状态对应的错误，调用成功时返回 nil。
+func (c *Call) Err() error {
+	return decodeStatus(c.Status).Err()
+}
+
+// call 记录进行中的调用，流的收发可能在不同的协程中进行，需要加锁。
+// 调用结束之后仍然可能有并发的收发，例如客户端取消调用时，结束后的消息和元数据不再记录。
+type call struct {
+	mu     sync.Mutex
+	c      *Call
+	start  time.Time
+	done   bool
+	writer *Recorder
+}
+
+func (c *call) message(from string, m any) {
+	pm, ok := m.(proto.Message)
+	if !ok {
+		return
+	}
+	b, err := protojson.Marshal(pm)
+	if err != nil {
+		log.Printf("recording: failed to marshal message of %s: %v\n", c.c.Method, err)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done {
+		return
+	}
+	c.c.Messages = append(c.c.Messages, &Message{From: from, Offset: Duration(time.Since(c.start)), Message: b})
+}
+
+func (c *call) header(md metadata.MD) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done {
+		return
+	}
+	c.c.Header = toMD(metadata.Join(c.c.Header.Metadata(), md))
+}
+
+func (c *call) trailer(md metadata.MD) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done {
+		return
+	}
+	c.c.Trailer = toMD(metadata.Join(c.c.Trailer.Metadata(), md))
+}
+
+// finish 只生效一次，写入一行记录。记录在持有锁时编码，写入时不再阻塞其他协程。
+func (c *call) finish(err error) {
+	c.mu.Lock()
+	if c.done {
+		c.mu.Unlock()
+		return
+	}
+	c.done = true
+	c.c.Duration = Duration(time.Since(c.start))
+	c.c.Status = encodeStatus(status.Convert(err))
+	b, err := json.Marshal(c.c)
+	c.mu.Unlock()
+	if err == nil {
+		err = c.writer.write(b)
+	}
+	if err != nil {
+		log.Printf("recording: failed to write %s: %v\n", c.c.Method, err)
+	}
+}
+
+func encodeStatus(st *status.Status) json.RawMessage {
+	b, err := protojson.Marshal(st.Proto())
+	if err != nil {
+		// 错误详情的类型没有注册时无法编码，只保留状态码和信息
+		b, _ = protojson.Marshal(status.New(st.Code(), st.Message()).Proto())
+	}
+	return b
+}
+
+// Recorder 将 rpc 调用以 JSON Lines 的格式写入 io.Writer，每次调用结束后写入一行，可以同时用于多个客户端和服务端。
+type Recorder struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// write 写入一行编码后的记录。
+func (r *Recorder) write(b []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.w.Write(append(b, '\n'))
+	return err
+}
+
+func (r *Recorder) begin(method string, md metadata.MD) *call {
+	now := time.Now()
+	return &call{c: &Call{Method: method, Metadata: toMD(md), Messages: []*Message{}, Start: now}, start: now, writer: r}
+}
+
+// recordingTransportStream 截获业务方法通过 grpc.SetHeader、grpc.SendHeader、grpc.SetTrailer 设置的元数据。
+type recordingTransportStream struct {
+	grpc.ServerTransportStream
+	call *call
+}
+
+func (s *recordingTransportStream) SetHeader(md metadata.MD) error {
+	err := s.ServerTransportStream.SetHeader(md)
+	if err == nil {
+		s.call.header(md)
+	}
+	return err
+}
+
+func (s *recordingTransportStream) SendHeader(md metadata.MD) error {
+	err := s.ServerTransportStream.SendHeader(md)
+	if err == nil {
+		s.call.header(md)
+	}
+	return err
+}
+
+func (s *recordingTransportStream) SetTrailer(md metadata.MD) error {
+	err := s.ServerTransportStream.SetTrailer(md)
+	if err == nil {
+		s.call.trailer(md)
+	}
+	return err
+}
+
+func withTransportStream(ctx context.Context, c *call) context.Context {
+	if sts := grpc.ServerTransportStreamFromContext(ctx); sts != nil {
+		return grpc.NewContextWithServerTransportStream(ctx, &recordingTransportStream{ServerTransportStream: sts, call: c})
+	}
+	return ctx
+}
+
+func incoming(ctx context.Context) metadata.MD {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return md
+}
+
+func (r *Recorder) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		c := r.begin(info.FullMethod, incoming(ctx))
+		c.message(FromClient, req)
+		resp, err := handler(withTransportStream(ctx, c), req)
+		if err == nil {
+			c.message(FromServer, resp)
+		}
+		c.finish(err)
+		return resp, err
+	}
+}
+
+type recordingServerStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	call *call
+}
+
+func (s *recordingServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *recordingServerStream) SetHeader(md metadata.MD) error {
+	err := s.ServerStream.SetHeader(md)
+	if err == nil {
+		s.call.header(md)
+	}
+	return err
+}
+
+func (s *recordingServerStream) SendHeader(md metadata.MD) error {
+	err := s.ServerStream.SendHeader(md)
+	if err == nil {
+		s.call.header(md)
+	}
+	return err
+}
+
+func (s *recordingServerStream) SetTrailer(md metadata.MD) {
+	s.ServerStream.SetTrailer(md)
+	s.call.trailer(md)
+}
+
+func (s *recordingServerStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.call.message(FromServer, m)
+	}
+	return err
+}
+
+func (s *recordingServerStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.call.message(FromClient, m)
+	}
+	return err
+}
+
+func (r *Recorder) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		c := r.begin(info.FullMethod, incoming(ss.Context()))
+		err := handler(srv, &recordingServerStream{ServerStream: ss, ctx: withTransportStream(ss.Context(), c), call: c})
+		c.finish(err)
+		return err
+	}
+}
+
+func outgoing(ctx context.Context) metadata.MD {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	return md
+}
+
+func (r *Recorder) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		c := r.begin(method, outgoing(ctx))
+		c.message(FromClient, req)
+		var header, trailer metadata.MD
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Header(&header), grpc.Trailer(&trailer))...)
+		if err == nil {
+			c.message(FromServer, reply)
+		}
+		c.header(header)
+		c.trailer(trailer)
+		c.finish(err)
+		return err
+	}
+}
+
+type recordingClientStream struct {
+	grpc.ClientStream
+	desc *grpc.StreamDesc
+	call *call
+	stop func() bool
+}
+
+// end 在流结束时补充服务端的 header、trailer 并写入记录。
+func (s *recordingClientStream) end(err error) {
+	s.stop()
+	if md, herr := s.ClientStream.Header(); herr == nil {
+		s.call.header(md)
+	}
+	s.call.trailer(s.ClientStream.Trailer())
+	s.call.finish(err)
+}
+
+func (s *recordingClientStream) SendMsg(m any) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.call.message(FromClient, m)
+	}
+	return err
+}
+
+func (s *recordingClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+		s.call.message(FromServer, m)
+		// 非服务端流的调用只有一条响应，RecvMsg 成功返回时流已经结束
+		if !s.desc.ServerStreams {
+			s.end(nil)
+		}
+	case errors.Is(err, io.EOF):
+		s.end(nil)
+	default:
+		s.end(err)
+	}
+	return err
+}
+
+func (r *Recorder) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		c := r.begin(method, outgoing(ctx))
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			c.finish(err)
+			return nil, err
+		}
+		s := &recordingClientStream{ClientStream: cs, desc: desc, call: c}
+		// 客户端没有读取到流结束就取消调用时，以取消的原因结束记录。
+		// 不能使用 cs.Context()，流正常结束时它也会被取消
+		s.stop = context.AfterFunc(ctx, func() {
+			c.finish(status.FromContextError(ctx.Err()).Err())
+		})
+		return s, nil
+	}
+}
+
+// ServerOptions 返回在服务端记录调用的配置。
+func (r *Recorder) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(r.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(r.StreamServerInterceptor()),
+	}
+}
+
+// DialOptions 返回在客户端记录调用的配置。
+func (r *Recorder) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(r.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(r.StreamClientInterceptor()),
+	}
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Load 读取 JSON Lines 格式的记录，空行会被忽略。
+func Load(rd io.Reader) ([]*Call, error) {
+	dec := json.NewDecoder(rd)
+	var calls []*Call
+	for line := 1; ; line++ {
+		c := &Call{}
+		if err := dec.Decode(c); err == io.EOF {
+			return calls, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("recording: record %d: %w", line, err)
+		}
+		calls = append(calls, c)
+	}
+}
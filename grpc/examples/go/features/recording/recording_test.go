@@ -0,0 +1,298 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"goexamples/bootstrap"
+	"goexamples/features/proto/message"
+	"goexamples/features/validate"
+	"goexamples/harness"
+	poempb "goexamples/poem-stream/proto"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// result 是一次调用在客户端看到的全部结果，用于比较录制和回放。
+type result struct {
+	responses []string
+	header    metadata.MD
+	trailer   metadata.MD
+	err       error
+}
+
+func msgs(contents ...string) []*message.Message {
+	out := make([]*message.Message, len(contents))
+	for i, c := range contents {
+		out[i] = &message.Message{Content: c}
+	}
+	return out
+}
+
+func recvAll[T interface{ GetContent() string }](recv func() (T, error)) ([]string, error) {
+	var out []string
+	for {
+		m, err := recv()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, m.GetContent())
+	}
+}
+
+// exercise 依次调用 MessageService 的四个方法，最后一次一元调用违反校验规则。
+func exercise(t *testing.T, conn grpc.ClientConnInterface) []result {
+	t.Helper()
+	c := message.NewMessageServiceClient(conn)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "client", "recording_test")
+	var results []result
+
+	unary := func(content string) {
+		var r result
+		resp, err := c.Unary(ctx, &message.Message{Content: content}, grpc.Header(&r.header), grpc.Trailer(&r.trailer))
+		r.responses, r.err = []string{resp.GetContent()}, err
+		results = append(results, r)
+	}
+	unary("hello")
+
+	cs, err := c.ClientStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range msgs("a", "b", "c") {
+		cs.Send(m)
+	}
+	var r result
+	mc, err := cs.CloseAndRecv()
+	for _, m := range mc.GetValue() {
+		r.responses = append(r.responses, m.GetContent())
+	}
+	r.header, _ = cs.Header()
+	r.trailer, r.err = cs.Trailer(), err
+	results = append(results, r)
+
+	ss, err := c.ServerStream(ctx, &message.MessageCollection{Value: msgs("x", "y")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = result{}
+	r.responses, r.err = recvAll(ss.Recv)
+	r.header, _ = ss.Header()
+	r.trailer = ss.Trailer()
+	results = append(results, r)
+
+	bs, err := c.BidirectionalStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range msgs("1", "2", "3") {
+		bs.Send(m)
+	}
+	bs.CloseSend()
+	r = result{}
+	r.responses, r.err = recvAll(bs.Recv)
+	r.header, _ = bs.Header()
+	r.trailer = bs.Trailer()
+	results = append(results, r)
+
+	unary(strings.Repeat("x", 4097))
+	return results
+}
+
+var methods = []string{
+	message.MessageService_Unary_FullMethodName,
+	message.MessageService_ClientStream_FullMethodName,
+	message.MessageService_ServerStream_FullMethodName,
+	message.MessageService_BidirectionalStream_FullMethodName,
+	message.MessageService_Unary_FullMethodName,
+}
+
+func startMessageSrv(t *testing.T, opts ...harness.Option) *grpc.ClientConn {
+	t.Helper()
+	return harness.New(t, opts...).Start(func(opts ...grpc.ServerOption) harness.Server {
+		return message.NewMessageSrvServer(bootstrap.WithServerOptions(opts...))
+	})
+}
+
+func load(t *testing.T, buf *bytes.Buffer) []*Call {
+	t.Helper()
+	calls, err := Load(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range calls {
+		got = append(got, c.Method)
+	}
+	if !slices.Equal(got, methods) {
+		t.Fatalf("recorded methods = %v, want %v", got, methods)
+	}
+	return calls
+}
+
+func TestRecordServer(t *testing.T) {
+	var buf bytes.Buffer
+	conn := startMessageSrv(t, harness.WithServerOptions(NewRecorder(&buf).ServerOptions()...))
+	exercise(t, conn)
+
+	calls := load(t, &buf)
+	wantMessages := []int{2, 4, 3, 6, 1}
+	for i, c := range calls {
+		if len(c.Messages) != wantMessages[i] {
+			t.Errorf("%s: %d messages, want %d", c.Method, len(c.Messages), wantMessages[i])
+		}
+		if got := c.Metadata["client"]; !slices.Equal(got, []string{"recording_test"}) {
+			t.Errorf("%s: metadata client = %v", c.Method, got)
+		}
+	}
+	// 一元调用通过 grpc.SetHeader 设置的 header 也能记录
+	if got := c0(calls[0].Header["from"]); got != "server.Unary header" {
+		t.Errorf("unary header from = %q", got)
+	}
+	if got := c0(calls[3].Trailer["from"]); got != "server.BidirectionalStream trailer" {
+		t.Errorf("bidi trailer from = %q", got)
+	}
+	if err := calls[4].Err(); status.Code(err) != codes.InvalidArgument || len(validate.Violations(err)) != 1 {
+		t.Errorf("recorded status = %v, want InvalidArgument with BadRequest", err)
+	}
+}
+
+func c0(v []string) string {
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	var buf bytes.Buffer
+	conn := startMessageSrv(t, harness.WithDialOptions(NewRecorder(&buf).DialOptions()...))
+	recorded := exercise(t, conn)
+
+	replay := NewReplay(load(t, &buf))
+	rconn := harness.New(t).Start(func(opts ...grpc.ServerOption) harness.Server {
+		return grpc.NewServer(append(opts, replay.ServerOption())...)
+	})
+	replayed := exercise(t, rconn)
+
+	for i, want := range recorded {
+		got := replayed[i]
+		if !slices.Equal(got.responses, want.responses) {
+			t.Errorf("%s: responses = %v, want %v", methods[i], got.responses, want.responses)
+		}
+		// header、trailer 中带有随机值，回放的结果应与录制时完全一致
+		for _, k := range []string{"from", "random", "timestamp"} {
+			if !slices.Equal(got.header.Get(k), want.header.Get(k)) {
+				t.Errorf("%s: header %s = %v, want %v", methods[i], k, got.header.Get(k), want.header.Get(k))
+			}
+			if !slices.Equal(got.trailer.Get(k), want.trailer.Get(k)) {
+				t.Errorf("%s: trailer %s = %v, want %v", methods[i], k, got.trailer.Get(k), want.trailer.Get(k))
+			}
+		}
+		if status.Code(got.err) != status.Code(want.err) || len(validate.Violations(got.err)) != len(validate.Violations(want.err)) {
+			t.Errorf("%s: err = %v, want %v", methods[i], got.err, want.err)
+		}
+	}
+
+	t.Run("unmatched request", func(t *testing.T) {
+		_, err := message.NewMessageServiceClient(rconn).Unary(context.Background(), &message.Message{Content: "not recorded"})
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("err = %v, want NotFound", err)
+		}
+	})
+
+	t.Run("method not recorded", func(t *testing.T) {
+		_, err := poempb.NewPoemServiceClient(rconn).GetPoem(context.Background(), &poempb.GetPoemRequest{Title: "洛神赋"})
+		if status.Code(err) != codes.Unimplemented {
+			t.Fatalf("err = %v, want Unimplemented", err)
+		}
+	})
+}
+
+func TestReplayRepeated(t *testing.T) {
+	calls := []*Call{
+		{Method: message.MessageService_Unary_FullMethodName, Messages: []*Message{
+			{From: FromClient, Message: []byte(`{"content":"hi"}`)},
+			{From: FromServer, Message: []byte(`{"content":"first"}`)},
+		}},
+		{Method: message.MessageService_Unary_FullMethodName, Messages: []*Message{
+			{From: FromClient, Message: []byte(`{"content":"hi"}`)},
+			{From: FromServer, Message: []byte(`{"content":"second"}`)},
+		}},
+	}
+	conn := harness.New(t).Start(func(opts ...grpc.ServerOption) harness.Server {
+		return grpc.NewServer(append(opts, NewReplay(calls).ServerOption())...)
+	})
+	c := message.NewMessageServiceClient(conn)
+	var got []string
+	for range 3 {
+		resp, err := c.Unary(context.Background(), &message.Message{Content: "hi"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, resp.GetContent())
+	}
+	if want := []string{"first", "second", "first"}; !slices.Equal(got, want) {
+		t.Fatalf("responses = %v, want %v", got, want)
+	}
+}
+
+// lineWriter 把每一行记录发送到通道，记录在其他协程中写入时用于等待
+type lineWriter chan []byte
+
+func (w lineWriter) Write(b []byte) (int, error) {
+	w <- slices.Clone(b)
+	return len(b), nil
+}
+
+// 客户端取消调用时记录立即结束，之后并发发送的消息不再记录，go test -race 可以发现记录时的数据竞争
+func TestRecordCancel(t *testing.T) {
+	lines := make(lineWriter, 1)
+	conn := startMessageSrv(t, harness.WithDialOptions(NewRecorder(lines).DialOptions()...))
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := message.NewMessageServiceClient(conn).BidirectionalStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for stream.Send(&message.Message{Content: "x"}) == nil {
+		}
+	}()
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	<-done
+
+	select {
+	case line := <-lines:
+		calls, err := Load(bytes.NewReader(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(calls) != 1 || status.Code(calls[0].Err()) != codes.Canceled {
+			t.Fatalf("recorded %d calls, want one canceled call", len(calls))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("call not recorded")
+	}
+}
@@ -0,0 +1,287 @@
+package recording
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func decodeStatus(b json.RawMessage) *status.Status {
+	if len(b) == 0 {
+		return status.New(codes.OK, "")
+	}
+	p := &spb.Status{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(b, p); err != nil {
+		return status.Newf(codes.Unknown, "recording: invalid status: %v", err)
+	}
+	return status.FromProto(p)
+}
+
+// 回放时不能由业务方设置的元数据，客户端一侧录制的 header 中会包含它们。
+func reserved(key string) bool {
+	return key == "content-type" || strings.HasPrefix(key, ":") || strings.HasPrefix(key, "grpc-")
+}
+
+func sanitize(md MD) metadata.MD {
+	out := md.Metadata()
+	for k := range out {
+		if reserved(k) {
+			delete(out, k)
+		}
+	}
+	return out
+}
+
+// methodTypes 通过全局注册表查找方法的请求、响应类型，没有生成代码的类型使用 dynamicpb。
+func methodTypes(fullMethod string) (in, out protoreflect.MessageType, err error) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok {
+		return nil, nil, status.Errorf(codes.Unimplemented, "malformed method name %q", fullMethod)
+	}
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Unimplemented, "unknown service %s", service)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, nil, status.Errorf(codes.Unimplemented, "unknown service %s", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, nil, status.Errorf(codes.Unimplemented, "unknown method %s", fullMethod)
+	}
+	lookup := func(desc protoreflect.MessageDescriptor) protoreflect.MessageType {
+		if mt, err := protoregistry.GlobalTypes.FindMessageByName(desc.FullName()); err == nil {
+			return mt
+		}
+		return dynamicpb.NewMessageType(desc)
+	}
+	return lookup(md.Input()), lookup(md.Output()), nil
+}
+
+func decode(mt protoreflect.MessageType, b json.RawMessage) (proto.Message, error) {
+	m := mt.New().Interface()
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(b, m); err != nil {
+		return nil, status.Errorf(codes.Internal, "recording: invalid message: %v", err)
+	}
+	return m, nil
+}
+
+// ReplayOption 配置 Replay。
+type ReplayOption func(*Replay)
+
+// WithTiming 按录制时的时间间隔发送服务端消息，默认不等待。
+func WithTiming() ReplayOption {
+	return func(r *Replay) {
+		r.timing = true
+	}
+}
+
+// WithMatchMetadata 匹配录制时请求元数据中的这些键，值需要完全相同。
+func WithMatchMetadata(keys ...string) ReplayOption {
+	return func(r *Replay) {
+		for _, k := range keys {
+			r.matchKeys = append(r.matchKeys, strings.ToLower(k))
+		}
+	}
+}
+
+// Replay 根据录制的调用回放响应，可以处理任何在 protobuf 全局注册表中注册过的服务，不需要实现服务接口。
+//
+// 请求按方法名、首条客户端消息（以及 WithMatchMetadata 指定的元数据）匹配录制的调用，
+// 有多条匹配的记录时按录制的顺序依次使用，全部用过后从头开始。
+// 流式调用按录制的顺序交替接收客户端消息、发送服务端消息，并回放录制的 header、trailer 和状态。
+type Replay struct {
+	timing    bool
+	matchKeys []string
+
+	mu    sync.Mutex
+	calls map[string][]*Call
+	used  map[*Call]int
+}
+
+// clientFirst 判断录制的调用中是否由客户端先发送消息。
+func clientFirst(c *Call) bool {
+	return len(c.Messages) > 0 && c.Messages[0].From == FromClient
+}
+
+func (r *Replay) matchMetadata(c *Call, md metadata.MD) bool {
+	recorded := c.Metadata.Metadata()
+	for _, k := range r.matchKeys {
+		if !slices.Equal(recorded.Get(k), md.Get(k)) {
+			return false
+		}
+	}
+	return true
+}
+
+// match 选出使用次数最少的匹配记录，first 为 nil 表示客户端没有发送消息。
+func (r *Replay) match(method string, in protoreflect.MessageType, first proto.Message, md metadata.MD) (*Call, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var best *Call
+	for _, c := range r.calls[method] {
+		if !r.matchMetadata(c, md) {
+			continue
+		}
+		if clientFirst(c) != (first != nil) {
+			continue
+		}
+		if first != nil {
+			m, err := decode(in, c.Messages[0].Message)
+			if err != nil || !proto.Equal(m, first) {
+				continue
+			}
+		}
+		if best == nil || r.used[c] < r.used[best] {
+			best = c
+		}
+	}
+	if best == nil {
+		return nil, status.Errorf(codes.NotFound, "recording: no recorded call of %s matches the request", method)
+	}
+	r.used[best]++
+	return best, nil
+}
+
+func (r *Replay) expectsClientFirst(method string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.ContainsFunc(r.calls[method], clientFirst)
+}
+
+// Handler 回放录制的调用，作为 grpc.UnknownServiceHandler 使用。
+func (r *Replay) Handler(_ any, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	r.mu.Lock()
+	_, recorded := r.calls[method]
+	r.mu.Unlock()
+	if !recorded {
+		return status.Errorf(codes.Unimplemented, "recording: method %s is not recorded", method)
+	}
+	in, out, err := methodTypes(method)
+	if err != nil {
+		return err
+	}
+
+	// 需要先读取第一条消息才能匹配
+	var first proto.Message
+	eof := false
+	if r.expectsClientFirst(method) {
+		first = in.New().Interface()
+		if err := stream.RecvMsg(first); errors.Is(err, io.EOF) {
+			first, eof = nil, true
+		} else if err != nil {
+			return err
+		}
+	}
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	c, err := r.match(method, in, first, md)
+	if err != nil {
+		return err
+	}
+
+	if h := sanitize(c.Header); len(h) > 0 {
+		if err := stream.SetHeader(h); err != nil {
+			return err
+		}
+	}
+	start := time.Now()
+	messages := c.Messages
+	if first != nil {
+		messages = messages[1:]
+	}
+	for _, m := range messages {
+		switch m.From {
+		case FromClient:
+			if eof {
+				continue
+			}
+			// 客户端实际发送的消息不再比较，只保证收发的顺序与录制时一致
+			if err := stream.RecvMsg(in.New().Interface()); errors.Is(err, io.EOF) {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		case FromServer:
+			msg, err := decode(out, m.Message)
+			if err != nil {
+				return err
+			}
+			if r.timing {
+				if d := time.Duration(m.Offset) - time.Since(start); d > 0 {
+					select {
+					case <-time.After(d):
+					case <-stream.Context().Done():
+						return status.FromContextError(stream.Context().Err()).Err()
+					}
+				}
+			}
+			if err := stream.SendMsg(msg); err != nil {
+				return err
+			}
+		}
+	}
+	stream.SetTrailer(sanitize(c.Trailer))
+	return decodeStatus(c.Status).Err()
+}
+
+// Services 返回录制的调用涉及的服务名，可以用来注册健康检查。
+func (r *Replay) Services() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for method := range r.calls {
+		if service, _, ok := strings.Cut(strings.TrimPrefix(method, "/"), "/"); ok && !slices.Contains(out, service) {
+			out = append(out, service)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// ServerOption 返回将 Replay 注册为未知服务处理器的配置，服务端上实际注册的服务不受影响。
+func (r *Replay) ServerOption() grpc.ServerOption {
+	return grpc.UnknownServiceHandler(r.Handler)
+}
+
+func NewReplay(calls []*Call, opts ...ReplayOption) *Replay {
+	r := &Replay{calls: map[string][]*Call{}, used: map[*Call]int{}}
+	for _, c := range calls {
+		r.calls[c.Method] = append(r.calls[c.Method], c)
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// LoadFile 读取录制文件并创建 Replay。
+func LoadFile(path string, opts ...ReplayOption) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	calls, err := Load(f)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplay(calls, opts...), nil
+}
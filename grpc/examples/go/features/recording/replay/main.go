@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"goexamples/bootstrap"
+	"goexamples/config"
+	"goexamples/features/recording"
+	"goexamples/features/reflection"
+	"log"
+	"net"
+
+	// 回放需要从全局注册表中查找消息类型，导入所有示例服务的 proto 包
+	_ "goexamples/features/proto/message"
+	_ "goexamples/gateway/helloworld/proto"
+	_ "goexamples/gateway/openapi/proto"
+	_ "goexamples/poem-stream/proto"
+)
+
+// Config 中 mode 为 dev 时注册录制的服务的反射。
+type Config struct {
+	config.Server
+	File   string   `config:"file,path" usage:"recorded JSON Lines file"`
+	Timing bool     `config:"timing" usage:"send server messages with the recorded intervals"`
+	Match  []string `config:"match" usage:"comma separated metadata keys which must match the recorded request"`
+}
+
+func (c Config) Validate() error {
+	return errors.Join(c.Server.Validate(), config.ValidateFile("file", c.File))
+}
+
+var cfg = Config{Server: config.DefaultServer, File: "record.jsonl"}
+
+func main() {
+	config.MustLoad(&cfg)
+	var opts []recording.ReplayOption
+	if cfg.Timing {
+		opts = append(opts, recording.WithTiming())
+	}
+	if len(cfg.Match) > 0 {
+		opts = append(opts, recording.WithMatchMetadata(cfg.Match...))
+	}
+	replay, err := recording.LoadFile(cfg.File, opts...)
+	if err != nil {
+		log.Fatalf("failed to load %s: %v\n", cfg.File, err)
+	}
+
+	server := bootstrap.New(
+		bootstrap.WithServerOptions(replay.ServerOption()),
+		// 示例客户端默认开启了健康检查，录制的服务都报告为 SERVING
+		bootstrap.WithHealth(replay.Services()...),
+		bootstrap.WithTCP(cfg.Port),
+		bootstrap.OnListen(func(lis net.Listener) {
+			log.Printf("replaying %s, server listening at %v\n", cfg.File, lis.Addr())
+		}),
+	)
+	// 录制的服务没有注册到服务端上，需要额外列出
+	reflection.RegisterServices(server, cfg.Mode, replay.Services()...)
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalf("failed to serve: %v\n", err)
+	}
+}
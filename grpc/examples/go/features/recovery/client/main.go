@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"goexamples/config"
+	"goexamples/features/proto/message"
+	"log"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func printError(from string, err error) {
+	st := status.Convert(err)
+	log.Printf("%s failed: code=%v, message=%v\n", from, st.Code(), st.Message())
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.DebugInfo); ok {
+			log.Printf("%s debug info: %v\n", from, info.GetDetail())
+			for _, entry := range info.GetStackEntries() {
+				fmt.Println(entry)
+			}
+		}
+	}
+}
+
+var cfg = config.DefaultClient
+
+func main() {
+	config.MustLoad(&cfg)
+	client, err := message.NewMessageSrvClient(cfg.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("did not start client: %v\n", err)
+	}
+	defer client.Close()
+
+	func() {
+		log.Println("main.client.Unary send message: panic")
+		if out, err := client.Unary(context.Background(), &message.Message{Content: "panic"}); err != nil {
+			printError("main.client.Unary", err)
+		} else {
+			log.Printf("main.client.Unary response: %v\n", out.GetContent())
+		}
+	}()
+
+	func() {
+		mc := []*message.Message{{Content: "bidirectional stream message 1"}, {Content: "panic"}, {Content: "bidirectional stream message 3"}}
+		fmt.Println()
+		log.Println("main.client.BidirectionalStream send message")
+
+		// 服务端 panic 后进程仍然存活，流以 codes.Internal 结束
+		if out, err := client.BidirectionalStream(context.Background(), mc); err != nil {
+			printError("main.client.BidirectionalStream", err)
+		} else {
+			for _, m := range out {
+				log.Printf("main.client.BidirectionalStream response: %v\n", m.GetContent())
+			}
+		}
+	}()
+
+	func() {
+		m := "hello world"
+		fmt.Println()
+		log.Printf("main.client.Unary send message: %s\n", m)
+		if out, err := client.Unary(context.Background(), &message.Message{Content: m}); err != nil {
+			printError("main.client.Unary", err)
+		} else {
+			log.Printf("main.client.Unary response: %v\n", out.GetContent())
+		}
+	}()
+}
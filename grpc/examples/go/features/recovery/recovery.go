@@ -0,0 +1,82 @@
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"goexamples/utils"
+	"log"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Recovery 提供捕获业务方法 panic 的服务端拦截器，将 panic 转换为 codes.Internal 错误返回给客户端，避免整个进程崩溃。
+//
+// 返回给客户端的错误只包含一个不透明的错误 id，服务端日志中会打印带有相同 id 的调用栈，便于对照排查。
+// dev 模式下会额外通过 errdetails.DebugInfo 将调用栈返回给客户端，生产环境不要开启。
+type Recovery struct {
+	debug  bool
+	panics atomic.Int64
+}
+
+// Panics 返回进程启动以来捕获的 panic 次数。
+func (r *Recovery) Panics() int64 {
+	return r.panics.Load()
+}
+
+func (r *Recovery) recover(method string, p any) error {
+	r.panics.Add(1)
+	id := utils.RandString(16)
+	stack := string(debug.Stack())
+	log.Printf("recovery: panic recovered: id=%s, method=%s, panic=%v\n%s", id, method, p, stack)
+
+	st := status.Newf(codes.Internal, "internal error, id=%s", id)
+	if r.debug {
+		info := &errdetails.DebugInfo{StackEntries: strings.Split(strings.TrimSpace(stack), "\n"), Detail: fmt.Sprint(p)}
+		if ds, err := st.WithDetails(info); err == nil {
+			st = ds
+		}
+	}
+	return st.Err()
+}
+
+func (r *Recovery) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				resp, err = nil, r.recover(info.FullMethod, p)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+func (r *Recovery) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = r.recover(info.FullMethod, p)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// ServerOptions 返回注册拦截器的服务端配置。
+// 由于 grpc.ChainUnaryInterceptor 按注册顺序执行，Recovery 应当最先注册，才能捕获后续拦截器中的 panic。
+func (r *Recovery) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(r.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(r.StreamServerInterceptor()),
+	}
+}
+
+// NewRecovery 创建 Recovery，mode 为 dev 时错误详情中携带调用栈。
+func NewRecovery(mode string) *Recovery {
+	return &Recovery{debug: mode == "dev"}
+}
@@ -0,0 +1,75 @@
+package recovery
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func debugInfo(err error) *errdetails.DebugInfo {
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.DebugInfo); ok {
+			return info
+		}
+	}
+	return nil
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		mode      string
+		wantDebug bool
+	}{
+		{mode: "dev", wantDebug: true},
+		{mode: "prod", wantDebug: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			r := NewRecovery(tt.mode)
+			info := &grpc.UnaryServerInfo{FullMethod: "/message.MessageService/Unary"}
+			resp, err := r.UnaryServerInterceptor()(context.Background(), nil, info, func(context.Context, any) (any, error) {
+				panic("boom")
+			})
+			if resp != nil {
+				t.Fatalf("want nil response, got %v", resp)
+			}
+			st := status.Convert(err)
+			if st.Code() != codes.Internal || !strings.HasPrefix(st.Message(), "internal error, id=") {
+				t.Fatalf("want Internal with error id, got %v", err)
+			}
+			if strings.Contains(st.Message(), "boom") {
+				t.Fatalf("panic value leaked to message: %v", st.Message())
+			}
+			if d := debugInfo(err); (d != nil) != tt.wantDebug {
+				t.Fatalf("want debug info %v, got %v", tt.wantDebug, d)
+			} else if d != nil && (d.GetDetail() != "boom" || len(d.GetStackEntries()) == 0) {
+				t.Fatalf("unexpected debug info: %v", d)
+			}
+			if r.Panics() != 1 {
+				t.Fatalf("want 1 panic counted, got %d", r.Panics())
+			}
+		})
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	r := NewRecovery("prod")
+	info := &grpc.StreamServerInfo{FullMethod: "/message.MessageService/BidirectionalStream"}
+	handler := func(any, grpc.ServerStream) error { panic("boom") }
+	for range 2 {
+		if err := r.StreamServerInterceptor()(nil, nil, info, handler); status.Code(err) != codes.Internal {
+			t.Fatalf("want Internal, got %v", err)
+		}
+	}
+	if err := r.StreamServerInterceptor()(nil, nil, info, func(any, grpc.ServerStream) error { return nil }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.Panics() != 2 {
+		t.Fatalf("want 2 panics counted, got %d", r.Panics())
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"goexamples/bootstrap"
+	"goexamples/config"
+	"goexamples/features/proto/message"
+	"goexamples/features/recovery"
+	"log"
+	"net"
+
+	"google.golang.org/grpc"
+)
+
+// 模拟业务方法中的 panic：收到内容为 "panic" 的消息时直接 panic
+func panicUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if m, ok := req.(*message.Message); ok && m.GetContent() == "panic" {
+		panic("server.Unary received panic message")
+	}
+	return handler(ctx, req)
+}
+
+func panicStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &panicServerStream{ServerStream: ss})
+}
+
+type panicServerStream struct {
+	grpc.ServerStream
+}
+
+func (s *panicServerStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if m, ok := m.(*message.Message); ok && m.GetContent() == "panic" {
+		panic("server stream received panic message")
+	}
+	return nil
+}
+
+var cfg = config.DefaultServer
+
+func main() {
+	config.MustLoad(&cfg)
+	r := recovery.NewRecovery(cfg.Mode)
+	server := message.NewMessageSrvServer(
+		// recovery 拦截器最先注册，才能捕获后续拦截器和业务方法中的 panic
+		bootstrap.WithUnaryInterceptors(r.UnaryServerInterceptor(), panicUnaryInterceptor),
+		bootstrap.WithStreamInterceptors(r.StreamServerInterceptor(), panicStreamInterceptor),
+		bootstrap.WithChannelz(cfg.Mode),
+		bootstrap.WithReflection(cfg.Mode),
+		bootstrap.WithTCP(cfg.Port),
+		bootstrap.OnListen(func(lis net.Listener) {
+			log.Printf("server listening at %v\n", lis.Addr())
+		}),
+	)
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalf("failed to listen: %v\n", err)
+	}
+}
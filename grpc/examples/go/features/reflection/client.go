@@ -0,0 +1,360 @@
+package reflection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Client 通过服务端反射获取服务的描述符，使用 dynamicpb 调用任意方法，不需要服务的生成代码。
+// 请求和响应都使用 protojson 格式，获取过的描述符会缓存在 Client 中。
+type Client struct {
+	conn grpc.ClientConnInterface
+	stub reflectionv1.ServerReflectionClient
+
+	mu     sync.Mutex
+	protos map[string]*descriptorpb.FileDescriptorProto
+	files  *protoregistry.Files
+	types  *dynamicpb.Types
+}
+
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	files := &protoregistry.Files{}
+	return &Client{
+		conn:   conn,
+		stub:   reflectionv1.NewServerReflectionClient(conn),
+		protos: map[string]*descriptorpb.FileDescriptorProto{},
+		files:  files,
+		types:  dynamicpb.NewTypes(files),
+	}
+}
+
+// request 在一个反射流上发送 req，返回响应；服务端返回的错误响应转换为 gRPC 状态。
+func request(stream reflectionv1.ServerReflection_ServerReflectionInfoClient, req *reflectionv1.ServerReflectionRequest) (*reflectionv1.ServerReflectionResponse, error) {
+	if err := stream.Send(req); err != nil {
+		return nil, err
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if e := resp.GetErrorResponse(); e != nil {
+		return nil, status.Error(codes.Code(e.GetErrorCode()), e.GetErrorMessage())
+	}
+	return resp, nil
+}
+
+// ListServices 返回服务端注册的全部服务名，按字母顺序排列。
+func (c *Client) ListServices(ctx context.Context) ([]string, error) {
+	stream, err := c.stub.ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CloseSend()
+	resp, err := request(stream, &reflectionv1.ServerReflectionRequest{
+		MessageRequest: &reflectionv1.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, s := range resp.GetListServicesResponse().GetService() {
+		out = append(out, s.GetName())
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+// addFiles 缓存响应中的文件描述符，返回还没有获取的依赖。
+func (c *Client) addFiles(resp *reflectionv1.ServerReflectionResponse) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		fd := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(b, fd); err != nil {
+			return nil, fmt.Errorf("reflection: invalid file descriptor: %w", err)
+		}
+		c.protos[fd.GetName()] = fd
+	}
+	var missing []string
+	for _, fd := range c.protos {
+		for _, dep := range fd.GetDependency() {
+			if _, ok := c.protos[dep]; !ok && !slices.Contains(missing, dep) {
+				missing = append(missing, dep)
+			}
+		}
+	}
+	return missing, nil
+}
+
+// build 用缓存的全部文件描述符重新构建注册表。
+func (c *Client) build() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range c.protos {
+		set.File = append(set.File, fd)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return fmt.Errorf("reflection: %w", err)
+	}
+	c.files, c.types = files, dynamicpb.NewTypes(files)
+	return nil
+}
+
+// fetch 获取定义 symbol 的文件及其全部依赖。
+func (c *Client) fetch(ctx context.Context, symbol string) error {
+	stream, err := c.stub.ServerReflectionInfo(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.CloseSend()
+	resp, err := request(stream, &reflectionv1.ServerReflectionRequest{
+		MessageRequest: &reflectionv1.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+	})
+	for err == nil {
+		var missing []string
+		if missing, err = c.addFiles(resp); err != nil || len(missing) == 0 {
+			break
+		}
+		resp, err = request(stream, &reflectionv1.ServerReflectionRequest{
+			MessageRequest: &reflectionv1.ServerReflectionRequest_FileByFilename{FileByFilename: missing[0]},
+		})
+	}
+	if err != nil {
+		return err
+	}
+	return c.build()
+}
+
+func (c *Client) registry() (*protoregistry.Files, *dynamicpb.Types) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.files, c.types
+}
+
+// Resolve 查找服务、方法、消息、枚举或字段的描述符，方法可以写成 pkg.Service/Method 或 pkg.Service.Method。
+func (c *Client) Resolve(ctx context.Context, symbol string) (protoreflect.Descriptor, error) {
+	name := protoreflect.FullName(strings.ReplaceAll(strings.TrimPrefix(strings.TrimPrefix(symbol, "/"), "."), "/", "."))
+	if !name.IsValid() {
+		return nil, status.Errorf(codes.InvalidArgument, "reflection: invalid symbol %q", symbol)
+	}
+	files, _ := c.registry()
+	if d, err := files.FindDescriptorByName(name); err == nil {
+		return d, nil
+	}
+	// 服务端不一定能按方法、字段等嵌套的名称查找文件，找不到时依次查找外层的名称
+	var err error
+	for n := name; n != ""; n = n.Parent() {
+		if err = c.fetch(ctx, string(n)); status.Code(err) != codes.NotFound {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	files, _ = c.registry()
+	d, err := files.FindDescriptorByName(name)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "reflection: symbol %s not found", name)
+	}
+	return d, nil
+}
+
+// ResolveMethod 查找方法的描述符。
+func (c *Client) ResolveMethod(ctx context.Context, method string) (protoreflect.MethodDescriptor, error) {
+	d, err := c.Resolve(ctx, method)
+	if err != nil {
+		return nil, err
+	}
+	md, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "reflection: %s is not a method", d.FullName())
+	}
+	return md, nil
+}
+
+// resolver 先从反射获取的类型中查找，再查找全局注册表，错误详情（例如 errdetails.BadRequest）通常只在后者中。
+type resolver struct {
+	types *dynamicpb.Types
+}
+
+func (r resolver) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	if mt, err := r.types.FindMessageByName(name); err == nil {
+		return mt, nil
+	}
+	return protoregistry.GlobalTypes.FindMessageByName(name)
+}
+
+func (r resolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	if mt, err := r.types.FindMessageByURL(url); err == nil {
+		return mt, nil
+	}
+	return protoregistry.GlobalTypes.FindMessageByURL(url)
+}
+
+func (r resolver) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	if xt, err := r.types.FindExtensionByName(field); err == nil {
+		return xt, nil
+	}
+	return protoregistry.GlobalTypes.FindExtensionByName(field)
+}
+
+func (r resolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	if xt, err := r.types.FindExtensionByNumber(message, field); err == nil {
+		return xt, nil
+	}
+	return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+}
+
+func (c *Client) resolver() resolver {
+	_, types := c.registry()
+	return resolver{types: types}
+}
+
+// Marshal 将消息格式化为多行的 protojson，Any 中的类型通过反射获取的描述符解析。
+func (c *Client) Marshal(m proto.Message) ([]byte, error) {
+	return protojson.MarshalOptions{Multiline: true, Resolver: c.resolver()}.Marshal(m)
+}
+
+// Handler 接收一次调用的 header、响应和 trailer，为 nil 的回调会被忽略。
+type Handler struct {
+	OnHeader   func(metadata.MD)
+	OnResponse func(proto.Message) error
+	OnTrailer  func(metadata.MD)
+}
+
+// decoder 从 JSON 流中依次读取请求消息，多条消息之间可以用空白分隔。
+type decoder struct {
+	dec  *json.Decoder
+	desc protoreflect.MessageDescriptor
+	opts protojson.UnmarshalOptions
+}
+
+func (d *decoder) next() (proto.Message, error) {
+	var raw json.RawMessage
+	if err := d.dec.Decode(&raw); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.InvalidArgument, "reflection: invalid JSON input: %v", err)
+	}
+	m := dynamicpb.NewMessage(d.desc)
+	if err := d.opts.Unmarshal(raw, m); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "reflection: invalid %s: %v", d.desc.FullName(), err)
+	}
+	return m, nil
+}
+
+// Invoke 调用 method，in 中是 JSON 格式的请求消息。
+// 非客户端流的方法最多只能有一条请求，没有请求时发送空消息；客户端流的请求边读取边发送，可以用于交互式的双向流。
+// 调用失败时返回 gRPC 状态错误，此时 trailer 仍会交给 Handler。
+func (c *Client) Invoke(ctx context.Context, method string, in io.Reader, h Handler) error {
+	md, err := c.ResolveMethod(ctx, method)
+	if err != nil {
+		return err
+	}
+	dec := &decoder{dec: json.NewDecoder(in), desc: md.Input(), opts: protojson.UnmarshalOptions{Resolver: c.resolver()}}
+
+	// 非客户端流的方法在建立连接之前读取并检查请求
+	var single proto.Message
+	if !md.IsStreamingClient() {
+		if single, err = dec.next(); err == io.EOF {
+			single = dynamicpb.NewMessage(md.Input())
+		} else if err != nil {
+			return err
+		} else if _, err := dec.next(); err != io.EOF {
+			return status.Errorf(codes.InvalidArgument, "reflection: %s accepts exactly one request message", md.FullName())
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	desc := &grpc.StreamDesc{
+		StreamName:    string(md.Name()),
+		ClientStreams: md.IsStreamingClient(),
+		ServerStreams: md.IsStreamingServer(),
+	}
+	fullMethod := fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name())
+	stream, err := c.conn.NewStream(ctx, desc, fullMethod)
+	if err != nil {
+		return err
+	}
+
+	// 发送和接收在不同的 goroutine 中进行，输入出错时先记录错误再取消调用
+	inputErr := make(chan error, 1)
+	go func() {
+		if single != nil {
+			if stream.SendMsg(single) == nil {
+				stream.CloseSend()
+			}
+			return
+		}
+		for {
+			m, err := dec.next()
+			if err == io.EOF {
+				stream.CloseSend()
+				return
+			}
+			if err != nil {
+				inputErr <- err
+				cancel()
+				return
+			}
+			// 返回 io.EOF 说明调用已经结束，错误从 RecvMsg 中获取
+			if stream.SendMsg(m) != nil {
+				return
+			}
+		}
+	}()
+
+	if header, err := stream.Header(); err == nil && h.OnHeader != nil {
+		h.OnHeader(header)
+	}
+	for {
+		resp := dynamicpb.NewMessage(md.Output())
+		if err = stream.RecvMsg(resp); err != nil {
+			break
+		}
+		if h.OnResponse != nil {
+			if err = h.OnResponse(resp); err != nil {
+				return err
+			}
+		}
+		if !md.IsStreamingServer() {
+			break
+		}
+	}
+	if h.OnTrailer != nil {
+		h.OnTrailer(stream.Trailer())
+	}
+	// 交互式的输入可能还在阻塞读取，调用结束后不等待发送的 goroutine
+	select {
+	case err := <-inputErr:
+		return err
+	default:
+	}
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
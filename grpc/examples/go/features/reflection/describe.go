@@ -0,0 +1,127 @@
+package reflection
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Describe 将描述符格式化为 proto 语法，类型使用以 . 开头的完整名称，与 grpcurl describe 的输出类似。
+func Describe(d protoreflect.Descriptor) string {
+	var b strings.Builder
+	describe(&b, d, "")
+	return b.String()
+}
+
+// Kind 返回描述符的种类，例如 service、rpc、message。
+func Kind(d protoreflect.Descriptor) string {
+	switch d.(type) {
+	case protoreflect.ServiceDescriptor:
+		return "service"
+	case protoreflect.MethodDescriptor:
+		return "rpc"
+	case protoreflect.MessageDescriptor:
+		return "message"
+	case protoreflect.EnumDescriptor:
+		return "enum"
+	case protoreflect.EnumValueDescriptor:
+		return "enum value"
+	case protoreflect.FieldDescriptor:
+		return "field"
+	case protoreflect.OneofDescriptor:
+		return "oneof"
+	default:
+		return "symbol"
+	}
+}
+
+func describe(b *strings.Builder, d protoreflect.Descriptor, indent string) {
+	switch d := d.(type) {
+	case protoreflect.ServiceDescriptor:
+		fmt.Fprintf(b, "%sservice %s {\n", indent, d.Name())
+		for i := range d.Methods().Len() {
+			describe(b, d.Methods().Get(i), indent+"  ")
+		}
+		fmt.Fprintf(b, "%s}\n", indent)
+	case protoreflect.MethodDescriptor:
+		fmt.Fprintf(b, "%srpc %s ( %s ) returns ( %s );\n", indent, d.Name(),
+			streamType(d.IsStreamingClient(), d.Input()), streamType(d.IsStreamingServer(), d.Output()))
+	case protoreflect.MessageDescriptor:
+		describeMessage(b, d, indent)
+	case protoreflect.EnumDescriptor:
+		fmt.Fprintf(b, "%senum %s {\n", indent, d.Name())
+		for i := range d.Values().Len() {
+			describe(b, d.Values().Get(i), indent+"  ")
+		}
+		fmt.Fprintf(b, "%s}\n", indent)
+	case protoreflect.EnumValueDescriptor:
+		fmt.Fprintf(b, "%s%s = %d;\n", indent, d.Name(), d.Number())
+	case protoreflect.FieldDescriptor:
+		fmt.Fprintf(b, "%s%s;\n", indent, field(d))
+	case protoreflect.OneofDescriptor:
+		fmt.Fprintf(b, "%soneof %s {\n", indent, d.Name())
+		for i := range d.Fields().Len() {
+			describe(b, d.Fields().Get(i), indent+"  ")
+		}
+		fmt.Fprintf(b, "%s}\n", indent)
+	default:
+		fmt.Fprintf(b, "%s%s\n", indent, d.FullName())
+	}
+}
+
+func describeMessage(b *strings.Builder, d protoreflect.MessageDescriptor, indent string) {
+	fmt.Fprintf(b, "%smessage %s {\n", indent, d.Name())
+	inner := indent + "  "
+	for i := range d.Fields().Len() {
+		f := d.Fields().Get(i)
+		// 真正的 oneof 中的字段在 oneof 块中输出，proto3 optional 的合成 oneof 不输出
+		if o := f.ContainingOneof(); o != nil && !o.IsSynthetic() {
+			if o.Fields().Get(0) == f {
+				describe(b, o, inner)
+			}
+			continue
+		}
+		describe(b, f, inner)
+	}
+	for i := range d.Messages().Len() {
+		if m := d.Messages().Get(i); !m.IsMapEntry() {
+			describeMessage(b, m, inner)
+		}
+	}
+	for i := range d.Enums().Len() {
+		describe(b, d.Enums().Get(i), inner)
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+func streamType(stream bool, d protoreflect.MessageDescriptor) string {
+	if stream {
+		return "stream ." + string(d.FullName())
+	}
+	return "." + string(d.FullName())
+}
+
+func typeName(f protoreflect.FieldDescriptor) string {
+	switch f.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return "." + string(f.Message().FullName())
+	case protoreflect.EnumKind:
+		return "." + string(f.Enum().FullName())
+	default:
+		return f.Kind().String()
+	}
+}
+
+func field(f protoreflect.FieldDescriptor) string {
+	var label string
+	switch {
+	case f.IsMap():
+		return fmt.Sprintf("map<%s, %s> %s = %d", typeName(f.MapKey()), typeName(f.MapValue()), f.Name(), f.Number())
+	case f.IsList():
+		label = "repeated "
+	case f.HasOptionalKeyword():
+		label = "optional "
+	}
+	return fmt.Sprintf("%s%s %s = %d", label, typeName(f), f.Name(), f.Number())
+}
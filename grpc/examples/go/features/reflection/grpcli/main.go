@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"goexamples/config"
+	"goexamples/features/reflection"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	// 错误详情的类型不在服务的 proto 文件中，需要从全局注册表中解析
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+const usage = `usage: grpcli [flags] <addr> <command> [args]
+
+commands:
+  list [service]      list services, or methods of a service
+  describe <symbol>   describe a service, method, message or enum
+  call <method>       invoke a method, e.g. message.MessageService/Unary
+
+flags:
+`
+
+// headers 是可以重复的 -H 参数，格式为 "key: value"。
+type headers []string
+
+func (h *headers) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headers) Set(s string) error {
+	if _, _, ok := strings.Cut(s, ":"); !ok {
+		return fmt.Errorf("metadata %q should be in the form key: value", s)
+	}
+	*h = append(*h, s)
+	return nil
+}
+
+func (h headers) metadata() metadata.MD {
+	md := metadata.MD{}
+	for _, s := range h {
+		k, v, _ := strings.Cut(s, ":")
+		md.Append(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	return md
+}
+
+// Config 中常用的 -H 可以写在配置文件里，地址和命令仍然通过位置参数传入。
+type Config struct {
+	Data    string        `config:"d" usage:"request messages in JSON, several messages for client streaming methods; \"@\" reads them from stdin"`
+	Timeout time.Duration `config:"timeout" usage:"deadline of the whole command, 0 means no deadline"`
+	Meta    headers       `config:"H" usage:"request metadata \"key: value\", can be repeated"`
+}
+
+var cfg Config
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	args := config.MustLoad(&cfg, config.WithEnvPrefix("GRPCLI")).Args
+	log.SetFlags(0)
+	if len(args) < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	conn, err := grpc.NewClient(args[0], grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	ctx := metadata.NewOutgoingContext(context.Background(), cfg.Meta.metadata())
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	c := reflection.NewClient(conn)
+	switch cmd, rest := args[1], args[2:]; {
+	case cmd == "list" && len(rest) == 0:
+		err = list(ctx, c)
+	case cmd == "list" && len(rest) == 1:
+		err = listMethods(ctx, c, rest[0])
+	case cmd == "describe" && len(rest) == 1:
+		err = describe(ctx, c, rest[0])
+	case cmd == "call" && len(rest) == 1:
+		err = call(ctx, c, rest[0])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		printStatus(c, err)
+		os.Exit(1)
+	}
+}
+
+func list(ctx context.Context, c *reflection.Client) error {
+	services, err := c.ListServices(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range services {
+		fmt.Println(s)
+	}
+	return nil
+}
+
+func listMethods(ctx context.Context, c *reflection.Client, service string) error {
+	d, err := c.Resolve(ctx, service)
+	if err != nil {
+		return err
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return fmt.Errorf("%s is not a service", d.FullName())
+	}
+	for i := range sd.Methods().Len() {
+		fmt.Printf("%s/%s\n", sd.FullName(), sd.Methods().Get(i).Name())
+	}
+	return nil
+}
+
+func describe(ctx context.Context, c *reflection.Client, symbol string) error {
+	d, err := c.Resolve(ctx, symbol)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is a %s:\n", d.FullName(), reflection.Kind(d))
+	fmt.Print(reflection.Describe(d))
+	return nil
+}
+
+// printMetadata 按键排序输出元数据，与响应分开输出到标准错误，标准输出中只有 JSON；-bin 结尾的二进制值以 base64 输出。
+func printMetadata(title string, md metadata.MD) {
+	fmt.Fprintf(os.Stderr, "%s:\n", title)
+	for _, k := range slices.Sorted(maps.Keys(md)) {
+		for _, v := range md[k] {
+			if strings.HasSuffix(k, "-bin") {
+				v = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", k, v)
+		}
+	}
+}
+
+func call(ctx context.Context, c *reflection.Client, method string) error {
+	var in io.Reader = strings.NewReader(cfg.Data)
+	if cfg.Data == "@" {
+		in = os.Stdin
+	}
+	return c.Invoke(ctx, method, in, reflection.Handler{
+		OnHeader: func(md metadata.MD) { printMetadata("Response headers", md) },
+		OnResponse: func(m proto.Message) error {
+			b, err := c.Marshal(m)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+			return nil
+		},
+		OnTrailer: func(md metadata.MD) { printMetadata("Response trailers", md) },
+	})
+}
+
+// printStatus 输出错误的状态码、消息和错误详情。
+func printStatus(c *reflection.Client, err error) {
+	st, ok := status.FromError(err)
+	if !ok {
+		log.Print(err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "ERROR:\n  Code: %s\n  Message: %s\n", st.Code(), st.Message())
+	if len(st.Details()) == 0 {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "  Details:")
+	for _, d := range st.Proto().GetDetails() {
+		b, err := c.Marshal(d)
+		if err != nil {
+			b = []byte(d.GetTypeUrl())
+		}
+		fmt.Fprintf(os.Stderr, "  %s\n", strings.ReplaceAll(string(b), "\n", "\n  "))
+	}
+}
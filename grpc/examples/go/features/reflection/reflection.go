@@ -0,0 +1,47 @@
+package reflection
+
+import (
+	"maps"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+)
+
+// Register 在 dev 模式下为服务端注册反射服务（v1 和 v1alpha），grpcli、grpcurl 等工具可以在没有 proto 文件的情况下调用服务，生产环境不要开启。
+func Register(s reflection.GRPCServer, mode string) {
+	if mode == "dev" {
+		reflection.Register(s)
+	}
+}
+
+// services 在服务端注册的服务之外额外列出 names 中的服务。
+type services struct {
+	reflection.ServiceInfoProvider
+	names []string
+}
+
+func (s services) GetServiceInfo() map[string]grpc.ServiceInfo {
+	out := maps.Clone(s.ServiceInfoProvider.GetServiceInfo())
+	if out == nil {
+		out = map[string]grpc.ServiceInfo{}
+	}
+	for _, name := range s.names {
+		if _, ok := out[name]; !ok {
+			out[name] = grpc.ServiceInfo{}
+		}
+	}
+	return out
+}
+
+// RegisterServices 与 Register 相同，并额外列出 names 中的服务，用于由 grpc.UnknownServiceHandler 处理、
+// 没有注册到服务端上的服务（例如回放服务端），服务的描述符从 protobuf 全局注册表中查找。
+func RegisterServices(s reflection.GRPCServer, mode string, names ...string) {
+	if mode != "dev" {
+		return
+	}
+	opts := reflection.ServerOptions{Services: services{ServiceInfoProvider: s, names: names}}
+	reflectionv1.RegisterServerReflectionServer(s, reflection.NewServerV1(opts))
+	reflectionv1alpha.RegisterServerReflectionServer(s, reflection.NewServer(opts))
+}
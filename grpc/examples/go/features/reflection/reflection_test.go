@@ -0,0 +1,263 @@
+package reflection_test
+
+import (
+	"context"
+	"goexamples/bootstrap"
+	"goexamples/features/proto/message"
+	"goexamples/features/recording"
+	"goexamples/features/reflection"
+	"goexamples/features/validate"
+	"goexamples/harness"
+	"goexamples/poem-stream/poem"
+	"goexamples/poem-stream/testdata"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const reflectionService = "grpc.reflection.v1.ServerReflection"
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestRegister(t *testing.T) {
+	for mode, want := range map[string]bool{"dev": true, "prod": false} {
+		s := grpc.NewServer()
+		reflection.Register(s, mode)
+		if _, ok := s.GetServiceInfo()[reflectionService]; ok != want {
+			t.Errorf("mode %s: reflection registered = %v, want %v", mode, ok, want)
+		}
+	}
+}
+
+func startMessageSrv(t *testing.T) *reflection.Client {
+	t.Helper()
+	conn := harness.New(t).Start(func(opts ...grpc.ServerOption) harness.Server {
+		s := message.NewMessageSrvServer(bootstrap.WithServerOptions(opts...))
+		reflection.Register(s, "dev")
+		return s
+	})
+	return reflection.NewClient(conn)
+}
+
+func startPoemSrv(t *testing.T) *reflection.Client {
+	t.Helper()
+	conn := harness.New(t).Start(func(opts ...grpc.ServerOption) harness.Server {
+		s := poem.NewServer(bootstrap.WithServerOptions(opts...))
+		s.SetDB(testdata.NewDB("../../poem-stream/testdata/server_poem.json"))
+		reflection.Register(s, "dev")
+		return s
+	})
+	return reflection.NewClient(conn)
+}
+
+func TestListServices(t *testing.T) {
+	got, err := startMessageSrv(t).ListServices(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"message.MessageService", "grpc.health.v1.Health", reflectionService} {
+		if !slices.Contains(got, want) {
+			t.Errorf("services = %v, want %s", got, want)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	c := startMessageSrv(t)
+	tests := []struct {
+		symbol string
+		kind   string
+		want   []string
+	}{
+		{"message.MessageService", "service", []string{
+			"service MessageService {",
+			"  rpc Unary ( .message.Message ) returns ( .message.Message );",
+			"  rpc BidirectionalStream ( stream .message.Message ) returns ( stream .message.Message );",
+		}},
+		{"message.MessageService/ClientStream", "rpc", []string{
+			"rpc ClientStream ( stream .message.Message ) returns ( .message.MessageCollection );",
+		}},
+		{"message.MessageCollection", "message", []string{
+			"repeated .message.Message value = 1;",
+		}},
+		{"message.Message", "message", []string{"string content = 1;", ".message.Kind kind = "}},
+		{"message.Kind", "enum", []string{"JOIN = "}},
+	}
+	for _, tt := range tests {
+		d, err := c.Resolve(context.Background(), tt.symbol)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.symbol, err)
+		}
+		if got := reflection.Kind(d); got != tt.kind {
+			t.Errorf("%s: kind = %s, want %s", tt.symbol, got, tt.kind)
+		}
+		got := reflection.Describe(d)
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: describe =\n%s\nwant %q", tt.symbol, got, want)
+			}
+		}
+	}
+
+	if _, err := c.Resolve(context.Background(), "message.Missing"); status.Code(err) != codes.NotFound {
+		t.Errorf("missing symbol: err = %v, want NotFound", err)
+	}
+}
+
+// result 是一次动态调用的结果，响应按字段名取出一个字符串字段。
+type result struct {
+	responses []string
+	header    metadata.MD
+	trailer   metadata.MD
+}
+
+func invoke(ctx context.Context, c *reflection.Client, method, in, field string) (*result, error) {
+	r := &result{}
+	err := c.Invoke(ctx, method, strings.NewReader(in), reflection.Handler{
+		OnHeader: func(md metadata.MD) { r.header = md },
+		OnResponse: func(m proto.Message) error {
+			msg := m.ProtoReflect()
+			fd := msg.Descriptor().Fields().ByName(protoreflect.Name(field))
+			if fd.IsList() {
+				list := msg.Get(fd).List()
+				for i := range list.Len() {
+					r.responses = append(r.responses, valueString(list.Get(i)))
+				}
+				return nil
+			}
+			r.responses = append(r.responses, valueString(msg.Get(fd)))
+			return nil
+		},
+		OnTrailer: func(md metadata.MD) { r.trailer = md },
+	})
+	return r, err
+}
+
+// valueString 对消息取 content 或 title 字段，其他值直接转换为字符串。
+func valueString(v protoreflect.Value) string {
+	if m, ok := v.Interface().(protoreflect.Message); ok {
+		for _, name := range []protoreflect.Name{"content", "title"} {
+			if fd := m.Descriptor().Fields().ByName(name); fd != nil {
+				return m.Get(fd).String()
+			}
+		}
+	}
+	return v.String()
+}
+
+func TestInvoke(t *testing.T) {
+	c := startMessageSrv(t)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "client", "grpcli")
+	tests := []struct {
+		method string
+		in     string
+		field  string
+		want   []string
+	}{
+		{"message.MessageService/Unary", `{"content": "hello"}`, "content", []string{"hello"}},
+		{"/message.MessageService/Unary", `{"content": "world"}`, "content", []string{"world"}},
+		{"message.MessageService.ClientStream", `{"content": "a"} {"content": "b"}`, "value", []string{"a", "b"}},
+		{"message.MessageService/ServerStream", `{"value": [{"content": "x"}, {"content": "y"}]}`, "content", []string{"x", "y"}},
+		{"message.MessageService/BidirectionalStream", "{\"content\": \"1\"}\n{\"content\": \"2\"}\n{\"content\": \"3\"}", "content", []string{"1", "2", "3"}},
+	}
+	for _, tt := range tests {
+		r, err := invoke(ctx, c, tt.method, tt.in, tt.field)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.method, err)
+		}
+		if !slices.Equal(r.responses, tt.want) {
+			t.Errorf("%s: responses = %q, want %q", tt.method, r.responses, tt.want)
+		}
+		if len(r.header.Get("from")) == 0 || len(r.trailer.Get("from")) == 0 {
+			t.Errorf("%s: header = %v, trailer = %v, want from in both", tt.method, r.header, r.trailer)
+		}
+	}
+}
+
+func TestInvokeErrors(t *testing.T) {
+	c := startMessageSrv(t)
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		method string
+		in     string
+		code   codes.Code
+	}{
+		{"invalid JSON", "message.MessageService/Unary", `{"content": `, codes.InvalidArgument},
+		{"unknown field", "message.MessageService/Unary", `{"text": "hello"}`, codes.InvalidArgument},
+		{"several messages for unary", "message.MessageService/Unary", `{} {}`, codes.InvalidArgument},
+		{"invalid JSON in stream", "message.MessageService/ClientStream", `{"content": "a"} {"content"`, codes.InvalidArgument},
+		{"not a method", "message.Message", `{}`, codes.InvalidArgument},
+		{"unknown method", "message.MessageService/Missing", `{}`, codes.NotFound},
+		{"validation error", "message.MessageService/Unary", `{"content": "` + strings.Repeat("x", 4097) + `"}`, codes.InvalidArgument},
+		{"empty input sends an empty message", "message.MessageService/Unary", ``, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		if _, err := invoke(ctx, c, tt.method, tt.in, "content"); status.Code(err) != tt.code {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.code)
+		}
+	}
+
+	// 服务端返回的错误详情可以通过全局注册表解析
+	_, err := invoke(ctx, c, "message.MessageService/Unary", `{"content": "`+strings.Repeat("x", 4097)+`"}`, "content")
+	if len(validate.Violations(err)) != 1 {
+		t.Fatalf("err = %v, want one field violation", err)
+	}
+	b, err := c.Marshal(status.Convert(err).Proto())
+	if err != nil || !strings.Contains(string(b), "fieldViolations") {
+		t.Fatalf("marshal status = %s, %v", b, err)
+	}
+}
+
+func TestInvokePoem(t *testing.T) {
+	c := startPoemSrv(t)
+	ctx := context.Background()
+
+	r, err := invoke(ctx, c, "PoemService/GetPoem", `{"title": "静夜思"}`, "author")
+	if err != nil || !slices.Equal(r.responses, []string{"李白"}) {
+		t.Fatalf("GetPoem = %v, %v", r.responses, err)
+	}
+	// google.protobuf.Empty 在依赖的文件中，需要通过反射继续获取
+	r, err = invoke(ctx, c, "PoemService/GetPoemAll", ``, "value")
+	if err != nil || !slices.Contains(r.responses, "洛神赋") {
+		t.Fatalf("GetPoemAll = %v, %v", r.responses, err)
+	}
+	if _, err := invoke(ctx, c, "PoemService/GetPoem", `{}`, "author"); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("GetPoem without title: err = %v, want InvalidArgument", err)
+	}
+}
+
+func TestRegisterServices(t *testing.T) {
+	calls := []*recording.Call{{Method: message.MessageService_Unary_FullMethodName, Messages: []*recording.Message{
+		{From: recording.FromClient, Message: []byte(`{"content":"hi"}`)},
+		{From: recording.FromServer, Message: []byte(`{"content":"replayed"}`)},
+	}}}
+	replay := recording.NewReplay(calls)
+	conn := harness.New(t).Start(func(opts ...grpc.ServerOption) harness.Server {
+		s := grpc.NewServer(append(opts, replay.ServerOption())...)
+		reflection.RegisterServices(s, "dev", replay.Services()...)
+		return s
+	})
+	c := reflection.NewClient(conn)
+	services, err := c.ListServices(context.Background())
+	if err != nil || !slices.Contains(services, "message.MessageService") {
+		t.Fatalf("services = %v, %v", services, err)
+	}
+	r, err := invoke(context.Background(), c, "message.MessageService/Unary", `{"content": "hi"}`, "content")
+	if err != nil || !slices.Equal(r.responses, []string{"replayed"}) {
+		t.Fatalf("replayed = %v, %v", r.responses, err)
+	}
+}
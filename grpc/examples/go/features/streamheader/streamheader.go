@@ -0,0 +1,200 @@
+package streamheader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ClientStream.Header() 会一直阻塞到服务端发送 Header 或者流结束。
+// 如果服务端在 Recv() 之前没有调用 SendHeader()，而客户端又在发送完消息之前等待 Header，双方会相互等待，形成死锁。
+// 本包在后台读取 Header，调用方可以通过 Future 异步获取、注册回调，或者带超时地等待。
+
+var (
+	// ErrHeaderTimeout 表示客户端已经发送完所有消息，但在超时时间内仍未收到 Header，通常是服务端处理缓慢。
+	ErrHeaderTimeout = errors.New("streamheader: timed out waiting for header")
+	// ErrMutualWait 表示客户端在发送完所有消息（CloseSend）之前等待 Header 超时，
+	// 很可能服务端也在等待客户端的消息，才会发送 Header，双方相互等待。
+	ErrMutualWait = errors.New("streamheader: possible mutual wait, header is awaited before CloseSend while the server may be waiting for client messages; " +
+		"call CloseSend / Recv before Header, or make the server call SendHeader before Recv")
+)
+
+// DefaultTimeout 是 ClientStream.Header() 默认的最长等待时间。
+const DefaultTimeout = 3 * time.Second
+
+// Future 是异步获取的 Header。
+type Future struct {
+	done chan struct{}
+	md   metadata.MD
+	err  error
+
+	mu        sync.Mutex
+	callbacks []func(metadata.MD, error)
+}
+
+func (f *Future) resolve(md metadata.MD, err error) {
+	f.mu.Lock()
+	f.md, f.err = md, err
+	close(f.done)
+	callbacks := f.callbacks
+	f.callbacks = nil
+	f.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(md, err)
+	}
+}
+
+// Done 在 Header 到达或者流结束时关闭。
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Ready 判断 Header 是否已经到达（或流已结束），为 true 时调用 Get 不会阻塞。
+func (f *Future) Ready() bool {
+	select {
+	case <-f.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Get 等待 Header 到达，或者 ctx 结束。
+func (f *Future) Get(ctx context.Context) (metadata.MD, error) {
+	// 流结束后上下文会被取消，已经到达的 Header 优先返回
+	if f.Ready() {
+		return f.md, f.err
+	}
+	select {
+	case <-f.done:
+		return f.md, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Then 注册 Header 到达后的回调；Header 已经到达时立即在当前协程中调用。
+// 回调在读取 Header 的后台协程中执行，不要在回调中阻塞。
+func (f *Future) Then(fn func(metadata.MD, error)) {
+	f.mu.Lock()
+	select {
+	case <-f.done:
+		f.mu.Unlock()
+		fn(f.md, f.err)
+	default:
+		f.callbacks = append(f.callbacks, fn)
+		f.mu.Unlock()
+	}
+}
+
+// Watch 启动一个后台协程读取流的 Header，协程在 Header 到达或流结束时退出。
+func Watch(cs grpc.ClientStream) *Future {
+	f := &Future{done: make(chan struct{})}
+	go func() {
+		md, err := cs.Header()
+		f.resolve(md, err)
+	}()
+	return f
+}
+
+type Option func(*ClientStream)
+
+// WithTimeout 设置 Header() 的最长等待时间，小于等于 0 时只受流的上下文限制。
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *ClientStream) {
+		s.timeout = timeout
+	}
+}
+
+// WithCallback 注册 Header 到达后的回调。
+func WithCallback(fn func(metadata.MD, error)) Option {
+	return func(s *ClientStream) {
+		s.header.Then(fn)
+	}
+}
+
+// halfClosed 用于非客户端流：生成的代码在发送唯一的请求后会立即调用 CloseSend。
+func halfClosed() Option {
+	return func(s *ClientStream) {
+		s.sendClosed.Store(true)
+	}
+}
+
+// ClientStream 包装 grpc.ClientStream，Header() 不再无限阻塞。
+type ClientStream struct {
+	grpc.ClientStream
+	header     *Future
+	timeout    time.Duration
+	sendClosed atomic.Bool
+	recving    atomic.Int32
+}
+
+// HeaderFuture 返回异步获取的 Header。
+func (s *ClientStream) HeaderFuture() *Future {
+	return s.header
+}
+
+func (s *ClientStream) CloseSend() error {
+	s.sendClosed.Store(true)
+	return s.ClientStream.CloseSend()
+}
+
+func (s *ClientStream) RecvMsg(m any) error {
+	s.recving.Add(1)
+	defer s.recving.Add(-1)
+	return s.ClientStream.RecvMsg(m)
+}
+
+// Header 在超时时间内等待 Header。
+// 超时时，如果客户端还没有 CloseSend，也没有协程在等待响应，返回 ErrMutualWait，否则返回 ErrHeaderTimeout。
+func (s *ClientStream) Header() (metadata.MD, error) {
+	ctx := s.ClientStream.Context()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	md, err := s.header.Get(ctx)
+	if err == nil || ctx.Err() == nil {
+		return md, err
+	}
+	// 流已经结束，后台协程中的 Header() 会立即返回，等待其结果即可
+	if s.ClientStream.Context().Err() != nil {
+		<-s.header.Done()
+		return s.header.md, s.header.err
+	}
+	if !s.sendClosed.Load() && s.recving.Load() == 0 {
+		return nil, fmt.Errorf("%w (waited %v)", ErrMutualWait, s.timeout)
+	}
+	return nil, fmt.Errorf("%w (waited %v)", ErrHeaderTimeout, s.timeout)
+}
+
+func Wrap(cs grpc.ClientStream, opts ...Option) *ClientStream {
+	s := &ClientStream{ClientStream: cs, header: Watch(cs), timeout: DefaultTimeout}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// StreamClientInterceptor 将所有流包装为 ClientStream，生成代码返回的流调用 Header() 时同样受超时保护。
+func StreamClientInterceptor(opts ...Option) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cs, err := streamer(ctx, desc, cc, method, callOpts...)
+		if err != nil {
+			return nil, err
+		}
+		if !desc.ClientStreams {
+			opts = append(opts[:len(opts):len(opts)], halfClosed())
+		}
+		return Wrap(cs, opts...), nil
+	}
+}
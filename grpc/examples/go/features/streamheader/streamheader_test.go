@@ -0,0 +1,162 @@
+package streamheader_test
+
+import (
+	"context"
+	"errors"
+	"goexamples/features/proto/message"
+	"goexamples/features/streamheader"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// headerServer 的 ClientStream 先接收完所有消息，再按配置延迟发送或者不发送 Header。
+type headerServer struct {
+	message.UnimplementedMessageServiceServer
+	delay time.Duration
+	omit  bool
+}
+
+func (s *headerServer) ClientStream(sin grpc.ClientStreamingServer[message.Message, message.MessageCollection]) error {
+	mc := []*message.Message{}
+	for {
+		in, err := sin.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		mc = append(mc, in)
+	}
+	time.Sleep(s.delay)
+	if !s.omit {
+		sin.SendHeader(metadata.Pairs("from", "header server"))
+	}
+	return sin.SendAndClose(&message.MessageCollection{Value: mc})
+}
+
+func start(t *testing.T, srv *headerServer, opts ...streamheader.Option) message.MessageServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	message.RegisterMessageServiceServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStreamInterceptor(streamheader.StreamClientInterceptor(opts...)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return message.NewMessageServiceClient(conn)
+}
+
+func TestMutualWait(t *testing.T) {
+	client := start(t, &headerServer{omit: true}, streamheader.WithTimeout(100*time.Millisecond))
+	sin, err := client.ClientStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sin.Send(&message.Message{Content: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 服务端等待客户端发送完消息，客户端在 CloseSend 之前等待 Header，原本会永远阻塞
+	if _, err := sin.Header(); !errors.Is(err, streamheader.ErrMutualWait) {
+		t.Fatalf("want ErrMutualWait, got %v", err)
+	}
+
+	// 客户端发送完消息后，服务端发送响应，Header 随响应一起到达
+	if mc, err := sin.CloseAndRecv(); err != nil || len(mc.GetValue()) != 1 {
+		t.Fatalf("unexpected response: %v, %v", mc, err)
+	}
+	if _, err := sin.Header(); err != nil {
+		t.Fatalf("want header after response, got %v", err)
+	}
+}
+
+func TestDelayedHeader(t *testing.T) {
+	called := make(chan metadata.MD, 1)
+	client := start(t, &headerServer{delay: 300 * time.Millisecond},
+		streamheader.WithTimeout(50*time.Millisecond),
+		streamheader.WithCallback(func(md metadata.MD, err error) {
+			if err == nil {
+				called <- md
+			}
+		}),
+	)
+	sin, err := client.ClientStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sin.Send(&message.Message{Content: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sin.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 客户端已经发送完消息，超时说明服务端处理缓慢，而不是相互等待
+	if _, err := sin.Header(); !errors.Is(err, streamheader.ErrHeaderTimeout) {
+		t.Fatalf("want ErrHeaderTimeout, got %v", err)
+	}
+
+	select {
+	case md := <-called:
+		if v := md.Get("from"); len(v) != 1 || v[0] != "header server" {
+			t.Fatalf("unexpected header: %v", md)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("header callback not called")
+	}
+}
+
+func TestFuture(t *testing.T) {
+	client := start(t, &headerServer{delay: 100 * time.Millisecond})
+	stream, err := client.ClientStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	future := streamheader.Watch(stream)
+	if future.Ready() {
+		t.Fatal("header should not be ready before the server responds")
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := future.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want DeadlineExceeded, got %v", err)
+	}
+
+	md, err := future.Get(context.Background())
+	if err != nil || len(md.Get("from")) != 1 {
+		t.Fatalf("unexpected header: %v, %v", md, err)
+	}
+	if !future.Ready() {
+		t.Fatal("want header ready")
+	}
+
+	then := make(chan struct{})
+	future.Then(func(metadata.MD, error) { close(then) })
+	select {
+	case <-then:
+	default:
+		t.Fatal("want callback called immediately when header is ready")
+	}
+}
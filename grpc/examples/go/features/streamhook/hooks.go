@@ -0,0 +1,154 @@
+package streamhook
+
+import (
+	"errors"
+	"fmt"
+	"goexamples/features/validate"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Stats 是一个方法所有流的累计统计。
+type Stats struct {
+	Streams  int64
+	Active   int64
+	Sent     int64
+	Received int64
+	Codes    map[codes.Code]int64
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("streams=%d, active=%d, sent=%d, received=%d, codes=%v", s.Streams, s.Active, s.Sent, s.Received, s.Codes)
+}
+
+// Counter 按方法统计流的数量、收发的消息数量以及流结束时的状态码。
+type Counter struct {
+	mu    sync.Mutex
+	stats map[string]*Stats
+}
+
+func (c *Counter) update(method string, fn func(*Stats)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.stats[method]
+	if !ok {
+		s = &Stats{Codes: map[codes.Code]int64{}}
+		c.stats[method] = s
+	}
+	fn(s)
+}
+
+// Stats 返回方法统计的副本。
+func (c *Counter) Stats(method string) Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.stats[method]
+	if !ok {
+		return Stats{Codes: map[codes.Code]int64{}}
+	}
+	cp := *s
+	cp.Codes = make(map[codes.Code]int64, len(s.Codes))
+	for k, v := range s.Codes {
+		cp.Codes[k] = v
+	}
+	return cp
+}
+
+// Hooks 返回计数钩子。
+func (c *Counter) Hooks() Hooks {
+	return Hooks{
+		OnOpen: func(info *Info) {
+			c.update(info.FullMethod, func(s *Stats) { s.Streams++; s.Active++ })
+		},
+		OnSent: func(info *Info, _ any, _ time.Duration, err error) {
+			if err == nil {
+				c.update(info.FullMethod, func(s *Stats) { s.Sent++ })
+			}
+		},
+		OnRecv: func(info *Info, _ any, _ time.Duration, err error) error {
+			if err == nil {
+				c.update(info.FullMethod, func(s *Stats) { s.Received++ })
+			}
+			return nil
+		},
+		OnClose: func(info *Info, st *status.Status) {
+			c.update(info.FullMethod, func(s *Stats) { s.Active--; s.Codes[st.Code()]++ })
+		},
+	}
+}
+
+func NewCounter() *Counter {
+	return &Counter{stats: map[string]*Stats{}}
+}
+
+// Validator 校验一条消息，返回的错误如果不是 status 错误，会被转换为 codes.InvalidArgument。
+type Validator func(info *Info, m any) error
+
+func invalid(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+// Validate 返回逐条校验消息的钩子：接收的消息校验失败时 RecvMsg 返回错误，发送的消息校验失败时不发送。
+// recv 或 send 为 nil 时不校验对应方向。
+func Validate(recv, send Validator) Hooks {
+	var h Hooks
+	if recv != nil {
+		h.OnRecv = func(info *Info, m any, _ time.Duration, err error) error {
+			if err != nil {
+				return nil
+			}
+			if verr := recv(info, m); verr != nil {
+				return invalid(verr)
+			}
+			return nil
+		}
+	}
+	if send != nil {
+		h.OnSend = func(info *Info, m any) error {
+			if verr := send(info, m); verr != nil {
+				return invalid(verr)
+			}
+			return nil
+		}
+	}
+	return h
+}
+
+// Timing 返回记录耗时的钩子：单条消息收发耗时超过 slow 时打印日志，流结束时打印总耗时和消息数量。
+// 注意：RecvMsg 的耗时包含等待对端发送消息的时间。
+func Timing(from string, slow time.Duration) Hooks {
+	return Hooks{
+		OnSent: func(info *Info, m any, cost time.Duration, err error) {
+			if cost >= slow {
+				log.Printf("%s: slow send: method=%s, cost=%v, err=%v\n", from, info.FullMethod, cost, err)
+			}
+		},
+		OnRecv: func(info *Info, m any, cost time.Duration, err error) error {
+			if cost >= slow && !errors.Is(err, io.EOF) {
+				log.Printf("%s: slow recv: method=%s, cost=%v, err=%v\n", from, info.FullMethod, cost, err)
+			}
+			return nil
+		},
+		OnClose: func(info *Info, st *status.Status) {
+			log.Printf("%s: stream closed: method=%s, code=%v, sent=%d, received=%d, cost=%v\n",
+				from, info.FullMethod, st.Code(), info.Sent(), info.Received(), time.Since(info.Start))
+		},
+	}
+}
+
+// SelfValidator 校验实现了 Validate() error 方法的消息，其他 proto 消息按字段上声明的 (validate.rules) 校验，
+// 与服务端的校验拦截器使用相同的规则。
+func SelfValidator(_ *Info, m any) error {
+	if v, ok := m.(interface{ Validate() error }); ok {
+		return v.Validate()
+	}
+	return validate.Validate(m)
+}
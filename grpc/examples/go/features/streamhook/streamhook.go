@@ -0,0 +1,309 @@
+package streamhook
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Info 描述一个正在进行的流，同一个流的所有钩子收到的是同一个 Info。
+type Info struct {
+	FullMethod     string
+	IsClientStream bool
+	IsServerStream bool
+	Start          time.Time
+
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+// Sent 返回已成功发送的消息数量。
+func (i *Info) Sent() int64 {
+	return i.sent.Load()
+}
+
+// Received 返回已成功接收的消息数量。
+func (i *Info) Received() int64 {
+	return i.received.Load()
+}
+
+func NewInfo(method string, isClientStream, isServerStream bool) *Info {
+	return &Info{FullMethod: method, IsClientStream: isClientStream, IsServerStream: isServerStream, Start: time.Now()}
+}
+
+// Hooks 是流的事件钩子，所有字段都是可选的。
+//
+//	OnOpen: 拦截器开始处理流时调用，先于其他所有钩子
+//	OnSend: 发送消息前调用，返回错误时不发送消息，SendMsg 直接返回该错误
+//	OnSent: 发送消息后调用，cost 为 SendMsg 的耗时
+//	OnRecv: 每次 RecvMsg 返回后调用，err 可能是 io.EOF；返回非 nil 错误时，RecvMsg 改为返回该错误
+//	OnHeader: 服务端设置或发送 Header 时调用；客户端收到 Header 时调用一次
+//	OnTrailer: 服务端设置 Trailer 时调用；客户端在流结束后调用一次
+//	OnClose: 流结束时调用一次，st 为流的最终状态
+type Hooks struct {
+	OnOpen    func(info *Info)
+	OnSend    func(info *Info, m any) error
+	OnSent    func(info *Info, m any, cost time.Duration, err error)
+	OnRecv    func(info *Info, m any, cost time.Duration, err error) error
+	OnHeader  func(info *Info, md metadata.MD)
+	OnTrailer func(info *Info, md metadata.MD)
+	OnClose   func(info *Info, st *status.Status)
+}
+
+// Merge 将多组钩子合并为一组，按传入顺序执行；返回错误的钩子会中断后续同类钩子的执行。
+func Merge(hooks ...Hooks) Hooks {
+	var m Hooks
+	for _, h := range hooks {
+		if h.OnOpen != nil {
+			prev, next := m.OnOpen, h.OnOpen
+			m.OnOpen = func(info *Info) {
+				if prev != nil {
+					prev(info)
+				}
+				next(info)
+			}
+		}
+		if h.OnSend != nil {
+			prev, next := m.OnSend, h.OnSend
+			m.OnSend = func(info *Info, msg any) error {
+				if prev != nil {
+					if err := prev(info, msg); err != nil {
+						return err
+					}
+				}
+				return next(info, msg)
+			}
+		}
+		if h.OnSent != nil {
+			prev, next := m.OnSent, h.OnSent
+			m.OnSent = func(info *Info, msg any, cost time.Duration, err error) {
+				if prev != nil {
+					prev(info, msg, cost, err)
+				}
+				next(info, msg, cost, err)
+			}
+		}
+		if h.OnRecv != nil {
+			prev, next := m.OnRecv, h.OnRecv
+			m.OnRecv = func(info *Info, msg any, cost time.Duration, err error) error {
+				if prev != nil {
+					if herr := prev(info, msg, cost, err); herr != nil {
+						return herr
+					}
+				}
+				return next(info, msg, cost, err)
+			}
+		}
+		if h.OnHeader != nil {
+			prev, next := m.OnHeader, h.OnHeader
+			m.OnHeader = func(info *Info, md metadata.MD) {
+				if prev != nil {
+					prev(info, md)
+				}
+				next(info, md)
+			}
+		}
+		if h.OnTrailer != nil {
+			prev, next := m.OnTrailer, h.OnTrailer
+			m.OnTrailer = func(info *Info, md metadata.MD) {
+				if prev != nil {
+					prev(info, md)
+				}
+				next(info, md)
+			}
+		}
+		if h.OnClose != nil {
+			prev, next := m.OnClose, h.OnClose
+			m.OnClose = func(info *Info, st *status.Status) {
+				if prev != nil {
+					prev(info, st)
+				}
+				next(info, st)
+			}
+		}
+	}
+	return m
+}
+
+func (h *Hooks) send(info *Info, m any, send func(any) error) error {
+	if h.OnSend != nil {
+		if err := h.OnSend(info, m); err != nil {
+			return err
+		}
+	}
+	start := time.Now()
+	err := send(m)
+	if err == nil {
+		info.sent.Add(1)
+	}
+	if h.OnSent != nil {
+		h.OnSent(info, m, time.Since(start), err)
+	}
+	return err
+}
+
+func (h *Hooks) recv(info *Info, m any, recv func(any) error) error {
+	start := time.Now()
+	err := recv(m)
+	if err == nil {
+		info.received.Add(1)
+	}
+	if h.OnRecv != nil {
+		if herr := h.OnRecv(info, m, time.Since(start), err); herr != nil {
+			return herr
+		}
+	}
+	return err
+}
+
+// ServerStream 包装 grpc.ServerStream，在每条消息收发以及 Header、Trailer 设置时调用钩子。
+type ServerStream struct {
+	grpc.ServerStream
+	info  *Info
+	hooks Hooks
+}
+
+func (s *ServerStream) Info() *Info {
+	return s.info
+}
+
+func (s *ServerStream) SendMsg(m any) error {
+	return s.hooks.send(s.info, m, s.ServerStream.SendMsg)
+}
+
+func (s *ServerStream) RecvMsg(m any) error {
+	return s.hooks.recv(s.info, m, s.ServerStream.RecvMsg)
+}
+
+func (s *ServerStream) SetHeader(md metadata.MD) error {
+	err := s.ServerStream.SetHeader(md)
+	if err == nil && s.hooks.OnHeader != nil {
+		s.hooks.OnHeader(s.info, md)
+	}
+	return err
+}
+
+func (s *ServerStream) SendHeader(md metadata.MD) error {
+	err := s.ServerStream.SendHeader(md)
+	if err == nil && s.hooks.OnHeader != nil {
+		s.hooks.OnHeader(s.info, md)
+	}
+	return err
+}
+
+func (s *ServerStream) SetTrailer(md metadata.MD) {
+	s.ServerStream.SetTrailer(md)
+	if s.hooks.OnTrailer != nil {
+		s.hooks.OnTrailer(s.info, md)
+	}
+}
+
+func WrapServerStream(ss grpc.ServerStream, info *Info, hooks Hooks) *ServerStream {
+	return &ServerStream{ServerStream: ss, info: info, hooks: hooks}
+}
+
+// ClientStream 包装 grpc.ClientStream，在每条消息收发、收到 Header、流结束时调用钩子。
+type ClientStream struct {
+	grpc.ClientStream
+	info  *Info
+	hooks Hooks
+	desc  *grpc.StreamDesc
+
+	headerOnce sync.Once
+	closeOnce  sync.Once
+}
+
+func (s *ClientStream) Info() *Info {
+	return s.info
+}
+
+func (s *ClientStream) header(md metadata.MD) {
+	s.headerOnce.Do(func() {
+		if s.hooks.OnHeader != nil {
+			s.hooks.OnHeader(s.info, md)
+		}
+	})
+}
+
+func (s *ClientStream) close(err error) {
+	s.closeOnce.Do(func() {
+		if err == io.EOF {
+			err = nil
+		}
+		// 流结束后 Trailer 已经到达，不会阻塞
+		if s.hooks.OnTrailer != nil {
+			s.hooks.OnTrailer(s.info, s.ClientStream.Trailer())
+		}
+		if s.hooks.OnClose != nil {
+			s.hooks.OnClose(s.info, status.Convert(err))
+		}
+	})
+}
+
+func (s *ClientStream) Header() (metadata.MD, error) {
+	md, err := s.ClientStream.Header()
+	if err == nil {
+		s.header(md)
+	}
+	return md, err
+}
+
+func (s *ClientStream) SendMsg(m any) error {
+	return s.hooks.send(s.info, m, s.ClientStream.SendMsg)
+}
+
+func (s *ClientStream) RecvMsg(m any) error {
+	err := s.hooks.recv(s.info, m, s.ClientStream.RecvMsg)
+	if err == nil {
+		// 收到第一条消息时 Header 一定已经到达，此时调用 Header() 不会阻塞
+		if md, herr := s.ClientStream.Header(); herr == nil {
+			s.header(md)
+		}
+	}
+	// 服务端流在 RecvMsg 返回错误（包括 io.EOF）时结束，非服务端流在收到唯一的响应后结束
+	if err != nil || !s.desc.ServerStreams {
+		s.close(err)
+	}
+	return err
+}
+
+func WrapClientStream(cs grpc.ClientStream, desc *grpc.StreamDesc, info *Info, hooks Hooks) *ClientStream {
+	return &ClientStream{ClientStream: cs, info: info, hooks: hooks, desc: desc}
+}
+
+func StreamServerInterceptor(hooks Hooks) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		i := NewInfo(info.FullMethod, info.IsClientStream, info.IsServerStream)
+		if hooks.OnOpen != nil {
+			hooks.OnOpen(i)
+		}
+		err := handler(srv, WrapServerStream(ss, i, hooks))
+		if hooks.OnClose != nil {
+			hooks.OnClose(i, status.Convert(err))
+		}
+		return err
+	}
+}
+
+func StreamClientInterceptor(hooks Hooks) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		i := NewInfo(method, desc.ClientStreams, desc.ServerStreams)
+		if hooks.OnOpen != nil {
+			hooks.OnOpen(i)
+		}
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			if hooks.OnClose != nil {
+				hooks.OnClose(i, status.Convert(err))
+			}
+			return nil, err
+		}
+		return WrapClientStream(cs, desc, i, hooks), nil
+	}
+}
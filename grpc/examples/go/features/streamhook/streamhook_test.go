@@ -0,0 +1,145 @@
+package streamhook
+
+import (
+	"context"
+	"goexamples/bootstrap"
+	"goexamples/features/proto/message"
+	"net"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type events struct {
+	mu       sync.Mutex
+	headers  int
+	trailers int
+	closed   []codes.Code
+}
+
+func (e *events) hooks() Hooks {
+	return Hooks{
+		OnHeader: func(*Info, metadata.MD) {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			e.headers++
+		},
+		OnTrailer: func(*Info, metadata.MD) {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			e.trailers++
+		},
+		OnClose: func(_ *Info, st *status.Status) {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			e.closed = append(e.closed, st.Code())
+		},
+	}
+}
+
+func start(t *testing.T, server, client Hooks) *message.MessageSrvClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := message.NewMessageSrvServer(bootstrap.WithStreamInterceptors(StreamServerInterceptor(server)))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	c, err := message.NewMessageSrvClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStreamInterceptor(StreamClientInterceptor(client)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func messages(contents ...string) []*message.Message {
+	mc := make([]*message.Message, len(contents))
+	for i, c := range contents {
+		mc[i] = &message.Message{Content: c}
+	}
+	return mc
+}
+
+func TestCounter(t *testing.T) {
+	sc, cc := NewCounter(), NewCounter()
+	se, ce := &events{}, &events{}
+	c := start(t, Merge(sc.Hooks(), se.hooks()), Merge(cc.Hooks(), ce.hooks()))
+
+	tests := []struct {
+		method     string
+		call       func(context.Context, []*message.Message, ...grpc.CallOption) ([]*message.Message, error)
+		serverSent int64
+		serverRecv int64
+		clientSent int64
+		clientRecv int64
+	}{
+		// ClientStream 服务端通过 SendAndClose 发送一条响应
+		{message.MessageService_ClientStream_FullMethodName, c.ClientStream, 1, 3, 3, 1},
+		// ServerStream 的请求由生成的 handler 通过包装后的 RecvMsg 读取，同样计入接收数量
+		{message.MessageService_ServerStream_FullMethodName, c.ServerStream, 3, 1, 1, 3},
+		{message.MessageService_BidirectionalStream_FullMethodName, c.BidirectionalStream, 3, 3, 3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			if _, err := tt.call(context.Background(), messages("1", "2", "3")); err != nil {
+				t.Fatal(err)
+			}
+			s, cs := sc.Stats(tt.method), cc.Stats(tt.method)
+			if s.Streams != 1 || s.Active != 0 || s.Sent != tt.serverSent || s.Received != tt.serverRecv || s.Codes[codes.OK] != 1 {
+				t.Fatalf("unexpected server stats: %v", s)
+			}
+			if cs.Streams != 1 || cs.Active != 0 || cs.Sent != tt.clientSent || cs.Received != tt.clientRecv || cs.Codes[codes.OK] != 1 {
+				t.Fatalf("unexpected client stats: %v", cs)
+			}
+		})
+	}
+
+	se.mu.Lock()
+	defer se.mu.Unlock()
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+	// 服务端每个流调用一次 SendHeader 和一次 SetTrailer
+	if se.headers != 3 || se.trailers != 3 || len(se.closed) != 3 {
+		t.Fatalf("unexpected server events: %+v", se)
+	}
+	if ce.headers != 3 || ce.trailers != 3 || len(ce.closed) != 3 {
+		t.Fatalf("unexpected client events: %+v", ce)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("server recv", func(t *testing.T) {
+		counter := NewCounter()
+		c := start(t, Merge(Validate(SelfValidator, nil), counter.Hooks()), Hooks{})
+		_, err := c.BidirectionalStream(context.Background(), messages("1", "", "3"))
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("want InvalidArgument, got %v", err)
+		}
+		if s := counter.Stats(message.MessageService_BidirectionalStream_FullMethodName); s.Codes[codes.InvalidArgument] != 1 {
+			t.Fatalf("want closed with InvalidArgument, got %v", s)
+		}
+	})
+
+	t.Run("client send", func(t *testing.T) {
+		counter := NewCounter()
+		c := start(t, Hooks{}, Merge(Validate(nil, SelfValidator), counter.Hooks()))
+		_, err := c.ClientStream(context.Background(), messages("1", "", "3"))
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("want InvalidArgument, got %v", err)
+		}
+		if s := counter.Stats(message.MessageService_ClientStream_FullMethodName); s.Sent != 1 {
+			t.Fatalf("want only valid message sent, got %v", s)
+		}
+	})
+}
@@ -0,0 +1,276 @@
+package validate
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// rules 是解析后的字段规则，pattern 只编译一次。
+type rules struct {
+	*FieldRules
+	re *regexp.Regexp
+}
+
+// 以字段全名缓存解析结果，没有声明规则的字段缓存为 nil，避免每次请求都解析 options。
+var cache sync.Map
+
+func rulesOf(fd protoreflect.FieldDescriptor) *rules {
+	if v, ok := cache.Load(fd.FullName()); ok {
+		return v.(*rules)
+	}
+	var r *rules
+	if opts, ok := fd.Options().(*descriptorpb.FieldOptions); ok && proto.HasExtension(opts, E_Rules) {
+		r = &rules{FieldRules: proto.GetExtension(opts, E_Rules).(*FieldRules)}
+		if p := r.GetPattern(); p != "" {
+			// 正则写错属于 proto 定义的编程错误，与请求无关
+			r.re = regexp.MustCompile(p)
+		}
+	}
+	v, _ := cache.LoadOrStore(fd.FullName(), r)
+	return v.(*rules)
+}
+
+// check 返回字段值违反的所有规则的描述，required 为 false 时不检查 required 规则。
+func (r *rules) check(m protoreflect.Message, fd protoreflect.FieldDescriptor, required bool) []string {
+	if fd.IsList() || fd.IsMap() {
+		return r.checkItems(m, fd, required)
+	}
+	if !m.Has(fd) {
+		if required {
+			return []string{"is required"}
+		}
+		return nil
+	}
+	var errs []string
+	v := m.Get(fd)
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		s := v.String()
+		errs = r.checkLen(errs, utf8.RuneCountInString(s), "characters")
+		if r.re != nil && !r.re.MatchString(s) {
+			errs = append(errs, fmt.Sprintf("must match pattern %q", r.GetPattern()))
+		}
+		if r.GetEmail() {
+			if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s {
+				errs = append(errs, "must be a valid email address")
+			}
+		}
+	case protoreflect.BytesKind:
+		errs = r.checkLen(errs, len(v.Bytes()), "bytes")
+	}
+	return errs
+}
+
+// checkItems 检查 repeated/map 字段，为空时同样检查 min_items。
+func (r *rules) checkItems(m protoreflect.Message, fd protoreflect.FieldDescriptor, required bool) []string {
+	var n int
+	if fd.IsList() {
+		n = m.Get(fd).List().Len()
+	} else {
+		n = m.Get(fd).Map().Len()
+	}
+	if n == 0 && required {
+		return []string{"is required"}
+	}
+	if lo := int(r.GetMinItems()); n < lo {
+		return []string{fmt.Sprintf("must contain at least %d items, got %d", lo, n)}
+	}
+	return nil
+}
+
+func (r *rules) checkLen(errs []string, n int, unit string) []string {
+	if lo := int(r.GetMinLen()); lo > 0 && n < lo {
+		errs = append(errs, fmt.Sprintf("must be at least %d %s, got %d", lo, unit, n))
+	}
+	if hi := int(r.GetMaxLen()); hi > 0 && n > hi {
+		errs = append(errs, fmt.Sprintf("must be at most %d %s, got %d", hi, unit, n))
+	}
+	return errs
+}
+
+// updateMaskField 是更新请求中 FieldMask 字段的名称，见 https://google.aip.dev/134
+const updateMaskField = "update_mask"
+
+// mask 是更新请求的 update_mask 中、相对于当前消息的字段路径，nil 表示检查所有字段。
+// 部分更新时未更新的字段为空是正常的，只有 mask 中的字段检查 required 规则，其他规则照常检查。
+type mask []string
+
+// updateMask 返回请求中 update_mask 的路径，没有设置时为 nil。
+func updateMask(m protoreflect.Message) mask {
+	fd := m.Descriptor().Fields().ByName(updateMaskField)
+	if fd == nil || fd.Message() == nil || fd.Message().FullName() != "google.protobuf.FieldMask" || !m.Has(fd) {
+		return nil
+	}
+	paths := m.Get(fd).Message().Get(fd.Message().Fields().ByName("paths")).List()
+	out := make(mask, 0, paths.Len())
+	for i := 0; i < paths.Len(); i++ {
+		out = append(out, paths.Get(i).String())
+	}
+	return out
+}
+
+// covers 判断字段是否在 mask 中，包括只更新它的部分子字段。
+func (pm mask) covers(name string) bool {
+	if pm == nil {
+		return true
+	}
+	for _, p := range pm {
+		if p == name || strings.HasPrefix(p, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// sub 返回嵌套消息字段 name 中的路径，整个字段都在 mask 中时返回 nil，检查它的所有字段。
+func (pm mask) sub(name string) mask {
+	if pm == nil {
+		return nil
+	}
+	out := mask{}
+	for _, p := range pm {
+		if p == name {
+			return nil
+		}
+		if rest, ok := strings.CutPrefix(p, name+"."); ok {
+			out = append(out, rest)
+		}
+	}
+	return out
+}
+
+func walk(m protoreflect.Message, prefix string, pm mask, out []*errdetails.BadRequest_FieldViolation) []*errdetails.BadRequest_FieldViolation {
+	um := updateMask(m)
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		name := string(fd.Name())
+		path := prefix + name
+		if r := rulesOf(fd); r != nil {
+			for _, desc := range r.check(m, fd, r.GetRequired() && pm.covers(name)) {
+				out = append(out, &errdetails.BadRequest_FieldViolation{Field: path, Description: desc})
+			}
+		}
+		if !m.Has(fd) {
+			continue
+		}
+		// 嵌套的消息同样按其字段上声明的规则校验，update_mask 作用于请求中被更新的消息
+		child := pm.sub(name)
+		if um != nil && name != updateMaskField {
+			child = um
+		}
+		switch {
+		case fd.IsList():
+			if fd.Message() == nil {
+				continue
+			}
+			list := m.Get(fd).List()
+			for j := 0; j < list.Len(); j++ {
+				out = walk(list.Get(j).Message(), fmt.Sprintf("%s[%d].", path, j), child, out)
+			}
+		case fd.IsMap():
+			if fd.MapValue().Message() == nil {
+				continue
+			}
+			m.Get(fd).Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				out = walk(v.Message(), fmt.Sprintf("%s[%v].", path, k.Interface()), child, out)
+				return true
+			})
+		case fd.Message() != nil:
+			out = walk(m.Get(fd).Message(), path+".", child, out)
+		}
+	}
+	return out
+}
+
+// Check 按字段上声明的 (validate.rules) 校验消息，返回所有违反的规则。
+// 字段路径使用 proto 字段名，嵌套消息以 . 分隔，repeated 字段带下标，例如 value[0].title。
+// 消息带有 update_mask 时按部分更新处理，被更新的消息中只有 mask 中的字段检查 required 规则。
+func Check(msg proto.Message) []*errdetails.BadRequest_FieldViolation {
+	if msg == nil {
+		return nil
+	}
+	return walk(msg.ProtoReflect(), "", nil, nil)
+}
+
+// Validate 校验消息，不通过时返回 codes.InvalidArgument 错误，并通过 errdetails.BadRequest 携带所有违反的规则。
+// 不是 proto 消息时直接通过。
+func Validate(msg any) error {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return nil
+	}
+	violations := Check(m)
+	if len(violations) == 0 {
+		return nil
+	}
+	first := violations[0]
+	st := status.Newf(codes.InvalidArgument, "invalid %s: %s %s", m.ProtoReflect().Descriptor().Name(), first.GetField(), first.GetDescription())
+	if n := len(violations) - 1; n > 0 {
+		st = status.Newf(codes.InvalidArgument, "%s (and %d more)", st.Message(), n)
+	}
+	if ds, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); err == nil {
+		st = ds
+	}
+	return st.Err()
+}
+
+// Violations 从错误中取出 errdetails.BadRequest 携带的字段错误，供客户端展示。
+func Violations(err error) []*errdetails.BadRequest_FieldViolation {
+	var out []*errdetails.BadRequest_FieldViolation
+	for _, d := range status.Convert(err).Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			out = append(out, br.GetFieldViolations()...)
+		}
+	}
+	return out
+}
+
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := Validate(req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// validatingStream 校验流中接收到的每一条消息，不通过时 RecvMsg 返回错误，业务方法通常会直接将其返回结束流。
+type validatingStream struct {
+	grpc.ServerStream
+}
+
+func (s *validatingStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return Validate(m)
+}
+
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &validatingStream{ss})
+	}
+}
+
+// ServerOptions 返回注册拦截器的服务端配置。
+// 校验应当紧挨业务方法执行，一般放在其他拦截器之后注册，这样认证、限流失败的请求不会再被校验。
+func ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(StreamServerInterceptor()),
+	}
+}
@@ -0,0 +1,135 @@
+package validate_test
+
+import (
+	"context"
+	"goexamples/bootstrap"
+	"goexamples/features/proto/message"
+	"goexamples/features/validate"
+	userpb "goexamples/gateway/openapi/proto"
+	"goexamples/harness"
+	"goexamples/poem-stream/poem"
+	poempb "goexamples/poem-stream/proto"
+	"goexamples/poem-stream/testdata"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func fields(t *testing.T, msg proto.Message) []string {
+	t.Helper()
+	var out []string
+	for _, v := range validate.Check(msg) {
+		out = append(out, v.GetField())
+	}
+	return out
+}
+
+func TestCheck(t *testing.T) {
+	poem := func(title string, contents ...string) *poempb.Poem {
+		return &poempb.Poem{Title: title, Author: "曹植", Contents: contents}
+	}
+	tests := []struct {
+		name string
+		msg  proto.Message
+		want []string
+	}{
+		{name: "valid poem", msg: poem("洛神赋", "黄初三年")},
+		{name: "required", msg: poem("", "黄初三年"), want: []string{"title"}},
+		{name: "max_len counts characters", msg: poem(strings.Repeat("赋", 64), "黄初三年")},
+		{name: "max_len", msg: poem(strings.Repeat("赋", 65), "黄初三年"), want: []string{"title"}},
+		{name: "min_items", msg: poem("洛神赋"), want: []string{"contents"}},
+		{name: "multiple violations", msg: &poempb.Poem{Author: strings.Repeat("a", 33)}, want: []string{"title", "author", "contents"}},
+		{name: "repeated nested", msg: &poempb.PoemCollection{Value: []*poempb.Poem{poem("洛神赋", "黄初三年"), poem("")}}, want: []string{"value[1].title", "value[1].contents"}},
+		{name: "empty repeated", msg: &poempb.PoemCollection{}, want: []string{"value"}},
+		{name: "pattern", msg: &message.Message{Content: "hello", Room: "room 1"}, want: []string{"room"}},
+		{name: "required string", msg: &message.Message{}, want: []string{"content"}},
+		{name: "empty string skips pattern", msg: &message.Message{Content: "hello"}},
+		{name: "email", msg: &userpb.CreateUserRequest{User: &userpb.User{Name: "zhangsan", Email: "zhangsan"}}, want: []string{"user.email"}},
+		{name: "email with display name", msg: &userpb.CreateUserRequest{User: &userpb.User{Name: "zhangsan", Email: "Zhang San <zhangsan@example.com>"}}, want: []string{"user.email"}},
+		{name: "valid email", msg: &userpb.CreateUserRequest{User: &userpb.User{Name: "zhangsan", Email: "zhangsan@example.com"}}},
+		{name: "required nested", msg: &userpb.CreateUserRequest{User: &userpb.User{Email: "zhangsan@example.com"}}, want: []string{"user.name"}},
+		{name: "update mask skips required", msg: &userpb.UpdateUserRequest{User: &userpb.User{Email: "lisi@example.com"}, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"email"}}}},
+		{name: "update mask checks masked fields", msg: &userpb.UpdateUserRequest{User: &userpb.User{Email: "lisi"}, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name", "email"}}}, want: []string{"user.name", "user.email"}},
+		{name: "update without mask", msg: &userpb.UpdateUserRequest{User: &userpb.User{Email: "lisi@example.com"}}, want: []string{"user.name"}},
+		{name: "required message", msg: &userpb.CreateUserRequest{}, want: []string{"user"}},
+		{name: "no rules", msg: &userpb.GetUserRequest{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fields(t, tt.msg); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("violations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := validate.Validate("not a proto message"); err != nil {
+		t.Fatalf("Validate(string) = %v, want nil", err)
+	}
+	err := validate.Validate(&poempb.Poem{})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("code = %v, want InvalidArgument", st.Code())
+	}
+	if want := "invalid Poem: title is required (and 1 more)"; st.Message() != want {
+		t.Fatalf("message = %q, want %q", st.Message(), want)
+	}
+	if n := len(validate.Violations(err)); n != 2 {
+		t.Fatalf("got %d violations, want 2", n)
+	}
+}
+
+func startPoemSrv(t *testing.T) poempb.PoemServiceClient {
+	t.Helper()
+	conn := harness.New(t).Start(func(opts ...grpc.ServerOption) harness.Server {
+		s := poem.NewServer(bootstrap.WithServerOptions(opts...))
+		s.SetDB(testdata.NewDB("../../poem-stream/testdata/server_poem.json"))
+		return s
+	})
+	return poempb.NewPoemServiceClient(conn)
+}
+
+func TestInterceptor(t *testing.T) {
+	c := startPoemSrv(t)
+	ctx := context.Background()
+
+	t.Run("unary", func(t *testing.T) {
+		_, err := c.GetPoem(ctx, &poempb.GetPoemRequest{})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("err = %v, want InvalidArgument", err)
+		}
+		v := validate.Violations(err)
+		if len(v) != 1 || v[0].GetField() != "title" {
+			t.Fatalf("violations = %v, want title", v)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		stream, err := c.BatchUploadPoemStream(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.Send(&poempb.Poem{Title: "洛神赋", Contents: []string{"黄初三年"}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Recv(); err != nil {
+			t.Fatalf("valid message rejected: %v", err)
+		}
+		if err := stream.Send(&poempb.Poem{Title: "洛神赋"}); err != nil {
+			t.Fatal(err)
+		}
+		_, err = stream.Recv()
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("err = %v, want InvalidArgument", err)
+		}
+		if v := validate.Violations(err); len(v) != 1 || v[0].GetField() != "contents" {
+			t.Fatalf("violations = %v, want contents", v)
+		}
+	})
+}
@@ -0,0 +1,338 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	// DefaultPath 是桥接的路径前缀，方法的路径为 DefaultPath 加上 pkg.Service/Method。
+	DefaultPath = "/ws/"
+	// DefaultPingInterval 是默认发送 ping 的间隔。
+	DefaultPingInterval = 30 * time.Second
+)
+
+// IsUpgrade 判断请求是否为访问桥接的 WebSocket 握手请求，可以作为 ServerMux 的匹配条件。
+func IsUpgrade(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, DefaultPath) && IsWebSocket(r)
+}
+
+type method struct {
+	conn grpc.ClientConnInterface
+	desc protoreflect.MethodDescriptor
+}
+
+type Option func(*Bridge)
+
+// WithMethod 允许通过 WebSocket 调用 conn 上的方法，方法写成 pkg.Service/Method，
+// 方法所在的 proto 文件需要已经注册到 protoregistry.GlobalFiles，即导入了生成的代码。
+func WithMethod(conn grpc.ClientConnInterface, methods ...string) Option {
+	return func(b *Bridge) {
+		for _, name := range methods {
+			service, m, _ := strings.Cut(name, "/")
+			d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+			if err != nil {
+				panic(fmt.Sprintf("websocket: service of %s not found: %v", name, err))
+			}
+			sd, ok := d.(protoreflect.ServiceDescriptor)
+			if !ok || sd.Methods().ByName(protoreflect.Name(m)) == nil {
+				panic(fmt.Sprintf("websocket: method %s not found", name))
+			}
+			b.methods[name] = method{conn: conn, desc: sd.Methods().ByName(protoreflect.Name(m))}
+		}
+	}
+}
+
+// WithPingInterval 设置发送 ping 的间隔，超过两个间隔没有收到客户端的任何帧时断开，小于等于 0 时不发送，默认为 DefaultPingInterval。
+func WithPingInterval(d time.Duration) Option {
+	return func(b *Bridge) {
+		b.pingInterval = d
+	}
+}
+
+// WithMaxFrameSize 设置客户端消息的最大长度，超过时以 CloseTooLarge 断开，默认为 DefaultMaxFrameSize。
+func WithMaxFrameSize(n int64) Option {
+	return func(b *Bridge) {
+		b.maxFrameSize = n
+	}
+}
+
+// WithCheckOrigin 设置允许的来源，默认为 SameOrigin。
+func WithCheckOrigin(f func(*http.Request) bool) Option {
+	return func(b *Bridge) {
+		b.checkOrigin = f
+	}
+}
+
+// Bridge 将 WebSocket 连接桥接到 gRPC 流，浏览器无法直接发起 gRPC 调用，grpc-gateway 也不支持双向流。
+//
+//   - 客户端的每个文本帧是一条 JSON 格式（protojson）的请求消息，每条响应消息作为一个文本帧发送给客户端。
+//   - 查询参数作为请求的元数据；第一帧也可以是 {"metadata": {"key": "value"}}，与查询参数合并。
+//     rpc 在收到第一帧之后才开始，所以连接后需要先发送元数据帧或第一条消息。
+//   - 空的文本帧表示客户端发送结束（half-close），之后仍然可以收到响应；客户端以 CloseNormal 关闭时同样处理，
+//     其他关闭码取消 rpc。
+//   - rpc 结束后以关闭码通知结果：正常结束为 CloseNormal，错误为 CloseCodeBase 加上 gRPC 状态码，原因为错误信息。
+//     二进制帧以 CloseUnsupportedData、消息过大以 CloseTooLarge 断开，Status 将关闭码转为 gRPC 状态。
+type Bridge struct {
+	methods      map[string]method
+	pingInterval time.Duration
+	maxFrameSize int64
+	checkOrigin  func(*http.Request) bool
+}
+
+// Methods 返回可以调用的方法。
+func (b *Bridge) Methods() []string {
+	return slices.Sorted(maps.Keys(b.methods))
+}
+
+func (b *Bridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m, ok := b.methods[strings.TrimPrefix(r.URL.Path, DefaultPath)]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	ws, err := Upgrade(w, r, b.checkOrigin)
+	if err != nil {
+		log.Printf("websocket: upgrade %s failed: %v\n", r.URL.Path, err)
+		return
+	}
+	defer ws.Close()
+	ws.SetMaxFrameSize(b.maxFrameSize)
+	ws.KeepAlive(b.pingInterval)
+
+	md := metadata.MD{}
+	for k, vs := range r.URL.Query() {
+		md.Append(strings.ToLower(k), vs...)
+	}
+	// 连接已经被接管，rpc 由关闭握手结束，不使用请求的 context
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &session{ws: ws, method: m, cancel: cancel}
+	code, reason := s.run(ctx, md)
+	ws.WriteClose(code, reason)
+	// 等待客户端回复关闭帧，读取的 goroutine 在收到关闭帧或者 closeTimeout 后退出
+	<-s.readDone
+}
+
+// session 是一个 WebSocket 连接上的一次 rpc。
+type session struct {
+	ws       *Conn
+	method   method
+	cancel   context.CancelFunc
+	readDone chan struct{}
+
+	mu      sync.Mutex
+	failure error // 桥接自身发现的错误（*CloseError 或者 gRPC 状态），优先于 rpc 的结果
+}
+
+func (s *session) fail(err error) {
+	s.mu.Lock()
+	if s.failure == nil {
+		s.failure = err
+	}
+	s.mu.Unlock()
+	s.cancel()
+}
+
+func newMessage(d protoreflect.MessageDescriptor) proto.Message {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByName(d.FullName()); err == nil {
+		return mt.New().Interface()
+	}
+	return dynamicpb.NewMessage(d)
+}
+
+// parseMetadata 解析 {"metadata": {...}} 帧，值可以是字符串或字符串数组；请求消息本身有 metadata 字段时不解析。
+func (s *session) parseMetadata(data []byte) (metadata.MD, bool) {
+	if s.method.desc.Input().Fields().ByJSONName("metadata") != nil {
+		return nil, false
+	}
+	var frame map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(data, &frame); err != nil || len(frame) != 1 || frame["metadata"] == nil {
+		return nil, false
+	}
+	md := metadata.MD{}
+	for k, raw := range frame["metadata"] {
+		var v string
+		var vs []string
+		if err := json.Unmarshal(raw, &v); err == nil {
+			md.Append(k, v)
+		} else if err := json.Unmarshal(raw, &vs); err == nil {
+			md.Append(k, vs...)
+		} else {
+			return nil, false
+		}
+	}
+	return md, true
+}
+
+// readFirst 读取第一帧，元数据帧合并到 md 中并返回 nil，否则返回第一条消息。
+func (s *session) readFirst(md metadata.MD) ([]byte, error) {
+	data, err := s.read()
+	if err != nil || data == nil {
+		return data, err
+	}
+	if extra, ok := s.parseMetadata(data); ok {
+		for k, vs := range extra {
+			md.Append(k, vs...)
+		}
+		return nil, nil
+	}
+	return data, nil
+}
+
+// read 读取一条文本消息，空的文本帧返回非 nil 的空切片。
+func (s *session) read() ([]byte, error) {
+	op, data, err := s.ws.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	if op != OpText {
+		return nil, s.ws.fail(&CloseError{Code: CloseUnsupportedData, Reason: "only text frames are supported"})
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return data, nil
+}
+
+func (s *session) run(ctx context.Context, md metadata.MD) (int, string) {
+	s.readDone = make(chan struct{})
+	first, err := s.readFirst(md)
+	if err != nil {
+		close(s.readDone)
+		return s.result(err)
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	desc := s.method.desc
+	stream, err := s.method.conn.NewStream(ctx, &grpc.StreamDesc{
+		StreamName:    string(desc.Name()),
+		ServerStreams: desc.IsStreamingServer(),
+		ClientStreams: desc.IsStreamingClient(),
+	}, fmt.Sprintf("/%s/%s", desc.Parent().FullName(), desc.Name()))
+	if err != nil {
+		close(s.readDone)
+		return s.result(err)
+	}
+	go s.forward(stream, first)
+
+	for {
+		out := newMessage(desc.Output())
+		if err := stream.RecvMsg(out); err == io.EOF {
+			return s.result(nil)
+		} else if err != nil {
+			return s.result(err)
+		}
+		b, err := protojson.Marshal(out)
+		if err == nil {
+			err = s.ws.WriteMessage(OpText, b)
+		}
+		if err != nil {
+			s.fail(status.Errorf(codes.Unavailable, "failed to send message: %v", err))
+		}
+	}
+}
+
+// result 返回发送给客户端的关闭码，桥接自身的错误优先于 rpc 的结果。
+func (s *session) result(err error) (int, string) {
+	s.mu.Lock()
+	if s.failure != nil {
+		err = s.failure
+	}
+	s.mu.Unlock()
+	var ce *CloseError
+	if errors.As(err, &ce) {
+		return ce.Code, ce.Reason
+	}
+	if err != nil && status.Code(err) == codes.Unknown {
+		// 读取失败等网络错误
+		err = status.Error(codes.Unavailable, err.Error())
+	}
+	return CloseCode(err)
+}
+
+// forward 将客户端的消息发送到 rpc，客户端发送结束或者出错后继续读取，直到收到关闭帧，以便回复 ping 和完成关闭握手。
+func (s *session) forward(stream grpc.ClientStream, first []byte) {
+	defer close(s.readDone)
+	desc := s.method.desc
+	sending := true
+	send := func(data []byte) {
+		if len(data) == 0 {
+			// 客户端发送结束
+			sending = false
+			stream.CloseSend()
+			return
+		}
+		if !sending {
+			s.fail(status.Errorf(codes.InvalidArgument, "message after the end of %s requests", desc.Name()))
+			return
+		}
+		msg := newMessage(desc.Input())
+		if err := protojson.Unmarshal(data, msg); err != nil {
+			s.fail(status.Errorf(codes.InvalidArgument, "invalid %s: %v", desc.Input().FullName(), err))
+			return
+		}
+		if err := stream.SendMsg(msg); err != nil {
+			// rpc 已经结束，结果由 RecvMsg 返回
+			sending = false
+			return
+		}
+		if !desc.IsStreamingClient() {
+			sending = false
+			stream.CloseSend()
+		}
+	}
+
+	if first != nil {
+		send(first)
+	}
+	for {
+		data, err := s.read()
+		var ce *CloseError
+		switch {
+		case errors.As(err, &ce) && ce.Code == CloseNormal:
+			if sending {
+				sending = false
+				stream.CloseSend()
+			}
+			return
+		case err != nil:
+			s.fail(err)
+			return
+		}
+		send(data)
+	}
+}
+
+// NewBridge 默认每 DefaultPingInterval 发送一次 ping，消息最大为 DefaultMaxFrameSize，只允许同源的请求。
+func NewBridge(opts ...Option) *Bridge {
+	b := &Bridge{
+		methods:      map[string]method{},
+		pingInterval: DefaultPingInterval,
+		maxFrameSize: DefaultMaxFrameSize,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
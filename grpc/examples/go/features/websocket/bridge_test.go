@@ -0,0 +1,231 @@
+package websocket_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"goexamples/bootstrap"
+	"goexamples/features/proto/message"
+	"goexamples/features/websocket"
+	"goexamples/harness"
+	"goexamples/poem-stream/poem"
+	"goexamples/poem-stream/testdata"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	bidi   = "message.MessageService/BidirectionalStream"
+	unary  = "message.MessageService/Unary"
+	upload = "PoemService/BatchUploadPoemStream"
+)
+
+// startBridge 在 bufconn 上启动 MessageService 和 PoemService，返回桥接的 ws:// 地址，
+// 收到的流元数据写入 mds。
+func startBridge(t *testing.T, opts ...websocket.Option) (string, <-chan metadata.MD) {
+	t.Helper()
+	mds := make(chan metadata.MD, 8)
+	h := harness.New(t, harness.WithStreamInterceptors(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, _ := metadata.FromIncomingContext(ss.Context())
+		mds <- md
+		return handler(srv, ss)
+	}))
+	messages := h.Start(func(opts ...grpc.ServerOption) harness.Server {
+		return message.NewMessageSrvServer(bootstrap.WithServerOptions(opts...))
+	})
+	poems := h.Start(func(opts ...grpc.ServerOption) harness.Server {
+		s := poem.NewServer(bootstrap.WithServerOptions(opts...))
+		s.SetDB(testdata.DB{})
+		return s
+	})
+
+	b := websocket.NewBridge(append([]websocket.Option{
+		websocket.WithMethod(messages, bidi, unary),
+		websocket.WithMethod(poems, upload),
+	}, opts...)...)
+	srv := httptest.NewServer(b)
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + websocket.DefaultPath, mds
+}
+
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ws, _, err := websocket.Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func write(t *testing.T, ws *websocket.Conn, msgs ...string) {
+	t.Helper()
+	for _, m := range msgs {
+		if err := ws.WriteMessage(websocket.OpText, []byte(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// read 读取 n 条消息和之后的关闭帧，返回消息和关闭帧转换出的状态。
+func read(t *testing.T, ws *websocket.Conn, n int) ([]map[string]any, codes.Code, string) {
+	t.Helper()
+	var msgs []map[string]any
+	for {
+		_, data, err := ws.ReadMessage()
+		var ce *websocket.CloseError
+		if errors.As(err, &ce) {
+			ws.WriteClose(ce.Code, "")
+			if len(msgs) != n {
+				t.Fatalf("got %d messages before close, want %d: %v", len(msgs), n, msgs)
+			}
+			st := websocket.Status(ce.Code, ce.Reason)
+			return msgs, st.Code(), st.Message()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]any
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatalf("invalid message %q: %v", data, err)
+		}
+		msgs = append(msgs, m)
+	}
+}
+
+func TestBridge(t *testing.T) {
+	url, mds := startBridge(t)
+
+	t.Run("bidi", func(t *testing.T) {
+		ws := dial(t, url+bidi+"?token=abc")
+		write(t, ws, `{"content":"hello"}`, `{"content":"world"}`)
+		for _, want := range []string{"hello", "world"} {
+			_, data, err := ws.ReadMessage()
+			if err != nil || !strings.Contains(string(data), want) {
+				t.Fatalf("ReadMessage = %q %v, want %s", data, err, want)
+			}
+		}
+		// 空帧结束发送，服务端返回后以 1000 关闭
+		write(t, ws, "")
+		if _, code, _ := read(t, ws, 0); code != codes.OK {
+			t.Fatalf("code = %v, want OK", code)
+		}
+		if md := <-mds; md.Get("token")[0] != "abc" {
+			t.Fatalf("metadata = %v, want token from query", md)
+		}
+	})
+
+	t.Run("metadata frame", func(t *testing.T) {
+		ws := dial(t, url+upload+"?token=abc")
+		write(t, ws,
+			`{"metadata":{"token":"def","trace":["1","2"]}}`,
+			`{"title":"静夜思","contents":["床前明月光"]}`,
+			`{"title":"春晓","contents":["春眠不觉晓"]}`,
+		)
+		// 以 1000 关闭等同于结束发送，仍然收到剩余的响应
+		ws.WriteClose(websocket.CloseNormal, "")
+		msgs, code, _ := read(t, ws, 2)
+		if code != codes.OK || msgs[1]["data"].([]any)[0].(map[string]any)["title"] != "春晓" {
+			t.Fatalf("got %v %v", msgs, code)
+		}
+		md := <-mds
+		if got := md.Get("token"); len(got) != 2 || got[1] != "def" {
+			t.Fatalf("token = %v, want query and frame values", got)
+		}
+		if got := md.Get("trace"); len(got) != 2 {
+			t.Fatalf("trace = %v", got)
+		}
+	})
+
+	t.Run("unary", func(t *testing.T) {
+		ws := dial(t, url+unary)
+		write(t, ws, `{"content":"once"}`)
+		if msgs, code, _ := read(t, ws, 1); code != codes.OK || msgs[0]["content"] != "once" {
+			t.Fatalf("got %v %v", msgs, code)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, resp, err := websocket.Dial(ctx, url+"message.MessageService/Missing", nil); err == nil || resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("Dial = %v, want 404", err)
+		}
+	})
+}
+
+func TestBridgeErrors(t *testing.T) {
+	url, _ := startBridge(t, websocket.WithMaxFrameSize(1024))
+
+	tests := []struct {
+		name   string
+		method string
+		send   func(*websocket.Conn) error
+		want   codes.Code
+	}{
+		{"invalid json", bidi, func(ws *websocket.Conn) error {
+			return ws.WriteMessage(websocket.OpText, []byte(`{"content":`))
+		}, codes.InvalidArgument},
+		{"validation", upload, func(ws *websocket.Conn) error {
+			return ws.WriteMessage(websocket.OpText, []byte(`{"author":"李白"}`))
+		}, codes.InvalidArgument},
+		{"binary", bidi, func(ws *websocket.Conn) error {
+			return ws.WriteMessage(websocket.OpBinary, []byte("hi"))
+		}, codes.InvalidArgument},
+		{"too large", bidi, func(ws *websocket.Conn) error {
+			return ws.WriteMessage(websocket.OpText, []byte(`{"content":"`+strings.Repeat("x", 2048)+`"}`))
+		}, codes.ResourceExhausted},
+		{"after unary", unary, func(ws *websocket.Conn) error {
+			ws.WriteMessage(websocket.OpText, []byte(`{"content":"once"}`))
+			return ws.WriteMessage(websocket.OpText, []byte(`{"content":"twice"}`))
+		}, codes.InvalidArgument},
+		{"going away", bidi, func(ws *websocket.Conn) error {
+			ws.WriteMessage(websocket.OpText, []byte(`{"content":"hello"}`))
+			return ws.WriteClose(websocket.CloseGoingAway, "")
+		}, codes.Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := dial(t, url+tt.method)
+			if err := tt.send(ws); err != nil {
+				t.Fatal(err)
+			}
+			var code codes.Code
+			for {
+				_, _, err := ws.ReadMessage()
+				var ce *websocket.CloseError
+				if errors.As(err, &ce) {
+					code = websocket.Status(ce.Code, ce.Reason).Code()
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if code != tt.want {
+				t.Fatalf("code = %v, want %v", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestBridgeKeepAlive(t *testing.T) {
+	url, _ := startBridge(t, websocket.WithPingInterval(50*time.Millisecond))
+	ws := dial(t, url+bidi)
+	write(t, ws, `{"content":"hello"}`)
+	// 不读取连接，客户端不会回复 ping，服务端超时后断开
+	time.Sleep(300 * time.Millisecond)
+	if msgs, code, _ := read(t, ws, 1); code != codes.Unavailable || msgs[0]["content"] != "hello" {
+		t.Fatalf("got %v %v, want Unavailable", msgs, code)
+	}
+}
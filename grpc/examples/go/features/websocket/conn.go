@@ -0,0 +1,451 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// Opcode 是帧的类型，见 RFC 6455 5.2。
+type Opcode byte
+
+const (
+	OpContinuation Opcode = 0x0
+	OpText         Opcode = 0x1
+	OpBinary       Opcode = 0x2
+	OpClose        Opcode = 0x8
+	OpPing         Opcode = 0x9
+	OpPong         Opcode = 0xA
+)
+
+func (op Opcode) control() bool {
+	return op&0x8 != 0
+}
+
+// 关闭码，见 RFC 6455 7.4.1，4000-4999 供应用使用。
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseAbnormal        = 1006
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseTooLarge        = 1009
+	CloseInternalError   = 1011
+)
+
+// DefaultMaxFrameSize 是默认允许的最大消息长度，分片的消息按所有分片的总长度计算。
+const DefaultMaxFrameSize = 64 << 10
+
+// closeTimeout 是发送关闭帧之后等待对方回复的时间，超时后 ReadMessage 返回错误。
+const closeTimeout = 5 * time.Second
+
+// guid 用于计算 Sec-WebSocket-Accept，见 RFC 6455 1.3。
+const guid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrClosed 在发送关闭帧之后继续发送时返回。
+var ErrClosed = errors.New("websocket: close sent")
+
+// CloseError 是收到的关闭帧，或者因为对方违反协议、消息过大而发送的关闭帧。
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Reason)
+}
+
+func protocolError(format string, args ...any) *CloseError {
+	return &CloseError{Code: CloseProtocolError, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Conn 是一个 WebSocket 连接。同一时刻只能有一个 goroutine 调用 ReadMessage，写方法可以并发调用。
+// ReadMessage 自动回复 ping；收到关闭帧时返回 *CloseError，由调用方决定何时调用 WriteClose 回复。
+type Conn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	client  bool // 客户端发送的帧需要掩码，服务端发送的帧不能有掩码
+	maxSize int64
+
+	readTimeout atomic.Int64 // time.Duration，KeepAlive 设置
+
+	wmu       sync.Mutex
+	closeSent bool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newConn(conn net.Conn, r *bufio.Reader, client bool) *Conn {
+	return &Conn{conn: conn, r: r, client: client, maxSize: DefaultMaxFrameSize, stop: make(chan struct{})}
+}
+
+// SetMaxFrameSize 设置允许读取的最大消息长度，超过时发送 CloseTooLarge 并返回错误。
+func (c *Conn) SetMaxFrameSize(n int64) {
+	c.maxSize = n
+}
+
+// KeepAlive 每隔 interval 发送一次 ping，超过两个 interval 没有收到任何帧（包括 pong）时 ReadMessage 返回超时错误。
+func (c *Conn) KeepAlive(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	c.readTimeout.Store(int64(2 * interval))
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-t.C:
+				if err := c.writeFrame(OpPing, nil); err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// RemoteAddr 返回对方的地址。
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// ReadMessage 读取一条完整的文本或二进制消息，分片的消息会被拼接起来，控制帧在其中处理。
+func (c *Conn) ReadMessage() (Opcode, []byte, error) {
+	var (
+		op   Opcode
+		data []byte
+	)
+	for {
+		// 发送关闭帧之后保留 WriteClose 设置的截止时间
+		c.wmu.Lock()
+		if d := time.Duration(c.readTimeout.Load()); d > 0 && !c.closeSent {
+			c.conn.SetReadDeadline(time.Now().Add(d))
+		}
+		c.wmu.Unlock()
+		fin, fop, payload, err := c.readFrame(int64(len(data)))
+		if err != nil {
+			return 0, nil, c.fail(err)
+		}
+		switch fop {
+		case OpPing:
+			// 回复失败时继续读取已经收到的帧，连接的错误由之后的读取返回
+			c.writeFrame(OpPong, payload)
+			continue
+		case OpPong:
+			continue
+		case OpClose:
+			return 0, nil, parseClose(payload)
+		case OpText, OpBinary:
+			if op != 0 {
+				return 0, nil, c.fail(protocolError("expected continuation frame"))
+			}
+			op = fop
+		case OpContinuation:
+			if op == 0 {
+				return 0, nil, c.fail(protocolError("unexpected continuation frame"))
+			}
+		default:
+			return 0, nil, c.fail(protocolError("unknown opcode %d", fop))
+		}
+		data = append(data, payload...)
+		if fin {
+			if op == OpText && !utf8.Valid(data) {
+				return 0, nil, c.fail(&CloseError{Code: CloseInvalidPayload, Reason: "invalid utf-8"})
+			}
+			return op, data, nil
+		}
+	}
+}
+
+// fail 对违反协议的帧发送关闭帧，网络错误原样返回。
+func (c *Conn) fail(err error) error {
+	var ce *CloseError
+	if errors.As(err, &ce) {
+		c.WriteClose(ce.Code, ce.Reason)
+	}
+	return err
+}
+
+// readFrame 读取一帧，read 是当前消息已经读取的长度，见 RFC 6455 5.2。
+func (c *Conn) readFrame(read int64) (fin bool, op Opcode, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.r, head[:]); err != nil {
+		return
+	}
+	fin, op = head[0]&0x80 != 0, Opcode(head[0]&0x0f)
+	if head[0]&0x70 != 0 {
+		return fin, op, nil, protocolError("reserved bits set")
+	}
+	masked := head[1]&0x80 != 0
+	if masked == c.client {
+		return fin, op, nil, protocolError("invalid frame mask")
+	}
+	n := int64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		n = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		if ext[0]&0x80 != 0 {
+			return fin, op, nil, protocolError("invalid payload length")
+		}
+		n = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+	if op.control() && (n > 125 || !fin) {
+		return fin, op, nil, protocolError("invalid control frame")
+	}
+	if !op.control() && c.maxSize > 0 && read+n > c.maxSize {
+		return fin, op, nil, &CloseError{Code: CloseTooLarge, Reason: "message too large"}
+	}
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+func parseClose(payload []byte) *CloseError {
+	switch {
+	case len(payload) == 0:
+		return &CloseError{Code: CloseNoStatus}
+	case len(payload) == 1:
+		return protocolError("invalid close frame")
+	}
+	return &CloseError{Code: int(binary.BigEndian.Uint16(payload)), Reason: string(payload[2:])}
+}
+
+// WriteMessage 以一帧发送一条文本或二进制消息。
+func (c *Conn) WriteMessage(op Opcode, data []byte) error {
+	if op != OpText && op != OpBinary {
+		return fmt.Errorf("websocket: invalid message opcode %d", op)
+	}
+	return c.writeFrame(op, data)
+}
+
+// WriteClose 发送关闭帧，之后不能再发送消息，ReadMessage 最多再等待 closeTimeout 读取对方回复的关闭帧；
+// reason 超过 123 字节时被截断。
+func (c *Conn) WriteClose(code int, reason string) error {
+	for len(reason) > 123 {
+		// 截断时保持 utf-8 编码有效
+		_, size := utf8.DecodeLastRuneInString(reason)
+		reason = reason[:len(reason)-size]
+	}
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	if code == CloseNoStatus {
+		payload = nil
+	}
+	return c.writeFrame(OpClose, append(payload, reason...))
+}
+
+func (c *Conn) writeFrame(op Opcode, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return ErrClosed
+	}
+	if op == OpClose {
+		c.closeSent = true
+		c.conn.SetReadDeadline(time.Now().Add(closeTimeout))
+	}
+
+	frame := []byte{0x80 | byte(op), 0}
+	switch n := len(payload); {
+	case n <= 125:
+		frame[1] = byte(n)
+	case n <= 0xffff:
+		frame[1] = 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame[1] = 127
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	if c.client {
+		frame[1] |= 0x80
+		var mask [4]byte
+		rand.Read(mask[:])
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range payload {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Close 关闭底层的连接，不发送关闭帧。
+func (c *Conn) Close() error {
+	c.stopOnce.Do(func() { close(c.stop) })
+	return c.conn.Close()
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + guid))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// headerContains 判断以逗号分隔的请求头中是否包含 token，不区分大小写。
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsWebSocket 判断请求是否为 WebSocket 握手请求。
+func IsWebSocket(r *http.Request) bool {
+	return r.Method == http.MethodGet && headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// SameOrigin 允许没有 Origin 的请求（非浏览器客户端）和同源的请求，是 Upgrade 默认的来源检查。
+func SameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// Upgrade 完成服务端的握手，见 RFC 6455 4.2。握手失败时已经写出了 HTTP 错误响应。
+// checkOrigin 为 nil 时使用 SameOrigin。
+func Upgrade(w http.ResponseWriter, r *http.Request, checkOrigin func(*http.Request) bool) (*Conn, error) {
+	if !IsWebSocket(r) {
+		http.Error(w, "websocket: not a websocket handshake", http.StatusBadRequest)
+		return nil, errors.New("websocket: not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "websocket: unsupported version", http.StatusUpgradeRequired)
+		return nil, errors.New("websocket: unsupported version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		http.Error(w, "websocket: invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("websocket: invalid Sec-WebSocket-Key")
+	}
+	if checkOrigin == nil {
+		checkOrigin = SameOrigin
+	}
+	if !checkOrigin(r) {
+		http.Error(w, "websocket: origin not allowed", http.StatusForbidden)
+		return nil, errors.New("websocket: origin not allowed")
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "websocket: hijack not supported", http.StatusInternalServerError)
+		return nil, err
+	}
+	// 握手之前的超时设置不再适用
+	conn.SetDeadline(time.Time{})
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newConn(conn, brw.Reader, false), nil
+}
+
+// Dial 作为客户端连接 ws:// 地址，用于测试和命令行客户端，见 RFC 6455 4.1。
+func Dial(ctx context.Context, rawURL string, header http.Header) (*Conn, *http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.Scheme != "ws" {
+		return nil, nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "80")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	var b [16]byte
+	rand.Read(b[:])
+	key := base64.StdEncoding.EncodeToString(b[:])
+	req := &http.Request{Method: http.MethodGet, URL: u, Host: u.Host, Header: http.Header{}}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!headerContains(resp.Header, "Upgrade", "websocket") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, resp, fmt.Errorf("websocket: handshake failed with status %s", resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	return newConn(conn, br, true), resp, nil
+}
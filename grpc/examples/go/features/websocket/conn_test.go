@@ -0,0 +1,242 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// RFC 6455 1.3 中的例子
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("acceptKey = %s", got)
+	}
+}
+
+type frame struct {
+	op      Opcode
+	payload []byte
+}
+
+// pipe 返回服务端的 Conn、客户端一侧的连接，以及客户端收到的帧。
+func pipe(t *testing.T) (*Conn, net.Conn, <-chan frame) {
+	s, c := net.Pipe()
+	t.Cleanup(func() {
+		s.Close()
+		c.Close()
+	})
+	frames := make(chan frame, 16)
+	peer := newConn(c, bufio.NewReader(c), true)
+	go func() {
+		defer close(frames)
+		for {
+			_, op, payload, err := peer.readFrame(0)
+			if err != nil {
+				return
+			}
+			frames <- frame{op, payload}
+		}
+	}()
+	return newConn(s, bufio.NewReader(s), false), c, frames
+}
+
+// rawFrame 按客户端的格式编码一帧，mask 为 false 时生成违反协议的无掩码帧。
+func rawFrame(fin bool, op Opcode, payload []byte, mask bool) []byte {
+	b := []byte{byte(op), 0}
+	if fin {
+		b[0] |= 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		b[1] = byte(n)
+	case n <= 0xffff:
+		b[1] = 126
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b[1] = 127
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	if !mask {
+		return append(b, payload...)
+	}
+	b[1] |= 0x80
+	key := []byte{1, 2, 3, 4}
+	b = append(b, key...)
+	for i, c := range payload {
+		b = append(b, c^key[i%4])
+	}
+	return b
+}
+
+func send(c net.Conn, frames ...[]byte) {
+	go func() {
+		for _, f := range frames {
+			if _, err := c.Write(f); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func TestReadMessage(t *testing.T) {
+	srv, c, frames := pipe(t)
+	send(c,
+		rawFrame(false, OpText, []byte("hel"), true),
+		rawFrame(true, OpPing, []byte("p"), true),
+		rawFrame(true, OpContinuation, []byte("lo"), true),
+		rawFrame(true, OpClose, append(binary.BigEndian.AppendUint16(nil, 4005), "missing"...), true),
+	)
+
+	op, data, err := srv.ReadMessage()
+	if err != nil || op != OpText || string(data) != "hello" {
+		t.Fatalf("ReadMessage = %v %q %v, want text hello", op, data, err)
+	}
+	if f := <-frames; f.op != OpPong || string(f.payload) != "p" {
+		t.Fatalf("got %v %q, want pong p", f.op, f.payload)
+	}
+	_, _, err = srv.ReadMessage()
+	var ce *CloseError
+	if !errors.As(err, &ce) || ce.Code != 4005 || ce.Reason != "missing" {
+		t.Fatalf("ReadMessage error = %v, want close 4005", err)
+	}
+	if st := Status(ce.Code, ce.Reason); st.Code() != codes.NotFound || st.Message() != "missing" {
+		t.Fatalf("Status = %v, want NotFound", st)
+	}
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames [][]byte
+		want   int
+	}{
+		{"unmasked", [][]byte{rawFrame(true, OpText, []byte("hi"), false)}, CloseProtocolError},
+		{"too large", [][]byte{rawFrame(true, OpText, make([]byte, 200), true)}, CloseTooLarge},
+		{"too large fragments", [][]byte{
+			rawFrame(false, OpText, make([]byte, 60), true),
+			rawFrame(true, OpContinuation, make([]byte, 60), true),
+		}, CloseTooLarge},
+		{"invalid utf-8", [][]byte{rawFrame(true, OpText, []byte{0xff, 0xfe}, true)}, CloseInvalidPayload},
+		{"unexpected continuation", [][]byte{rawFrame(true, OpContinuation, []byte("hi"), true)}, CloseProtocolError},
+		{"fragmented control", [][]byte{rawFrame(false, OpPing, nil, true)}, CloseProtocolError},
+		{"interleaved message", [][]byte{
+			rawFrame(false, OpText, []byte("a"), true),
+			rawFrame(true, OpBinary, []byte("b"), true),
+		}, CloseProtocolError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, c, frames := pipe(t)
+			srv.SetMaxFrameSize(100)
+			send(c, tt.frames...)
+
+			_, _, err := srv.ReadMessage()
+			var ce *CloseError
+			if !errors.As(err, &ce) || ce.Code != tt.want {
+				t.Fatalf("ReadMessage error = %v, want close %d", err, tt.want)
+			}
+			f := <-frames
+			if f.op != OpClose || parseClose(f.payload).Code != tt.want {
+				t.Fatalf("got %v %q, want close %d", f.op, f.payload, tt.want)
+			}
+			if err := srv.WriteMessage(OpText, []byte("hi")); !errors.Is(err, ErrClosed) {
+				t.Fatalf("WriteMessage after close = %v, want ErrClosed", err)
+			}
+		})
+	}
+}
+
+func TestWriteCloseTruncate(t *testing.T) {
+	srv, _, frames := pipe(t)
+	go srv.WriteClose(CloseNormal, strings.Repeat("好", 50))
+	f := <-frames
+	ce := parseClose(f.payload)
+	if len(f.payload) > 125 || ce.Code != CloseNormal || ce.Reason != strings.Repeat("好", 41) {
+		t.Fatalf("close frame of %d bytes, reason %q", len(f.payload), ce.Reason)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			op, data, err := ws.ReadMessage()
+			if err != nil {
+				var ce *CloseError
+				if errors.As(err, &ce) {
+					ws.WriteClose(ce.Code, ce.Reason)
+				}
+				return
+			}
+			ws.WriteMessage(op, data)
+		}
+	}))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("echo", func(t *testing.T) {
+		ws, _, err := Dial(ctx, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+		// 超过 125 字节使用扩展长度
+		msg := strings.Repeat("x", 1000)
+		if err := ws.WriteMessage(OpText, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		if op, data, err := ws.ReadMessage(); err != nil || op != OpText || string(data) != msg {
+			t.Fatalf("ReadMessage = %v %d bytes %v", op, len(data), err)
+		}
+		ws.WriteClose(CloseNormal, "bye")
+		var ce *CloseError
+		if _, _, err := ws.ReadMessage(); !errors.As(err, &ce) || ce.Code != CloseNormal {
+			t.Fatalf("ReadMessage error = %v, want close 1000", err)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"version", http.Header{"Sec-Websocket-Version": {"8"}}, http.StatusUpgradeRequired},
+		{"key", http.Header{"Sec-Websocket-Key": {"short"}}, http.StatusBadRequest},
+		{"origin", http.Header{"Origin": {"http://evil.example.com"}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", "websocket")
+			req.Header.Set("Sec-WebSocket-Version", "13")
+			req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package websocket
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CloseCodeBase 加上 gRPC 状态码为桥接发送的关闭码，例如 4005 为 NotFound，4000 表示正常结束。
+const CloseCodeBase = 4000
+
+// CloseCode 将 rpc 的结果转为关闭码和原因，nil 为 CloseNormal。
+func CloseCode(err error) (int, string) {
+	if err == nil {
+		return CloseNormal, ""
+	}
+	st := status.Convert(err)
+	if st.Code() == codes.OK {
+		return CloseNormal, ""
+	}
+	return CloseCodeBase + int(st.Code()), st.Message()
+}
+
+// Status 将关闭码转为 gRPC 状态，4000-4016 为 CloseCode 发送的状态码，其他关闭码按含义转换。
+func Status(code int, reason string) *status.Status {
+	if code >= CloseCodeBase && code <= CloseCodeBase+int(codes.Unauthenticated) {
+		return status.New(codes.Code(code-CloseCodeBase), reason)
+	}
+	var c codes.Code
+	switch code {
+	case CloseNormal:
+		c = codes.OK
+	case CloseGoingAway, CloseNoStatus, CloseAbnormal:
+		c = codes.Unavailable
+	case CloseUnsupportedData, CloseInvalidPayload, CloseProtocolError:
+		c = codes.InvalidArgument
+	case ClosePolicyViolation:
+		c = codes.PermissionDenied
+	case CloseTooLarge:
+		c = codes.ResourceExhausted
+	case CloseInternalError:
+		c = codes.Internal
+	default:
+		c = codes.Unknown
+	}
+	return status.New(c, reason)
+}
@@ -2,8 +2,13 @@ package main
 
 import (
 	"context"
-	"flag"
+	"errors"
 	"fmt"
+	"goexamples/bootstrap"
+	"goexamples/config"
+	"goexamples/features/channelz"
+	"goexamples/features/problem"
+	"goexamples/features/recovery"
 	"goexamples/gateway/helloworld/internal/server"
 	"log"
 	"net"
@@ -13,25 +18,39 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-var (
-	rpcPort  = flag.Int("rpc-port", 50051, "rpc server port to listen on")
-	httpPort = flag.Int("http-port", 8080, "http server port to listen on")
-	mode     = flag.String("mode", "dev", "mode to run")
-)
+// Config 中的 rpc 服务端和网关分别监听两个端口。
+type Config struct {
+	RPCPort  int    `config:"rpc-port" usage:"rpc server port to listen on"`
+	HTTPPort int    `config:"http-port" usage:"http server port to listen on"`
+	Mode     string `config:"mode" usage:"mode to run, dev or prod"`
+}
+
+func (c Config) Validate() error {
+	var err error
+	if c.RPCPort == c.HTTPPort {
+		err = fmt.Errorf("rpc-port and http-port should be different, both are %d", c.RPCPort)
+	}
+	return errors.Join(config.ValidatePort("rpc-port", c.RPCPort), config.ValidatePort("http-port", c.HTTPPort), config.ValidateMode(c.Mode), err)
+}
+
+var cfg = Config{RPCPort: 50051, HTTPPort: 8080, Mode: "dev"}
 
 func main() {
-	flag.Parse()
+	config.MustLoad(&cfg)
 
 	wait := sync.WaitGroup{}
 	wait.Add(2)
 
 	go func() {
-		srv := server.NewGreeterRPCServer(*mode)
-		listener := func(lis net.Listener) {
-			log.Printf("rpc server listening at %v\n", lis.Addr())
-			log.Println("You can test it with: \n" + fmt.Sprintf(`    grpcurl -plaintext -d '{"name":"world"}' localhost:%v Greeter.SayHello`, *rpcPort))
-		}
-		if err := srv.Listen(*rpcPort, listener); err != nil {
+		srv := server.NewGreeterRPCServer(cfg.Mode,
+			bootstrap.WithServerOptions(recovery.NewRecovery(cfg.Mode).ServerOptions()...),
+			bootstrap.WithTCP(cfg.RPCPort),
+			bootstrap.OnListen(func(lis net.Listener) {
+				log.Printf("rpc server listening at %v\n", lis.Addr())
+				log.Println("You can test it with: \n" + fmt.Sprintf(`    grpcurl -plaintext -d '{"name":"world"}' localhost:%v Greeter.SayHello`, cfg.RPCPort))
+			}),
+		)
+		if err := srv.ListenAndServe(); err != nil {
 			log.Fatalf("failed to listen: %v\n", err)
 		}
 		wait.Done()
@@ -39,10 +58,13 @@ func main() {
 
 	go func() {
 		opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
-		srv := server.NewGreeterGateway(context.Background(), fmt.Sprintf("localhost:%v", *rpcPort), opts)
-		log.Printf("http server listening at http://localhost:%v\n", *httpPort)
-		log.Println("You can test it with: \n" + fmt.Sprintf(`    curl -X POST http://localhost:%v/Greeter/SayHello -H "Content-Type: application/json" -d '{"name": "world"}'`, *httpPort))
-		if err := srv.Listen(*httpPort); err != nil {
+		srv := server.NewGreeterGateway(context.Background(), fmt.Sprintf("localhost:%v", cfg.RPCPort), opts, problem.NewHandler().ServeMuxOption())
+		if err := channelz.HandleGateway(srv.RawMux(), cfg.Mode); err != nil {
+			log.Fatalf("failed to handle channelz: %v\n", err)
+		}
+		log.Printf("http server listening at http://localhost:%v\n", cfg.HTTPPort)
+		log.Println("You can test it with: \n" + fmt.Sprintf(`    curl -X POST http://localhost:%v/Greeter/SayHello -H "Content-Type: application/json" -d '{"name": "world"}'`, cfg.HTTPPort))
+		if err := srv.Listen(cfg.HTTPPort); err != nil {
 			log.Fatalf("failed to listen: %v\n", err)
 		}
 		wait.Done()
@@ -2,28 +2,36 @@ package main
 
 import (
 	"context"
-	"flag"
 	"fmt"
+	"goexamples/config"
+	"goexamples/features/problem"
 	"goexamples/gateway/helloworld/internal/server"
 	"log"
 )
 
-var (
-	port = flag.Int("port", 8080, "port to listen on")
-)
+// Config 中没有 mode，这里不启动 rpc 服务端。
+type Config struct {
+	Port int `config:"port" usage:"port to listen on"`
+}
+
+func (c Config) Validate() error {
+	return config.ValidatePort("port", c.Port)
+}
+
+var cfg = Config{Port: 8080}
 
 func main() {
-	flag.Parse()
+	config.MustLoad(&cfg)
 
 	// 通过 Server 业务实现创建 http 服务器。
 	// 此时未创建 grpc 客户端，该服务器仅负责将 JSON 数据转发给业务方法，对外暴露业务接口，中间不涉及 protobuf 的编解码。
 	// 由于未初始化 gRPC 服务实例，外部客户端无法建立 gRPC 协议连接进行远程调用。
-	gsrv := server.NewGreeterGatewayFromServer(context.Background(), &server.GreeterRPCServer{})
-	log.Printf("http server listening at http://localhost:%v\n", *port)
+	gsrv := server.NewGreeterGatewayFromServer(context.Background(), &server.GreeterRPCServer{}, problem.NewHandler().ServeMuxOption())
+	log.Printf("http server listening at http://localhost:%v\n", cfg.Port)
 	log.Println("rpc server is not started")
 
-	log.Println("You can test it with: \n" + fmt.Sprintf(`    curl -X POST http://localhost:%v/Greeter/SayHello -H "Content-Type: application/json" -d '{"name": "world"}'`, *port))
-	if err := gsrv.Listen(*port); err != nil {
+	log.Println("You can test it with: \n" + fmt.Sprintf(`    curl -X POST http://localhost:%v/Greeter/SayHello -H "Content-Type: application/json" -d '{"name": "world"}'`, cfg.Port))
+	if err := gsrv.Listen(cfg.Port); err != nil {
 		log.Fatalf("failed to listen: %v\n", err)
 	}
 }
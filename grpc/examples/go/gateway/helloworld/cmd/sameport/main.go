@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
-	"flag"
 	"fmt"
+	"goexamples/bootstrap"
+	"goexamples/config"
+	"goexamples/features/channelz"
+	"goexamples/features/problem"
+	"goexamples/features/recovery"
 	"goexamples/gateway/helloworld/internal/server"
 	"log"
 	"net/http"
@@ -12,22 +16,26 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-var (
-	port = flag.Int("port", 8080, "port to listen on")
-	mode = flag.String("mode", "dev", "mode to run")
-)
+var cfg = config.Server{Port: 8080, Mode: "dev"}
 
 func main() {
-	flag.Parse()
+	config.MustLoad(&cfg)
 
 	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
-	gsrv := server.NewGreeterGateway(context.Background(), fmt.Sprintf("localhost:%v", *port), opts)
-	rsrv := server.NewGreeterRPCServer(*mode)
+	gsrv := server.NewGreeterGateway(context.Background(), fmt.Sprintf("localhost:%v", cfg.Port), opts, problem.NewHandler().ServeMuxOption())
+	rsrv := server.NewGreeterRPCServer(cfg.Mode, bootstrap.WithServerOptions(recovery.NewRecovery(cfg.Mode).ServerOptions()...))
+	// gRPC 和 http 共用同一个端口，通过 channelz 页面查看网关到 gRPC 服务端的连接
+	if err := channelz.HandleGateway(gsrv.RawMux(), cfg.Mode); err != nil {
+		log.Fatalf("failed to handle channelz: %v\n", err)
+	}
 
-	log.Printf("http server and rpc server will run on the same port, server listening at http://localhost:%v\n", *port)
-	log.Println("You can test it with: \n" + fmt.Sprintf(`    grpcurl -plaintext -d '{"name":"world"}' localhost:%v Greeter.SayHello`, *port))
-	log.Println("You can test it with: \n" + fmt.Sprintf(`    curl -X POST http://localhost:%v/Greeter/SayHello -H "Content-Type: application/json" -d '{"name": "world"}'`, *port))
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", *port), server.MustServerMux(rsrv, gsrv)); err != nil {
+	log.Printf("http server and rpc server will run on the same port, server listening at http://localhost:%v\n", cfg.Port)
+	log.Println("You can test it with: \n" + fmt.Sprintf(`    grpcurl -plaintext -d '{"name":"world"}' localhost:%v Greeter.SayHello`, cfg.Port))
+	log.Println("You can test it with: \n" + fmt.Sprintf(`    curl -X POST http://localhost:%v/Greeter/SayHello -H "Content-Type: application/json" -d '{"name": "world"}'`, cfg.Port))
+	if cfg.Mode == "dev" {
+		log.Printf("channelz page at http://localhost:%v%s\n", cfg.Port, channelz.DefaultPath)
+	}
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.Port), server.MustServerMux(rsrv, gsrv)); err != nil {
 		log.Fatalf("failed to listen: %v\n", err)
 	}
 }
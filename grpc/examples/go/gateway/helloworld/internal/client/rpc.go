@@ -2,6 +2,8 @@ package client
 
 import (
 	"context"
+	"goexamples/features/healthcheck"
+	"goexamples/features/keepalive"
 	"goexamples/gateway/helloworld/proto"
 
 	"google.golang.org/grpc"
@@ -25,9 +27,14 @@ func (cli *GreeterRPCClient) SayHello(ctx context.Context, in *proto.HelloReques
 }
 
 func NewGreeterRPCClient(addr string, opts ...grpc.DialOption) *GreeterRPCClient {
+	opts = append(append(keepalive.DefaultClient.Options(), healthcheck.WithHealthCheck(proto.Greeter_ServiceDesc.ServiceName)), opts...)
 	conn, err := grpc.NewClient(addr, opts...)
 	if err != nil {
 		panic(err)
 	}
+	return NewGreeterRPCClientFromConn(conn)
+}
+
+func NewGreeterRPCClientFromConn(conn *grpc.ClientConn) *GreeterRPCClient {
 	return &GreeterRPCClient{conn: conn, client: proto.NewGreeterClient(conn)}
 }
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"goexamples/bootstrap"
+	"goexamples/gateway/helloworld/proto"
+	"goexamples/harness"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+func TestGreeterSayHello(t *testing.T) {
+	c := harness.Client(harness.New(t), func(opts ...grpc.ServerOption) harness.Server {
+		return NewGreeterRPCServer("prod", bootstrap.WithServerOptions(opts...)).RawServer()
+	}, proto.NewGreeterClient)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "world", want: "hello world"},
+		{name: "", want: "hello "},
+		{name: "世界", want: "hello 世界"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := c.SayHello(context.Background(), &proto.HelloRequest{Name: tt.name})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.GetMessage() != tt.want {
+				t.Fatalf("want %q, got %q", tt.want, r.GetMessage())
+			}
+		})
+	}
+}
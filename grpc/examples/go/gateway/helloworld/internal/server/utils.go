@@ -1,6 +1,7 @@
 package server
 
 import (
+	"goexamples/features/grpcweb"
 	"net/http"
 	"strings"
 
@@ -12,13 +13,17 @@ func EnableH2C(handler http.Handler) http.Handler {
 	return h2c.NewHandler(handler, &http2.Server{})
 }
 
+// MustServerMux 将 gRPC 请求交给 rpcServer，浏览器的 gRPC-Web 请求转为 gRPC 请求后同样交给 rpcServer，其他请求交给 httpServer。
 func MustServerMux(rpcServer, httpServer http.Handler) http.Handler {
 	if rpcServer == nil || httpServer == nil {
 		panic("rpcServer or httpServer is nil")
 	}
+	web := grpcweb.NewHandler(rpcServer)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
 			rpcServer.ServeHTTP(w, r) // 处理 gRPC 请求
+		} else if grpcweb.IsGRPCWeb(r) {
+			web.ServeHTTP(w, r) // 处理 gRPC-Web 请求
 		} else {
 			httpServer.ServeHTTP(w, r)
 		}
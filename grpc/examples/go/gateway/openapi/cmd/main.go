@@ -2,54 +2,184 @@ package main
 
 import (
 	"context"
-	"flag"
+	"errors"
 	"fmt"
+	"goexamples/bootstrap"
+	"goexamples/config"
+	"goexamples/features/breaker"
+	"goexamples/features/channelz"
+	"goexamples/features/cors"
+	"goexamples/features/deadline"
+	"goexamples/features/fault"
+	"goexamples/features/grpcweb"
+	"goexamples/features/healthcheck"
+	"goexamples/features/problem"
+	_ "goexamples/features/proto/message"
+	"goexamples/features/recovery"
+	"goexamples/features/websocket"
 	"goexamples/gateway/openapi/internal/client"
 	"goexamples/gateway/openapi/internal/model"
 	"goexamples/gateway/openapi/internal/server"
+	_ "goexamples/poem-stream/proto"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-var (
-	port = flag.Int("port", 8080, "port to listen on")
-	mode = flag.String("mode", "dev", "mode to run")
-)
+// Config 中的数据路径默认相对 gateway/openapi 目录。
+type Config struct {
+	config.Server
+	Users string `config:"users,path" usage:"users json file"`
+	Docs  string `config:"docs,path" usage:"directory of the openapi docs"`
+	// 错误响应为 application/problem+json，这里可以覆盖 gRPC 状态码对应的 HTTP 状态码
+	Statuses problem.Statuses `config:"statuses" usage:"grpc code to http status of error responses, e.g. FailedPrecondition=409, can be repeated"`
+	// 浏览器通过 /ws/ 下的 WebSocket 调用这两个服务的流方法，为空时不开放
+	MessageAddr string `config:"message_addr" usage:"address of the message server exposed over websocket, empty to disable"`
+	PoemAddr    string `config:"poem_addr" usage:"address of the poem server exposed over websocket, empty to disable"`
+	// 默认只允许同源访问，其他前端的来源需要在这里设置
+	CORSOrigins     []string      `config:"cors_origins" usage:"allowed origins of cross-origin requests: https://app.example.com, https://*.example.com or a regexp starting with ^, can be repeated"`
+	CORSMetadata    []string      `config:"cors_metadata" usage:"grpc metadata keys browsers may send through the gateway (Grpc-Metadata-<key>) or grpc-web (<key>), can be repeated"`
+	CORSCredentials bool          `config:"cors_credentials" usage:"allow cross-origin requests with credentials, cannot be used with origin *"`
+	CORSMaxAge      time.Duration `config:"cors_max_age" usage:"how long browsers cache the preflight results"`
+	// 故障管理接口没有认证，开启后任何能访问网关的人都可以注入延迟和错误，只在 dev 模式下生效
+	FaultAdmin bool `config:"fault_admin" usage:"serve the fault rules admin endpoint on the gateway in dev mode"`
+}
+
+func (c Config) Validate() error {
+	return errors.Join(c.Server.Validate(), config.ValidateFile("users", c.Users), config.ValidateFile("docs", c.Docs), cors.ValidateOrigins(c.CORSOrigins, c.CORSCredentials))
+}
+
+var cfg = Config{
+	Server:     config.Server{Port: 8080, Mode: "dev"},
+	Users:      filepath.Join("testdata", "users.json"),
+	Docs:       filepath.Join("third_party", "openapi"),
+	CORSMaxAge: cors.DefaultMaxAge,
+}
 
 func main() {
-	flag.Parse()
+	config.MustLoad(&cfg)
 
-	root, err := os.Getwd()
-	if err != nil {
-		log.Fatalf("can't get current directory: %v\n", err)
+	// 服务端：客户端未设置截止时间时默认 5 秒，最长不超过 30 秒；流式方法不补充，SSE 的流保持到客户端离开
+	sd := deadline.NewDeadline(
+		deadline.WithDefault(5*time.Second),
+		deadline.WithMax(30*time.Second),
+		deadline.WithStreamDefault(0),
+	)
+	// 故障注入在截止时间之后执行，注入的延迟受截止时间限制；开启 fault_admin 后规则通过网关的 /debug/faults 在运行时设置
+	injector := fault.NewInjector(cfg.Mode)
+	rsrv := server.NewUserRPCServer(cfg.Mode,
+		bootstrap.WithServerOptions(recovery.NewRecovery(cfg.Mode).ServerOptions()...),
+		bootstrap.WithUnaryInterceptors(sd.UnaryServerInterceptor(), injector.UnaryServerInterceptor()),
+		bootstrap.WithStreamInterceptors(sd.StreamServerInterceptor(), injector.StreamServerInterceptor()),
+	)
+	rsrv.SetModel(model.NewUserModel().MustLoad(cfg.Users))
+
+	// 网关：http 请求未携带 Grpc-Timeout 头时，为转发的 rpc 调用设置 3 秒超时；
+	// 请求 SSE、NDJSON 格式时不补充（见 server.Streaming），否则流在第一次心跳之前就会被取消
+	cd := deadline.NewDeadline(deadline.WithDefault(3 * time.Second))
+	// 网关：后端连续失败 5 次或最近 20 次调用中一半失败后熔断 10 秒，期间直接返回 503，不再等待超时
+	cb := breaker.NewBreaker(
+		breaker.WithKey(breaker.ByTarget),
+		breaker.WithFailureRate(0.5, 20, 10),
+		breaker.WithOnStateChange(func(key string, from, to breaker.State) {
+			log.Printf("circuit breaker for %s: %v -> %v\n", key, from, to)
+		}),
+	)
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(cb.UnaryClientInterceptor(), cd.UnaryClientInterceptor(), client.PostAutoFillFieldMask),
+		grpc.WithChainStreamInterceptor(cb.StreamClientInterceptor(), cd.StreamClientInterceptor()),
+	}
+	gsrv := server.NewUserGateway(context.Background(), fmt.Sprintf("localhost:%v", cfg.Port), opts,
+		runtime.WithMiddlewares(server.BodyBufferMiddleware),
+		problem.NewHandler(problem.WithStatuses(cfg.Statuses)).ServeMuxOption(),
+	)
+	if err := channelz.HandleGateway(gsrv.RawMux(), cfg.Mode); err != nil {
+		log.Fatalf("failed to handle channelz: %v\n", err)
+	}
+	if cfg.FaultAdmin {
+		if err := injector.HandleGateway(gsrv.RawMux()); err != nil {
+			log.Fatalf("failed to handle fault admin: %v\n", err)
+		}
 	}
 
-	rsrv := server.NewUserRPCServer(*mode)
-	rsrv.SetModel(model.NewUserModel().MustLoad(filepath.Join(root, "testdata", "users.json")))
+	fsrv := server.StaticServer(cfg.Docs)
 
-	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithUnaryInterceptor(client.PostAutoFillFieldMask)}
-	gsrv := server.NewUserGateway(context.Background(), fmt.Sprintf("localhost:%v", *port), opts, runtime.WithMiddlewares(server.BodyBufferMiddleware))
+	// 跨域：预检请求在进入 ServerMux 之前回复，不会到达网关和 gRPC 服务端；gRPC-Web 和 WebSocket 使用相同的来源规则
+	corsOpts := []cors.Option{cors.WithOrigins(cfg.CORSOrigins...), cors.WithMetadata(cfg.CORSMetadata...), cors.WithMaxAge(cfg.CORSMaxAge)}
+	if cfg.CORSCredentials {
+		corsOpts = append(corsOpts, cors.WithCredentials())
+	}
+	cs := cors.NewCORS(corsOpts...)
 
-	fsrv := server.StaticServer(filepath.Join(root, "third_party", "openapi"))
+	wsOpts := []websocket.Option{websocket.WithCheckOrigin(func(r *http.Request) bool {
+		return websocket.SameOrigin(r) || cs.AllowOrigin(r.Header.Get("Origin"))
+	})}
+	for _, backend := range []struct {
+		addr    string
+		methods []string
+	}{
+		{cfg.MessageAddr, []string{"message.MessageService/BidirectionalStream", "message.MessageService/ServerStream"}},
+		{cfg.PoemAddr, []string{"PoemService/BatchUploadPoemStream", "PoemService/GetPoemStream"}},
+	} {
+		if backend.addr == "" {
+			continue
+		}
+		conn, err := grpc.NewClient(backend.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			log.Fatalf("failed to connect to %s: %v\n", backend.addr, err)
+		}
+		defer conn.Close()
+		wsOpts = append(wsOpts, websocket.WithMethod(conn, backend.methods...))
+	}
+	wsrv := websocket.NewBridge(wsOpts...)
 
 	mux := server.NewServerMux(
 		rsrv, func(r *http.Request) bool {
 			return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
 		},
+		grpcweb.NewHandler(rsrv, grpcweb.WithOriginFunc(cs.AllowOrigin)), grpcweb.IsGRPCWeb,
 		gsrv, func(r *http.Request) bool {
-			return strings.HasPrefix(r.URL.Path, "/api")
+			return strings.HasPrefix(r.URL.Path, "/api") || channelz.IsAdmin(r) || fault.IsAdmin(r)
 		},
+		wsrv, websocket.IsUpgrade,
 		fsrv, nil,
 	)
-	log.Printf("http server and rpc server will run on the same port, server listening at http://localhost:%v, you can visit it to get api docs\n", *port)
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", *port), server.EnableH2C(mux)); err != nil {
+	mux.HandleHealth(rsrv.Health())
+
+	hsrv := &http.Server{Addr: fmt.Sprintf(":%d", cfg.Port), Handler: server.EnableH2C(cs.Handler(mux))}
+	go func() {
+		// 收到退出信号后先将健康状态设置为 NOT_SERVING，再关闭服务
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		rsrv.Health().Shutdown()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		hsrv.Shutdown(ctx)
+	}()
+
+	log.Printf("http server and rpc server will run on the same port, server listening at http://localhost:%v, you can visit it to get api docs\n", cfg.Port)
+	log.Printf("health probes at http://localhost:%v%s and http://localhost:%v%s\n", cfg.Port, healthcheck.LivePath, cfg.Port, healthcheck.ReadyPath)
+	if cfg.Mode == "dev" {
+		log.Printf("channelz page at http://localhost:%v%s\n", cfg.Port, channelz.DefaultPath)
+	}
+	if injector.Enabled() && cfg.FaultAdmin {
+		log.Printf("fault rules admin at http://localhost:%v%s\n", cfg.Port, fault.DefaultPath)
+	}
+	for _, m := range wsrv.Methods() {
+		log.Printf("websocket bridge at ws://localhost:%v%s%s\n", cfg.Port, websocket.DefaultPath, m)
+	}
+	if err := hsrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("failed to listen: %v\n", err)
 	}
 }
@@ -1,7 +1,11 @@
 package client
 
 import (
+	"context"
+	"goexamples/features/healthcheck"
+	"goexamples/features/keepalive"
 	"goexamples/gateway/openapi/proto"
+	"goexamples/streams"
 
 	"google.golang.org/grpc"
 )
@@ -31,14 +35,22 @@ func (cli *UserRPCClient) Close() error {
 // func (cli *UserRPCClient) GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*GetUserResponse, error) {
 // }
 
-// func (cli *UserRPCClient) ListUsers(ctx context.Context, in *ListUsersRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ListUsersResponse], error) {
-// }
+func (cli *UserRPCClient) ListUsers(ctx context.Context, opts ...grpc.CallOption) ([]*proto.User, error) {
+	sout, err := cli.client.ListUsers(ctx, &proto.ListUsersRequest{}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return streams.Fold(ctx, sout, []*proto.User{}, func(users []*proto.User, r *proto.ListUsersResponse) []*proto.User {
+		return append(users, r.GetUser())
+	})
+}
 
 func NewUserRPCClientFromConn(conn *grpc.ClientConn) *UserRPCClient {
 	return &UserRPCClient{conn: conn, client: proto.NewUserServiceClient(conn)}
 }
 
 func NewUserRPCClient(addr string, opts ...grpc.DialOption) *UserRPCClient {
+	opts = append(append(keepalive.DefaultClient.Options(), healthcheck.WithHealthCheck(proto.UserService_ServiceDesc.ServiceName)), opts...)
 	conn, err := grpc.NewClient(addr, opts...)
 	if err != nil {
 		panic(err)
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"goexamples/bootstrap"
+	"goexamples/features/deadline"
+	"goexamples/gateway/openapi/internal/model"
+	"goexamples/gateway/openapi/proto"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// 测试截止时间经过网关转发后传递到 grpc 服务端：
+// http 请求头 Grpc-Timeout -> 网关上下文 -> 网关 grpc 客户端拦截器 -> grpc-timeout -> 服务端拦截器 -> 业务方法
+func TestDeadlinePropagationAcrossGateway(t *testing.T) {
+	seen := make(chan time.Duration, 1)
+	record := func(ctx context.Context) {
+		if d, ok := ctx.Deadline(); ok {
+			seen <- time.Until(d)
+		} else {
+			seen <- 0
+		}
+	}
+
+	sd := deadline.NewDeadline(deadline.WithDefault(5*time.Second), deadline.WithMax(8*time.Second))
+	rsrv := NewUserRPCServer(
+		"prod",
+		bootstrap.WithUnaryInterceptors(sd.UnaryServerInterceptor(), func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			record(ctx)
+			return handler(ctx, req)
+		}),
+		bootstrap.WithStreamInterceptors(sd.StreamServerInterceptor(), func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			record(ss.Context())
+			return handler(srv, ss)
+		}),
+	)
+	rsrv.SetModel(model.NewUserModel().MustLoad("../../testdata/users.json"))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go rsrv.RawServer().Serve(lis)
+	defer rsrv.RawServer().Stop()
+
+	newGateway := func(timeout time.Duration) *UserGateway {
+		cd := deadline.NewDeadline(deadline.WithDefault(timeout))
+		opts := []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithUnaryInterceptor(cd.UnaryClientInterceptor()),
+			grpc.WithStreamInterceptor(cd.StreamClientInterceptor()),
+		}
+		return NewUserGateway(context.Background(), lis.Addr().String(), opts)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		header         string // Grpc-Timeout 请求头
+		accept         string
+		gatewayTimeout time.Duration // 网关 grpc 客户端的默认超时时间
+		want           time.Duration
+	}{
+		{name: "server default", path: "/api/v1/users/1", want: 5 * time.Second},
+		{name: "gateway default", path: "/api/v1/users/1", gatewayTimeout: 2 * time.Second, want: 2 * time.Second},
+		{name: "http header", path: "/api/v1/users/1", header: "1S", gatewayTimeout: 2 * time.Second, want: time.Second},
+		{name: "http header capped", path: "/api/v1/users/1", header: "60S", want: 8 * time.Second},
+		{name: "stream http header", path: "/api/v1/users", header: "1500m", want: 1500 * time.Millisecond},
+		{name: "stream gateway default", path: "/api/v1/users", gatewayTimeout: 3 * time.Second, want: 3 * time.Second},
+		// SSE 跳过网关的默认超时时间，由服务端补充
+		{name: "sse skips gateway default", path: "/api/v1/users", accept: MIMEEventStream, gatewayTimeout: 3 * time.Second, want: 5 * time.Second},
+		{name: "sse http header", path: "/api/v1/users", accept: MIMEEventStream, header: "1500m", gatewayTimeout: 3 * time.Second, want: 1500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Grpc-Timeout", tt.header)
+			}
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			newGateway(tt.gatewayTimeout).ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("want status 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			got := <-seen
+			if got > tt.want || got < tt.want-500*time.Millisecond {
+				t.Fatalf("want server remaining about %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+type sendCounter struct {
+	grpc.ServerStreamingServer[proto.ListUsersResponse]
+	ctx  context.Context
+	sent int
+}
+
+func (s *sendCounter) Context() context.Context { return s.ctx }
+func (s *sendCounter) Send(*proto.ListUsersResponse) error {
+	s.sent++
+	return nil
+}
+
+func TestListUsersStopsOnCancel(t *testing.T) {
+	rsrv := NewUserRPCServer("prod")
+	rsrv.SetModel(model.NewUserModel().MustLoad("../../testdata/users.json"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sout := &sendCounter{ctx: ctx}
+	if err := rsrv.ListUsers(&proto.ListUsersRequest{}, sout); status.Code(err) != codes.Canceled {
+		t.Fatalf("want Canceled, got %v", err)
+	}
+	if sout.sent != 0 {
+		t.Fatalf("want nothing sent after cancel, got %d", sout.sent)
+	}
+}
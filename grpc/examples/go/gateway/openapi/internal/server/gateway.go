@@ -32,9 +32,14 @@ func (srv *UserGateway) Listen(port int) error {
 	return http.ListenAndServe(fmt.Sprintf(":%d", port), srv.mux)
 }
 
+// newServeMux 创建网关的 ServeMux，服务端流方法可以按 Accept 返回 SSE 或 NDJSON，见 Streaming。
+func newServeMux(opts []runtime.ServeMuxOption) *runtime.ServeMux {
+	return runtime.NewServeMux(append(NewStreaming().ServeMuxOptions(), opts...)...)
+}
+
 // 创建一个反向代理服务器。用于将 RESTful http 请求转为 grpc 请求。
 func NewUserGateway(ctx context.Context, addr string, clientOpts []grpc.DialOption, opts ...runtime.ServeMuxOption) *UserGateway {
-	mux := runtime.NewServeMux(opts...)
+	mux := newServeMux(opts)
 	if err := proto.RegisterUserServiceHandlerFromEndpoint(ctx, mux, addr, clientOpts); err != nil {
 		panic(err)
 	}
@@ -42,7 +47,7 @@ func NewUserGateway(ctx context.Context, addr string, clientOpts []grpc.DialOpti
 }
 
 func NewUserGatewayFromConn(ctx context.Context, conn *grpc.ClientConn, opts ...runtime.ServeMuxOption) *UserGateway {
-	mux := runtime.NewServeMux(opts...)
+	mux := newServeMux(opts)
 	if err := proto.RegisterUserServiceHandler(ctx, mux, conn); err != nil {
 		panic(err)
 	}
@@ -50,7 +55,7 @@ func NewUserGatewayFromConn(ctx context.Context, conn *grpc.ClientConn, opts ...
 }
 
 func NewUserGatewayFromClient(ctx context.Context, client proto.UserServiceClient, opts ...runtime.ServeMuxOption) *UserGateway {
-	mux := runtime.NewServeMux(opts...)
+	mux := newServeMux(opts)
 	if err := proto.RegisterUserServiceHandlerClient(ctx, mux, client); err != nil {
 		panic(err)
 	}
@@ -58,7 +63,7 @@ func NewUserGatewayFromClient(ctx context.Context, client proto.UserServiceClien
 }
 
 func NewUserGatewayFromServer(ctx context.Context, server proto.UserServiceServer, opts ...runtime.ServeMuxOption) *UserGateway {
-	mux := runtime.NewServeMux(opts...)
+	mux := newServeMux(opts)
 	if err := proto.RegisterUserServiceHandlerServer(ctx, mux, server); err != nil {
 		panic(err)
 	}
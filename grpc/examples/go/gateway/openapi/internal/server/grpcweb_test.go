@@ -0,0 +1,253 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"goexamples/bootstrap"
+	"goexamples/features/cors"
+	"goexamples/features/grpcweb"
+	"goexamples/gateway/openapi/internal/model"
+	"goexamples/gateway/openapi/proto"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// webClient 是手写的 gRPC-Web 客户端，按 PROTOCOL-WEB.md 编码请求、解析响应中的消息帧和 trailer 帧。
+type webClient struct {
+	url  string
+	text bool
+}
+
+func (c webClient) call(method string, in protobuf.Message) ([][]byte, *status.Status, error) {
+	msg, err := protobuf.Marshal(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	body := append([]byte{0}, binary.BigEndian.AppendUint32(nil, uint32(len(msg)))...)
+	body = append(body, msg...)
+	contentType := grpcweb.ContentType + "+proto"
+	if c.text {
+		body = []byte(base64.StdEncoding.EncodeToString(body))
+		contentType = grpcweb.ContentTypeText + "+proto"
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url+method, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Grpc-Web", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != contentType {
+		return nil, nil, fmt.Errorf("unexpected response %s %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.text {
+		// 服务端每次刷新单独编码，按 4 个字符一组解码
+		var decoded []byte
+		for i := 0; i+4 <= len(data); i += 4 {
+			b, err := base64.StdEncoding.DecodeString(string(data[i : i+4]))
+			if err != nil {
+				return nil, nil, err
+			}
+			decoded = append(decoded, b...)
+		}
+		data = decoded
+	}
+
+	var msgs [][]byte
+	for len(data) >= 5 {
+		flag, n := data[0], binary.BigEndian.Uint32(data[1:5])
+		frame := data[5 : 5+n]
+		data = data[5+n:]
+		if flag&0x80 == 0 {
+			msgs = append(msgs, frame)
+			continue
+		}
+		st, err := parseTrailer(string(frame))
+		return msgs, st, err
+	}
+	return nil, nil, fmt.Errorf("missing trailer frame")
+}
+
+func parseTrailer(trailer string) (*status.Status, error) {
+	md := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(trailer), "\r\n") {
+		k, v, _ := strings.Cut(line, ": ")
+		md[k] = v
+	}
+	code, err := strconv.Atoi(md["grpc-status"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid trailer %q", trailer)
+	}
+	if bin, ok := md["grpc-status-details-bin"]; ok {
+		b, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(bin, "="))
+		if err != nil {
+			return nil, err
+		}
+		p := &spb.Status{}
+		if err := protobuf.Unmarshal(b, p); err != nil {
+			return nil, err
+		}
+		return status.FromProto(p), nil
+	}
+	message, _ := url.PathUnescape(md["grpc-message"])
+	return status.New(codes.Code(code), message), nil
+}
+
+func startWebSrv(t *testing.T) string {
+	t.Helper()
+	rsrv := NewUserRPCServer("prod")
+	rsrv.SetModel(model.NewUserModel().MustLoad("../../testdata/users.json"))
+	mux := NewServerMux(
+		grpcweb.NewHandler(rsrv), grpcweb.IsGRPCWeb,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("%s %s should be handled by grpc-web", r.Method, r.URL)
+		}), nil,
+	)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestGRPCWeb(t *testing.T) {
+	addr := startWebSrv(t)
+
+	for _, text := range []bool{false, true} {
+		c := webClient{url: addr, text: text}
+		t.Run(fmt.Sprintf("text=%v", text), func(t *testing.T) {
+			msgs, st, err := c.call(proto.UserService_GetUser_FullMethodName, &proto.GetUserRequest{Id: 1})
+			if err != nil || st.Code() != codes.OK || len(msgs) != 1 {
+				t.Fatalf("GetUser = %d messages, %v, %v", len(msgs), st, err)
+			}
+			resp := &proto.GetUserResponse{}
+			if err := protobuf.Unmarshal(msgs[0], resp); err != nil || resp.GetUser().GetName() != "zhangsan" {
+				t.Fatalf("GetUser = %v, %v", resp, err)
+			}
+
+			// 服务端流：每个用户一帧
+			msgs, st, err = c.call(proto.UserService_ListUsers_FullMethodName, &proto.ListUsersRequest{})
+			if err != nil || st.Code() != codes.OK || len(msgs) != 3 {
+				t.Fatalf("ListUsers = %d messages, %v, %v", len(msgs), st, err)
+			}
+
+			// 只有 trailer 的错误响应，错误详情在 grpc-status-details-bin 中
+			msgs, st, err = c.call(proto.UserService_GetUser_FullMethodName, &proto.GetUserRequest{Id: 100})
+			if err != nil || st.Code() != codes.NotFound || len(msgs) != 0 {
+				t.Fatalf("GetUser = %d messages, %v, %v", len(msgs), st, err)
+			}
+			if d := st.Details(); len(d) != 1 || d[0].(*errdetails.ResourceInfo).GetResourceName() != "users/100" {
+				t.Fatalf("details = %v", d)
+			}
+		})
+	}
+}
+
+func TestGRPCWebCORS(t *testing.T) {
+	addr := startWebSrv(t)
+
+	req, _ := http.NewRequest(http.MethodOptions, addr+proto.UserService_GetUser_FullMethodName, nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web,x-user-agent")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "http://localhost:3000" {
+		t.Fatalf("preflight = %s %v", resp.Status, resp.Header)
+	}
+
+	msg, _ := protobuf.Marshal(&proto.GetUserRequest{Id: 1})
+	body := append(binary.BigEndian.AppendUint32([]byte{0}, uint32(len(msg))), msg...)
+	req, _ = http.NewRequest(http.MethodPost, addr+proto.UserService_GetUser_FullMethodName, bytes.NewReader(body))
+	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("Content-Type", grpcweb.ContentType)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Access-Control-Allow-Origin") != "http://localhost:3000" || !strings.Contains(resp.Header.Get("Access-Control-Expose-Headers"), "grpc-status") {
+		t.Fatalf("response headers = %v", resp.Header)
+	}
+}
+
+// 与 cmd/main.go 相同，cors.Handler 包装整个 ServerMux，gRPC-Web 的预检请求由 cors 回复，元数据请求头通过 WithMetadata 允许
+func TestGRPCWebBehindCORS(t *testing.T) {
+	tenants := make(chan []string, 1)
+	rsrv := NewUserRPCServer("prod", bootstrap.WithUnaryInterceptors(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		tenants <- md.Get("tenant")
+		return handler(ctx, req)
+	}))
+	rsrv.SetModel(model.NewUserModel().MustLoad("../../testdata/users.json"))
+	cs := cors.NewCORS(cors.WithOrigins("http://localhost:3000"), cors.WithMetadata("tenant"))
+	mux := NewServerMux(grpcweb.NewHandler(rsrv, grpcweb.WithOriginFunc(cs.AllowOrigin)), grpcweb.IsGRPCWeb)
+	srv := httptest.NewServer(cs.Handler(mux))
+	defer srv.Close()
+
+	preflight := func(headers string) *http.Response {
+		req, _ := http.NewRequest(http.MethodOptions, srv.URL+proto.UserService_GetUser_FullMethodName, nil)
+		req.Header.Set("Origin", "http://localhost:3000")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", headers)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	if resp := preflight("content-type,grpc-timeout,tenant,x-grpc-web,x-user-agent"); resp.StatusCode != http.StatusNoContent ||
+		!strings.Contains(resp.Header.Get("Access-Control-Allow-Headers"), "tenant") {
+		t.Fatalf("preflight = %s %v", resp.Status, resp.Header)
+	}
+	if resp := preflight("content-type,x-grpc-web,x-other"); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("preflight with unknown header = %s, want 403", resp.Status)
+	}
+
+	msg, _ := protobuf.Marshal(&proto.GetUserRequest{Id: 1})
+	body := append(binary.BigEndian.AppendUint32([]byte{0}, uint32(len(msg))), msg...)
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+proto.UserService_GetUser_FullMethodName, bytes.NewReader(body))
+	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("Content-Type", grpcweb.ContentType)
+	req.Header.Set("X-Grpc-Web", "1")
+	req.Header.Set("Tenant", "acme")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Access-Control-Allow-Origin") != "http://localhost:3000" ||
+		!strings.Contains(resp.Header.Get("Access-Control-Expose-Headers"), "grpc-status") {
+		t.Fatalf("response = %s %v", resp.Status, resp.Header)
+	}
+	if got := <-tenants; len(got) != 1 || got[0] != "acme" {
+		t.Fatalf("tenant metadata = %v, want [acme]", got)
+	}
+}
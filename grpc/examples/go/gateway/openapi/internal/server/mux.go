@@ -2,6 +2,7 @@ package server
 
 import (
 	"fmt"
+	"goexamples/features/healthcheck"
 	"net/http"
 
 	"golang.org/x/net/http2"
@@ -26,6 +27,14 @@ func (sm *ServerMux) Add(server http.Handler, condition ServerCondition) {
 	sm.pairs = append(sm.pairs, &scPair{server: server, condition: condition})
 }
 
+// HandleHealth 添加 /healthz、/readyz 探针，探针优先于其他服务匹配。
+func (sm *ServerMux) HandleHealth(health *healthcheck.Health) {
+	if health == nil {
+		return
+	}
+	sm.pairs = append([]*scPair{{server: health, condition: healthcheck.IsProbe}}, sm.pairs...)
+}
+
 func (sm *ServerMux) Remove(server http.Handler) {
 	if server == nil {
 		return
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"goexamples/features/problem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 找不到用户返回 404，校验失败返回 400 并带有字段错误，都是 application/problem+json
+func TestProblemDetails(t *testing.T) {
+	gsrv := NewUserGatewayFromClient(context.Background(), startUserSrv(t), problem.NewHandler().ServeMuxOption())
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		check  func(t *testing.T, p map[string]any)
+	}{
+		{
+			name: "get missing user", method: http.MethodGet, path: "/api/v1/users/100", status: http.StatusNotFound,
+			check: func(t *testing.T, p map[string]any) {
+				resource, _ := p["resource"].(map[string]any)
+				if p["code"] != "NotFound" || resource["name"] != "users/100" || p["instance"] != "/api/v1/users/100" {
+					t.Fatalf("problem = %v", p)
+				}
+			},
+		},
+		{
+			name: "delete missing user", method: http.MethodDelete, path: "/api/v1/users/100", status: http.StatusNotFound,
+			check: func(t *testing.T, p map[string]any) {
+				if p["detail"] != "user 100 not found" {
+					t.Fatalf("problem = %v", p)
+				}
+			},
+		},
+		{
+			name: "invalid email", method: http.MethodPost, path: "/api/v1/users", body: `{"name": "zhaoliu", "email": "zhaoliu"}`, status: http.StatusBadRequest,
+			check: func(t *testing.T, p map[string]any) {
+				params, _ := p["invalid-params"].([]any)
+				if len(params) != 1 || params[0].(map[string]any)["name"] != "user.email" {
+					t.Fatalf("problem = %v", p)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			gsrv.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if w.Code != tt.status || w.Header().Get("Content-Type") != problem.ContentType {
+				t.Fatalf("status = %d, Content-Type = %q, want %d", w.Code, w.Header().Get("Content-Type"), tt.status)
+			}
+			var p map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			if p["status"] != float64(tt.status) || p["type"] != problem.DefaultType {
+				t.Fatalf("problem = %v", p)
+			}
+			tt.check(t, p)
+		})
+	}
+}
@@ -3,50 +3,41 @@ package server
 import (
 	"context"
 	"fmt"
+	"goexamples/bootstrap"
 	"goexamples/gateway/openapi/internal/model"
 	"goexamples/gateway/openapi/proto"
 	"goexamples/utils"
 	"log"
-	"net"
-	"net/http"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 )
 
 type UserRPCServer struct {
 	proto.UnimplementedUserServiceServer
-	server *grpc.Server
-	model  *model.UserModel
+	*bootstrap.Server
+	model *model.UserModel
 }
 
+// SetModel 设置数据模型，设置之前服务的健康状态为 NOT_SERVING。
 func (srv *UserRPCServer) SetModel(model *model.UserModel) {
 	srv.model = model
+	srv.Health().Set(proto.UserService_ServiceDesc.ServiceName, model != nil)
 }
 
-func (srv *UserRPCServer) RawServer() *grpc.Server {
-	return srv.server
-}
-
-func (srv *UserRPCServer) GetServiceInfo() map[string]grpc.ServiceInfo {
-	return srv.server.GetServiceInfo()
-}
-
-func (srv *UserRPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	srv.server.ServeHTTP(w, r)
-}
-
-func (srv *UserRPCServer) Listen(port int, listener func(net.Listener)) error {
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		return err
+// notFound 返回 NotFound 错误，并通过 errdetails.ResourceInfo 说明找不到的用户，网关将其转为 404。
+func notFound(id int64) error {
+	st := status.Newf(codes.NotFound, "user %d not found", id)
+	if ds, err := st.WithDetails(&errdetails.ResourceInfo{
+		ResourceType: "user.User",
+		ResourceName: fmt.Sprintf("users/%d", id),
+		Description:  "the user does not exist or has been deleted",
+	}); err == nil {
+		st = ds
 	}
-	if listener != nil {
-		listener(lis)
-	}
-	return srv.server.Serve(lis)
+	return st.Err()
 }
 
 func (srv *UserRPCServer) CreateUser(_ context.Context, req *proto.CreateUserRequest) (*proto.CreateUserResponse, error) {
@@ -64,15 +55,19 @@ func (srv *UserRPCServer) DeleteUser(_ context.Context, req *proto.DeleteUserReq
 	if user, ok := srv.model.Delete(req.GetId()); ok {
 		return &proto.DeleteUserResponse{User: user}, nil
 	}
-	return nil, status.Errorf(codes.FailedPrecondition, "can not delete user")
+	return nil, notFound(req.GetId())
 }
 
 func (srv *UserRPCServer) UpdateUser(_ context.Context, req *proto.UpdateUserRequest) (*proto.UpdateUserResponse, error) {
 	log.Printf("server.UpdateUser received: request=%s, user=%s\n", utils.String(req), utils.String(req.GetUser()))
-	if user, ok := srv.model.Update(req.GetUser(), req.GetUpdateMask()); ok {
+	user, ok := srv.model.Update(req.GetUser(), req.GetUpdateMask())
+	if ok {
 		return &proto.UpdateUserResponse{User: user}, nil
 	}
-	return nil, status.Errorf(codes.FailedPrecondition, "can not update user")
+	if user == nil {
+		return nil, notFound(req.GetUser().GetId())
+	}
+	return nil, status.Errorf(codes.FailedPrecondition, "can not update user without update mask")
 }
 
 func (srv *UserRPCServer) GetUser(_ context.Context, req *proto.GetUserRequest) (*proto.GetUserResponse, error) {
@@ -80,12 +75,16 @@ func (srv *UserRPCServer) GetUser(_ context.Context, req *proto.GetUserRequest)
 	if user, ok := srv.model.Get(req.GetId()); ok {
 		return &proto.GetUserResponse{User: user}, nil
 	}
-	return nil, status.Errorf(codes.FailedPrecondition, "can not get user")
+	return nil, notFound(req.GetId())
 }
 
 func (srv *UserRPCServer) ListUsers(_ *proto.ListUsersRequest, sout grpc.ServerStreamingServer[proto.ListUsersResponse]) error {
 	log.Println("server.ListUsers received request")
 	for _, user := range srv.model.List() {
+		// 客户端离开或者超过截止时间后，停止发送剩余的数据
+		if err := sout.Context().Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
 		if err := sout.Send(&proto.ListUsersResponse{User: user}); err != nil {
 			return status.Errorf(codes.Internal, "failed to send user: %v", err)
 		} else {
@@ -95,12 +94,18 @@ func (srv *UserRPCServer) ListUsers(_ *proto.ListUsersRequest, sout grpc.ServerS
 	return nil
 }
 
-func NewUserRPCServer(mode string, opts ...grpc.ServerOption) *UserRPCServer {
-	server := grpc.NewServer(opts...)
-	srv := &UserRPCServer{server: server}
-	if mode == "dev" {
-		reflection.Register(server)
-	}
-	proto.RegisterUserServiceServer(server, srv)
+// NewUserRPCServer 注册 UserService 和健康检查服务，dev 模式下注册反射和 channelz 服务。
+// 请求按 user.proto 中声明的校验规则检查，校验拦截器在 opts 中的拦截器之后执行。
+func NewUserRPCServer(mode string, opts ...bootstrap.Option) *UserRPCServer {
+	srv := &UserRPCServer{}
+	srv.Server = bootstrap.New(append([]bootstrap.Option{
+		bootstrap.WithService(&proto.UserService_ServiceDesc, srv),
+		bootstrap.WithHealth(),
+		bootstrap.WithValidation(),
+		bootstrap.WithReflection(mode),
+		bootstrap.WithChannelz(mode),
+	}, opts...)...)
+	// 数据模型加载完成之前不能处理请求
+	srv.Health().Set(proto.UserService_ServiceDesc.ServiceName, false)
 	return srv
 }
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"goexamples/bootstrap"
+	"goexamples/gateway/openapi/internal/model"
+	"goexamples/gateway/openapi/proto"
+	"goexamples/harness"
+	"goexamples/streams"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func startUserSrv(t *testing.T, opts ...harness.Option) proto.UserServiceClient {
+	t.Helper()
+	return harness.Client(harness.New(t, opts...), func(opts ...grpc.ServerOption) harness.Server {
+		srv := NewUserRPCServer("prod", bootstrap.WithServerOptions(opts...))
+		srv.SetModel(model.NewUserModel().MustLoad("../../testdata/users.json"))
+		return srv.RawServer()
+	}, proto.NewUserServiceClient)
+}
+
+func TestUserService(t *testing.T) {
+	c := startUserSrv(t)
+	ctx := context.Background()
+
+	// 按顺序执行：新建用户后对其进行查询、修改和删除
+	tests := []struct {
+		name     string
+		call     func() (*proto.User, error)
+		wantName string
+		wantCode codes.Code
+	}{
+		{
+			name: "CreateUser",
+			call: func() (*proto.User, error) {
+				r, err := c.CreateUser(ctx, &proto.CreateUserRequest{User: &proto.User{Name: "zhaoliu", Email: "zhaoliu@example.com"}})
+				return r.GetUser(), err
+			},
+			wantName: "zhaoliu",
+		},
+		{
+			name: "CreateUser without user",
+			call: func() (*proto.User, error) {
+				r, err := c.CreateUser(ctx, &proto.CreateUserRequest{})
+				return r.GetUser(), err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "GetUser",
+			call: func() (*proto.User, error) {
+				r, err := c.GetUser(ctx, &proto.GetUserRequest{Id: 4})
+				return r.GetUser(), err
+			},
+			wantName: "zhaoliu",
+		},
+		{
+			name: "UpdateUser",
+			call: func() (*proto.User, error) {
+				r, err := c.UpdateUser(ctx, &proto.UpdateUserRequest{
+					User:       &proto.User{Id: 4, Name: "zhaoqi", Email: "ignored@example.com"},
+					UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+				})
+				return r.GetUser(), err
+			},
+			wantName: "zhaoqi",
+		},
+		{
+			// 部分更新只校验 mask 中字段的 required 规则，name 为空不影响
+			name: "UpdateUser email only",
+			call: func() (*proto.User, error) {
+				r, err := c.UpdateUser(ctx, &proto.UpdateUserRequest{
+					User:       &proto.User{Id: 4, Email: "zhaoqi@example.com"},
+					UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"email"}},
+				})
+				return r.GetUser(), err
+			},
+			wantName: "zhaoqi",
+		},
+		{
+			name: "UpdateUser without mask",
+			call: func() (*proto.User, error) {
+				r, err := c.UpdateUser(ctx, &proto.UpdateUserRequest{User: &proto.User{Id: 4, Name: "zhaoba"}})
+				return r.GetUser(), err
+			},
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name: "DeleteUser",
+			call: func() (*proto.User, error) {
+				r, err := c.DeleteUser(ctx, &proto.DeleteUserRequest{Id: 4})
+				return r.GetUser(), err
+			},
+			wantName: "zhaoqi",
+		},
+		{
+			name: "GetUser deleted",
+			call: func() (*proto.User, error) {
+				r, err := c.GetUser(ctx, &proto.GetUserRequest{Id: 4})
+				return r.GetUser(), err
+			},
+			wantCode: codes.NotFound,
+		},
+		{
+			name: "DeleteUser not found",
+			call: func() (*proto.User, error) {
+				r, err := c.DeleteUser(ctx, &proto.DeleteUserRequest{Id: 100})
+				return r.GetUser(), err
+			},
+			wantCode: codes.NotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := tt.call()
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("want %v, got %v", tt.wantCode, err)
+			}
+			if err == nil && user.GetName() != tt.wantName {
+				t.Fatalf("want user %q, got %v", tt.wantName, user)
+			}
+		})
+	}
+}
+
+func TestUserServiceListUsers(t *testing.T) {
+	ctx := context.Background()
+	sout, err := startUserSrv(t).ListUsers(ctx, &proto.ListUsersRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := streams.Collect(ctx, sout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"zhangsan", "lisi", "wangwu"}
+	if len(users) != len(want) {
+		t.Fatalf("want %d users, got %d", len(want), len(users))
+	}
+	for i, r := range users {
+		if r.GetUser().GetName() != want[i] {
+			t.Fatalf("want %v, got %v", want, users)
+		}
+	}
+}
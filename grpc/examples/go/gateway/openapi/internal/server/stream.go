@@ -0,0 +1,346 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"goexamples/features/deadline"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	MIMEEventStream = "text/event-stream"
+	MIMENDJSON      = "application/x-ndjson"
+	// DefaultHeartbeat 是 SSE 心跳的默认间隔，避免代理因为连接空闲而断开。
+	DefaultHeartbeat = 15 * time.Second
+)
+
+// streamMarshaler 与网关默认的 JSON 格式相同，只是服务端流的 Content-Type 为协商出的类型，
+// Streaming 的中间件据此区分服务端流和一元调用（以及流开始之前的错误）。
+type streamMarshaler struct {
+	runtime.Marshaler
+	contentType string
+}
+
+func (m streamMarshaler) StreamContentType(any) string {
+	return m.contentType
+}
+
+func (m streamMarshaler) Delimiter() []byte {
+	return []byte("\n")
+}
+
+type StreamOption func(*Streaming)
+
+// WithHeartbeat 设置 SSE 心跳的间隔，小于等于 0 时不发送心跳，默认为 DefaultHeartbeat。
+func WithHeartbeat(d time.Duration) StreamOption {
+	return func(s *Streaming) {
+		s.heartbeat = d
+	}
+}
+
+// Streaming 为网关上的所有服务端流方法提供 Server-Sent Events 和 NDJSON 两种格式，按 Accept 请求头协商：
+//
+//	text/event-stream: 每条消息是一个事件，id 从 1 开始递增，流中的错误为 error 事件，正常结束时发送 end 事件；
+//	                   定时发送注释行作为心跳，重连时按 Last-Event-ID 跳过已经收到的消息
+//	application/x-ndjson: 每行一条消息，流中的错误为一行 {"error": {...}}
+//
+// 其他 Accept 保持网关默认的格式，每行一个 {"result": {...}}。
+// SSE 的响应头在调用后端之前写出并开始心跳，后端迟迟不发送消息时浏览器也能收到响应；因此一元调用的响应是一个 data 事件，
+// 流开始之前的错误是 error 事件，header 元数据不再转为响应头。NDJSON 的一元调用和流开始之前的错误不受影响。
+// 续传依赖后端对相同的请求按相同的顺序返回消息，网关重新调用方法并丢弃已经发送过的消息。
+type Streaming struct {
+	heartbeat time.Duration
+}
+
+// ServeMuxOptions 返回注册 SSE、NDJSON 的 Marshaler 和协商格式的中间件的选项，需要在注册服务之前传给 runtime.NewServeMux。
+func (s *Streaming) ServeMuxOptions() []runtime.ServeMuxOption {
+	m := &runtime.JSONPb{
+		MarshalOptions:   protojson.MarshalOptions{EmitUnpopulated: true},
+		UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+	}
+	return []runtime.ServeMuxOption{
+		runtime.WithMarshalerOption(MIMEEventStream, streamMarshaler{Marshaler: m, contentType: MIMEEventStream}),
+		runtime.WithMarshalerOption(MIMENDJSON, streamMarshaler{Marshaler: m, contentType: MIMENDJSON}),
+		runtime.WithMiddlewares(s.middleware),
+	}
+}
+
+// negotiate 按 Accept 中的顺序返回第一个支持的流格式，浏览器的 EventSource 只发送 text/event-stream。
+func negotiate(r *http.Request) string {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, v := range strings.Split(accept, ",") {
+			if mt, _, err := mime.ParseMediaType(strings.TrimSpace(v)); err == nil && (mt == MIMEEventStream || mt == MIMENDJSON) {
+				return mt
+			}
+		}
+	}
+	return ""
+}
+
+func (s *Streaming) middleware(next runtime.HandlerFunc) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		format := negotiate(r)
+		if format == "" {
+			next(w, r, pathParams)
+			return
+		}
+		// 网关按 Accept 的完整值查找 Marshaler，这里改写为协商出的类型；
+		// EventSource 无法设置 Grpc-Timeout，流式格式的请求不补充网关客户端默认的超时时间，流保持到客户端离开
+		r = r.Clone(deadline.WithoutDefault(r.Context()))
+		r.Header.Set("Accept", format)
+
+		sw := &streamWriter{w: w, rc: http.NewResponseController(w), format: format, heartbeat: s.heartbeat}
+		if format == MIMEEventStream {
+			sw.skip, _ = strconv.Atoi(r.Header.Get("Last-Event-ID"))
+			sw.commit(http.StatusOK)
+		}
+		defer sw.close()
+		next(sw, r, pathParams)
+	}
+}
+
+// streamWriter 将网关写出的 {"result": ...}、{"error": ...} 行转为协商出的格式。
+type streamWriter struct {
+	w         http.ResponseWriter
+	rc        *http.ResponseController
+	format    string
+	heartbeat time.Duration
+
+	mu        sync.Mutex
+	decided   bool // 是否已经根据 Content-Type 判断出响应类型
+	streaming bool
+	committed bool // 是否已经写出流的响应头
+	status    int  // 响应头写出之后，一元调用或者错误的状态码
+	body      []byte
+	closed    bool
+	failed    bool
+	skip      int // Last-Event-ID，已经收到的消息数
+	id        int
+	buf       []byte
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func (sw *streamWriter) Header() http.Header {
+	return sw.w.Header()
+}
+
+// Unwrap 让 http.ResponseController 可以访问底层的 ResponseWriter。
+func (sw *streamWriter) Unwrap() http.ResponseWriter {
+	return sw.w
+}
+
+func (sw *streamWriter) WriteHeader(code int) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.writeHeader(code)
+}
+
+func (sw *streamWriter) writeHeader(code int) {
+	if sw.decided {
+		return
+	}
+	sw.decided = true
+	if sw.w.Header().Get("Content-Type") != sw.format {
+		if sw.committed {
+			// 响应体缓存起来，在 close 中转为一个事件
+			sw.status = code
+			return
+		}
+		sw.w.WriteHeader(code)
+		return
+	}
+	sw.streaming = true
+	if !sw.committed {
+		sw.commit(code)
+	}
+}
+
+// commit 写出流的响应头，SSE 同时开始发送心跳。
+func (sw *streamWriter) commit(code int) {
+	sw.committed = true
+	h := sw.w.Header()
+	h.Set("Content-Type", sw.format)
+	h.Del("Content-Length")
+	if sw.format == MIMEEventStream {
+		h.Set("Cache-Control", "no-cache")
+	}
+	sw.w.WriteHeader(code)
+	sw.rc.Flush()
+	if sw.format == MIMEEventStream && sw.heartbeat > 0 && !sw.closed {
+		sw.stop, sw.done = make(chan struct{}), make(chan struct{})
+		go sw.beat()
+	}
+}
+
+func (sw *streamWriter) Write(b []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.writeHeader(http.StatusOK)
+	if !sw.streaming {
+		if sw.committed {
+			sw.body = append(sw.body, b...)
+			return len(b), nil
+		}
+		return sw.w.Write(b)
+	}
+	sw.buf = append(sw.buf, b...)
+	for {
+		i := bytes.IndexByte(sw.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		line := sw.buf[:i]
+		sw.buf = sw.buf[i+1:]
+		if err := sw.writeChunk(line); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Flush 由网关在每条消息之后调用，消息已经在 Write 中刷新。
+func (sw *streamWriter) Flush() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.rc.Flush()
+}
+
+func (sw *streamWriter) writeChunk(line []byte) error {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil
+	}
+	var chunk struct {
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(line, &chunk); err != nil {
+		return fmt.Errorf("stream: invalid chunk %q: %w", line, err)
+	}
+
+	var err error
+	switch {
+	case chunk.Error != nil && sw.format == MIMEEventStream:
+		sw.failed = true
+		err = sw.event("error", chunk.Error)
+	case chunk.Error != nil:
+		sw.failed = true
+		_, err = fmt.Fprintf(sw.w, "{\"error\":%s}\n", chunk.Error)
+	default:
+		if sw.id++; sw.id <= sw.skip {
+			return nil
+		}
+		if sw.format == MIMEEventStream {
+			err = sw.message(chunk.Result)
+		} else {
+			_, err = fmt.Fprintf(sw.w, "%s\n", chunk.Result)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return sw.rc.Flush()
+}
+
+// message 写出一条消息，id 为消息的序号。
+func (sw *streamWriter) message(data []byte) error {
+	if _, err := fmt.Fprintf(sw.w, "id: %d\n", sw.id); err != nil {
+		return err
+	}
+	return sw.event("", data)
+}
+
+// event 写出一个事件，name 为空时是默认的 message 事件；data 中的每一行都是一个 data 字段。
+func (sw *streamWriter) event(name string, data []byte) error {
+	var b bytes.Buffer
+	if name != "" {
+		fmt.Fprintf(&b, "event: %s\n", name)
+	}
+	for line := range bytes.Lines(bytes.TrimSpace(data)) {
+		fmt.Fprintf(&b, "data: %s\n", bytes.TrimRight(line, "\r\n"))
+	}
+	b.WriteByte('\n')
+	_, err := sw.w.Write(b.Bytes())
+	return err
+}
+
+func (sw *streamWriter) beat() {
+	defer close(sw.done)
+	t := time.NewTicker(sw.heartbeat)
+	defer t.Stop()
+	for {
+		select {
+		case <-sw.stop:
+			return
+		case <-t.C:
+			sw.mu.Lock()
+			_, err := fmt.Fprint(sw.w, ": heartbeat\n\n")
+			if err == nil {
+				err = sw.rc.Flush()
+			}
+			sw.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// close 在网关的处理函数返回后执行，停止心跳；没有任何消息的 NDJSON 流此时才写出响应头。
+// SSE 中一元调用的响应转为一个消息，错误转为 error 事件，正常结束时发送 end 事件。
+func (sw *streamWriter) close() {
+	sw.mu.Lock()
+	sw.closed = true
+	if !sw.decided {
+		sw.w.Header().Set("Content-Type", sw.format)
+		sw.writeHeader(http.StatusOK)
+	}
+	stop, done := sw.stop, sw.done
+	sw.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.format != MIMEEventStream {
+		return
+	}
+	if !sw.streaming {
+		var err error
+		if sw.status >= http.StatusBadRequest {
+			sw.failed = true
+			err = sw.event("error", sw.body)
+		} else if sw.id++; sw.id > sw.skip {
+			err = sw.message(sw.body)
+		}
+		if err != nil {
+			grpclog.Errorf("Failed to send response event: %v", err)
+			return
+		}
+	}
+	if !sw.failed {
+		if _, err := fmt.Fprint(sw.w, "event: end\ndata: {}\n\n"); err != nil {
+			grpclog.Errorf("Failed to send end event: %v", err)
+		}
+	}
+}
+
+// NewStreaming 默认每 DefaultHeartbeat 发送一次心跳。
+func NewStreaming(opts ...StreamOption) *Streaming {
+	s := &Streaming{heartbeat: DefaultHeartbeat}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"goexamples/gateway/openapi/proto"
+	"goexamples/harness"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	zhangsan = `{"id":"1","name":"zhangsan"`
+	lisi     = `{"id":"2","name":"lisi"`
+	wangwu   = `{"id":"3","name":"wangwu"`
+)
+
+// sendHook 在服务端每次发送消息之前执行 f，n 从 1 开始。
+func sendHook(f func(n int) error) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &hookStream{ServerStream: ss, f: f})
+	}
+}
+
+type hookStream struct {
+	grpc.ServerStream
+	f func(n int) error
+	n int
+}
+
+func (s *hookStream) SendMsg(m any) error {
+	s.n++
+	if err := s.f(s.n); err != nil {
+		return err
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func serve(h http.Handler, path string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// compact 去掉 protojson 输出中随机的空白，方便比较。
+func compact(s string) string {
+	return strings.NewReplacer(`": `, `":`, `, `, `,`).Replace(s)
+}
+
+func TestStreamingFormats(t *testing.T) {
+	gsrv := NewUserGatewayFromClient(context.Background(), startUserSrv(t))
+
+	tests := []struct {
+		name        string
+		path        string
+		header      []string
+		status      int
+		contentType string
+		want        []string // 按顺序出现在响应中
+		notWant     []string
+	}{
+		{
+			name: "sse", path: "/api/v1/users", header: []string{"Accept", "text/event-stream"},
+			status: http.StatusOK, contentType: MIMEEventStream,
+			want: []string{"id: 1\ndata: " + zhangsan, "id: 2\ndata: " + lisi, "id: 3\ndata: " + wangwu, "event: end\ndata: {}\n\n"},
+		},
+		{
+			name: "sse resume", path: "/api/v1/users", header: []string{"Accept", "text/event-stream", "Last-Event-ID", "2"},
+			status: http.StatusOK, contentType: MIMEEventStream,
+			want:    []string{"id: 3\ndata: " + wangwu, "event: end"},
+			notWant: []string{"zhangsan", "lisi"},
+		},
+		{
+			name: "ndjson", path: "/api/v1/users", header: []string{"Accept", "application/json;q=0.9, application/x-ndjson"},
+			status: http.StatusOK, contentType: MIMENDJSON,
+			want:    []string{zhangsan, "}\n" + lisi, "}\n" + wangwu},
+			notWant: []string{"result", "id: "},
+		},
+		{
+			name: "default", path: "/api/v1/users",
+			status: http.StatusOK, contentType: "application/json",
+			want: []string{`{"result":` + zhangsan},
+		},
+		{
+			name: "unary", path: "/api/v1/users/2", header: []string{"Accept", "text/event-stream"},
+			status: http.StatusOK, contentType: MIMEEventStream,
+			want: []string{"id: 1\ndata: " + lisi, "event: end"},
+		},
+		{
+			name: "unary error", path: "/api/v1/users/100", header: []string{"Accept", "text/event-stream"},
+			status: http.StatusOK, contentType: MIMEEventStream,
+			want:    []string{"event: error\ndata: ", "user 100 not found"},
+			notWant: []string{"event: end"},
+		},
+		{
+			name: "ndjson unary", path: "/api/v1/users/2", header: []string{"Accept", "application/x-ndjson"},
+			status: http.StatusOK, contentType: "application/json",
+			want:    []string{lisi},
+			notWant: []string{"result"},
+		},
+		{
+			name: "ndjson unary error", path: "/api/v1/users/100", header: []string{"Accept", "application/x-ndjson"},
+			status: http.StatusNotFound, contentType: "application/json",
+			want: []string{"user 100 not found"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(gsrv, tt.path, tt.header...)
+			// 响应头写出之后网关仍会修改 w.Header()，这里检查写出时的响应头
+			if ct := w.Result().Header.Get("Content-Type"); w.Code != tt.status || ct != tt.contentType {
+				t.Fatalf("status = %d, Content-Type = %q, want %d %q", w.Code, ct, tt.status, tt.contentType)
+			}
+			body := compact(w.Body.String())
+			rest := body
+			for _, s := range tt.want {
+				i := strings.Index(rest, s)
+				if i < 0 {
+					t.Fatalf("body does not contain %q in order:\n%s", s, body)
+				}
+				rest = rest[i+len(s):]
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(body, s) {
+					t.Fatalf("body contains %q:\n%s", s, body)
+				}
+			}
+		})
+	}
+}
+
+// 消息之间的间隔超过心跳间隔时发送心跳，流中的错误为 error 事件，不再发送 end 事件
+func TestStreamingHeartbeatAndError(t *testing.T) {
+	c := startUserSrv(t, harness.WithStreamInterceptors(sendHook(func(n int) error {
+		if n == 3 {
+			return status.Error(codes.Unavailable, "backend gone")
+		}
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})))
+	mux := runtime.NewServeMux(NewStreaming(WithHeartbeat(10 * time.Millisecond)).ServeMuxOptions()...)
+	if err := proto.RegisterUserServiceHandlerClient(context.Background(), mux, c); err != nil {
+		t.Fatal(err)
+	}
+
+	for accept, want := range map[string][]string{
+		MIMEEventStream: {": heartbeat\n\n", "id: 1\ndata: " + zhangsan, "id: 2\ndata: " + lisi, "event: error\ndata: {\"code\":13"},
+		MIMENDJSON:      {zhangsan, lisi, "{\"error\":{\"code\":13"},
+	} {
+		body := compact(serve(mux, "/api/v1/users", "Accept", accept).Body.String())
+		for _, s := range want {
+			if !strings.Contains(body, s) {
+				t.Fatalf("%s: body does not contain %q:\n%s", accept, s, body)
+			}
+		}
+		if strings.Contains(body, "event: end") || (accept == MIMENDJSON && strings.Contains(body, "heartbeat")) {
+			t.Fatalf("%s: unexpected end event or heartbeat:\n%s", accept, body)
+		}
+	}
+}
+
+// 后端还没有发送任何消息时，SSE 的响应头已经写出，并且持续发送心跳
+func TestStreamingIdle(t *testing.T) {
+	release := make(chan struct{})
+	c := startUserSrv(t, harness.WithStreamInterceptors(sendHook(func(n int) error {
+		if n == 1 {
+			<-release
+		}
+		return nil
+	})))
+	mux := runtime.NewServeMux(NewStreaming(WithHeartbeat(10 * time.Millisecond)).ServeMuxOptions()...)
+	if err := proto.RegisterUserServiceHandlerClient(context.Background(), mux, c); err != nil {
+		t.Fatal(err)
+	}
+	hsrv := httptest.NewServer(mux)
+	defer hsrv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, hsrv.URL+"/api/v1/users", nil)
+	req.Header.Set("Accept", MIMEEventStream)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != MIMEEventStream {
+		t.Fatalf("Content-Type = %q, want %q", resp.Header.Get("Content-Type"), MIMEEventStream)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	for _, want := range []string{": heartbeat", ": heartbeat"} {
+		line, err := r.ReadString('\n')
+		for err == nil && line == "\n" {
+			line, err = r.ReadString('\n')
+		}
+		if err != nil || line != want+"\n" {
+			t.Fatalf("read %q, %v, want %q", line, err, want)
+		}
+	}
+	close(release)
+	var body strings.Builder
+	if _, err := r.WriteTo(&body); err != nil {
+		t.Fatal(err)
+	}
+	if s := compact(body.String()); !strings.Contains(s, "id: 1\ndata: "+zhangsan) || !strings.HasSuffix(s, "event: end\ndata: {}\n\n") {
+		t.Fatalf("unexpected body after release:\n%s", s)
+	}
+}
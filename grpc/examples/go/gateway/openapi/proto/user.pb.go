@@ -8,6 +8,7 @@ package proto
 
 import (
 	_ "github.com/grpc-ecosystem/grpc-gateway/v2/protoc-gen-openapiv2/options"
+	_ "goexamples/features/validate"
 	_ "google.golang.org/genproto/googleapis/api/annotations"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
@@ -299,12 +300,11 @@ type UpdateUserRequest struct {
 	User  *User                  `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
 	// https://grpc-ecosystem.github.io/grpc-gateway/docs/mapping/patch_feature/
 	// gRPC-Gateway 自动填充 FieldMask 需要满足三个条件：
-	//  1. 仅 PATCH 请求
-	//  2. 消息体定义中仅有一个 FieldMask 字段
-	//  3. PATCH 请求定义时，body 选项不能为 *
-	//
+	//     1. 仅 PATCH 请求
+	//     2. 消息体定义中仅有一个 FieldMask 字段
+	//     3. PATCH 请求处理方法定义时，body 选项不能为 *
 	// 其他情况下，FieldMask 视为普通字段，需要手动添加
-	// 字段掩码指定了要更新的字段路径，格式为 "name"、"email" 等。此例中，该字段为 nil 时，表示不更新任何字段
+	// 字段掩码指定了要更新的字段路径，格式为 "name"、"email" 等。此例中，该字段为 nil 或者 Paths 长度为 0 时，表示不更新任何字段
 	UpdateMask    *fieldmaskpb.FieldMask `protobuf:"bytes,2,opt,name=update_mask,json=updateMask,proto3" json:"update_mask,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -571,16 +571,16 @@ var File_user_proto protoreflect.FileDescriptor
 const file_user_proto_rawDesc = "" +
 	"\n" +
 	"\n" +
-	"user.proto\x12\x04user\x1a\x1cgoogle/api/annotations.proto\x1a google/protobuf/field_mask.proto\x1a\x1fgoogle/protobuf/timestamp.proto\x1a.protoc-gen-openapiv2/options/annotations.proto\"\xb2\x01\n" +
+	"user.proto\x12\x04user\x1a\x1cgoogle/api/annotations.proto\x1a google/protobuf/field_mask.proto\x1a\x1fgoogle/protobuf/timestamp.proto\x1a.protoc-gen-openapiv2/options/annotations.proto\x1a\x17validate/validate.proto\"\xc7\x01\n" +
 	"\x04User\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x12\n" +
-	"\x04name\x18\x02 \x01(\tR\x04name\x12\x14\n" +
-	"\x05email\x18\x03 \x01(\tR\x05email\x127\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x1c\n" +
+	"\x04name\x18\x02 \x01(\tB\b\x8a\xb5\x18\x04\b\x01\x18 R\x04name\x12\x1f\n" +
+	"\x05email\x18\x03 \x01(\tB\t\x8a\xb5\x18\x05\x18\xfe\x01(\x01R\x05email\x127\n" +
 	"\tcreate_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\bcreateAt\x127\n" +
-	"\tupdate_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\bupdateAt\"p\n" +
-	"\x11CreateUserRequest\x12\x1e\n" +
+	"\tupdate_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\bupdateAt\"x\n" +
+	"\x11CreateUserRequest\x12&\n" +
 	"\x04user\x18\x01 \x01(\v2\n" +
-	".user.UserR\x04user\x12;\n" +
+	".user.UserB\x06\x8a\xb5\x18\x02\b\x01R\x04user\x12;\n" +
 	"\vcreate_mask\x18\x02 \x01(\v2\x1a.google.protobuf.FieldMaskR\n" +
 	"createMask\"4\n" +
 	"\x12CreateUserResponse\x12\x1e\n" +
@@ -590,10 +590,10 @@ const file_user_proto_rawDesc = "" +
 	"\x02id\x18\x01 \x01(\x03R\x02id\"4\n" +
 	"\x12DeleteUserResponse\x12\x1e\n" +
 	"\x04user\x18\x01 \x01(\v2\n" +
-	".user.UserR\x04user\"p\n" +
-	"\x11UpdateUserRequest\x12\x1e\n" +
+	".user.UserR\x04user\"x\n" +
+	"\x11UpdateUserRequest\x12&\n" +
 	"\x04user\x18\x01 \x01(\v2\n" +
-	".user.UserR\x04user\x12;\n" +
+	".user.UserB\x06\x8a\xb5\x18\x02\b\x01R\x04user\x12;\n" +
 	"\vupdate_mask\x18\x02 \x01(\v2\x1a.google.protobuf.FieldMaskR\n" +
 	"updateMask\"4\n" +
 	"\x12UpdateUserResponse\x12\x1e\n" +
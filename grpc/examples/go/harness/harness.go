@@ -0,0 +1,141 @@
+package harness
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// DefaultBufferSize 是每个 bufconn 监听器的缓冲区大小。
+const DefaultBufferSize = 1 << 20
+
+// Server 是可以在 bufconn 上启动的服务端，*grpc.Server 和示例中的各个服务端都满足该接口，
+// 只提供 RawServer 的服务端可以返回 RawServer()。
+type Server interface {
+	Serve(net.Listener) error
+	Stop()
+}
+
+// Factory 使用 Harness 组装好的服务端选项（拦截器等）创建服务端。
+type Factory func(opts ...grpc.ServerOption) Server
+
+type Option func(*Harness)
+
+// WithUnaryInterceptors 为所有服务端添加一元拦截器，按添加顺序执行。
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) Option {
+	return func(h *Harness) {
+		h.unary = append(h.unary, interceptors...)
+	}
+}
+
+// WithStreamInterceptors 为所有服务端添加流拦截器，按添加顺序执行。
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) Option {
+	return func(h *Harness) {
+		h.stream = append(h.stream, interceptors...)
+	}
+}
+
+func WithServerOptions(opts ...grpc.ServerOption) Option {
+	return func(h *Harness) {
+		h.serverOpts = append(h.serverOpts, opts...)
+	}
+}
+
+// WithDialOptions 为所有客户端连接添加选项，比如客户端拦截器。
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(h *Harness) {
+		h.dialOpts = append(h.dialOpts, opts...)
+	}
+}
+
+func WithBufferSize(size int) Option {
+	return func(h *Harness) {
+		h.bufferSize = size
+	}
+}
+
+// Harness 在进程内的 bufconn 上启动任意数量的服务端，每个服务端使用独立的监听器，
+// 并返回已经连接的客户端，测试结束时自动关闭。
+type Harness struct {
+	tb         testing.TB
+	bufferSize int
+	unary      []grpc.UnaryServerInterceptor
+	stream     []grpc.StreamServerInterceptor
+	serverOpts []grpc.ServerOption
+	dialOpts   []grpc.DialOption
+
+	mu      sync.Mutex
+	closers []func()
+}
+
+func (h *Harness) serverOptions() []grpc.ServerOption {
+	opts := slices.Clone(h.serverOpts)
+	if len(h.unary) > 0 {
+		opts = append(opts, grpc.ChainUnaryInterceptor(h.unary...))
+	}
+	if len(h.stream) > 0 {
+		opts = append(opts, grpc.ChainStreamInterceptor(h.stream...))
+	}
+	return opts
+}
+
+func (h *Harness) onClose(f func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closers = append(h.closers, f)
+}
+
+// Start 在新的 bufconn 上启动 factory 创建的服务端，返回连接到该服务端的客户端连接。
+func (h *Harness) Start(factory Factory) *grpc.ClientConn {
+	h.tb.Helper()
+	lis := bufconn.Listen(h.bufferSize)
+	srv := factory(h.serverOptions()...)
+	go srv.Serve(lis)
+	h.onClose(srv.Stop)
+
+	opts := append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, h.dialOpts...)
+	conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+	if err != nil {
+		h.tb.Fatalf("harness: failed to create client: %v", err)
+	}
+	h.onClose(func() { conn.Close() })
+	return conn
+}
+
+// Close 按启动的相反顺序关闭客户端连接和服务端，可以重复调用。
+func (h *Harness) Close() {
+	h.mu.Lock()
+	closers := h.closers
+	h.closers = nil
+	h.mu.Unlock()
+	for _, f := range slices.Backward(closers) {
+		f()
+	}
+}
+
+// New 创建 Harness，测试结束时自动调用 Close。
+func New(tb testing.TB, opts ...Option) *Harness {
+	h := &Harness{tb: tb, bufferSize: DefaultBufferSize}
+	for _, opt := range opts {
+		opt(h)
+	}
+	tb.Cleanup(h.Close)
+	return h
+}
+
+// Client 启动服务端并用 newClient 创建类型化的客户端，比如：
+//
+//	client := harness.Client(h, factory, proto.NewPoemServiceClient)
+func Client[C any](h *Harness, factory Factory, newClient func(grpc.ClientConnInterface) C) C {
+	h.tb.Helper()
+	return newClient(h.Start(factory))
+}
@@ -0,0 +1,80 @@
+package harness_test
+
+import (
+	"context"
+	"goexamples/bootstrap"
+	"goexamples/features/proto/message"
+	"goexamples/harness"
+	"goexamples/poem-stream/poem"
+	"goexamples/poem-stream/proto"
+	"goexamples/poem-stream/testdata"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func messageSrv(opts ...grpc.ServerOption) harness.Server {
+	return message.NewMessageSrvServer(bootstrap.WithServerOptions(opts...))
+}
+
+func poemSrv(opts ...grpc.ServerOption) harness.Server {
+	s := poem.NewServer(bootstrap.WithServerOptions(opts...))
+	s.SetDB(testdata.NewDB("../poem-stream/testdata/server_poem.json"))
+	return s
+}
+
+// 同一个 Harness 中启动多个服务，拦截器对所有服务生效
+func TestHarnessCombination(t *testing.T) {
+	var unary, stream atomic.Int64
+	h := harness.New(t,
+		harness.WithUnaryInterceptors(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			unary.Add(1)
+			return handler(ctx, req)
+		}),
+		harness.WithStreamInterceptors(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			stream.Add(1)
+			return handler(srv, ss)
+		}),
+	)
+	mc := harness.Client(h, messageSrv, message.NewMessageServiceClient)
+	pc := harness.Client(h, poemSrv, proto.NewPoemServiceClient)
+
+	ctx := context.Background()
+	if _, err := mc.Unary(ctx, &message.Message{Content: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pc.GetPoem(ctx, &proto.GetPoemRequest{Title: "静夜思"}); err != nil {
+		t.Fatal(err)
+	}
+	sout, err := pc.GetPoemStream(ctx, &proto.GetPoemRequest{Title: "静夜思"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := sout.Recv(); err != nil {
+			break
+		}
+	}
+	if unary.Load() != 2 || stream.Load() != 1 {
+		t.Fatalf("want 2 unary and 1 stream intercepted, got %d, %d", unary.Load(), stream.Load())
+	}
+}
+
+func TestHarnessClose(t *testing.T) {
+	h := harness.New(t)
+	c := harness.Client(h, messageSrv, message.NewMessageServiceClient)
+	if _, err := c.Unary(context.Background(), &message.Message{Content: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := c.Unary(ctx, &message.Message{Content: "hello"}); status.Code(err) != codes.Canceled {
+		t.Fatalf("want Canceled after close, got %v", err)
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"flag"
+	"goexamples/config"
 	"goexamples/helloworld/proto"
 	"log"
 
@@ -38,24 +38,26 @@ func NewClient(addr string) *Client {
 	}
 }
 
-var (
-	addr = flag.String("addr", "localhost:50051", "port to connect to")
-	name = flag.String("name", "world", "name to greet")
-)
+type Config struct {
+	config.Client
+	Name string `config:"name" usage:"name to greet"`
+}
+
+var cfg = Config{Client: config.DefaultClient, Name: "world"}
 
 func main() {
-	flag.Parse()
+	config.MustLoad(&cfg)
 
-	c := NewClient(*addr)
+	c := NewClient(cfg.Addr)
 	defer c.Close()
 
-	r, err := c.SayHello(context.Background(), &proto.HelloRequest{Name: *name})
+	r, err := c.SayHello(context.Background(), &proto.HelloRequest{Name: cfg.Name})
 	if err != nil {
 		log.Fatalf("could not greet: %v", err)
 	}
 	log.Printf("Greeting: %s", r.GetMessage())
 
-	r, err = c.SayHelloAgain(context.Background(), &proto.HelloRequest{Name: *name})
+	r, err = c.SayHelloAgain(context.Background(), &proto.HelloRequest{Name: cfg.Name})
 	if err != nil {
 		log.Fatalf("could not greet: %v", err)
 	}
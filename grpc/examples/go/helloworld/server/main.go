@@ -2,18 +2,14 @@ package main
 
 import (
 	"context"
-	"flag"
-	"fmt"
+	"goexamples/bootstrap"
+	"goexamples/config"
 	"goexamples/helloworld/proto"
 	"log"
 	"net"
-
-	"google.golang.org/grpc"
 )
 
 type Server struct {
-	listener net.Listener
-	server   *grpc.Server
 	proto.UnimplementedGreeterServer
 }
 
@@ -25,26 +21,20 @@ func (*Server) SayHelloAgain(ctx context.Context, in *proto.HelloRequest) (*prot
 	return &proto.HelloReply{Message: "Hello " + in.GetName() + " again"}, nil
 }
 
-func NewServer(port int) *Server {
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
-	}
-	gs := grpc.NewServer()
-	srv := &Server{server: gs, listener: lis}
-	proto.RegisterGreeterServer(gs, srv)
-	log.Printf("server listening at %v", lis.Addr())
-	if err := gs.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
-	}
-	return srv
-}
-
-var (
-	port = flag.Int("port", 50051, "port to listen on")
-)
+var cfg = config.DefaultServer
 
 func main() {
-	flag.Parse()
-	_ = NewServer(*port)
+	config.MustLoad(&cfg)
+	server := bootstrap.New(
+		bootstrap.WithService(&proto.Greeter_ServiceDesc, &Server{}),
+		bootstrap.WithChannelz(cfg.Mode),
+		bootstrap.WithReflection(cfg.Mode),
+		bootstrap.WithTCP(cfg.Port),
+		bootstrap.OnListen(func(lis net.Listener) {
+			log.Printf("server listening at %v", lis.Addr())
+		}),
+	)
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
 }
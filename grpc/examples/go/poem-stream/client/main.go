@@ -2,209 +2,65 @@ package main
 
 import (
 	"context"
-	"flag"
+	"errors"
 	"fmt"
+	"goexamples/config"
+	"goexamples/features/loadbalance"
+	"goexamples/features/ratelimit"
+	"goexamples/features/recording"
+	"goexamples/poem-stream/poem"
 	"goexamples/poem-stream/proto"
 	"goexamples/poem-stream/testdata"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"sync"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/protobuf/types/known/emptypb"
 )
 
-type Client struct {
-	conn   *grpc.ClientConn
-	client proto.PoemServiceClient
+// Config 中 addr 还可以是 static:///host1:port1,host2:port2 和 file:///path，用于连接多个副本。
+type Config struct {
+	config.Client
+	Policy   string `config:"policy" usage:"load balancing policy: round_robin or weighted_least_request"`
+	JSONFile string `config:"json_file,path" usage:"client upload poem json file"`
+	Record   string `config:"record,path" usage:"record rpc calls to this JSON Lines file, which can be replayed by features/recording/replay"`
 }
 
-func (c *Client) GetPoem(ctx context.Context, in *proto.GetPoemRequest, opts ...grpc.CallOption) (*proto.Poem, error) {
-	return c.client.GetPoem(ctx, in, opts...)
-}
-
-func (c *Client) GetPoemStream(ctx context.Context, in *proto.GetPoemRequest, opts ...grpc.CallOption) (*proto.Poem, error) {
-	sout, err := c.client.GetPoemStream(ctx, in, opts...)
-	if err != nil {
-		return nil, err
-	}
-
-	p := new(proto.Poem)
-	for {
-		r, err := sout.Recv()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-		switch r.OneOf.(type) {
-		case *proto.StreamPoem_Title:
-			p.Title = r.OneOf.(*proto.StreamPoem_Title).Title
-		case *proto.StreamPoem_Author:
-			p.Author = r.OneOf.(*proto.StreamPoem_Author).Author
-		case *proto.StreamPoem_Content:
-			p.Contents = append(p.GetContents(), r.OneOf.(*proto.StreamPoem_Content).Content)
-		}
+func (c Config) Validate() error {
+	var err error
+	if c.Policy != loadbalance.RoundRobin && c.Policy != loadbalance.WeightedLeastRequest {
+		err = fmt.Errorf("policy %q should be %s or %s", c.Policy, loadbalance.RoundRobin, loadbalance.WeightedLeastRequest)
 	}
-	return p, nil
+	return errors.Join(c.Client.Validate(), err, config.ValidateFile("json_file", c.JSONFile))
 }
 
-func (c *Client) GetPoemAll(ctx context.Context, opts ...grpc.CallOption) ([]*proto.Poem, error) {
-	if r, err := c.client.GetPoemAll(ctx, new(emptypb.Empty), opts...); err != nil {
-		return nil, err
-	} else {
-		return r.GetValue(), nil
-	}
+var cfg = Config{
+	Client:   config.DefaultClient,
+	Policy:   loadbalance.RoundRobin,
+	JSONFile: filepath.Join("testdata", "client_poem.json"),
 }
 
-func (c *Client) GetPoemAllStream(ctx context.Context, opts ...grpc.CallOption) ([]*proto.Poem, error) {
-	sin, err := c.client.GetPoemAllStream(ctx, new(emptypb.Empty), opts...)
-	if err != nil {
-		return nil, err
-	}
-	poems := []*proto.Poem{}
-	for {
-		r, err := sin.Recv()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-		poems = append(poems, r)
-	}
-	return poems, nil
-}
-
-func (c *Client) UploadPoem(ctx context.Context, in *proto.Poem, opts ...grpc.CallOption) (*proto.UploadPoemResponse, error) {
-	return c.client.UploadPoem(ctx, in, opts...)
-}
-
-func (c *Client) UploadPoemStream(ctx context.Context, in *proto.Poem, opts ...grpc.CallOption) (*proto.UploadPoemResponse, error) {
-	sin, err := c.client.UploadPoemStream(ctx, opts...)
-	if err != nil {
-		return nil, err
-	}
-	if err := sin.Send(&proto.StreamPoem{OneOf: &proto.StreamPoem_Title{Title: in.GetTitle()}}); err != nil {
-		return nil, err
-	}
-	if err := sin.Send(&proto.StreamPoem{OneOf: &proto.StreamPoem_Author{Author: in.GetAuthor()}}); err != nil {
-		return nil, err
-	}
-	for _, content := range in.GetContents() {
-		if err := sin.Send(&proto.StreamPoem{OneOf: &proto.StreamPoem_Content{Content: content}}); err != nil {
-			return nil, err
-		}
-	}
-	return sin.CloseAndRecv()
-}
-
-func (c *Client) BatchUploadPoem(ctx context.Context, in []*proto.Poem, opts ...grpc.CallOption) (*proto.UploadPoemResponse, error) {
-	return c.client.BatchUploadPoem(ctx, &proto.PoemCollection{Value: in}, opts...)
-}
-
-func (c *Client) BatchUploadPoemStream(ctx context.Context, in []*proto.Poem, afterUpload func(*proto.UploadPoemResponse), opts ...grpc.CallOption) error {
-	stream, err := c.client.BatchUploadPoemStream(ctx, opts...)
-	if err != nil {
-		return err
-	}
-
-	var mu sync.Mutex
-	safeAfterUpload := func(r *proto.UploadPoemResponse) error {
-		mu.Lock()
-		defer mu.Unlock()
+func main() {
+	config.MustLoad(&cfg)
 
-		var err error
-		defer func() {
-			if r := recover(); r != nil {
-				err = fmt.Errorf("after upload err: %v", r)
-			}
-		}()
-		afterUpload(r)
-		return err
+	throttle := ratelimit.NewThrottle(3)
+	opts := []grpc.DialOption{
+		grpc.WithUnaryInterceptor(throttle.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(throttle.StreamClientInterceptor()),
+		loadbalance.WithPolicy(cfg.Policy, proto.PoemService_ServiceDesc.ServiceName),
 	}
-
-	ch := make(chan error, 2)
-	defer close(ch)
-
-	done := sync.WaitGroup{}
-	done.Add(1)
-	go func() {
-		defer done.Done()
-		for {
-			r, err := stream.Recv()
-			if err == io.EOF {
-				return
-			}
-			if err != nil {
-				ch <- err
-				return
-			}
-			if err := safeAfterUpload(r); err != nil {
-				ch <- err
-				return
-			}
-		}
-	}()
-
-	done.Add(1)
-	go func() {
-		defer done.Done()
-		for _, p := range in {
-			if err := stream.Send(p); err != nil {
-				ch <- err
-				return
-			}
-		}
-		if err := stream.CloseSend(); err != nil {
-			ch <- err
+	if cfg.Record != "" {
+		f, err := os.Create(cfg.Record)
+		if err != nil {
+			log.Fatalf("failed to create record file: %v", err)
 		}
-	}()
-
-	done.Wait()
-	select {
-	case err := <-ch:
-		return err
-	default:
-		return nil
+		defer f.Close()
+		opts = append(opts, recording.NewRecorder(f).DialOptions()...)
 	}
-}
-
-func (c *Client) Close() {
-	c.conn.Close()
-}
-
-func NewClient(addr string) *Client {
-	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		log.Fatalf("did not connect: %v", err)
-	}
-	return &Client{conn: conn, client: proto.NewPoemServiceClient(conn)}
-}
-
-var (
-	addr     = flag.String("addr", "localhost:50051", "port to connect to")
-	jsonFile = flag.String("json_file", "", "client upload poem json file")
-)
-
-func main() {
-	flag.Parse()
-
-	c := NewClient(*addr)
+	c := poem.NewClient(cfg.Addr, opts...)
 	defer c.Close()
 
-	if *jsonFile == "" {
-		if file, err := os.Getwd(); err != nil {
-			log.Fatalf("failed to get work dir: %v", err)
-		} else {
-			*jsonFile = filepath.Join(file, "testdata", "client_poem.json")
-		}
-	}
-	db := testdata.NewDB(*jsonFile)
+	db := testdata.NewDB(cfg.JSONFile)
 
 	func() {
 		t := "无题"
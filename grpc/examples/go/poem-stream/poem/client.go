@@ -0,0 +1,149 @@
+package poem
+
+import (
+	"context"
+	"fmt"
+	"goexamples/features/healthcheck"
+	"goexamples/features/keepalive"
+	"goexamples/poem-stream/proto"
+	"goexamples/streams"
+	"log"
+	"slices"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	// 注册 static、file 地址解析方案和 weighted_least_request 策略
+	"goexamples/features/loadbalance"
+)
+
+type Client struct {
+	conn   *grpc.ClientConn
+	client proto.PoemServiceClient
+}
+
+func (c *Client) GetPoem(ctx context.Context, in *proto.GetPoemRequest, opts ...grpc.CallOption) (*proto.Poem, error) {
+	return c.client.GetPoem(ctx, in, opts...)
+}
+
+func (c *Client) GetPoemStream(ctx context.Context, in *proto.GetPoemRequest, opts ...grpc.CallOption) (*proto.Poem, error) {
+	sout, err := c.client.GetPoemStream(ctx, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// 服务端将一首诗拆分成标题、作者和多段内容依次发送，这里重新组装
+	return streams.Fold(ctx, sout, new(proto.Poem), func(p *proto.Poem, r *proto.StreamPoem) *proto.Poem {
+		switch r.OneOf.(type) {
+		case *proto.StreamPoem_Title:
+			p.Title = r.GetTitle()
+		case *proto.StreamPoem_Author:
+			p.Author = r.GetAuthor()
+		case *proto.StreamPoem_Content:
+			p.Contents = append(p.GetContents(), r.GetContent())
+		}
+		return p
+	})
+}
+
+func (c *Client) GetPoemAll(ctx context.Context, opts ...grpc.CallOption) ([]*proto.Poem, error) {
+	if r, err := c.client.GetPoemAll(ctx, new(emptypb.Empty), opts...); err != nil {
+		return nil, err
+	} else {
+		return r.GetValue(), nil
+	}
+}
+
+func (c *Client) GetPoemAllStream(ctx context.Context, opts ...grpc.CallOption) ([]*proto.Poem, error) {
+	sin, err := c.client.GetPoemAllStream(ctx, new(emptypb.Empty), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return streams.Collect(ctx, sin)
+}
+
+func (c *Client) UploadPoem(ctx context.Context, in *proto.Poem, opts ...grpc.CallOption) (*proto.UploadPoemResponse, error) {
+	return c.client.UploadPoem(ctx, in, opts...)
+}
+
+func (c *Client) UploadPoemStream(ctx context.Context, in *proto.Poem, opts ...grpc.CallOption) (*proto.UploadPoemResponse, error) {
+	sin, err := c.client.UploadPoemStream(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	// 将一首诗拆分成标题、作者和多段内容依次发送
+	pieces := func(yield func(*proto.StreamPoem) bool) {
+		if !yield(&proto.StreamPoem{OneOf: &proto.StreamPoem_Title{Title: in.GetTitle()}}) {
+			return
+		}
+		if !yield(&proto.StreamPoem{OneOf: &proto.StreamPoem_Author{Author: in.GetAuthor()}}) {
+			return
+		}
+		for _, content := range in.GetContents() {
+			if !yield(&proto.StreamPoem{OneOf: &proto.StreamPoem_Content{Content: content}}) {
+				return
+			}
+		}
+	}
+	return streams.SendAllAndClose(ctx, sin, pieces)
+}
+
+func (c *Client) BatchUploadPoem(ctx context.Context, in []*proto.Poem, opts ...grpc.CallOption) (*proto.UploadPoemResponse, error) {
+	return c.client.BatchUploadPoem(ctx, &proto.PoemCollection{Value: in}, opts...)
+}
+
+func (c *Client) BatchUploadPoemStream(ctx context.Context, in []*proto.Poem, afterUpload func(*proto.UploadPoemResponse), opts ...grpc.CallOption) error {
+	// 提前返回时取消流，使后台的发送协程退出
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.client.BatchUploadPoemStream(ctx, opts...)
+	if err != nil {
+		return err
+	}
+
+	safeAfterUpload := func(r *proto.UploadPoemResponse) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("after upload err: %v", r)
+			}
+		}()
+		afterUpload(r)
+		return nil
+	}
+
+	// 发送和接收同时进行，每收到一个响应就调用一次 afterUpload
+	for r, err := range streams.Exchange(ctx, stream, slices.Values(in)) {
+		if err != nil {
+			return err
+		}
+		if err := safeAfterUpload(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) Close() {
+	c.conn.Close()
+}
+
+// NewClient 中 addr 可以是 static:///host1:port1,host2:port2 或 file:///path 形式的多个服务端副本。
+func NewClient(addr string, opts ...grpc.DialOption) *Client {
+	opts = append(append(keepalive.DefaultClient.Options(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		healthcheck.WithHealthCheck(proto.PoemService_ServiceDesc.ServiceName),
+	), opts...)
+	// 放在最后，opts 中同一方案的解析器优先
+	opts = append(opts, loadbalance.WithResolvers())
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	return NewClientFromConn(conn)
+}
+
+func NewClientFromConn(conn *grpc.ClientConn) *Client {
+	return &Client{conn: conn, client: proto.NewPoemServiceClient(conn)}
+}
@@ -0,0 +1,205 @@
+package poem
+
+import (
+	"context"
+	"goexamples/bootstrap"
+	"goexamples/features/ratelimit"
+	"goexamples/harness"
+	"goexamples/poem-stream/proto"
+	"goexamples/poem-stream/testdata"
+	"slices"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	gproto "google.golang.org/protobuf/proto"
+)
+
+func startPoemSrv(t *testing.T, opts ...harness.Option) (*Client, testdata.DB) {
+	t.Helper()
+	db := testdata.NewDB("../testdata/server_poem.json")
+	conn := harness.New(t, opts...).Start(func(opts ...grpc.ServerOption) harness.Server {
+		s := NewServer(bootstrap.WithServerOptions(opts...))
+		s.SetDB(db)
+		return s
+	})
+	return NewClientFromConn(conn), db
+}
+
+func titles(poems []*proto.Poem) []string {
+	out := make([]string, len(poems))
+	for i, p := range poems {
+		out[i] = p.GetTitle()
+	}
+	slices.Sort(out)
+	return out
+}
+
+func TestPoemServiceGet(t *testing.T) {
+	c, db := startPoemSrv(t)
+	want, _ := db.GetPoem("洛神赋")
+
+	tests := []struct {
+		name    string
+		get     func(ctx context.Context, in *proto.GetPoemRequest, opts ...grpc.CallOption) (*proto.Poem, error)
+		title   string
+		wantErr bool
+	}{
+		{name: "GetPoem", get: c.GetPoem, title: "洛神赋"},
+		{name: "GetPoemStream", get: c.GetPoemStream, title: "洛神赋"},
+		{name: "GetPoem not found", get: c.GetPoem, title: "不存在", wantErr: true},
+		{name: "GetPoemStream not found", get: c.GetPoemStream, title: "不存在", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.get(context.Background(), &proto.GetPoemRequest{Title: tt.title})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !gproto.Equal(got, want) {
+				t.Fatalf("want %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestPoemServiceGetAll(t *testing.T) {
+	c, db := startPoemSrv(t)
+	want := titles(db.GetPoemCollection())
+
+	tests := []struct {
+		name   string
+		getAll func(ctx context.Context, opts ...grpc.CallOption) ([]*proto.Poem, error)
+	}{
+		{name: "GetPoemAll", getAll: c.GetPoemAll},
+		{name: "GetPoemAllStream", getAll: c.GetPoemAllStream},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.getAll(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(titles(got), want) {
+				t.Fatalf("want %v, got %v", want, titles(got))
+			}
+		})
+	}
+}
+
+func TestPoemServiceUpload(t *testing.T) {
+	c, db := startPoemSrv(t)
+	poem := func(title string) *proto.Poem {
+		return &proto.Poem{Title: title, Author: "佚名", Contents: []string{"第一句。", "第二句。"}}
+	}
+
+	tests := []struct {
+		name   string
+		upload func(ctx context.Context, in []*proto.Poem) ([]*proto.Poem, error)
+		in     []*proto.Poem
+	}{
+		{
+			name: "UploadPoem",
+			upload: func(ctx context.Context, in []*proto.Poem) ([]*proto.Poem, error) {
+				r, err := c.UploadPoem(ctx, in[0])
+				return r.GetData(), err
+			},
+			in: []*proto.Poem{poem("一元上传")},
+		},
+		{
+			name: "UploadPoemStream",
+			upload: func(ctx context.Context, in []*proto.Poem) ([]*proto.Poem, error) {
+				r, err := c.UploadPoemStream(ctx, in[0])
+				return r.GetData(), err
+			},
+			in: []*proto.Poem{poem("客户端流上传")},
+		},
+		{
+			name: "BatchUploadPoem",
+			upload: func(ctx context.Context, in []*proto.Poem) ([]*proto.Poem, error) {
+				r, err := c.BatchUploadPoem(ctx, in)
+				return r.GetData(), err
+			},
+			in: []*proto.Poem{poem("批量上传一"), poem("批量上传二")},
+		},
+		{
+			name: "BatchUploadPoemStream",
+			upload: func(ctx context.Context, in []*proto.Poem) ([]*proto.Poem, error) {
+				out := []*proto.Poem{}
+				err := c.BatchUploadPoemStream(ctx, in, func(r *proto.UploadPoemResponse) {
+					if r.GetSuccess() {
+						out = append(out, r.GetData()...)
+					}
+				})
+				return out, err
+			},
+			in: []*proto.Poem{poem("双向流上传一"), poem("双向流上传二"), poem("双向流上传三")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.upload(context.Background(), tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(titles(got), titles(tt.in)) {
+				t.Fatalf("want %v echoed, got %v", titles(tt.in), titles(got))
+			}
+			// 上传的诗保存到服务端，之后可以查询到
+			for _, p := range tt.in {
+				saved, err := db.GetPoem(p.GetTitle())
+				if err != nil || !gproto.Equal(saved, p) {
+					t.Fatalf("want %q saved, got %v, %v", p.GetTitle(), saved, err)
+				}
+			}
+		})
+	}
+}
+
+// 每条消息消耗一个令牌，客户端恰好发送 Burst 条消息后结束流不会超出限制
+func TestBatchUploadPoemStreamRateLimit(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.WithKey(ratelimit.MetadataKey("token")), ratelimit.WithMethod(proto.PoemService_BatchUploadPoemStream_FullMethodName, ratelimit.Rule{
+		Message: ratelimit.Limit{Rate: 0.001, Burst: 2},
+	}))
+	c, _ := startPoemSrv(t, harness.WithStreamInterceptors(limiter.StreamServerInterceptor()))
+	poem := func(title string) *proto.Poem {
+		return &proto.Poem{Title: title, Author: "佚名", Contents: []string{"第一句。"}}
+	}
+	// 不同的客户端标识使用不同的令牌桶
+	upload := func(key string, in ...*proto.Poem) error {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "token", key)
+		return c.BatchUploadPoemStream(ctx, in, func(*proto.UploadPoemResponse) {})
+	}
+
+	if err := upload("exact", poem("限流一"), poem("限流二")); err != nil {
+		t.Fatalf("want success with exactly Burst messages, got %v", err)
+	}
+	if err := upload("exceeded", poem("限流三"), poem("限流四"), poem("限流五")); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("want ResourceExhausted, got %v", err)
+	}
+}
+
+// 数据设置之前服务不能处理请求，健康状态为 NOT_SERVING
+func TestServerHealth(t *testing.T) {
+	s := NewServer()
+	service := proto.PoemService_ServiceDesc.ServiceName
+	if s.Health().Serving(service) {
+		t.Fatal("want NOT_SERVING before SetDB")
+	}
+	s.SetDB(testdata.DB{})
+	if !s.Health().Serving(service) {
+		t.Fatal("want SERVING after SetDB")
+	}
+	s.SetDB(nil)
+	if s.Health().Serving(service) {
+		t.Fatal("want NOT_SERVING after SetDB(nil)")
+	}
+}
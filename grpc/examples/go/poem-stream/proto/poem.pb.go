@@ -7,6 +7,7 @@
 package proto
 
 import (
+	_ "goexamples/features/validate"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
 	emptypb "google.golang.org/protobuf/types/known/emptypb"
@@ -333,21 +334,21 @@ var File_poem_proto protoreflect.FileDescriptor
 const file_poem_proto_rawDesc = "" +
 	"\n" +
 	"\n" +
-	"poem.proto\x1a\x1bgoogle/protobuf/empty.proto\"P\n" +
-	"\x04Poem\x12\x14\n" +
-	"\x05title\x18\x01 \x01(\tR\x05title\x12\x16\n" +
-	"\x06author\x18\x02 \x01(\tR\x06author\x12\x1a\n" +
-	"\bcontents\x18\x03 \x03(\tR\bcontents\"-\n" +
-	"\x0ePoemCollection\x12\x1b\n" +
-	"\x05value\x18\x01 \x03(\v2\x05.PoemR\x05value\"c\n" +
+	"poem.proto\x1a\x1bgoogle/protobuf/empty.proto\x1a\x17validate/validate.proto\"j\n" +
+	"\x04Poem\x12\x1e\n" +
+	"\x05title\x18\x01 \x01(\tB\b\x8a\xb5\x18\x04\b\x01\x18@R\x05title\x12\x1e\n" +
+	"\x06author\x18\x02 \x01(\tB\x06\x8a\xb5\x18\x02\x18 R\x06author\x12\"\n" +
+	"\bcontents\x18\x03 \x03(\tB\x06\x8a\xb5\x18\x020\x01R\bcontents\"5\n" +
+	"\x0ePoemCollection\x12#\n" +
+	"\x05value\x18\x01 \x03(\v2\x05.PoemB\x06\x8a\xb5\x18\x020\x01R\x05value\"c\n" +
 	"\n" +
 	"StreamPoem\x12\x16\n" +
 	"\x05title\x18\x01 \x01(\tH\x00R\x05title\x12\x18\n" +
 	"\x06author\x18\x02 \x01(\tH\x00R\x06author\x12\x1a\n" +
 	"\acontent\x18\x03 \x01(\tH\x00R\acontentB\a\n" +
-	"\x05OneOf\"&\n" +
-	"\x0eGetPoemRequest\x12\x14\n" +
-	"\x05title\x18\x01 \x01(\tR\x05title\"d\n" +
+	"\x05OneOf\".\n" +
+	"\x0eGetPoemRequest\x12\x1c\n" +
+	"\x05title\x18\x01 \x01(\tB\x06\x8a\xb5\x18\x02\b\x01R\x05title\"d\n" +
 	"\x12UploadPoemResponse\x12\x19\n" +
 	"\bend_time\x18\x01 \x01(\tR\aendTime\x12\x18\n" +
 	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x19\n" +
@@ -1,162 +1,81 @@
 package main
 
 import (
-	"context"
-	"flag"
+	"errors"
 	"fmt"
+	"goexamples/bootstrap"
+	"goexamples/config"
+	"goexamples/features/fault"
+	"goexamples/features/ratelimit"
+	"goexamples/features/recovery"
+	"goexamples/poem-stream/poem"
 	"goexamples/poem-stream/proto"
 	"goexamples/poem-stream/testdata"
-	"io"
 	"log"
 	"net"
-	"os"
 	"path/filepath"
-	"sync"
-	"time"
-
-	"google.golang.org/grpc"
-	"google.golang.org/protobuf/types/known/emptypb"
 )
 
-type Server struct {
-	db testdata.DB
-	mu sync.Mutex
-	proto.UnimplementedPoemServiceServer
-}
-
-func (s *Server) SetDB(db testdata.DB) {
-	s.db = db
-}
-
-func (s *Server) Start(port int) error {
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
-	}
-	server := grpc.NewServer()
-	proto.RegisterPoemServiceServer(server, s)
-	log.Printf("server listening at %v", lis.Addr())
-	return server.Serve(lis)
-}
-
-func (s *Server) GetPoem(_ context.Context, in *proto.GetPoemRequest) (*proto.Poem, error) {
-	return s.db.GetPoem(in.GetTitle())
+// Config 中 mode 为 dev 时注册 channelz、反射并注入故障，配置文件示例见 config.yaml。
+type Config struct {
+	config.Server
+	Unix      string  `config:"unix,path" usage:"unix socket path to listen on in addition to the port"`
+	JSONFile  string  `config:"json_file,path" usage:"server poem json file"`
+	FaultPort int     `config:"fault_port" usage:"port of the fault rules admin endpoint on 127.0.0.1, 0 to disable, faults are injected only in dev mode"`
+	Rate      float64 `config:"rate" usage:"max uploaded poems per second of each client in BatchUploadPoemStream, 0 means unlimited"`
 }
 
-func (s *Server) GetPoemStream(in *proto.GetPoemRequest, sout grpc.ServerStreamingServer[proto.StreamPoem]) error {
-	var poem *proto.Poem
-	if p, err := s.db.GetPoem(in.GetTitle()); err != nil {
-		return err
-	} else {
-		poem = p
-	}
-
-	if err := sout.Send(&proto.StreamPoem{OneOf: &proto.StreamPoem_Title{Title: poem.GetTitle()}}); err != nil {
-		return err
+func (c Config) Validate() error {
+	var errs []error
+	if c.Rate < 0 {
+		errs = append(errs, fmt.Errorf("rate %v should not be negative", c.Rate))
 	}
-	if err := sout.Send(&proto.StreamPoem{OneOf: &proto.StreamPoem_Author{Author: poem.GetAuthor()}}); err != nil {
-		return err
+	if c.JSONFile == "" {
+		errs = append(errs, errors.New("json_file is required"))
 	}
-	for _, content := range poem.GetContents() {
-		if err := sout.Send(&proto.StreamPoem{OneOf: &proto.StreamPoem_Content{Content: content}}); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func (s *Server) GetPoemAll(_ context.Context, _ *emptypb.Empty) (*proto.PoemCollection, error) {
-	return &proto.PoemCollection{Value: s.db.GetPoemCollection()}, nil
-}
-
-func (s *Server) GetPoemAllStream(_ *emptypb.Empty, sout grpc.ServerStreamingServer[proto.Poem]) error {
-	for _, p := range s.db.GetPoemCollection() {
-		if err := sout.Send(p); err != nil {
-			return err
-		}
-	}
-	return nil
+	return errors.Join(c.Server.Validate(), config.ValidatePort("fault_port", c.FaultPort), config.ValidateFile("json_file", c.JSONFile), errors.Join(errs...))
 }
 
-func (s *Server) UploadPoem(_ context.Context, in *proto.Poem) (*proto.UploadPoemResponse, error) {
-	s.db.SetPoem(in.GetTitle(), in)
-	log.Printf("uploaded poem: %s\n", in.GetTitle())
-	return &proto.UploadPoemResponse{EndTime: time.Now().Format(time.DateTime), Success: true, Data: []*proto.Poem{in}}, nil
+var cfg = Config{
+	Server:   config.DefaultServer,
+	JSONFile: filepath.Join("testdata", "server_poem.json"),
 }
 
-func (s *Server) UploadPoemStream(sin grpc.ClientStreamingServer[proto.StreamPoem, proto.UploadPoemResponse]) error {
-	poem := new(proto.Poem)
-	for {
-		in, err := sin.Recv()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
-		switch in.GetOneOf().(type) {
-		case *proto.StreamPoem_Title:
-			poem.Title = in.GetTitle()
-		case *proto.StreamPoem_Author:
-			poem.Author = in.GetAuthor()
-		case *proto.StreamPoem_Content:
-			poem.Contents = append(poem.Contents, in.GetContent())
-		}
-	}
-	s.db.SetPoem(poem.GetTitle(), poem)
-	log.Printf("uploaded poem: %s\n", poem.GetTitle())
-	return sin.SendAndClose(&proto.UploadPoemResponse{EndTime: time.Now().Format(time.DateTime), Success: true, Data: []*proto.Poem{poem}})
-}
-
-func (s *Server) BatchUploadPoem(_ context.Context, in *proto.PoemCollection) (*proto.UploadPoemResponse, error) {
-	for _, p := range in.GetValue() {
-		s.db.SetPoem(p.GetTitle(), p)
-		log.Printf("uploaded poem: %s\n", p.GetTitle())
-	}
-	return &proto.UploadPoemResponse{EndTime: time.Now().Format(time.DateTime), Success: true, Data: in.GetValue()}, nil
-}
-
-func (s *Server) BatchUploadPoemStream(stream grpc.BidiStreamingServer[proto.Poem, proto.UploadPoemResponse]) error {
-	for {
-		in, err := stream.Recv()
-		if err == io.EOF {
-			return nil
-		}
-		if err != nil {
-			return err
-		}
-		s.mu.Lock()
-		s.db.SetPoem(in.GetTitle(), in)
-		log.Printf("uploaded poem: %s\n", in.GetTitle())
-		s.mu.Unlock()
-		if err := stream.Send(&proto.UploadPoemResponse{EndTime: time.Now().Format(time.DateTime), Success: true, Data: []*proto.Poem{in}}); err != nil {
-			return err
-		}
-	}
-}
-
-func NewServer(port int) *Server {
-	return new(Server)
-}
-
-var (
-	port     = flag.Int("port", 50051, "port to listen on")
-	jsonFile = flag.String("json_file", "", "server poem json file")
-)
-
 func main() {
-	flag.Parse()
-	if *jsonFile == "" {
-		if file, err := os.Getwd(); err != nil {
-			log.Fatalf("failed to get work dir: %v", err)
-		} else {
-			*jsonFile = filepath.Join(file, "testdata", "server_poem.json")
+	config.MustLoad(&cfg)
+
+	limiter := ratelimit.NewLimiter(
+		ratelimit.WithMethod(proto.PoemService_BatchUploadPoemStream_FullMethodName, ratelimit.Rule{
+			Message: ratelimit.Limit{Rate: cfg.Rate, Burst: max(1, int(cfg.Rate))},
+		}),
+	)
+
+	// 故障规则默认为空，设置 fault_port 后通过管理接口在运行时设置
+	injector := fault.NewInjector(cfg.Mode)
+	go func() {
+		if err := injector.ListenAndServe(cfg.FaultPort); err != nil {
+			log.Fatalf("failed to serve fault admin: %v", err)
 		}
+	}()
+
+	r := recovery.NewRecovery("")
+	opts := []bootstrap.Option{
+		bootstrap.WithUnaryInterceptors(r.UnaryServerInterceptor(), injector.UnaryServerInterceptor(), limiter.UnaryServerInterceptor()),
+		bootstrap.WithStreamInterceptors(r.StreamServerInterceptor(), injector.StreamServerInterceptor(), limiter.StreamServerInterceptor()),
+		bootstrap.WithChannelz(cfg.Mode),
+		bootstrap.WithReflection(cfg.Mode),
+		bootstrap.WithTCP(cfg.Port),
+		bootstrap.OnListen(func(lis net.Listener) {
+			log.Printf("server listening at %v", lis.Addr())
+		}),
 	}
-
-	s := NewServer(*port)
-	s.SetDB(testdata.NewDB(*jsonFile))
-	if err := s.Start(*port); err != nil {
+	if cfg.Unix != "" {
+		// 同一个服务端同时监听 TCP 端口和 unix socket，例如 grpcli unix:///tmp/poem.sock list
+		opts = append(opts, bootstrap.WithUnix(cfg.Unix))
+	}
+	s := poem.NewServer(opts...)
+	s.SetDB(testdata.NewDB(cfg.JSONFile))
+	if err := s.ListenAndServe(); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
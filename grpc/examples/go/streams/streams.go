@@ -0,0 +1,193 @@
+package streams
+
+import (
+	"context"
+	"io"
+	"iter"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Receiver 是可以逐条接收消息的流。
+// 客户端的 grpc.ServerStreamingClient[T]、grpc.BidiStreamingClient[Req, T]，
+// 以及服务端的 grpc.ClientStreamingServer[T, Res]、grpc.BidiStreamingServer[T, Res] 都满足该接口。
+type Receiver[T any] interface {
+	Recv() (*T, error)
+}
+
+// Sender 是可以逐条发送消息的流。
+type Sender[T any] interface {
+	Send(*T) error
+}
+
+// HalfCloser 是可以逐条发送消息，并通知对端发送结束的流，比如 grpc.BidiStreamingClient[T, Res]。
+type HalfCloser[T any] interface {
+	Sender[T]
+	CloseSend() error
+}
+
+func contextError(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return nil
+}
+
+// All 将流转换为迭代器，流正常结束（io.EOF）时迭代结束，出错时产出一次错误后结束。
+//
+// 每次接收前检查 ctx，取消后产出 codes.Canceled / codes.DeadlineExceeded 错误。
+// 阻塞中的 Recv 只受创建流时的上下文控制，因此 ctx 应当与创建流的上下文相同或者由其派生。
+// 提前结束迭代不会结束流，调用方需要取消创建流的上下文。
+func All[T any](ctx context.Context, r Receiver[T]) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		for {
+			if err := contextError(ctx); err != nil {
+				yield(nil, err)
+				return
+			}
+			m, err := r.Recv()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(m, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Collect 接收流中所有的消息。
+func Collect[T any](ctx context.Context, r Receiver[T]) ([]*T, error) {
+	out := []*T{}
+	for m, err := range All(ctx, r) {
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// Fold 依次将流中的消息合并到 acc 中，比如将分段传输的消息重新组装成完整的消息。
+func Fold[T, A any](ctx context.Context, r Receiver[T], acc A, fn func(A, *T) A) (A, error) {
+	for m, err := range All(ctx, r) {
+		if err != nil {
+			return acc, err
+		}
+		acc = fn(acc, m)
+	}
+	return acc, nil
+}
+
+// Batch 将流中的消息按 size 条分批产出，最后一批可能不足 size 条。
+func Batch[T any](ctx context.Context, r Receiver[T], size int) iter.Seq2[[]*T, error] {
+	size = max(size, 1)
+	return func(yield func([]*T, error) bool) {
+		batch := make([]*T, 0, size)
+		for m, err := range All(ctx, r) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if batch = append(batch, m); len(batch) == size {
+				if !yield(batch, nil) {
+					return
+				}
+				batch = make([]*T, 0, size)
+			}
+		}
+		if len(batch) > 0 {
+			yield(batch, nil)
+		}
+	}
+}
+
+// Chan 在后台协程中接收消息并写入容量为 size 的通道，流结束时关闭通道。
+// 返回的错误通道在通道关闭后产出一次最终结果（正常结束时为 nil）。
+// 调用方消费过慢时后台协程停止接收，ctx 取消后后台协程退出。
+func Chan[T any](ctx context.Context, r Receiver[T], size int) (<-chan *T, <-chan error) {
+	out := make(chan *T, max(size, 0))
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		err := func() error {
+			defer close(out)
+			for m, err := range All(ctx, r) {
+				if err != nil {
+					return err
+				}
+				select {
+				case out <- m:
+				case <-ctx.Done():
+					return contextError(ctx)
+				}
+			}
+			return nil
+		}()
+		errc <- err
+	}()
+	return out, errc
+}
+
+// SendAll 依次发送迭代器产出的消息，每次发送前检查 ctx。
+// 发送返回 io.EOF 表示流已经被对端结束，真正的原因需要通过接收获得。
+func SendAll[T any](ctx context.Context, s Sender[T], in iter.Seq[*T]) error {
+	for m := range in {
+		if err := contextError(ctx); err != nil {
+			return err
+		}
+		if err := s.Send(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendAllAndCloseSend 发送所有消息后调用 CloseSend。
+func SendAllAndCloseSend[T any](ctx context.Context, s HalfCloser[T], in iter.Seq[*T]) error {
+	if err := SendAll(ctx, s, in); err != nil {
+		return err
+	}
+	return s.CloseSend()
+}
+
+// SendAllAndClose 用于客户端流：发送所有消息后等待服务端唯一的响应。
+func SendAllAndClose[Req, Res any](ctx context.Context, s grpc.ClientStreamingClient[Req, Res], in iter.Seq[*Req]) (*Res, error) {
+	// 发送返回 io.EOF 时，CloseAndRecv 会返回服务端结束流的原因
+	if err := SendAll(ctx, s, in); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return s.CloseAndRecv()
+}
+
+// Exchange 用于双向流：在后台协程中发送迭代器产出的消息，同时在当前协程中迭代服务端的响应。
+// 服务端结束流之后不再等待发送协程，in 阻塞时（比如交互式的输入）发送协程在 in 产出下一条消息后退出。
+// 提前结束迭代时，调用方需要取消创建流的上下文，以便结束流。
+func Exchange[Req, Res any](ctx context.Context, s grpc.BidiStreamingClient[Req, Res], in iter.Seq[*Req]) iter.Seq2[*Res, error] {
+	return func(yield func(*Res, error) bool) {
+		sendCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		sent := make(chan error, 1)
+		go func() {
+			sent <- SendAllAndCloseSend(sendCtx, s, in)
+		}()
+		for m, err := range All(ctx, s) {
+			if !yield(m, err) || err != nil {
+				return
+			}
+		}
+		// 接收正常结束，但发送过程中出错（比如发送途中 ctx 被取消）
+		select {
+		case err := <-sent:
+			if err != nil && err != io.EOF {
+				yield(nil, err)
+			}
+		default:
+		}
+	}
+}
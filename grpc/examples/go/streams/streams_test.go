@@ -0,0 +1,210 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type message struct {
+	n int
+}
+
+// fakeStream 依次返回 msgs 中的消息，之后返回 err（默认为 io.EOF）。
+type fakeStream struct {
+	msgs []*message
+	err  error
+	sent []*message
+}
+
+func (s *fakeStream) Recv() (*message, error) {
+	if len(s.msgs) == 0 {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	m := s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return m, nil
+}
+
+func (s *fakeStream) Send(m *message) error {
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+func newFakeStream(n int, err error) *fakeStream {
+	s := &fakeStream{err: err}
+	for i := range n {
+		s.msgs = append(s.msgs, &message{n: i})
+	}
+	return s
+}
+
+func nums(msgs []*message) []int {
+	out := make([]int, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.n
+	}
+	return out
+}
+
+func TestCollect(t *testing.T) {
+	broken := errors.New("broken")
+	tests := []struct {
+		name    string
+		stream  *fakeStream
+		want    []int
+		wantErr error
+	}{
+		{name: "empty", stream: newFakeStream(0, nil), want: []int{}},
+		{name: "eof", stream: newFakeStream(3, nil), want: []int{0, 1, 2}},
+		{name: "error", stream: newFakeStream(3, broken), wantErr: broken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Collect(context.Background(), tt.stream)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && !slices.Equal(nums(got), tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, nums(got))
+			}
+		})
+	}
+}
+
+func TestAllCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := newFakeStream(5, nil)
+	var got []int
+	var gotErr error
+	for m, err := range All(ctx, stream) {
+		if err != nil {
+			gotErr = err
+			break
+		}
+		if got = append(got, m.n); len(got) == 2 {
+			cancel()
+		}
+	}
+	if status.Code(gotErr) != codes.Canceled {
+		t.Fatalf("want Canceled, got %v", gotErr)
+	}
+	if !slices.Equal(got, []int{0, 1}) || len(stream.msgs) != 3 {
+		t.Fatalf("want stop receiving after cancel, got %v, %d left", got, len(stream.msgs))
+	}
+}
+
+func TestFold(t *testing.T) {
+	sum, err := Fold(context.Background(), newFakeStream(5, nil), 0, func(acc int, m *message) int { return acc + m.n })
+	if err != nil || sum != 10 {
+		t.Fatalf("want 10, got %v, %v", sum, err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	var got [][]int
+	for batch, err := range Batch(context.Background(), newFakeStream(7, nil), 3) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, nums(batch))
+	}
+	want := [][]int{{0, 1, 2}, {3, 4, 5}, {6}}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
+
+func TestChan(t *testing.T) {
+	broken := errors.New("broken")
+	out, errc := Chan(context.Background(), newFakeStream(3, broken), 1)
+	var got []*message
+	for m := range out {
+		got = append(got, m)
+	}
+	if err := <-errc; !errors.Is(err, broken) {
+		t.Fatalf("want %v, got %v", broken, err)
+	}
+	if !slices.Equal(nums(got), []int{0, 1, 2}) {
+		t.Fatalf("want [0 1 2], got %v", nums(got))
+	}
+
+	// 不消费通道时取消，后台协程退出
+	ctx, cancel := context.WithCancel(context.Background())
+	out, errc = Chan(ctx, newFakeStream(3, nil), 0)
+	cancel()
+	if err := <-errc; status.Code(err) != codes.Canceled {
+		t.Fatalf("want Canceled, got %v", err)
+	}
+	for range out {
+	}
+}
+
+func TestSendAll(t *testing.T) {
+	stream := newFakeStream(0, nil)
+	in := []*message{{n: 1}, {n: 2}}
+	if err := SendAll(context.Background(), stream, slices.Values(in)); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(nums(stream.sent), []int{1, 2}) {
+		t.Fatalf("want [1 2] sent, got %v", nums(stream.sent))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := SendAll(ctx, stream, slices.Values(in)); status.Code(err) != codes.Canceled {
+		t.Fatalf("want Canceled, got %v", err)
+	}
+}
+
+type fakeBidiStream struct {
+	grpc.ClientStream
+	*fakeStream
+}
+
+func (s fakeBidiStream) CloseSend() error {
+	return nil
+}
+
+// 服务端结束流时发送协程仍阻塞在 in 上，Exchange 不等待它
+func TestExchangeBlockedInput(t *testing.T) {
+	stream := fakeBidiStream{fakeStream: newFakeStream(2, nil)}
+	block := make(chan struct{})
+	defer close(block)
+	in := func(yield func(*message) bool) {
+		if yield(&message{n: 1}) {
+			<-block
+		}
+	}
+
+	done := make(chan []int)
+	go func() {
+		var got []int
+		for m, err := range Exchange(context.Background(), stream, in) {
+			if err != nil {
+				t.Error(err)
+			}
+			got = append(got, m.n)
+		}
+		done <- got
+	}()
+	select {
+	case got := <-done:
+		if !slices.Equal(got, []int{0, 1}) {
+			t.Fatalf("want [0 1] received, got %v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Exchange blocked on the input after the stream ended")
+	}
+}